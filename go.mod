@@ -3,9 +3,14 @@ module github.com/thatpix3l/stopcon
 go 1.18
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/alexflint/go-arg v1.4.3
 	github.com/charmbracelet/lipgloss v0.10.0
 	github.com/charmbracelet/log v0.4.0
+	github.com/muesli/termenv v0.15.2
+	github.com/nicksnyder/go-i18n/v2 v2.5.1
+	golang.org/x/sys v0.13.0
+	golang.org/x/text v0.21.0
 )
 
 require (
@@ -16,8 +21,6 @@ require (
 	github.com/mattn/go-isatty v0.0.18 // indirect
 	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/muesli/reflow v0.3.0 // indirect
-	github.com/muesli/termenv v0.15.2 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	golang.org/x/exp v0.0.0-20231006140011-7918f672742d // indirect
-	golang.org/x/sys v0.13.0 // indirect
 )
@@ -0,0 +1,219 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Whether file at p is an archive by its extension: ZIP, TAR, or gzip-compressed TAR.
+func IsArchive(p string) bool {
+
+	lower := strings.ToLower(p)
+
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Archived card or directory, whose files are extracted only when first read.
+type Archive struct {
+	path      string
+	members   map[string]string // Path inside archive of each file, by base name.
+	entries   []fs.DirEntry
+	tmp       string            // Directory extracted files are written to; created on first extraction.
+	extracted map[string]string // Extracted path of each file, by base name.
+	mutex     sync.Mutex
+}
+
+// List files of archive at p; directories are flattened, as a card's DCIM folders would be by copying it.
+func Open(p string) (*Archive, error) {
+
+	a := &Archive{path: p, members: map[string]string{}, extracted: map[string]string{}}
+
+	add := func(name string, info fs.FileInfo) {
+
+		if !info.Mode().IsRegular() {
+			return
+		}
+
+		base := path.Base(name)
+		if _, ok := a.members[base]; ok {
+			return
+		}
+
+		a.members[base] = name
+		a.entries = append(a.entries, fs.FileInfoToDirEntry(info))
+	}
+
+	if strings.HasSuffix(strings.ToLower(p), ".zip") {
+
+		z, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, err
+		}
+		defer z.Close()
+
+		for _, f := range z.File {
+			add(f.Name, f.FileInfo())
+		}
+
+		return a, nil
+	}
+
+	err := a.walkTar(func(h *tar.Header, r io.Reader) (bool, error) {
+		add(h.Name, h.FileInfo())
+		return false, nil
+	})
+
+	return a, err
+}
+
+// Call fn with each header of a TAR archive until it returns true or an error.
+func (a *Archive) walkTar(fn func(h *tar.Header, r io.Reader) (bool, error)) error {
+
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+
+	lower := strings.ToLower(a.path)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	t := tar.NewReader(r)
+
+	for {
+
+		h, err := t.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if stop, err := fn(h, t); stop || err != nil {
+			return err
+		}
+
+	}
+}
+
+// Files of archive, named by base name.
+func (a *Archive) Entries() []fs.DirEntry {
+	return a.entries
+}
+
+// Path to extracted copy of file named name, extracting it first if needed.
+func (a *Archive) Extract(name string) (string, error) {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if p, ok := a.extracted[name]; ok {
+		return p, nil
+	}
+
+	member, ok := a.members[name]
+	if !ok {
+		return "", errors.New("file \"" + name + "\" not in archive")
+	}
+
+	if a.tmp == "" {
+		tmp, err := os.MkdirTemp("", "stopcon-archive-")
+		if err != nil {
+			return "", err
+		}
+		a.tmp = tmp
+	}
+
+	dst := filepath.Join(a.tmp, name)
+
+	var err error
+	if strings.HasSuffix(strings.ToLower(a.path), ".zip") {
+		err = a.extractZip(member, dst)
+	} else {
+		err = a.walkTar(func(h *tar.Header, r io.Reader) (bool, error) {
+			if h.Name != member {
+				return false, nil
+			}
+			return true, writeFile(r, dst)
+		})
+	}
+
+	if err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+
+	a.extracted[name] = dst
+
+	return dst, nil
+}
+
+func (a *Archive) extractZip(member string, dst string) error {
+
+	z, err := zip.OpenReader(a.path)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	r, err := z.Open(member)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return writeFile(r, dst)
+}
+
+// Write contents of r to new file at dst.
+func writeFile(r io.Reader, dst string) error {
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Remove extracted files.
+func (a *Archive) Close() error {
+
+	if a == nil || a.tmp == "" {
+		return nil
+	}
+
+	return os.RemoveAll(a.tmp)
+}
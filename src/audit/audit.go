@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+// Audited recording.
+type Recording struct {
+	Id        string
+	Start     time.Time
+	Duration  time.Duration
+	Fragments int   // Fragments found.
+	Missing   []int // Indices of fragments missing before the highest one found.
+	Merged    bool
+	Verified  bool
+}
+
+// Recordings started on the same day.
+type Day struct {
+	Date       string
+	Recordings []Recording
+}
+
+// Disk space taken by a directory.
+type Usage struct {
+	Name  string
+	Bytes int64
+}
+
+// Files with identical contents.
+type Duplicate struct {
+	Hash  string
+	Paths []string
+}
+
+// Everything shown in an audit report.
+type Report struct {
+	Generated  time.Time
+	Root       string
+	Days       []Day
+	Missing    []Recording // Recordings with missing fragments.
+	Unverified []Recording // Recordings merged without passing verification.
+	Usage      []Usage
+	Duplicates []Duplicate
+}
+
+// Human-readable size.
+func humanBytes(n int64) string {
+
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	size := float64(n)
+
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
+
+// Width of a usage bar, as a percentage of the largest usage.
+func (r Report) BarWidth(u Usage) int {
+
+	max := int64(0)
+	for _, other := range r.Usage {
+		if other.Bytes > max {
+			max = other.Bytes
+		}
+	}
+
+	if max == 0 {
+		return 0
+	}
+
+	return int(u.Bytes * 100 / max)
+}
+
+var page = template.Must(template.New("audit").Funcs(template.FuncMap{
+	"bytes": humanBytes,
+	"clock": func(t time.Time) string { return t.Format("15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>stopcon audit of {{.Root}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5em; }
+th, td { text-align: left; padding: 0.25em 0.5em; border-bottom: 1px solid #ddd; }
+.bar { background: #52aeff; height: 1em; }
+.bad { color: #a32a00; }
+</style>
+</head>
+<body>
+<h1>stopcon audit</h1>
+<p>{{.Root}}, generated {{.Generated.Format "2006-01-02 15:04"}}</p>
+
+<h2>Timeline</h2>
+{{range .Days}}
+<h3>{{.Date}}</h3>
+<table>
+<tr><th>Start</th><th>ID</th><th>Duration</th><th>Fragments</th><th>Merged</th></tr>
+{{range .Recordings}}
+<tr>
+<td>{{clock .Start}}</td><td>{{.Id}}</td><td>{{.Duration}}</td>
+<td{{if .Missing}} class="bad"{{end}}>{{.Fragments}}{{if .Missing}} (missing {{.Missing}}){{end}}</td>
+<td>{{if .Verified}}verified{{else if .Merged}}<span class="bad">unverified</span>{{else}}no{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>No recordings found.</p>
+{{end}}
+
+<h2>Missing chapters</h2>
+{{if .Missing}}
+<ul>{{range .Missing}}<li>{{.Id}}: missing parts {{.Missing}}</li>{{end}}</ul>
+{{else}}<p>None.</p>{{end}}
+
+<h2>Unverified merges</h2>
+{{if .Unverified}}
+<ul>{{range .Unverified}}<li>{{.Id}}</li>{{end}}</ul>
+{{else}}<p>None.</p>{{end}}
+
+<h2>Disk usage</h2>
+<table>
+{{range .Usage}}
+<tr><td>{{.Name}}</td><td>{{bytes .Bytes}}</td><td style="width: 50%"><div class="bar" style="width: {{$.BarWidth .}}%"></div></td></tr>
+{{end}}
+</table>
+
+<h2>Duplicate candidates</h2>
+{{if .Duplicates}}
+<ul>{{range .Duplicates}}<li><code>{{.Hash}}</code><ul>{{range .Paths}}<li>{{.}}</li>{{end}}</ul></li>{{end}}</ul>
+{{else}}<p>None.</p>{{end}}
+</body>
+</html>
+`))
+
+// Render report as a standalone HTML page.
+func (r Report) Write(w io.Writer) error {
+	return page.Execute(w, r)
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Persistent ffprobe output of files, keyed by absolute path, so files unchanged since the last run are not probed again.
+type Cache struct {
+	path    string
+	mutex   sync.Mutex
+	Entries map[string]*Entry `json:"entries"`
+}
+
+// Probe output of a single file.
+type Entry struct {
+	Size    int64           `json:"size"`
+	ModTime time.Time       `json:"mod_time"`
+	Probe   json.RawMessage `json:"probe"` // Output of ffprobe as it was.
+}
+
+// Load cache stored at path; a missing file results in an empty cache.
+func Open(path string) (*Cache, error) {
+
+	c := Cache{path: path, Entries: map[string]*Entry{}}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &c, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, err
+	}
+
+	// File may contain an explicit null
+	if c.Entries == nil {
+		c.Entries = map[string]*Entry{}
+	}
+
+	return &c, nil
+}
+
+// Cached probe output of file at path, if recorded and the file has not changed since.
+func (c *Cache) Lookup(path string, info fs.FileInfo) ([]byte, bool) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.Entries[path]
+	if !ok || e.Size != info.Size() || !e.ModTime.Equal(info.ModTime()) {
+		return nil, false
+	}
+
+	return e.Probe, true
+}
+
+// Record probe output of file at path; output that is not JSON is not cached.
+func (c *Cache) Store(path string, info fs.FileInfo, probe []byte) {
+
+	if !json.Valid(probe) {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.Entries[path] = &Entry{Size: info.Size(), ModTime: info.ModTime(), Probe: probe}
+}
+
+// Carry entry of file at path old over to path new, as the file was renamed.
+// Relative paths are made absolute.
+func (c *Cache) Move(old string, new string) {
+
+	old, errOld := filepath.Abs(old)
+	new, errNew := filepath.Abs(new)
+	if errOld != nil || errNew != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, ok := c.Entries[old]; ok {
+		c.Entries[new] = e
+		delete(c.Entries, old)
+	}
+}
+
+// Drop entries of files that no longer exist.
+func (c *Cache) Prune() {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for path := range c.Entries {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			delete(c.Entries, path)
+		}
+	}
+}
+
+// Write cache back to where it was loaded from.
+func (c *Cache) Save() error {
+
+	c.mutex.Lock()
+	buf, err := json.Marshal(c)
+	c.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated cache
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".cache-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
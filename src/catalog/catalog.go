@@ -0,0 +1,332 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Outcome of merging a recording's fragments.
+type Merge struct {
+	Output    string    `json:"output"`            // Path of merged video.
+	Fragments []string  `json:"fragments"`         // Paths of fragments merged.
+	At        time.Time `json:"at"`                // When merge finished.
+	Verified  bool      `json:"verified"`          // Whether merged video was probed and matched its fragments.
+	Batches   []string  `json:"batches,omitempty"` // Import batches its fragments came in with.
+}
+
+// Stage a recording failed at, so it can be looked at and retried.
+type Failure struct {
+	Stage  string    `json:"stage"`         // E.g. "merge", "verify" or a pipeline step.
+	Reason string    `json:"reason"`        // Error the stage failed with.
+	Fix    string    `json:"fix,omitempty"` // Suggested way to resolve it.
+	Dir    string    `json:"dir"`           // Working directory of the failed run.
+	Retry  []string  `json:"retry"`         // Arguments to run stopcon with again, narrowed to the recording where possible.
+	At     time.Time `json:"at"`            // When it failed.
+}
+
+// User-supplied details about a single recording.
+type Recording struct {
+	Rating  int               `json:"rating,omitempty"`  // Rating from 1 to 5, 0 if unrated.
+	Note    string            `json:"note,omitempty"`    // Free-form note.
+	Starred bool              `json:"starred,omitempty"` // Flagged as a favorite.
+	Uploads map[string]string `json:"uploads,omitempty"` // Remote video IDs keyed by upload service, e.g. "youtube".
+	Merge   *Merge            `json:"merge,omitempty"`   // Latest merge, nil if never merged.
+	Failure *Failure          `json:"failure,omitempty"` // Latest failure, nil once resolved; such recordings need attention.
+}
+
+// Whether recording holds no details worth keeping.
+func (r Recording) IsEmpty() bool {
+	return r.Rating == 0 && r.Note == "" && !r.Starred && len(r.Uploads) == 0 && r.Merge == nil && r.Failure == nil
+}
+
+// Camera file imported into the library.
+type Import struct {
+	Size  int64     `json:"size"`            // Size in bytes.
+	At    time.Time `json:"at"`              // When import finished.
+	Batch string    `json:"batch,omitempty"` // Import run it came in with, e.g. "2024-06-14-153012"; empty for imports before batches were recorded.
+}
+
+// Provenance tag embedded into a merged video, tracing copies of it back to where its footage came from.
+type Provenance struct {
+	Id      string    `json:"id"`                // Recording merged.
+	Owner   string    `json:"owner,omitempty"`   // Owner named at the time.
+	Batches []string  `json:"batches,omitempty"` // Import batches its fragments came in with.
+	Output  string    `json:"output"`            // Path of merged video.
+	At      time.Time `json:"at"`                // When merge finished.
+}
+
+// Key of recording with given ID created at created: its ID and time of creation, so recordings reusing an ID, e.g. after the camera's counter wrapped past 9999, are kept apart; its ID alone without time.
+func Key(id string, created *time.Time) string {
+
+	if created == nil {
+		return id
+	}
+
+	return id + " " + created.Format(time.RFC3339)
+}
+
+// ID of recording stored under key.
+func KeyId(key string) string {
+	return strings.SplitN(key, " ", 2)[0]
+}
+
+// Recording stored under key as --id picks it alone: its ID, followed by "@" and its time of creation if the key holds one, e.g. "0042@2024-05-01T10:00:00Z".
+func Pick(key string) string {
+	return strings.Replace(key, " ", "@", 1)
+}
+
+// Whether pick, an ID or ID@DATE, picks recording stored under key; DATE may be any start of the time of creation [Pick] names, e.g. "0042@2024-05-01", to pick one of several recordings sharing the ID.
+func Picks(pick string, key string) bool {
+
+	id, date, dated := strings.Cut(pick, "@")
+
+	parts := strings.SplitN(key, " ", 2)
+	if parts[0] != id {
+		return false
+	}
+
+	if !dated {
+		return true
+	}
+
+	return len(parts) == 2 && strings.HasPrefix(parts[1], date)
+}
+
+// Persistent store of recording details, keyed by [Key]; catalogs written before keys held the time of creation are keyed by ID, see [Catalog.Migrate].
+type Catalog struct {
+	path       string
+	Recordings map[string]*Recording `json:"recordings"`
+	Imports    map[string][]Import   `json:"imports,omitempty"`    // Files imported so far, keyed by name on the camera; names recur once IDs roll over.
+	Provenance map[string]Provenance `json:"provenance,omitempty"` // Provenance tags embedded so far, keyed by UUID; kept when recordings are merged again, as earlier copies may still be around.
+}
+
+// Load catalog stored at path; a missing file results in an empty catalog.
+func Open(path string) (*Catalog, error) {
+
+	c := Catalog{path: path, Recordings: map[string]*Recording{}}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &c, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, err
+	}
+
+	// File may contain an explicit null
+	if c.Recordings == nil {
+		c.Recordings = map[string]*Recording{}
+	}
+
+	return &c, nil
+}
+
+// Details for recording stored under key, creating an empty entry if needed.
+func (c *Catalog) Recording(key string) *Recording {
+
+	if _, ok := c.Recordings[key]; !ok {
+		c.Recordings[key] = &Recording{}
+	}
+
+	return c.Recordings[key]
+}
+
+// Details for recording stored under key, or nil if never cataloged.
+func (c *Catalog) Lookup(key string) *Recording {
+	return c.Recordings[key]
+}
+
+// Move details kept under the bare ID of key, as by catalogs written before keys held the time of creation, to key, if claims tells they are about its recording; tells whether they were moved.
+// Details already kept under key are not overwritten.
+func (c *Catalog) Migrate(key string, claims func(r *Recording) bool) bool {
+
+	id := KeyId(key)
+
+	r, ok := c.Recordings[id]
+	if id == key || !ok || !claims(r) {
+		return false
+	}
+
+	if existing, ok := c.Recordings[key]; ok && !existing.IsEmpty() {
+		return false
+	}
+
+	c.Recordings[key] = r
+	delete(c.Recordings, id)
+
+	return true
+}
+
+// Keys of recordings needing attention, oldest failure first.
+func (c *Catalog) Failed() []string {
+
+	keys := []string{}
+	for key, r := range c.Recordings {
+		if r.Failure != nil {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return c.Recordings[keys[i]].Failure.At.Before(c.Recordings[keys[j]].Failure.At)
+	})
+
+	return keys
+}
+
+// Forget failure of recording stored under key, dropping its entry if nothing else is left in it.
+func (c *Catalog) Resolve(key string) {
+
+	r, ok := c.Recordings[key]
+	if !ok {
+		return
+	}
+
+	r.Failure = nil
+
+	if r.IsEmpty() {
+		delete(c.Recordings, key)
+	}
+}
+
+// Whether camera file of given name and size was imported before, however it was renamed or merged since.
+func (c *Catalog) Imported(name string, size int64) bool {
+
+	for _, i := range c.Imports[name] {
+		if i.Size == size {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Note import of camera file of given name and size with batch, if not noted already.
+func (c *Catalog) RecordImport(name string, size int64, batch string) {
+
+	if c.Imported(name, size) {
+		return
+	}
+
+	if c.Imports == nil {
+		c.Imports = map[string][]Import{}
+	}
+
+	c.Imports[name] = append(c.Imports[name], Import{Size: size, At: time.Now(), Batch: batch})
+}
+
+// Batch camera file of given name and size was imported with; empty if unknown.
+func (c *Catalog) Batch(name string, size int64) string {
+
+	for _, i := range c.Imports[name] {
+		if i.Size == size {
+			return i.Batch
+		}
+	}
+
+	return ""
+}
+
+// Forget import of camera file of given name and size, so it is imported again.
+func (c *Catalog) ForgetImport(name string, size int64) {
+
+	kept := []Import{}
+	for _, i := range c.Imports[name] {
+		if i.Size != size {
+			kept = append(kept, i)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(c.Imports, name)
+		return
+	}
+
+	c.Imports[name] = kept
+}
+
+// Names of import batches files were recorded with, sorted.
+func (c *Catalog) Batches() []string {
+
+	seen := map[string]bool{}
+	batches := []string{}
+	for _, imports := range c.Imports {
+		for _, i := range imports {
+			if i.Batch != "" && !seen[i.Batch] {
+				seen[i.Batch] = true
+				batches = append(batches, i.Batch)
+			}
+		}
+	}
+
+	sort.Strings(batches)
+
+	return batches
+}
+
+// Names of camera files imported with batch, sorted.
+func (c *Catalog) BatchFiles(batch string) []string {
+
+	names := []string{}
+	for name, imports := range c.Imports {
+		for _, i := range imports {
+			if i.Batch == batch {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Note provenance tag embedded with given UUID.
+func (c *Catalog) RecordProvenance(uuid string, p Provenance) {
+
+	if c.Provenance == nil {
+		c.Provenance = map[string]Provenance{}
+	}
+
+	c.Provenance[uuid] = p
+}
+
+// Write catalog back to where it was loaded from.
+func (c *Catalog) Save() error {
+
+	buf, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated catalog
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".catalog-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,79 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+)
+
+// --id picks recordings by ID alone, or by ID and any start of their time of creation.
+func TestPicks(t *testing.T) {
+
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	key := Key("0042", &created)
+
+	tests := []struct {
+		pick string
+		key  string
+		want bool
+	}{
+		{pick: "0042", key: key, want: true},
+		{pick: "0042@2024-05-01", key: key, want: true},
+		{pick: "0042@2024", key: key, want: true},
+		{pick: Pick(key), key: key, want: true},
+		{pick: "0042@2025", key: key},
+		{pick: "0043", key: key},
+		{pick: "004", key: key},
+		{pick: "0042", key: "0042", want: true},
+		{pick: "0042@2024", key: "0042"},
+	}
+
+	for _, test := range tests {
+		if got := Picks(test.pick, test.key); got != test.want {
+			t.Errorf("%q picks %q: %t, want %t", test.pick, test.key, got, test.want)
+		}
+	}
+
+}
+
+// Entries kept under bare IDs move to the keys of recordings claiming them, without overwriting theirs.
+func TestMigrate(t *testing.T) {
+
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	key := Key("0042", &created)
+
+	tests := []struct {
+		name     string
+		existing *Recording // Entry already kept under key, if any.
+		claimed  bool
+		want     bool
+	}{
+		{name: "claimed", claimed: true, want: true},
+		{name: "not claimed"},
+		{name: "empty entry", existing: &Recording{}, claimed: true, want: true},
+		{name: "kept entry", existing: &Recording{Rating: 2}, claimed: true},
+	}
+
+	for _, test := range tests {
+
+		old := &Recording{Rating: 4}
+		c := Catalog{Recordings: map[string]*Recording{"0042": old}}
+		if test.existing != nil {
+			c.Recordings[key] = test.existing
+		}
+
+		if got := c.Migrate(key, func(*Recording) bool { return test.claimed }); got != test.want {
+			t.Errorf("%s: migrated %t, want %t", test.name, got, test.want)
+		}
+
+		if moved := c.Recordings[key] == old && c.Recordings["0042"] == nil; moved != test.want {
+			t.Errorf("%s: entries %v", test.name, c.Recordings)
+		}
+	}
+
+	// Recordings without time of creation are kept under their ID already
+	c := Catalog{Recordings: map[string]*Recording{"0042": {Rating: 4}}}
+	if c.Migrate("0042", func(*Recording) bool { return true }) {
+		t.Error("migrated entry onto itself")
+	}
+
+}
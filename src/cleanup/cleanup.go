@@ -0,0 +1,86 @@
+package cleanup
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Reasons a recording looks accidental.
+const (
+	Short  = "short"  // Shorter than a record press would be on purpose.
+	Dark   = "dark"   // Sampled frame nearly black, e.g. with the lens cap on or in a pocket.
+	Silent = "silent" // Audio nowhere near audible, e.g. with the microphone covered.
+)
+
+// Limits below which a recording is flagged.
+type Thresholds struct {
+	Duration  time.Duration
+	Luma      float64 // Mean brightness of sampled frame, from 0 to 1.
+	MaxVolume float64 // Peak audio level in dB.
+}
+
+// What is known about a recording; unknown signs are left out of the judgement.
+type Signs struct {
+	Duration  time.Duration
+	Luma      *float64 // Mean brightness of sampled frame, from 0 to 1; nil if not sampled.
+	MaxVolume *float64 // Peak audio level in dB; nil without audio.
+}
+
+// Reasons signs look accidental under thresholds, empty if none.
+func (s Signs) Reasons(t Thresholds) []string {
+
+	reasons := []string{}
+
+	if s.Duration > 0 && s.Duration < t.Duration {
+		reasons = append(reasons, Short)
+	}
+
+	if s.Luma != nil && *s.Luma < t.Luma {
+		reasons = append(reasons, Dark)
+	}
+
+	if s.MaxVolume != nil && *s.MaxVolume < t.MaxVolume {
+		reasons = append(reasons, Silent)
+	}
+
+	return reasons
+}
+
+// Mean brightness, from 0 to 1, of an 8-bit grayscale frame.
+func MeanLuma(gray []byte) float64 {
+
+	if len(gray) == 0 {
+		return 0
+	}
+
+	sum := 0
+	for _, b := range gray {
+		sum += int(b)
+	}
+
+	return float64(sum) / float64(len(gray)) / 255
+}
+
+var maxVolume = regexp.MustCompile(`max_volume: (-?[0-9.]+|-inf) dB`)
+
+// Peak level in dB reported by ffmpeg's volumedetect filter in its log output; false if not reported.
+func ParseMaxVolume(log string) (float64, bool) {
+
+	matches := maxVolume.FindStringSubmatch(log)
+	if matches == nil {
+		return 0, false
+	}
+
+	// Digital silence has no level at all
+	if matches[1] == "-inf" {
+		return -200, true
+	}
+
+	v, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return v, true
+}
@@ -2,24 +2,326 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 	"path"
 	"reflect"
 	"runtime"
 	"strings"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/merger"
 )
 
 type cmdRename struct {
-	Commit bool `help:"really rename files, not just do a dry run"`
+	Files        []string `arg:"positional" placeholder:"FILE" help:"rename only these files, instead of everything in input directory"`
+	Commit       bool     `help:"really rename files, not just do a dry run"`
+	To           string   `arg:"--to" default:"renamed" help:"names to rename to: renamed (descriptive names) or raw (stock GoPro names such as GX010123.MP4, e.g. for GoPro Quik)"`
+	SetMtime     bool     `arg:"--set-mtime" help:"set modification time of renamed files to when they were recorded, for apps sorting by it; each chapter gets the recording's creation time plus the length of chapters before it"`
+	NameTemplate string   `arg:"--name-template" help:"layout of new names with tokens {date}, {id}, {index}, {ext}, {codec} and {camera}, e.g. \"{date} {id} P{index}.{ext}\", or a Go template, e.g. {{.Date | date \"20060102\"}}_{{.Id}}{{if .Starred}} starred{{end}}.{{.Extension}}; helpers: upper, lower, title, trim, replace, slugify, truncate, default, pad, date, dateAdd, addDays"`
 }
 
 type cmdMerge struct {
-	OutputDirPath string `arg:"--output-dir,required" help:"directory to store merged videos"`
+	Files            []string      `arg:"positional" placeholder:"FILE" help:"merge only these fragments, instead of everything in input directory"`
+	OutputDirPath    string        `arg:"--output-dir" help:"directory to store merged videos (default: masters directory of library)"`
+	EmbedTags        bool          `arg:"--embed-tags" help:"write cataloged ratings and notes into merged video metadata"`
+	Provenance       bool          `arg:"--provenance" help:"tag merged videos with a new UUID, --owner and the import batches of their fragments, recorded in the catalog so lookup can trace copies found elsewhere back to them; the native backend cannot write it"`
+	Owner            string        `arg:"--owner,env:STOPCON_OWNER" help:"owner named in provenance tags, e.g. an archive or person"`
+	Order            string        `arg:"--order" default:"oldest-first" help:"merge order: smallest-first, newest-first or oldest-first"`
+	NameTemplate     string        `arg:"--name-template" help:"layout of merged names with tokens {date}, {id}, {ext}, {codec} and {camera}, e.g. \"{date} {camera} {id}.{ext}\", or a Go template, e.g. {{.Date.Format \"2006-01-02\"}} {{.Id}}.{{.Extension}}"`
+	OutputFilePath   string        `arg:"--output" help:"write the merged recording to this file instead of output directory; - streams it to stdout as MPEG-TS"`
+	Ids              []string      `arg:"--id,separate" help:"only merge recordings with this ID, or ID@DATE, e.g. 0042@2024-05-01, to pick one of several sharing it; repeatable"`
+	Batch            string        `arg:"--batch" help:"only merge recordings with fragments from this import batch, or from every batch whose name starts with it, e.g. 2024-06-14 for all cards imported that day"`
+	ExternalAudio    string        `arg:"--external-audio" help:"mux WAV recordings found in input directory, and files attached by policy, that overlap a recording, aligned by creation time: add (as second audio track) or replace (camera audio)"`
+	Container        string        `arg:"--container" help:"container of merged videos: mkv, mp4, mov, fmp4 (fragmented, for web streaming and resumable writes to network storage) or mpegts; mp4 and mov have their index up front for streaming (default: picked by codec and --container-preference, or mpegts when streaming)"`
+	FragmentDuration time.Duration `arg:"--fragment-duration" default:"2s" help:"target length of fragments in fmp4 output"`
+	Sidecar          string        `arg:"--sidecar" help:"write provenance next to each merged video: json (NAME.json) or md (NAME.md README), listing fragments, hashes, probe results, version and arguments"`
+	MissingChapters  string        `arg:"--missing-chapters" default:"warn" help:"when parts of a recording are missing: warn (and merge what is there) or abort"`
+	NoData           bool          `arg:"--no-data" help:"leave out data streams such as GPMF telemetry and timecode; otherwise every stream is kept, data streams only in mp4 and fmp4 output, which alone can hold them"`
+	Mismatched       string        `arg:"--mismatched" default:"refuse" help:"when fragments of a recording differ in codec, size or frame rate, as after changing settings mid-session: refuse (quarantine the recording) or transcode (re-encode every fragment to the first one's settings with ffmpeg)"`
+	AudioPreset      string        `arg:"--audio-preset" help:"normalize loudness, re-encoding audio while video is still copied: voice (wind filtered, mono, even), action (wind filtered, stereo) or music (full range, stereo); needs the ffmpeg backend"`
+	Single           string        `arg:"--single" default:"remux" help:"what to do with recordings of a single fragment: remux (like any other), link (hard link, falling back to copy) or copy; linked and copied videos keep their source file as is, without embedded metadata, and are remuxed anyway when another container, external audio, an audio preset, --provenance or --no-data is asked for"`
+	Merger           string        `arg:"--merger" default:"auto" help:"merging backend: native (pure Go, MP4 chapters with identical settings only), ffmpeg, auto (native, falling back to ffmpeg), or libav if built with the libav tag"`
+}
+
+type cmdProbe struct {
+	Files          []string `arg:"positional,required" placeholder:"FILE" help:"files to show parsed names and metadata of"`
+	ExportFilePath string   `arg:"--export" help:"also write probe results to this file, for rename and merge --probe-data on another machine"`
+}
+
+type cmdInspect struct {
+	Compare []string `arg:"--compare,required" placeholder:"FILE" help:"two files whose probe data to show side by side, e.g. chapters that will not merge by stream copying; fields keeping them from it are marked with !"`
+	All     bool     `arg:"--all" help:"also list fields both files agree on"`
+}
+
+type cmdLookup struct {
+	Files []string `arg:"positional,required" placeholder:"FILE" help:"merged videos, or copies of them, to trace back by their provenance tag"`
+}
+
+type cmdTag struct {
+	Id            string  `arg:"--id" help:"ID, or ID@DATE to pick one of several sharing it, of recording to tag"`
+	Rating        *int    `arg:"--rating" help:"rating from 1 to 5, or 0 to clear"`
+	Note          *string `arg:"--note" help:"free-form note, or empty to clear"`
+	Star          *bool   `arg:"--star" help:"flag recording as a favorite; --star=false to unflag"`
+	Provenance    bool    `arg:"--provenance" help:"instead of tagging one recording, tag merged videos without provenance tag as merge --provenance would have, e.g. those merged before it existed"`
+	Owner         string  `arg:"--owner,env:STOPCON_OWNER" help:"owner named in provenance tags, e.g. an archive or person"`
+	MergedDirPath string  `arg:"--merged-dir" help:"directory containing merged videos to tag with --provenance (default: masters directory of library)"`
+	Commit        bool    `help:"really rewrite merged videos with --provenance, not just list what would be tagged"`
+}
+
+type cmdInit struct {
+	LibraryDirPath string `arg:"positional,required" placeholder:"DIR" help:"directory to create library in"`
+}
+
+type cmdGc struct {
+	Retention time.Duration `arg:"--retention" default:"2160h" help:"age after which archived originals count as reclaimable"`
+}
+
+type cmdTrim struct {
+	MergedDirPath  string        `arg:"--merged-dir" help:"directory containing merged videos (default: masters directory of library)"`
+	Id             string        `arg:"--id,required" help:"ID, or ID@DATE to pick one of several sharing it, of recording to trim"`
+	Start          time.Duration `arg:"--start" help:"where to cut from, e.g. 1m30s"`
+	End            time.Duration `arg:"--end" help:"where to cut to, e.g. 4m; 0 for the end of the video"`
+	OutputFilePath string        `arg:"--output" help:"file to write the trimmed video to (default: NAME.trim.EXT beside the merged video)"`
+}
+
+type cmdClean struct {
+	MergedDirPath  string        `arg:"--merged-dir" help:"directory containing merged videos, swept for unfinished merges (default: masters directory of library)"`
+	PreviewDirPath string        `arg:"--preview-dir" help:"directory containing waveforms, sprite sheets, VTT cues and posters (default: proxies directory of library)"`
+	Temp           time.Duration `arg:"--temp" default:"24h" help:"age after which temporary files left by interrupted runs expire: concat lists, unfinished merges and, with --staging, staging directories"`
+	Staging        bool          `arg:"--staging" help:"also remove staging copies of read-only input directories past --temp, which may hold the only renamed copies"`
+	Reports        time.Duration `arg:"--reports" help:"age after which import reports expire; 0 keeps them, as they prove what was verified before a card was formatted"`
+	Previews       time.Duration `arg:"--previews" help:"age after which previews expire, to be generated again when needed; 0 keeps them"`
+	Quarantine     time.Duration `arg:"--quarantine" help:"age after which quarantined fragments expire; 0 keeps them"`
+	Commit         bool          `help:"really remove expired files, not just list what would be removed"`
+}
+
+type cmdPrune struct {
+	Keep           time.Duration `arg:"--keep" default:"2160h" help:"how long to keep raw fragments after a verified merge"`
+	Action         string        `arg:"--action" default:"archive" help:"what to do with expired fragments: archive or delete"`
+	ArchiveDirPath string        `arg:"--archive-dir" help:"where to move archived fragments (default: archive directory of library)"`
+	Commit         bool          `help:"really prune fragments, not just report what would be pruned"`
+}
+
+type cmdAudit struct {
+	HtmlFilePath string `arg:"--html,required" help:"where to write the HTML report"`
+}
+
+type cmdChecksum struct {
+	OutputFilePath string `arg:"--output" help:"where to write checksums in sha256sum format (default: SHA256SUMS in input directory)"`
+	Workers        int    `arg:"--workers" help:"number of files hashed at once (default: number of CPUs)"`
+}
+
+type cmdImport struct {
+	FromDirPath string   `arg:"--from" help:"card or directory to import from"`
+	Urls        []string `arg:"--url,separate" help:"URL of file to download, e.g. from a camera's WiFi server; repeatable"`
+	Retries     int      `arg:"--retries" default:"5" help:"attempts per file before giving up; downloads resume where the last attempt stopped"`
+	Connections int      `arg:"--connections" default:"4" help:"parallel ranged requests per downloaded file; 1 to download sequentially"`
+	ChunkSize   string   `arg:"--chunk-size" default:"8M" help:"size of each ranged request, with optional K, M or G suffix; smaller files download sequentially"`
+	LimitRate   string   `arg:"--limit-rate" help:"maximum download speed in bytes per second, with optional K, M or G suffix"`
+	ReportPath  string   `arg:"--report" help:"where to write the verification report of a card import (default: .stopcon-import-DATE.txt in input directory)"`
+	MTP         bool     `arg:"--mtp" help:"source is a camera mounted over MTP or PTP (e.g. by gvfs, jmtpfs or Windows); cache its listing and hashes in input directory and resume partial copies, so interrupted imports pick up quickly"`
+	Relist      bool     `arg:"--relist" help:"with --mtp, enumerate the camera again instead of reusing the cached listing, e.g. after recording more"`
+	Reimport    bool     `arg:"--reimport" help:"import files the catalog lists as imported before, e.g. after deleting them from the library"`
+	FormatCard  bool     `arg:"--format-card" help:"after every file is verified, delete the media under DCIM from the card, asking twice first"`
+}
+
+type cmdPackage struct {
+	MergedDirPath string        `arg:"--merged-dir" help:"directory containing merged videos (default: masters directory of library)"`
+	OutputDirPath string        `arg:"--output-dir" help:"directory to write one package directory per recording into (default: proxies directory of library)"`
+	Format        string        `arg:"--format" default:"hls" help:"streaming format: hls or dash"`
+	Segment       time.Duration `arg:"--segment" default:"6s" help:"target segment length"`
+	Ladder        string        `arg:"--ladder" help:"encode one rendition per height instead of copying the original, e.g. 1080p,720p,480p"`
+	Ids           []string      `arg:"--id,separate" help:"only package recordings with this ID, or ID@DATE, e.g. 0042@2024-05-01, to pick one of several sharing it; repeatable"`
+}
+
+type cmdVerify struct {
+	MergedDirPath string   `arg:"--merged-dir" help:"directory containing merged videos (default: masters directory of library)"`
+	Ids           []string `arg:"--id,separate" help:"only verify recordings with this ID, or ID@DATE, e.g. 0042@2024-05-01, to pick one of several sharing it; repeatable"`
+}
+
+type cmdPreview struct {
+	MergedDirPath string        `arg:"--merged-dir" help:"directory containing merged videos (default: masters directory of library)"`
+	OutputDirPath string        `arg:"--output-dir" help:"directory to write waveforms, sprite sheets and VTT cues into (default: proxies directory of library)"`
+	Interval      time.Duration `arg:"--interval" default:"10s" help:"time between thumbnails"`
+	ThumbWidth    int           `arg:"--thumb-width" default:"160" help:"width of each thumbnail in pixels"`
+	Columns       int           `arg:"--columns" default:"10" help:"thumbnails per sprite sheet row"`
+	Rows          int           `arg:"--rows" default:"10" help:"thumbnail rows per sprite sheet"`
+	WaveformRate  int           `arg:"--waveform-rate" default:"10" help:"waveform points per second of audio"`
+	Poster        bool          `arg:"--poster" help:"also write a poster frame NAME.jpg, the sharpest well-exposed of evenly spaced frames"`
+	ToneMap       string        `arg:"--tonemap" default:"auto" help:"tone-map HDR footage to SDR for thumbnails and posters, so they do not look washed out: auto (recordings probed as HDR), on or off"`
+	Ids           []string      `arg:"--id,separate" help:"only generate previews of recordings with this ID, or ID@DATE, e.g. 0042@2024-05-01, to pick one of several sharing it; repeatable"`
+}
+
+type cmdDiff struct {
+	OldFilePath string `arg:"positional" placeholder:"OLD" help:"older manifest (default: stored manifest)"`
+	NewFilePath string `arg:"positional" placeholder:"NEW" help:"newer manifest (default: files currently on disk)"`
+	Verify      bool   `arg:"--verify" help:"when comparing against files on disk, rehash them to catch bit rot"`
+}
+
+type cmdScrub struct {
+	Fraction float64 `arg:"--fraction" default:"0.1" help:"share of checksummed files to rehash this run, least recently scrubbed first"`
+	Workers  int     `arg:"--workers" help:"number of files hashed at once (default: number of CPUs)"`
+}
+
+type cmdShell struct {
+	Run       string `arg:"--run" default:"import --from {}" help:"stopcon arguments run on the selected folder, which {} stands for"`
+	Uninstall bool   `arg:"--uninstall" help:"remove the context-menu entry instead"`
+}
+
+type cmdConfigCheck struct{}
+
+type cmdConfigShow struct {
+	Effective bool `arg:"--effective" help:"also show options as resolved from flags, environment and defaults"`
+}
+
+type cmdConfig struct {
+	Check *cmdConfigCheck `arg:"subcommand:check" help:"validate configuration file, e.g. for unknown keys and actions"`
+	Show  *cmdConfigShow  `arg:"subcommand:show" help:"print configuration as loaded"`
+}
+
+type cmdRun struct {
+	Ids []string `arg:"--id,separate" help:"only process recordings with this ID, or ID@DATE, e.g. 0042@2024-05-01, to pick one of several sharing it; repeatable"`
+}
+
+type cmdCleanup struct {
+	MaxDuration       time.Duration `arg:"--max-duration" default:"3s" help:"flag recordings shorter than this"`
+	DarkLevel         float64       `arg:"--dark-level" default:"0.06" help:"flag recordings whose middle frame is darker than this mean brightness, from 0 to 1, e.g. with the lens cap on"`
+	SilentLevel       float64       `arg:"--silent-level" default:"-60" help:"flag recordings whose audio peaks below this level in dB, e.g. with the microphone covered"`
+	Quarantine        []string      `arg:"--quarantine,separate" help:"move fragments of the flagged recording with this ID or ID@DATE, or \"all\" flagged ones, to the quarantine directory; repeatable"`
+	QuarantineDirPath string        `arg:"--quarantine-dir" help:"directory quarantined fragments are moved to, to delete once reviewed (default: .stopcon-quarantine in input directory)"`
+}
+
+type cmdTriage struct {
+	Retry []string `arg:"--retry,separate" help:"run the failed command again for the recording with this ID or ID@DATE, or \"all\"; repeatable"`
+	Clear []string `arg:"--clear,separate" help:"mark the recording with this ID or ID@DATE as resolved without retrying; repeatable"`
+}
+
+type cmdUndo struct {
+	Keep   bool `arg:"--keep" help:"keep the undone run in the journal, e.g. to look at it again"`
+	Commit bool `help:"really undo the run, not just show what would be undone"`
+}
+
+type cmdRollback struct {
+	Batch    string `arg:"--batch,required" help:"import batch whose fragments to remove, or the start of the names of several, e.g. 2024-06-14 for all cards imported that day"`
+	Commit   bool   `help:"really remove fragments, not just list what would be removed"`
+	Unmerged bool   `arg:"--unmerged" help:"also remove fragments without a verified merge in the catalog, whose footage is then lost unless kept elsewhere"`
+}
+
+type cmdStats struct {
+	ListJobs bool `arg:"--list-jobs" help:"list CPU time, wall time and bytes read and written by each merge and packaging job"`
+}
+
+type cmdSimulate struct {
+	ListingFilePath string `arg:"--listing,required" help:"text file listing one file name per line; the files themselves are not needed"`
+	NameTemplate    string `arg:"--name-template" help:"Go template for new names, as in rename"`
+	MergeTemplate   string `arg:"--merge-template" help:"Go template for merged names, as in merge"`
+}
+
+type cmdUploadYoutube struct {
+	ClientId            string `arg:"--client-id,required,env:STOPCON_YOUTUBE_CLIENT_ID" help:"OAuth client ID"`
+	ClientSecret        string `arg:"--client-secret,env:STOPCON_YOUTUBE_CLIENT_SECRET" help:"OAuth client secret"`
+	TokenFilePath       string `arg:"--token-file" help:"where to cache the OAuth token (default: stopcon/youtube-token.json in user config directory)"`
+	TitleTemplate       string `arg:"--title" default:"GoPro {{.Date.Format \"2006-01-02 15:04\"}} ({{.Id}})" help:"Go template for video titles"`
+	DescriptionTemplate string `arg:"--description" default:"{{.Note}}" help:"Go template for video descriptions"`
+	Privacy             string `arg:"--privacy" default:"private" help:"privacy status: private, unlisted or public"`
+}
+
+type cmdUploadImmich struct {
+	Url    string `arg:"--url,required,env:STOPCON_IMMICH_URL" help:"base URL of Immich server"`
+	ApiKey string `arg:"--api-key,required,env:STOPCON_IMMICH_API_KEY" help:"Immich API key"`
+}
+
+type cmdUploadPhotoprism struct {
+	Url     string `arg:"--url,required,env:STOPCON_PHOTOPRISM_URL" help:"base URL of PhotoPrism server"`
+	Token   string `arg:"--token,required,env:STOPCON_PHOTOPRISM_TOKEN" help:"PhotoPrism app password"`
+	UserUid string `arg:"--user-uid,required,env:STOPCON_PHOTOPRISM_USER_UID" help:"UID of user owning the uploads"`
+}
+
+type cmdUploadPhotos struct {
+	Album string `arg:"--album,env:STOPCON_PHOTOS_ALBUM" help:"album to add imported videos to, created if missing"`
+}
+
+type cmdUpload struct {
+	Youtube       *cmdUploadYoutube    `arg:"subcommand:youtube" help:"upload to YouTube"`
+	Immich        *cmdUploadImmich     `arg:"subcommand:immich" help:"import into an Immich server"`
+	Photoprism    *cmdUploadPhotoprism `arg:"subcommand:photoprism" help:"import into a PhotoPrism server"`
+	Photos        *cmdUploadPhotos     `arg:"subcommand:photos" help:"import into Apple Photos on macOS, keeping capture date and location"`
+	MergedDirPath string               `arg:"--merged-dir,required" help:"directory containing merged videos"`
+	Ids           []string             `arg:"--id,separate" help:"only upload recordings with this ID, or ID@DATE, e.g. 0042@2024-05-01, to pick one of several sharing it; repeatable"`
+	Batch         string               `arg:"--batch" help:"only upload recordings merged from fragments of this import batch, or of every batch whose name starts with it, e.g. 2024-06-14"`
 }
 
 type CmdRoot struct {
-	Rename       *cmdRename `arg:"subcommand:rename" help:"rename videos"`
-	Merge        *cmdMerge  `arg:"subcommand:merge" help:"merge videos"`
-	InputDirPath string     `arg:"--input-dir,required" help:"directory containing videos"`
+	Rename           *cmdRename    `arg:"subcommand:rename" help:"rename videos"`
+	Merge            *cmdMerge     `arg:"subcommand:merge" help:"merge videos"`
+	Probe            *cmdProbe     `arg:"subcommand:probe" help:"show how files are parsed and what metadata they carry"`
+	Inspect          *cmdInspect   `arg:"subcommand:inspect" help:"compare codec parameters, tags and timing of two files, to tell why they will not merge"`
+	Lookup           *cmdLookup    `arg:"subcommand:lookup" help:"trace merged videos back to their recording and import batch by their provenance tag"`
+	Tag              *cmdTag       `arg:"subcommand:tag" help:"rate or annotate a recording in the catalog"`
+	Upload           *cmdUpload    `arg:"subcommand:upload" help:"upload merged videos"`
+	Checksum         *cmdChecksum  `arg:"subcommand:checksum" help:"write SHA-256 checksums of input files"`
+	Init             *cmdInit      `arg:"subcommand:init" help:"create a library with the standard layout"`
+	Gc               *cmdGc        `arg:"subcommand:gc" help:"remove orphaned library files and report reclaimable space"`
+	Trim             *cmdTrim      `arg:"subcommand:trim" help:"cut a stretch out of a merged video frame-accurately, re-encoding only around the cut points"`
+	Clean            *cmdClean     `arg:"subcommand:clean" help:"remove temporary files, reports, previews and quarantined fragments past their retention, reporting space freed"`
+	Prune            *cmdPrune     `arg:"subcommand:prune" help:"archive or delete raw fragments of recordings merged long ago"`
+	Audit            *cmdAudit     `arg:"subcommand:audit" help:"write a read-only HTML report of the library"`
+	Import           *cmdImport    `arg:"subcommand:import" help:"copy or download videos into input directory"`
+	Package          *cmdPackage   `arg:"subcommand:package" help:"package merged videos as HLS or DASH for self-hosted streaming"`
+	Verify           *cmdVerify    `arg:"subcommand:verify" help:"probe merged videos again and check they are as long as their fragments, recording the outcome in the catalog"`
+	Preview          *cmdPreview   `arg:"subcommand:preview" help:"generate waveforms and thumbnail sprites of merged videos for scrubbing previews"`
+	Diff             *cmdDiff      `arg:"subcommand:diff" help:"show files that appeared, disappeared or changed between two manifests, or since the stored manifest"`
+	Scrub            *cmdScrub     `arg:"subcommand:scrub" help:"rehash part of the checksummed files each run and alert on bit rot"`
+	Stats            *cmdStats     `arg:"subcommand:stats" help:"summarize files and jobs recorded in the manifest"`
+	Config           *cmdConfig    `arg:"subcommand:config" help:"check or show the configuration"`
+	Run              *cmdRun       `arg:"subcommand:run" help:"carry out the pipeline steps of the configuration on each recording in turn"`
+	Cleanup          *cmdCleanup   `arg:"subcommand:cleanup" help:"flag likely accidental recordings (very short, dark or silent) for review and move them to quarantine"`
+	Triage           *cmdTriage    `arg:"subcommand:triage" help:"list recordings that failed to merge or in a pipeline step, with suggested fixes, and retry them"`
+	Undo             *cmdUndo      `arg:"subcommand:undo" help:"reverse the renames, copies and merges of the latest run, as recorded in the journal"`
+	Rollback         *cmdRollback  `arg:"subcommand:rollback" help:"remove the fragments of an import batch from input directory and forget they were imported, so the batch can be imported again; merged videos are kept"`
+	InstallShell     *cmdShell     `arg:"subcommand:install-shell-integration" help:"add a \"Process with stopcon\" entry to the folder context menu of Explorer, Finder, Nautilus or Dolphin"`
+	Simulate         *cmdSimulate  `arg:"subcommand:simulate" help:"show how listed file names would be parsed, grouped and renamed"`
+	InputDirPaths    []string      `arg:"--input-dir,separate" help:"directory containing videos; repeatable, e.g. for cards offloaded into separate folders, the first one receiving stopcon's own files (default: incoming directory of library)"`
+	InputDirPath     string        `arg:"-"` // First of InputDirPaths.
+	LibraryDirPath   string        `arg:"--library" help:"root of library created by init, from which other paths are inferred (default: found by walking up from working directory)"`
+	SmbMode          string        `arg:"--smb" default:"auto" help:"SMB-aware renaming (copy+delete with retries): auto, on or off"`
+	WslMode          string        `arg:"--wsl" default:"auto" help:"WSL interop: auto, on or off; takes Windows paths such as C:\\Videos for /mnt/c/Videos, keeps names valid on Windows drives and does not follow their links"`
+	SmbRetries       int           `arg:"--smb-retries" default:"5" help:"attempts per file when renaming over SMB"`
+	SmbTimeout       time.Duration `arg:"--smb-timeout" default:"10m" help:"time limit per attempt when renaming over SMB"`
+	ConfigFilePath   string        `arg:"--config" help:"configuration file, e.g. for per-extension policies (default: config.toml of library)"`
+	CatalogFilePath  string        `arg:"--catalog" help:"catalog file (default: .stopcon-catalog.json in input directory)"`
+	Plain            bool          `arg:"--plain,env:STOPCON_PLAIN" help:"screen-reader friendly output: no colors, no in-place updates, explicit labels"`
+	SettleTime       time.Duration `arg:"--settle-time" default:"1s" help:"skip files whose size changes within this window, as they are still being copied or synced; 0 to disable"`
+	ContainerOrder   string        `arg:"--container-preference" default:"source,mp4,mkv" help:"containers to pick from for merged videos, most preferred first, source standing for the fragments' own; the first one fitting the fragments' codec wins unless merge --container is given"`
+	LapseDir         string        `arg:"--lapse-dir" default:"lapses" help:"subdirectory of merged videos for TimeWarp and Night Lapse recordings; empty to keep them with real-time footage"`
+	OnlyStarred      bool          `arg:"--only-starred" help:"only process recordings with HiLight tags or starred in the catalog"`
+	MinDuration      time.Duration `arg:"--min-duration" help:"skip recordings shorter than this, e.g. 3s for accidental record presses; going by probed durations"`
+	MaxAge           time.Duration `arg:"--max-age" help:"skip recordings made longer ago than this, e.g. 720h for the last 30 days"`
+	MinAge           time.Duration `arg:"--min-age" help:"skip recordings made more recently than this, e.g. 1h to leave ongoing sessions for later"`
+	MediaListPath    string        `arg:"--media-list" help:"camera's media list (GET /gopro/media/list), telling how many chapters each recording has (default: .stopcon-media-list.json in input directory, saved by imports)"`
+	ManifestFilePath string        `arg:"--manifest" help:"manifest caching file hashes (default: .stopcon-manifest.json in input directory)"`
+	CopyDirPath      string        `arg:"--copy-mode" placeholder:"DIR" help:"leave input directory untouched: renamed copies, merged videos, catalog, manifest and checksums are written to DIR instead"`
+	StagingDirPath   string        `arg:"--staging-dir" help:"directory to copy videos into when input directory is read-only (default: new temporary directory)"`
+	DryRun           bool          `arg:"--dry-run" help:"show what would be renamed, merged, pruned, imported or removed without touching any files; overrides --commit"`
+	Verbose          bool          `arg:"-v,--verbose" help:"print each ffmpeg and ffprobe command line before running it"`
+	FFmpegPath       string        `arg:"--ffmpeg-path,env:STOPCON_FFMPEG" default:"ffmpeg" help:"ffmpeg binary, as a path or a name looked up in PATH; checked to run and be at least version 4 before any file is touched"`
+	FFprobePath      string        `arg:"--ffprobe-path,env:STOPCON_FFPROBE" default:"ffprobe" help:"ffprobe binary, as a path or a name looked up in PATH; checked like --ffmpeg-path"`
+	IncludeHidden    bool          `arg:"--include-hidden" help:"also consider hidden files and OS artifacts such as AppleDouble ._ files, .Trashes and Thumbs.db"`
+	Strict           bool          `arg:"--strict" help:"abort on the first file that cannot be parsed or probed, instead of skipping it with a warning"`
+	Recursive        bool          `arg:"-r,--recursive" help:"also scan directories below input directory, e.g. DCIM/100GOPRO and 101GOPRO of a card"`
+	MaxDepth         int           `arg:"--max-depth" default:"3" help:"levels of directories below input directory scanned with --recursive"`
+	FollowSymlinks   bool          `arg:"--follow-symlinks" help:"follow symbolic links to directories with --recursive; each directory is still scanned once"`
+	TimestampSource  string        `arg:"--timestamp-source" default:"container,stream,mtime,filename" help:"sources of creation times, first one found wins: container, stream, gps, mtime or filename, comma-separated, e.g. container,gps,mtime; the source used is logged when falling back, and sources other than mtime disagreeing by over a minute are warned about"`
+	NoCache          bool          `arg:"--no-cache" help:"probe every file afresh, neither reading nor updating the probe cache .stopcon-cache.json"`
+	MetadataReader   string        `arg:"--metadata-reader" default:"auto" help:"how creation times, codecs and durations are read: auto reads MP4 files natively, without ffprobe and much faster, handing other containers and MP4 files it cannot make sense of to ffprobe; ffprobe runs ffprobe on every file"`
+	AssumeDate       string        `arg:"--assume-date" help:"creation time of files none of the timestamp sources has one for, e.g. 2024-05-01 or 2024-05-01T14:30, instead of rejecting them"`
+	Events           string        `arg:"--events" default:"text" help:"how discoveries and progress are reported: text, or json for one event object per line on stdout (stderr when merging to stdout), for scripts and other front ends"`
+	RolloverGap      time.Duration `arg:"--rollover-gap" default:"1h" help:"fragments sharing an ID but recorded further apart than this are merged as separate recordings, as the camera's counter wraps past 9999 and cards can be mixed; 0 to go by ID and chapter alone"`
+	ProbeDataPath    string        `arg:"--probe-data" help:"take probe results from a file written by probe --export instead of running ffprobe, for files it lists at the same size; others are probed as usual"`
+	TimeOffset       time.Duration `arg:"--time-offset" help:"correct a camera clock that was off, e.g. +37m if it ran 37 minutes slow or, written with =, --time-offset=-1h if an hour fast; applied to creation times from container and stream tags and modification times, not GPS or names"`
+	Timezone         string        `arg:"--timezone" help:"zone to show creation times in, e.g. Europe/Berlin, for cameras writing real UTC; names and merged videos then carry local time (default: take times as the camera wrote them)"`
+	UtcOffset        string        `arg:"--utc-offset" help:"like --timezone, but a fixed offset such as +02:00 or, written with =, --utc-offset=-05:00, ignoring daylight saving time"`
+	Jobs             int           `arg:"-j,--jobs" help:"number of files probed, and of recordings merged, at once (default: number of CPUs)"`
 }
 
 func isSubcommand(s reflect.StructField) bool {
@@ -127,6 +429,11 @@ func cleanDir(base reflect.Value) {
 
 			vStr := v.Interface().(string)
 
+			// Leave optional paths unset instead of turning them into "."
+			if vStr == "" {
+				return
+			}
+
 			// Workaround for trailing quote on windows
 			if runtime.GOOS == "windows" {
 				vStr = strings.TrimSuffix(vStr, "\"")
@@ -152,6 +459,42 @@ func cleanDir(base reflect.Value) {
 
 }
 
+// Replace each set path flag of r and its subcommands, and each file they were given, with what fn makes of it.
+func (r *CmdRoot) MapPaths(fn func(string) string) {
+	mapPaths(reflect.ValueOf(r), fn)
+}
+
+func mapPaths(base reflect.Value, fn func(string) string) {
+
+	// Convert to struct, exit early if unable.
+	if err := toStruct(&base); err != nil {
+		return
+	}
+
+	forField(base, func(s reflect.StructField, v reflect.Value) {
+
+		if !s.IsExported() || !v.CanSet() {
+			return
+		}
+
+		switch {
+
+		case v.Kind() == reflect.String && strings.HasSuffix(s.Name, "Path") && v.String() != "":
+			v.SetString(fn(v.String()))
+
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String && (strings.HasSuffix(s.Name, "Paths") || s.Name == "Files"):
+			for i := 0; i < v.Len(); i++ {
+				v.Index(i).SetString(fn(v.Index(i).String()))
+			}
+
+		case isSubcommand(s):
+			mapPaths(v, fn)
+
+		}
+
+	})
+}
+
 // Verify existence of a walkable tree of subcommands picked by the user.
 func verifyCommandTree(base reflect.Value) error {
 
@@ -221,6 +564,57 @@ func verifyCommandTree(base reflect.Value) error {
 	return nil
 }
 
+// Option of root command with its resolved value.
+type Setting struct {
+	Flag  string // Long flag, e.g. "--input-dir".
+	Env   string // Environment variable it is also read from, if any.
+	Value string
+}
+
+// Root options as resolved from flags, environment and defaults, in declaration order.
+func (r CmdRoot) Settings() []Setting {
+
+	settings := []Setting{}
+
+	forField(reflect.ValueOf(r), func(s reflect.StructField, v reflect.Value) {
+
+		if !s.IsExported() || isSubcommand(s) || s.Tag.Get("arg") == "-" {
+			return
+		}
+
+		setting := Setting{Value: fmt.Sprint(v.Interface())}
+
+		for _, subtag := range strings.Split(s.Tag.Get("arg"), ",") {
+
+			if strings.HasPrefix(subtag, "--") {
+				setting.Flag = subtag
+			}
+
+			if strings.HasPrefix(subtag, "env:") {
+				setting.Env = strings.TrimPrefix(subtag, "env:")
+			}
+
+		}
+
+		settings = append(settings, setting)
+
+	})
+
+	return settings
+}
+
+// Date of --assume-date as wall-clock time in loc, given to the day, minute or second.
+func ParseAssumeDate(s string, loc *time.Location) (time.Time, error) {
+
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date \"%s\", expected e.g. 2024-05-01 or 2024-05-01T14:30", s)
+}
+
 // Run post process funcs for command structure
 func (r CmdRoot) PostProcess() error {
 
@@ -228,6 +622,235 @@ func (r CmdRoot) PostProcess() error {
 	rv := reflect.ValueOf(&r)
 	cleanDir(rv)
 
+	// Verify exactly one thing to tag
+	if r.Tag != nil && (r.Tag.Id == "") == !r.Tag.Provenance {
+		return errors.New("tag needs either --id or --provenance")
+	}
+
+	// Verify rating range
+	if r.Tag != nil && r.Tag.Rating != nil && (*r.Tag.Rating < 0 || *r.Tag.Rating > 5) {
+		return errors.New("rating must be between 0 and 5")
+	}
+
+	// Verify rename target
+	if r.Rename != nil {
+		switch r.Rename.To {
+		case "renamed":
+		case "raw":
+			if r.Rename.NameTemplate != "" {
+				return errors.New("--to raw conflicts with --name-template")
+			}
+		default:
+			return fmt.Errorf("unknown rename target \"%s\"", r.Rename.To)
+		}
+	}
+
+	// Verify merge order
+	if r.Merge != nil {
+		switch r.Merge.Order {
+		case "smallest-first", "newest-first", "oldest-first":
+		default:
+			return fmt.Errorf("unknown merge order \"%s\"", r.Merge.Order)
+		}
+	}
+
+	// Verify handling of mismatched fragments
+	if r.Merge != nil {
+		switch r.Merge.Mismatched {
+		case "refuse", "transcode":
+		default:
+			return fmt.Errorf("unknown mismatch handling \"%s\"", r.Merge.Mismatched)
+		}
+	}
+
+	// Verify audio preset
+	if r.Merge != nil && r.Merge.AudioPreset != "" {
+		if _, ok := merger.AudioPresets[r.Merge.AudioPreset]; !ok {
+			return fmt.Errorf("unknown audio preset \"%s\"", r.Merge.AudioPreset)
+		}
+	}
+
+	// Verify handling of single fragments
+	if r.Merge != nil {
+		switch r.Merge.Single {
+		case "remux", "link", "copy":
+		default:
+			return fmt.Errorf("unknown single-fragment mode \"%s\"", r.Merge.Single)
+		}
+	}
+
+	// Verify merge container
+	if r.Merge != nil {
+		switch r.Merge.Container {
+		case "", "mkv", "mp4", "mov", "fmp4", "mpegts":
+		default:
+			return fmt.Errorf("unknown container \"%s\"", r.Merge.Container)
+		}
+	}
+
+	// Verify container preference
+	for _, c := range strings.Split(r.ContainerOrder, ",") {
+		switch c {
+		case "source", "mkv", "mp4", "mov", "mpegts":
+		default:
+			return fmt.Errorf("unknown container \"%s\" in preference", c)
+		}
+	}
+
+	// Verify sidecar format
+	if r.Merge != nil && r.Merge.Sidecar != "" && r.Merge.Sidecar != "json" && r.Merge.Sidecar != "md" {
+		return fmt.Errorf("unknown sidecar format \"%s\"", r.Merge.Sidecar)
+	}
+
+	// Verify missing chapter handling
+	if r.Merge != nil && r.Merge.MissingChapters != "warn" && r.Merge.MissingChapters != "abort" {
+		return fmt.Errorf("unknown missing chapter handling \"%s\"", r.Merge.MissingChapters)
+	}
+
+	// Verify external audio mode
+	if r.Merge != nil {
+		switch r.Merge.ExternalAudio {
+		case "", "add", "replace":
+		default:
+			return fmt.Errorf("unknown external audio mode \"%s\"", r.Merge.ExternalAudio)
+		}
+	}
+
+	// Verify merging backend was built in
+	if r.Merge != nil {
+		if _, err := merger.New(r.Merge.Merger); err != nil {
+			return err
+		}
+	}
+
+	// Every file is tried at least once
+	if r.SmbRetries < 1 {
+		return errors.New("--smb-retries must be at least 1")
+	}
+
+	// Verify prune action
+	if r.Prune != nil && r.Prune.Action != "archive" && r.Prune.Action != "delete" {
+		return fmt.Errorf("unknown prune action \"%s\"", r.Prune.Action)
+	}
+
+	// Verify scrub fraction
+	if r.Scrub != nil && (r.Scrub.Fraction <= 0 || r.Scrub.Fraction > 1) {
+		return errors.New("scrub fraction must be above 0 and at most 1")
+	}
+
+	// Verify both manifests or neither are given
+	if r.Diff != nil && r.Diff.OldFilePath != "" && r.Diff.NewFilePath == "" {
+		return errors.New("diff needs two manifests, or none to compare the stored manifest against files on disk")
+	}
+
+	// Pruning removes fragments from where they were recorded
+	if r.Prune != nil && r.CopyDirPath != "" {
+		return errors.New("prune cannot be used with --copy-mode")
+	}
+
+	// Verify exactly one import source
+	if r.Import != nil && (r.Import.FromDirPath == "") == (len(r.Import.Urls) == 0) {
+		return errors.New("import needs either --from or --url")
+	}
+
+	// Every file is tried at least once
+	if r.Import != nil && r.Import.Retries < 1 {
+		return errors.New("--retries must be at least 1")
+	}
+
+	// Verify there is a card to format
+	if r.Import != nil && r.Import.FormatCard && r.Import.FromDirPath == "" {
+		return errors.New("--format-card needs --from")
+	}
+
+	// Verify there is a mounted camera to cache
+	if r.Import != nil && r.Import.MTP && r.Import.FromDirPath == "" {
+		return errors.New("--mtp needs --from")
+	}
+
+	// Verify preview layout
+	if r.Preview != nil && (r.Preview.Interval <= 0 || r.Preview.ThumbWidth <= 0 || r.Preview.Columns <= 0 || r.Preview.Rows <= 0 || r.Preview.WaveformRate <= 0) {
+		return errors.New("preview interval, thumbnail width, columns, rows and waveform rate must be positive")
+	}
+
+	// Verify tone mapping
+	if r.Preview != nil {
+		switch r.Preview.ToneMap {
+		case "auto", "on", "off":
+		default:
+			return fmt.Errorf("unknown tone mapping \"%s\"", r.Preview.ToneMap)
+		}
+	}
+
+	// Verify packaging format
+	if r.Package != nil && r.Package.Format != "hls" && r.Package.Format != "dash" {
+		return fmt.Errorf("unknown packaging format \"%s\"", r.Package.Format)
+	}
+
+	// Verify YouTube privacy status
+	if r.Upload != nil && r.Upload.Youtube != nil {
+		switch r.Upload.Youtube.Privacy {
+		case "private", "unlisted", "public":
+		default:
+			return fmt.Errorf("unknown privacy status \"%s\"", r.Upload.Youtube.Privacy)
+		}
+	}
+
+	// Verify SMB mode
+	switch r.SmbMode {
+	case "auto", "on", "off":
+	default:
+		return fmt.Errorf("unknown SMB mode \"%s\"", r.SmbMode)
+	}
+
+	// Verify timestamp sources
+	for _, source := range strings.Split(r.TimestampSource, ",") {
+		switch source {
+		case "container", "stream", "gps", "mtime", "filename":
+		default:
+			return fmt.Errorf("unknown timestamp source \"%s\"", source)
+		}
+	}
+
+	if r.AssumeDate != "" {
+		if _, err := ParseAssumeDate(r.AssumeDate, time.UTC); err != nil {
+			return err
+		}
+	}
+
+	if r.Timezone != "" && r.UtcOffset != "" {
+		return errors.New("--timezone and --utc-offset cannot be used together")
+	}
+
+	if r.Trim != nil && (r.Trim.Start < 0 || r.Trim.End != 0 && r.Trim.End <= r.Trim.Start) {
+		return errors.New("--end must come after --start")
+	}
+
+	if r.Inspect != nil && len(r.Inspect.Compare) != 2 {
+		return errors.New("--compare takes two files")
+	}
+
+	// Verify metadata reader
+	switch r.MetadataReader {
+	case "auto", "ffprobe":
+	default:
+		return fmt.Errorf("unknown metadata reader \"%s\"", r.MetadataReader)
+	}
+
+	// Verify event format
+	switch r.Events {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown event format \"%s\"", r.Events)
+	}
+
+	// Verify WSL mode
+	switch r.WslMode {
+	case "auto", "on", "off":
+	default:
+		return fmt.Errorf("unknown WSL mode \"%s\"", r.WslMode)
+	}
+
 	// Verify walkable tree of subcommands have been picked by the user
 	next := reflect.ValueOf(r)
 	if err := verifyCommandTree(next); err != nil {
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Settings read from a TOML file, e.g. the config.toml of a library.
+type Config struct {
+	Policies map[string]string `toml:"policies"` // Action for each file extension, e.g. LRV = "delete".
+	Names    Names             `toml:"names"`
+	Pipeline Pipeline          `toml:"pipeline"`
+}
+
+// Steps of stopcon run, carried out on each recording in turn.
+type Pipeline struct {
+	Steps []string `toml:"steps"` // Subcommand of each step with its flags, quoted as in a shell, e.g. "upload youtube --title 'Summer trip'"; one of rename, merge, verify, preview, package, upload, prune or archive.
+}
+
+// Shortening of default renamed and merged names, or custom layouts replacing them.
+type Names struct {
+	Abbreviations map[string]string `toml:"abbreviations"`  // Replacement of each word of the names, e.g. Recording = "Rec"; empty to leave the word out.
+	DropUniqueId  bool              `toml:"drop_unique_id"` // Leave the ID out of merged names of recordings alone on their day.
+	Renamed       string            `toml:"renamed"`        // Layout of renamed names, e.g. "{date} {id} P{index}.{ext}".
+	Merged        string            `toml:"merged"`         // Layout of merged names, e.g. "{date} {camera} {id}.{ext}".
+}
+
+// Load configuration stored at path; a missing file results in an empty configuration.
+func Load(path string) (*Config, error) {
+
+	c := Config{}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &c, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := toml.Decode(string(buf), &c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Misspelled keys would otherwise be silently ignored
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = "\"" + key.String() + "\""
+		}
+
+		return nil, fmt.Errorf("unknown keys %s", strings.Join(keys, ", "))
+	}
+
+	// A custom layout names every merged recording alike, alone on its day or not
+	if c.Names.Merged != "" && c.Names.DropUniqueId {
+		return nil, errors.New("\"names.drop_unique_id\" conflicts with \"names.merged\"; leave one out")
+	}
+
+	return &c, nil
+}
+
+// Write configuration as TOML.
+func (c Config) Encode(w io.Writer) error {
+	return toml.NewEncoder(w).Encode(c)
+}
@@ -1,24 +1,74 @@
 package entrypoint
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"math"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/alexflint/go-arg"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
+	"github.com/muesli/termenv"
+	"github.com/thatpix3l/stopcon/src/archive"
+	"github.com/thatpix3l/stopcon/src/audit"
+	"github.com/thatpix3l/stopcon/src/cache"
+	"github.com/thatpix3l/stopcon/src/catalog"
+	"github.com/thatpix3l/stopcon/src/cleanup"
 	"github.com/thatpix3l/stopcon/src/cmd"
+	"github.com/thatpix3l/stopcon/src/config"
+	"github.com/thatpix3l/stopcon/src/failure"
 	"github.com/thatpix3l/stopcon/src/ff"
 	"github.com/thatpix3l/stopcon/src/format"
+	"github.com/thatpix3l/stopcon/src/gpmf"
+	"github.com/thatpix3l/stopcon/src/hash"
+	"github.com/thatpix3l/stopcon/src/ignore"
+	"github.com/thatpix3l/stopcon/src/immich"
+	"github.com/thatpix3l/stopcon/src/importer"
+	"github.com/thatpix3l/stopcon/src/inspect"
+	"github.com/thatpix3l/stopcon/src/journal"
+	"github.com/thatpix3l/stopcon/src/library"
+	"github.com/thatpix3l/stopcon/src/locale"
+	"github.com/thatpix3l/stopcon/src/manifest"
+	"github.com/thatpix3l/stopcon/src/medialist"
+	merging "github.com/thatpix3l/stopcon/src/merge"
+	"github.com/thatpix3l/stopcon/src/merger"
+	"github.com/thatpix3l/stopcon/src/mp4"
+	"github.com/thatpix3l/stopcon/src/naming"
+	"github.com/thatpix3l/stopcon/src/packaging"
+	"github.com/thatpix3l/stopcon/src/photoprism"
+	"github.com/thatpix3l/stopcon/src/photos"
+	"github.com/thatpix3l/stopcon/src/policy"
+	"github.com/thatpix3l/stopcon/src/preview"
+	renamer "github.com/thatpix3l/stopcon/src/rename"
+	"github.com/thatpix3l/stopcon/src/report"
+	"github.com/thatpix3l/stopcon/src/scan"
+	"github.com/thatpix3l/stopcon/src/shell"
+	"github.com/thatpix3l/stopcon/src/sidecar"
+	"github.com/thatpix3l/stopcon/src/snapshot"
+	"github.com/thatpix3l/stopcon/src/trim"
+	"github.com/thatpix3l/stopcon/src/utils"
+	"github.com/thatpix3l/stopcon/src/youtube"
 )
 
 var (
@@ -28,24 +78,86 @@ var (
 	styleBold        = lipgloss.NewStyle().Bold(true)
 )
 
-var root = cmd.CmdRoot{}
+// Receives discoveries and progress of the run; programs embedding stopcon may set it before [Main] to show them in their own UI, otherwise it is picked by --events.
+var Reporter report.Reporter
 
-type Metadata struct {
-	Codec        string
-	CreationTime *time.Time
+// State of one run, from parsing the command line to exiting with the status of its first failure.
+type app struct {
+	root     cmd.CmdRoot
+	reporter report.Reporter // Receives discoveries and progress of the run, see [Reporter].
+	runCtx   context.Context // Context of the run, done once it is interrupted with Ctrl-C or terminated.
+	stdin    *bufio.Reader   // Shared so buffered input is not lost between questions.
+	status   io.Writer       // Where progress of merging is printed; stderr when the merged video itself goes to stdout.
+
+	videoCatalog  *catalog.Catalog   // Ratings and notes of recordings.
+	videoLibrary  *library.Library   // Library in use, nil when working on a bare directory.
+	videoManifest *manifest.Manifest // Record of files seen, caching their hashes.
+	inputArchive  *archive.Archive   // Archive standing in for input directory, if --input-dir names one.
+	loadedConfig  *config.Config     // Configuration as loaded from file; empty without one.
+	policies      *policy.Engine     // Policies for each file extension, from configuration.
+	pipeline      []pipelineStep     // Steps of pipeline, in order.
+
+	// Paths of files kept alongside recordings by the attach policy, e.g. external audio; copied next to merged videos by [VideoWhole.keepAttached].
+	attached []string
+
+	// User-specified naming templates, nil when using the default names.
+	renameTemplate *naming.Template
+	mergeTemplate  *naming.Template
+
+	smb             bool // Whether input directory is handled as an SMB share.
+	wsl             bool // Whether running under WSL, where Windows paths are taken and Windows drives get Windows-safe names.
+	simulating      bool // Whether names are parsed from a listing rather than real files.
+	probeless       bool // Whether ffprobe is missing, so merging goes by names alone.
+	probeMissing    bool // Whether ffprobe is missing while other commands read MP4 files natively.
+	noZscale        bool // Whether ffmpeg lacks the zscale filter tone mapping needs.
+	parallelMerges  bool // Whether several recordings are merged at once.
+	listingsChanged bool // Whether a directory was read afresh during discovery, so its listing is worth saving.
+
+	// Zone creation times are shown in, as given by --timezone or --utc-offset; nil to take tags at face value, local wall-clock time marked as UTC as GoPro writes them.
+	timeZone    *time.Location
+	assumedDate time.Time // Creation time given by --assume-date; zero if none.
+
+	probeCache    *cache.Cache       // Output of ffprobe for files probed before, kept between runs; nil with --no-cache.
+	probeSnapshot *snapshot.Snapshot // Probe results taken elsewhere, nil unless given with --probe-data.
+	pickedBatches map[string]bool    // Import batches picked by --batch, by name; nil if not given.
+	audioClips    []audioClip        // Audio recordings available for --external-audio, probed once per run.
+	videoMerger   merger.Merger      // Backend merging videos, picked by --merger.
+
+	videoList   VideoList
+	videosMutex sync.RWMutex
+
+	runJournal   *journal.Journal // Journal of changes made to files, so the latest run can be undone.
+	journalBegun bool             // Whether this run was begun in the journal yet.
+	recordMutex  sync.Mutex       // Guards catalog, manifest and journal against merges finishing at once.
+
+	firstFailure error // First failure of the run, whose class becomes its exit status; nil while all is well.
+	failureMutex sync.Mutex
 }
 
-func (m Metadata) CreationTimeString() string {
-	if m.CreationTime == nil {
-		return ""
-	}
+// Run reporting to reporter, or to one picked by --events if nil.
+func newApp(reporter report.Reporter) *app {
 
-	return m.CreationTime.Format("2006-01-02 15_04_05")
+	return &app{
+		reporter:      reporter,
+		runCtx:        context.Background(),
+		stdin:         bufio.NewReader(os.Stdin),
+		status:        os.Stdout,
+		videoCatalog:  &catalog.Catalog{},
+		videoManifest: &manifest.Manifest{},
+		loadedConfig:  &config.Config{},
+		pipeline:      []pipelineStep{},
+		attached:      []string{},
+		videoList:     VideoList{},
+	}
 }
 
+// Metadata of a fragment or recording, as read by [scan.Scanner].
+type Metadata = scan.Metadata
+
 type Video struct {
 	Id string
 	Metadata
+	app *app // Run the video was found in.
 }
 
 type VideoFragment struct {
@@ -54,16 +166,94 @@ type VideoFragment struct {
 	Extension   string // File name extension.
 	CurrentName string // File name as-is.
 	NewName     string // File name for renaming purposes.
+	Dir         string // Directory of file when given explicitly; empty for input directory.
+}
+
+// Logger prefixing lines with [VideoFragment]'s name, for use while fragments are parsed concurrently.
+func (f VideoFragment) logger() *log.Logger {
+	return log.WithPrefix(f.CurrentName)
 }
 
 // Absolute path to [VideoFragment]'s current location.
 func (f VideoFragment) InputPath() string {
-	return filepath.Join(root.InputDirPath, f.CurrentName)
+
+	if f.Dir != "" {
+		return filepath.Join(f.Dir, f.CurrentName)
+	}
+
+	// Archived files are only read once extracted
+	if f.app.inputArchive != nil {
+		p, err := f.app.inputArchive.Extract(f.CurrentName)
+		if err != nil {
+			log.Warnf("%v", err)
+		}
+		return p
+	}
+
+	return filepath.Join(f.app.root.InputDirPath, f.CurrentName)
 }
 
 // Absolute path to [VideoFragment]'s new location, for renaming purposes.
 func (f VideoFragment) NewPath() string {
-	return filepath.Join(root.InputDirPath, f.NewName)
+
+	// Explicitly given files are renamed where they are
+	if f.Dir != "" && f.app.root.CopyDirPath == "" {
+		return filepath.Join(f.Dir, f.NewName)
+	}
+
+	return filepath.Join(f.app.stateDir(), f.NewName)
+}
+
+// Files given on the command line, instead of discovering the input directory.
+func (app *app) explicitFiles() []string {
+
+	switch {
+	case app.root.Probe != nil:
+		return app.root.Probe.Files
+	case app.root.Rename != nil:
+		return app.root.Rename.Files
+	case app.root.Merge != nil:
+		return app.root.Merge.Files
+	}
+
+	return nil
+}
+
+// Directory receiving files stopcon writes beside videos: the input directory, or the copy directory in copy mode.
+func (app *app) stateDir() string {
+
+	if app.root.CopyDirPath != "" {
+		return app.root.CopyDirPath
+	}
+
+	// Nothing can be written into an archive, so write beside it
+	if app.inputArchive != nil {
+		return filepath.Dir(app.root.InputDirPath)
+	}
+
+	return app.root.InputDirPath
+}
+
+// Open input directory as archive if it is one.
+func (app *app) openArchive() error {
+
+	if !archive.IsArchive(app.root.InputDirPath) {
+		return nil
+	}
+
+	// Renamed files have to land outside the archive
+	if app.root.Rename != nil && app.committing(app.root.Rename.Commit) && app.root.CopyDirPath == "" {
+		return errors.New(locale.T("ArchiveNeedsCopyMode", "renaming files of an archive needs --copy-mode"))
+	}
+
+	a, err := archive.Open(app.root.InputDirPath)
+	if err != nil {
+		return err
+	}
+
+	app.inputArchive = a
+
+	return nil
 }
 
 func cmdAdapter[Slice any, Output any](callback func(Slice, ...Slice) Output, c []Slice) Output {
@@ -86,400 +276,6850 @@ func cmdAdapter[Slice any, Output any](callback func(Slice, ...Slice) Output, c
 	return callback(first, rest...)
 }
 
-func ffprobeCmd(path string) []string {
-	return []string{
-		"ffprobe", path,
-		"-print_format", "json",
-		"-show_format",
-		"-show_streams",
-		"-select_streams", "v:0",
-		"-hide_banner",
-		"-loglevel", "fatal",
-	}
+// Command for args, printed first in verbose or dry-run mode so it can be rerun by hand.
+// If stdin is not empty, it is shown as a heredoc fed to the command.
+func (app *app) newCmd(args []string, stdin string) *exec.Cmd {
+	return app.newCmdFor(log.Default(), args, stdin)
 }
 
-func ffmpegCmd(dest string) []string {
-	return []string{
-		"ffmpeg",
-		"-protocol_whitelist", "file,pipe",
-		"-f", "concat",
-		"-safe", "0",
-		"-i", "pipe:",
-		"-codec", "copy",
-		"-map_metadata", "0",
-		dest,
-	}
-}
+// Command for args like [newCmd], printed through logger so lines of concurrent jobs can be told apart.
+func (app *app) newCmdFor(logger *log.Logger, args []string, stdin string) *exec.Cmd {
 
-// Merge separated video fragments into a single video file.
-func (vw VideoWhole) merge() error {
+	args = app.withTool(args)
 
-	sources := strings.Builder{}
+	if app.root.Verbose || app.root.DryRun {
 
-	for _, f := range vw.Fragments {
-		if _, err := sources.WriteString(fmt.Sprintf("file '%s'\n", f.InputPath())); err != nil {
-			return err
+		line := utils.ShellQuote(args)
+		if stdin != "" {
+			line += " <<'EOF'\n" + stdin + "EOF"
 		}
+
+		logger.Info(line)
+
 	}
 
-	cmd := cmdAdapter(exec.Command, ffmpegCmd(vw.OutputPath()))
-	cmd.Stdin = strings.NewReader(sources.String())
+	// Killed once the run is interrupted, rather than left running on its own
+	command := func(name string, arg ...string) *exec.Cmd { return exec.CommandContext(app.runCtx, name, arg...) }
 
-	if _, err := cmd.Output(); err != nil {
-		return err
+	cmd := cmdAdapter(command, args)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
 	}
 
-	return nil
+	return cmd
 }
 
-// Parse and store embedded video [VideoFragment] metadata.
-func (vf *VideoFragment) parseMetadata() error {
+// Args running ffmpeg and ffprobe as given with --ffmpeg-path and --ffprobe-path, leaving args of other commands as they are.
+func (app *app) withTool(args []string) []string {
 
-	jsonBuf, err := cmdAdapter(exec.Command, ffprobeCmd(vf.InputPath())).Output()
-	if err != nil {
-		return err
+	if len(args) < 1 {
+		return args
 	}
 
-	data := ff.ProbeData{}
-	if err := json.Unmarshal(jsonBuf, &data); err != nil {
-		return err
+	bin := args[0]
+	switch bin {
+	case "ffmpeg":
+		bin = app.root.FFmpegPath
+	case "ffprobe":
+		bin = app.root.FFprobePath
 	}
 
-	// Extract what we care from structure
-	codec := data.Streams[0].CodecName
+	if bin == "" || bin == args[0] {
+		return args
+	}
 
-	creationTimeV, ok := data.Format.Tags["creation_time"]
-	if !ok {
-		return errors.New("tag \"creation_time\"not embedded in video")
+	// Copied, as callers may hold on to their args
+	return append([]string{bin}, args[1:]...)
+}
+
+func ffprobeCmd(path string) []string {
+	return scan.ProbeArgs(path)
+}
+
+// Container tags embedding cataloged details of [VideoWhole].
+func (vw VideoWhole) metadata() map[string]string {
+
+	tags := map[string]string{}
+
+	if !vw.app.root.Merge.EmbedTags {
+		return tags
 	}
 
-	creationTimeStr, ok := creationTimeV.(string)
-	if !ok {
-		return errors.New("tag \"creation_time\" is not a string")
+	r := vw.app.videoCatalog.Lookup(vw.key())
+	if r == nil {
+		return tags
 	}
 
-	// Parse timestamp into Go's time.Time, cache for later use
-	creationTime, err := time.Parse("2006-01-02T15:04:05.9Z", creationTimeStr)
-	if err != nil {
-		return err
+	if r.Rating > 0 {
+		tags["rating"] = strconv.Itoa(r.Rating)
 	}
 
-	// Store into video [Fragment]
-	vf.Metadata.Codec = codec
-	vf.Metadata.CreationTime = &creationTime
+	if r.Note != "" {
+		tags["comment"] = r.Note
+	}
 
-	return nil
+	return tags
 }
 
-// Parser for GoPro-named partial recordings.
-func (vf *VideoFragment) parseRaw() error {
+// Container tags of provenance, as written with --provenance.
+const (
+	tagUUID  = "stopcon_uuid"
+	tagOwner = "stopcon_owner"
+	tagBatch = "stopcon_batch"
+)
+
+// Provenance tags of [VideoWhole]; nil without --provenance.
+func (vw VideoWhole) provenance() map[string]string {
 
-	// Get matches based off of [Fragment]'s name.
-	matches := format.Raw.Regex.FindStringSubmatch(vf.CurrentName)
-	if len(matches) < len(format.Raw.Tokens.Slice) {
-		return errors.New("cannot parse as raw name")
+	if !vw.app.root.Merge.Provenance {
+		return nil
 	}
 
-	index, err := strconv.Atoi(matches[2])
-	if err != nil {
-		return errors.New("cannot parse index as an integer")
+	tags := map[string]string{}
+
+	// Not yet given when only showing what would be merged
+	if vw.UUID != "" {
+		tags[tagUUID] = vw.UUID
 	}
 
-	vf.Id = matches[3]
-	vf.Index = index
-	vf.Extension = matches[4]
+	if vw.app.root.Merge.Owner != "" {
+		tags[tagOwner] = vw.app.root.Merge.Owner
+	}
 
-	return nil
+	if batches := vw.batches(); len(batches) > 0 {
+		tags[tagBatch] = strings.Join(batches, ",")
+	}
+
+	return tags
 }
 
-// Parser for preferred-name partial recordings.
-func (vf *VideoFragment) parseRenamed() error {
+// Import batches [VideoWhole]'s fragments came in with, sorted; fragments imported before batches were recorded, or not imported at all, add none.
+func (vw VideoWhole) batches() []string {
 
-	// Get matches based off of [Fragment]'s name.
-	matches := format.Renamed.Regex.FindStringSubmatch(vf.CurrentName)
-	if len(matches) < len(format.Renamed.Tokens.Slice) {
-		return errors.New("cannot parse as pretty name")
-	}
+	seen := map[string]bool{}
+	batches := []string{}
+
+	for _, f := range vw.Fragments {
+
+		name, size, ok := f.imported()
+		if !ok {
+			continue
+		}
+
+		if batch := vw.app.videoCatalog.Batch(name, size); batch != "" && !seen[batch] {
+			seen[batch] = true
+			batches = append(batches, batch)
+		}
 
-	index, err := strconv.Atoi(matches[format.Renamed.Tokens.Map["index"].Index+1])
-	if err != nil {
-		return err
 	}
 
-	vf.Id = matches[format.Renamed.Tokens.Map["id"].Index+1]
-	vf.Index = index
-	vf.Extension = matches[format.Renamed.Tokens.Map["extension"].Index+1]
+	sort.Strings(batches)
 
-	return nil
+	return batches
 }
 
-// Parser for preferred-name merged recordings.
-func (vf *VideoFragment) parseMerged() error {
-	matches := format.Merged.Regex.FindStringSubmatch(vf.CurrentName)
-	if len(matches) < len(format.Merged.Tokens.Slice) {
-		return errors.New("cannot parse as merged name")
-	}
+// Name on the camera and size [VideoFragment]'s import is recorded by; not ok if the file cannot be read.
+func (f VideoFragment) imported() (string, int64, bool) {
 
-	vf.Id = matches[2]
-	vf.Extension = matches[3]
+	info, err := os.Stat(f.InputPath())
+	if err != nil {
+		return "", 0, false
+	}
 
-	return nil
+	// Imports are recorded by name on the camera, which renamed fragments no longer carry
+	name := f.CurrentName
+	if raw, err := f.rawName(); err == nil {
+		name = raw
+	}
 
+	return name, info.Size(), true
 }
 
-// Parse fragment by its name and embedded metadata.
-func (vf *VideoFragment) Parse() error {
+// Batch names or starts of names given with --batch of the picked subcommand; empty if none.
+func (app *app) batchFlag() string {
 
-	nameParsers := []func() error{vf.parseRenamed, vf.parseRaw, vf.parseMerged}
+	switch {
+	case app.root.Merge != nil:
+		return app.root.Merge.Batch
+	case app.root.Upload != nil:
+		return app.root.Upload.Batch
+	case app.root.Rollback != nil:
+		return app.root.Rollback.Batch
+	}
 
-	for _, nameParser := range nameParsers {
-		if err := nameParser(); err == nil {
+	return ""
+}
 
-			if err := vf.parseMetadata(); err != nil {
-				return err
-			}
+// Find import batches picked by --batch: the one it names, or every one whose name starts with it.
+func (app *app) loadBatches() error {
 
-			vf.NewName = fmt.Sprintf(format.Renamed.Layout, vf.CreationTimeString(), vf.Id, vf.Index, vf.Extension)
+	prefix := app.batchFlag()
+	if prefix == "" {
+		return nil
+	}
 
-			return nil
+	app.pickedBatches = map[string]bool{}
 
+	for _, b := range app.videoManifest.FindBatches(prefix) {
+		app.pickedBatches[b.Name] = true
+	}
+
+	// Imports made before batches went into the manifest are only in the catalog
+	for _, name := range app.videoCatalog.Batches() {
+		if strings.HasPrefix(name, prefix) {
+			app.pickedBatches[name] = true
 		}
 	}
 
-	return errors.New("name not parseable")
+	if len(app.pickedBatches) == 0 {
+		return errors.New(locale.Td("NoBatch", "no import batch matches \"{{.Batch}}\"", map[string]any{"Batch": prefix}))
+	}
 
-}
+	names := []string{}
+	for name := range app.pickedBatches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-// VideoWhole [Video], composed of one or more [VideoFragment]s
-type VideoWhole struct {
-	Video
-	Fragments []VideoFragment // Individual video fragments that, when merged together, create a whole video.
-	Expected  int             // Total expected fragments for merged video.
-	Name      string          // Cached name for video merging purposes.
+	log.Info(locale.Td("BatchesPicked", "Import batches picked: {{.Batches}}", map[string]any{"Batches": strings.Join(names, ", ")}))
+
+	return nil
 }
 
-// Absolute path to output when merging [VideoWhole].
-func (vw VideoWhole) OutputPath() string {
-	return filepath.Join(root.Merge.OutputDirPath, vw.Name)
+// Whether any of batches is picked by --batch, or none need be.
+func (app *app) batchPicked(batches []string) bool {
+
+	if app.pickedBatches == nil {
+		return true
+	}
+
+	for _, batch := range batches {
+		if app.pickedBatches[batch] {
+			return true
+		}
+	}
+
+	return false
 }
 
-type VideoList map[string]*VideoWhole
+// Merge job joining [VideoWhole]'s fragments into its output.
+func (vw VideoWhole) mergeJob() merger.Job {
 
-var videosMutex = sync.RWMutex{}
+	ctr, _ := vw.container()
 
-// Add entry as a new video [VideoFragment].
-func (vl VideoList) Add(name string) error {
+	job := merger.Job{Output: vw.OutputPath(), Format: ctr, Metadata: vw.metadata(), Provenance: vw.provenance(), Fragment: vw.app.root.Merge.FragmentDuration, NoData: vw.app.root.Merge.NoData}
 
-	f := VideoFragment{CurrentName: name}
+	// Media managers sort by it, and would otherwise see the time of merging
+	if vw.CreationTime != nil {
+		job.Created = *vw.CreationTime
+	}
 
-	if err := f.Parse(); err != nil {
-		return err
+	for _, f := range vw.Fragments {
+		job.Inputs = append(job.Inputs, f.InputPath())
 	}
 
-	videosMutex.Lock()
-	defer videosMutex.Unlock()
+	job.Audio = vw.externalAudio()
 
-	// Initialize video if never created for current [Fragment]'s ID
-	if _, ok := vl[f.Id]; !ok {
-		vl[f.Id] = &VideoWhole{
-			Video:     f.Video,
-			Fragments: []VideoFragment{},
-		}
+	if preset, ok := merger.AudioPresets[vw.app.root.Merge.AudioPreset]; ok {
+		job.Sound = &preset
 	}
 
-	// Address of current merged
-	merged := vl[f.Id]
+	// Re-encoded to the first fragment's picture, as the recording started out
+	if vw.app.root.Merge.Mismatched == "transcode" && vw.checkPictures() != nil {
+		f := vw.Fragments[0]
+		job.Convert = &merger.Picture{Codec: f.Codec, Width: f.Width, Height: f.Height, Rate: f.FrameRate, Audio: !vw.Lapse}
+	}
 
-	// If video already contains date, assign it to [Fragment]; otherwise, parse and set both.
-	if merged.CreationTime != nil {
-		f.CreationTime = merged.CreationTime
+	return job
+}
 
-	} else {
-		merged.CreationTime = f.CreationTime
-	}
+// Audio recording found in input directory, e.g. a WAV from a Media Mod or field recorder.
+type audioClip struct {
+	Path     string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Probe WAV files in input directory, and files attached by policy, for their start time and length.
+func (app *app) findExternalAudio() error {
 
-	// Store current [Fragment] into video
-	merged.Fragments = append(merged.Fragments, f)
+	entries, err := os.ReadDir(app.root.InputDirPath)
+	if err != nil {
+		return err
+	}
 
-	// Update expected count of [Fragment]s if necessary
-	if f.Index > merged.Expected {
-		merged.Expected = f.Index
+	paths := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".wav") {
+			paths = append(paths, filepath.Join(app.root.InputDirPath, entry.Name()))
+		}
 	}
 
-	if merged.Name == "" {
-		merged.Name = fmt.Sprintf(format.Merged.Layout, merged.CreationTimeString(), merged.Id, "mkv")
+	// Files attached by policy count too, whatever their extension or directory
+	for _, path := range app.attached {
+		if !strings.EqualFold(filepath.Dir(path), app.root.InputDirPath) || !strings.EqualFold(filepath.Ext(path), ".wav") {
+			paths = append(paths, path)
+		}
 	}
 
-	return nil
+	for _, path := range paths {
 
-}
+		name := filepath.Base(path)
 
-// Print what will be renamed.
-func renameInfo(old string, new string) error {
+		jsonBuf, err := utils.Output(app.newCmd(ffprobeCmd(path), ""), "")
+		if err != nil {
+			log.Warnf("%s: %v", name, err)
+			continue
+		}
+
+		data := ff.ProbeData{}
+		if err := json.Unmarshal(jsonBuf, &data); err != nil {
+			log.Warnf("%s: %v", name, err)
+			continue
+		}
+
+		clip := audioClip{Path: path, Duration: scan.Seconds(data.Format.Duration)}
+
+		if clip.Start, err = audioStart(path, data.Format.Tags, clip.Duration); err != nil {
+			log.Warnf("%s: %v", name, err)
+			continue
+		}
 
-	fmt.Printf("%4s\n%s\n%4s\n%s\n", styleBold.Render("From"), old, styleBold.Render("To"), styleDestination.Render(new))
+		app.audioClips = append(app.audioClips, clip)
+
+	}
 
 	return nil
 }
 
-// Rename old file into new file.
-func renameCommit(old string, new string) error {
+// Start of audio recording, from its creation_time tag, its BWF origination stamp, or else its modification time less its length.
+func audioStart(path string, tags map[string]any, duration time.Duration) (time.Time, error) {
 
-	if err := os.Rename(old, new); err != nil {
-		return err
+	if s, ok := tags["creation_time"].(string); ok {
+		if t, err := time.Parse("2006-01-02T15:04:05.9Z", s); err == nil {
+			return t, nil
+		}
 	}
 
-	return nil
+	// Broadcast WAV stamps local wall-clock time, as GoPro does despite its "Z"
+	date, dateOk := tags["origination_date"].(string)
+	clock, clockOk := tags["origination_time"].(string)
+	if dateOk && clockOk {
+		if t, err := time.Parse("2006-01-02 15:04:05", date+" "+strings.ReplaceAll(clock, "-", ":")); err == nil {
+			return t, nil
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// Recorders close the file when they stop; read its local wall-clock time as UTC, to compare with GoPro's
+	mod := info.ModTime().Local()
+	end := time.Date(mod.Year(), mod.Month(), mod.Day(), mod.Hour(), mod.Minute(), mod.Second(), mod.Nanosecond(), time.UTC)
+
+	return end.Add(-duration), nil
 }
 
-func renameActionBuilder(actionList ...func(old string, new string) error) func(old string, new string) error {
-	return func(old, new string) error {
+// External audio overlapping [VideoWhole] the most, or nil if none or not asked for.
+func (vw VideoWhole) externalAudio() *merger.Audio {
 
-		if old == new {
+	if vw.app.root.Merge == nil || vw.app.root.Merge.ExternalAudio == "" || vw.CreationTime == nil {
+		return nil
+	}
 
-			log.Infof("Already renamed: %s", old)
+	duration := time.Duration(0)
+	for _, f := range vw.Fragments {
+		duration += f.Duration
+	}
 
-			return nil
+	start := *vw.CreationTime
+	end := start.Add(duration)
+
+	var best *audioClip
+	bestOverlap := time.Duration(0)
+
+	for i, clip := range vw.app.audioClips {
+
+		// Overlap of both spans, negative if they are apart
+		from, to := start, end
+		if clip.Start.After(from) {
+			from = clip.Start
+		}
+		if clipEnd := clip.Start.Add(clip.Duration); clipEnd.Before(to) {
+			to = clipEnd
 		}
 
-		for _, action := range actionList {
-			if err := action(old, new); err != nil {
-				return err
-			}
+		if overlap := to.Sub(from); overlap > bestOverlap {
+			best = &vw.app.audioClips[i]
+			bestOverlap = overlap
 		}
 
+	}
+
+	if best == nil {
 		return nil
 	}
+
+	return &merger.Audio{
+		Path:     best.Path,
+		Offset:   best.Start.Sub(start),
+		Duration: duration,
+		Replace:  vw.app.root.Merge.ExternalAudio == "replace",
+	}
 }
 
-func (vl VideoList) Parse() error {
+// Set up merging backend.
+func (app *app) openMerger() error {
 
-	dirEntries, err := os.ReadDir(root.InputDirPath)
+	m, err := merger.New(app.root.Merge.Merger)
 	if err != nil {
 		return err
 	}
 
-	addWG := sync.WaitGroup{}
+	// Route ffmpeg through our command builder so it shows up in verbose output
+	switch m := m.(type) {
+	case *merger.FFmpeg:
+		m.Command = app.newCmd
+	case *merger.Auto:
+		m.FFmpeg.Command = app.newCmd
+	}
 
-	// For each entry in input directory...
-	for _, entry := range dirEntries {
+	app.videoMerger = m
 
-		addWG.Add(1)
+	return nil
+}
 
-		// Parse and add entry to list of video entries, store error if any.
-		go func(e fs.DirEntry) {
-			defer addWG.Done()
-			if err := vl.Add(e.Name()); err != nil {
-				log.Warnf("entry %s cannot be added: %v", styleExample.Render(e.Name()), styleError.Render(err.Error()))
-			}
-		}(entry)
+// Merge separated video fragments into a single video file, accounting processes it runs to usage.
+func (vw VideoWhole) merge(usage *jobUsage) error {
 
-	}
+	job := vw.mergeJob()
+	job.Ran = usage.ran
 
-	addWG.Wait()
+	// Show how far along the merge is, for backends that say
+	job.Progress = func(fraction float64) {
+		vw.app.reporter.Progress(vw.Id, "merge", fraction)
+	}
 
-	// Error if no videos to process
-	if len(vl) == 0 {
-		return fmt.Errorf("directory does not contain GoPro-named videos")
+	opts := vw.app.mergeOptions()
+	opts.LinkFailed = func(err error) {
+		vw.logger().Info(locale.Td("LinkFailed", "cannot hard link, copying instead: {{.Error}}", map[string]any{"Error": err.Error()}))
 	}
 
-	return nil
+	return merging.New(opts).Merge(vw.app.runCtx, job)
 }
 
-var videoList = VideoList{}
+// Options of merges as told by the command line.
+func (app *app) mergeOptions() merging.Options {
 
-func rename() error {
+	opts := merging.Options{Backend: app.videoMerger, Preference: strings.Split(app.root.ContainerOrder, ","), Streaming: app.streaming(), Location: app.timeZone}
 
-	renameMessage := "Renaming (Dry Run)"
-	if root.Rename.Commit {
-		renameMessage = "Renaming"
+	if app.root.Merge != nil {
+		opts.Container = app.root.Merge.Container
+		opts.Single = app.root.Merge.Single
 	}
 
-	// Print renaming message
-	fmt.Printf("%s\n\n", renameMessage)
+	return opts
+}
 
-	// Set default renaming action: only print, don't actually rename.
-	renameAction := renameInfo
+// Merger picking containers and merging as told by the command line.
+func (app *app) newMerger() *merging.Merger {
+	return merging.New(app.mergeOptions())
+}
 
-	// Set renaming function to also rename if specified by user
-	if root.Rename.Commit {
-		renameAction = renameActionBuilder(renameInfo, renameCommit)
-	}
+// Remove merges left half-written in output directories by interrupted runs; those still being written by another run are left alone.
+func (app *app) removeStaleParts() error {
 
-	// Run rename action on each video [Fragment]
-	totalFragments := 0
-	for _, vm := range videoList {
-		for _, vf := range vm.Fragments {
-			old := vf.InputPath()
-			new := vf.NewPath()
+	removed, err := merging.RemoveStaleParts([]string{app.outputDir(), filepath.Join(app.outputDir(), app.root.LapseDir)})
 
-			if totalFragments > 0 {
-				fmt.Println()
-			}
+	for _, path := range removed {
+		log.Info(locale.Td("StalePartRemoved", "Removed merge left unfinished by an interrupted run: {{.Name}}", map[string]any{"Name": filepath.Base(path)}))
+	}
 
-			totalFragments++
+	return err
+}
 
-			if err := renameAction(old, new); err != nil {
-				log.Warn("%v", err)
-				continue
-			}
+// Parse and store embedded video [VideoFragment] metadata.
+func (vf *VideoFragment) parseMetadata() error {
 
-		}
+	metadata, ts, err := vf.app.newScanner().Metadata(vf.app.runCtx, vf.InputPath())
+	if errors.Is(err, scan.ErrNoTimestamp) {
+		return errors.New(locale.Td("NoTimestamp", "no creation time found in {{.Sources}}", map[string]any{"Sources": vf.app.root.TimestampSource}))
+	}
+	if err != nil {
+		return err
 	}
 
+	vf.logTimestamp(ts)
+	vf.Metadata = metadata
+
 	return nil
 }
 
-func merge() error {
-
-	for _, vw := range videoList {
-
-		fmt.Printf("merging videos with ID \"%s\"...", vw.Id)
+// Tell how the creation time of [VideoFragment] was found, where it is worth telling.
+func (vf VideoFragment) logTimestamp(ts scan.Timestamp) {
 
-		if err := vw.merge(); err != nil {
-			fmt.Println("error!")
-			log.Warnf("%v", err)
-
-		} else {
-			fmt.Println("done!")
-		}
+	if ts.Source == scan.SourceAssumed {
+		vf.logger().Warn(locale.Td("TimestampAssumed", "no creation time found in {{.Sources}}; assuming {{.Time}}", map[string]any{"Sources": vf.app.root.TimestampSource, "Time": ts.Time.Format(time.RFC3339)}))
+		return
 	}
 
-	return nil
+	for _, r := range ts.Disagreeing() {
+		vf.logger().Warn(locale.Td("TimestampsDisagree", "{{.Other}} says {{.OtherTime}}, {{.Source}} says {{.Time}}; going by {{.Source}}", map[string]any{"Other": r.Source, "OtherTime": r.Time.Format(time.RFC3339), "Source": ts.Source, "Time": ts.Time.Format(time.RFC3339)}))
+	}
 
+	// Falling back is worth telling about; the preferred source only when asked to be verbose
+	if vf.app.root.Verbose || ts.Source != strings.Split(vf.app.root.TimestampSource, ",")[0] {
+		vf.logger().Info(locale.Td("TimestampSource", "creation time {{.Time}} from {{.Source}}", map[string]any{"Time": ts.Time.Format(time.RFC3339), "Source": ts.Source}))
+	}
 }
 
-func Main() {
+// Scanner probing and grouping fragments as told by the command line.
+func (app *app) newScanner() *scan.Scanner {
 
-	log.SetLevel(log.DebugLevel)
+	return scan.New(scan.Options{
+		Sources:     strings.Split(app.root.TimestampSource, ","),
+		TimeOffset:  app.root.TimeOffset,
+		Location:    app.timeZone,
+		AssumedDate: app.assumedDate,
+		RolloverGap: app.root.RolloverGap,
+		Reader:      app.root.MetadataReader,
+		NativeOnly:  app.probeMissing,
+		Cache:       app.probeCache,
+		Jobs:        app.jobs(),
+		Command:     app.newCmd,
+	})
+}
 
-	// Parse options
-	arg.MustParse(&root)
+// Load date given by --assume-date, if any, as wall-clock time in the user's zone.
+func (app *app) loadAssumedDate() error {
 
-	// Post process of command stuff
-	if err := root.PostProcess(); err != nil {
-		log.Errorf("%v", err)
-		return
+	if app.root.AssumeDate == "" {
+		return nil
 	}
 
-	// Parse directory supposedly containing GoPro videos
-	if err := videoList.Parse(); err != nil {
-		log.Errorf("%v", err)
-		return
+	loc := app.timeZone
+	if loc == nil {
+		loc = time.UTC
 	}
 
-	// Rename videos.
-	if root.Rename != nil {
-		if err := rename(); err != nil {
-			log.Errorf("%v", err)
+	t, err := cmd.ParseAssumeDate(app.root.AssumeDate, loc)
+	if err != nil {
+		return err
+	}
+
+	app.assumedDate = t
+
+	return nil
+}
+
+// Load zone given by --timezone or --utc-offset, if any.
+func (app *app) loadTimeZone() error {
+
+	if app.root.Timezone != "" {
+		loc, err := time.LoadLocation(app.root.Timezone)
+		if err != nil {
+			return err
+		}
+		app.timeZone = loc
+	}
+
+	if app.root.UtcOffset != "" {
+		offset, err := parseUtcOffset(app.root.UtcOffset)
+		if err != nil {
+			return err
+		}
+		app.timeZone = time.FixedZone(app.root.UtcOffset, int(offset.Seconds()))
+	}
+
+	return nil
+}
+
+var utcOffset = regexp.MustCompile(`^([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+// Offset from UTC such as "+02:00", "-0530" or "+2".
+func parseUtcOffset(s string) (time.Duration, error) {
+
+	matches := utcOffset.FindStringSubmatch(s)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid UTC offset \"%s\", expected e.g. +02:00", s)
+	}
+
+	hours, _ := strconv.Atoi(matches[2])
+
+	minutes := 0
+	if matches[3] != "" {
+		minutes, _ = strconv.Atoi(matches[3])
+	}
+
+	offset := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+	if matches[1] == "-" {
+		offset = -offset
+	}
+
+	return offset, nil
+}
+
+// Values for naming templates, merging in details from the catalog.
+func (v Video) namingData() naming.Data {
+	return v.app.newRenamer().Data(v.Id, v.Metadata)
+}
+
+// Token values of name layouts, by token name.
+func (v Video) layoutValues(extension string) map[string]any {
+	return map[string]any{"date": v.CreationTimeString(), "id": v.Id, "extension": extension, "codec": v.Codec, "camera": v.Camera}
+}
+
+// [VideoFragment] as [scan] knows fragments.
+func (vf VideoFragment) scanned() scan.Fragment {
+	return scan.Fragment{Id: vf.Id, Index: vf.Index, Extension: vf.Extension, Metadata: vf.Metadata}
+}
+
+// Stock GoPro name of [VideoFragment], e.g. "GX010123.MP4", with the codec letter reconstructed from probed metadata.
+func (vf VideoFragment) rawName() (string, error) {
+
+	name, ok := renamer.StockName(vf.scanned())
+	if !ok {
+		return "", errors.New(locale.Td("NoCodecLetter", "codec \"{{.Codec}}\" has no letter in stock names; probe with ffprobe installed", map[string]any{"Codec": vf.Codec}))
+	}
+
+	return name, nil
+}
+
+// Whether renamed and merged names may stand in for probing, taking their date from the name: renaming by a layout of date, ID and index needs nothing else, and the date is what the name was made from.
+// Merges and the other commands need codecs, durations and picture settings, and some options ask for times read afresh.
+func (app *app) datedByName() bool {
+
+	if app.root.Rename == nil || app.renameTemplate != nil || app.root.Rename.To == "raw" {
+		return false
+	}
+
+	if format.Renamed.Has("codec") || format.Renamed.Has("camera") {
+		return false
+	}
+
+	// Filtering by probed metadata, or asking for times other than those the names were made with
+	if app.root.MinDuration > 0 || app.root.OnlyStarred || app.root.TimeOffset != 0 || app.timeZone != nil {
+		return false
+	}
+
+	source := strings.Split(app.root.TimestampSource, ",")[0]
+
+	return source == scan.SourceContainer || source == scan.SourceStream || source == scan.SourceFilename
+}
+
+// Creation time carried by renamed or merged names; nil for raw names.
+func (app *app) nameDate(name string) *time.Time {
+
+	// Names hold wall-clock time, which is in the user's zone if given
+	date, ok := scan.NameDate(name, app.timeZone)
+	if !ok {
+		return nil
+	}
+
+	return &date
+}
+
+// Parse fragment by its name and embedded metadata.
+func (vf *VideoFragment) Parse() error {
+
+	parsed, err := scan.ParseName(vf.CurrentName)
+	if err != nil {
+		return failure.Wrap(failure.NotGoProFile, err)
+	}
+
+	vf.Id, vf.Index, vf.Extension = parsed.Id, parsed.Index, parsed.Extension
+
+	// Probe results taken elsewhere stand in for probing
+	found, err := vf.fromSnapshot()
+	if err != nil {
+		return err
+	}
+
+	// Simulated names have no file behind them, and without ffprobe there is no way to look inside, so only the name can tell the date
+	if !found && (vf.app.simulating || vf.app.probeless) {
+		vf.CreationTime = vf.app.nameDate(vf.CurrentName)
+	} else if date := vf.app.nameDate(vf.CurrentName); !found && date != nil && vf.app.datedByName() {
+		vf.CreationTime = date
+		vf.TimeSource = scan.SourceFilename
+	} else if !found {
+		if err := vf.parseMetadata(); err != nil {
+			return failure.Wrap(failure.ProbeFailed, err)
+		}
+	}
+
+	// Raw names carry no date, which merged names need
+	if vf.app.probeless && vf.CreationTime == nil {
+		return errors.New(locale.T("NoDateWithoutProbe", "name holds no date and ffprobe is missing; rename with ffprobe installed first"))
+	}
+
+	dir := vf.Dir
+	if dir == "" {
+		dir = vf.app.root.InputDirPath
+	}
+
+	f := vf.scanned()
+	f.Path = filepath.Join(dir, vf.CurrentName)
+
+	name, err := vf.app.newRenamer().Name(f)
+	if errors.Is(err, renamer.ErrNoCodecLetter) {
+		return errors.New(locale.Td("NoCodecLetter", "codec \"{{.Codec}}\" has no letter in stock names; probe with ffprobe installed", map[string]any{"Codec": vf.Codec}))
+	}
+	if err != nil {
+		return err
+	}
+
+	vf.NewName = name
+
+	return nil
+}
+
+// VideoWhole [Video], composed of one or more [VideoFragment]s
+type VideoWhole struct {
+	Video
+	Fragments []VideoFragment // Individual video fragments that, when merged together, create a whole video.
+	Expected  int             // Total expected fragments for merged video.
+	Listed    bool            // Whether Expected comes from the camera's media list rather than the highest index found.
+	Name      string          // Cached name for video merging purposes.
+	UUID      string          // Provenance UUID of the merge under way, given with --provenance.
+}
+
+// Logger prefixing lines with [VideoWhole]'s ID.
+func (vw VideoWhole) logger() *log.Logger {
+	return log.WithPrefix(vw.Id)
+}
+
+// Absolute path to output when merging [VideoWhole].
+func (vw VideoWhole) OutputPath() string {
+
+	if vw.app.root.Merge != nil && vw.app.root.Merge.OutputFilePath != "" {
+		return vw.app.root.Merge.OutputFilePath
+	}
+
+	// Keep sped-up footage apart from real-time footage
+	if vw.Lapse && vw.app.root.LapseDir != "" {
+		return filepath.Join(vw.app.outputDir(), vw.app.root.LapseDir, vw.Name)
+	}
+
+	return filepath.Join(vw.app.outputDir(), vw.Name)
+}
+
+// Container of merged [VideoWhole], as picked by --container, or else the most preferred one fitting its codec; also says why.
+func (vw VideoWhole) container() (string, string) {
+	return vw.app.newMerger().Container(vw.scanned())
+}
+
+// [VideoWhole] as [scan] knows recordings.
+func (vw VideoWhole) scanned() scan.Recording {
+
+	r := scan.Recording{Id: vw.Id, Metadata: vw.Metadata, Fragments: []scan.Fragment{}, Expected: vw.Expected}
+	for _, f := range vw.Fragments {
+		r.Fragments = append(r.Fragments, f.scanned())
+	}
+
+	return r
+}
+
+// Whether merged video goes to stdout instead of a file.
+func (app *app) streaming() bool {
+	return app.root.Merge != nil && app.root.Merge.OutputFilePath == "-"
+}
+
+// Directory holding merged videos for the picked subcommand.
+func (app *app) outputDir() string {
+
+	if app.root.Merge != nil {
+		return app.root.Merge.OutputDirPath
+	}
+
+	if app.root.Upload != nil {
+		return app.root.Upload.MergedDirPath
+	}
+
+	if app.root.Package != nil {
+		return app.root.Package.MergedDirPath
+	}
+
+	if app.root.Preview != nil {
+		return app.root.Preview.MergedDirPath
+	}
+
+	if app.root.Verify != nil {
+		return app.root.Verify.MergedDirPath
+	}
+
+	if app.root.Clean != nil {
+		return app.root.Clean.MergedDirPath
+	}
+
+	if app.root.Trim != nil {
+		return app.root.Trim.MergedDirPath
+	}
+
+	return ""
+}
+
+type VideoList map[string]*VideoWhole
+
+// Number of files probed, or recordings merged, at once.
+func (app *app) jobs() int {
+
+	if app.root.Jobs > 0 {
+		return app.root.Jobs
+	}
+
+	return runtime.NumCPU()
+}
+
+// Key of [Video] in a [VideoList]: its ID and time of creation, so recordings reusing an ID, e.g. after the camera's counter wrapped past 9999, are not merged together.
+// The catalog keeps recordings under the same key.
+func (v Video) key() string {
+	return catalog.Key(v.Id, v.CreationTime)
+}
+
+// Add entry as a new video [VideoFragment] of the video list.
+func (app *app) addVideo(name string) error {
+	return app.addFragment(VideoFragment{Video: Video{app: app}, CurrentName: name})
+}
+
+// Parse and add fragment to list of videos.
+func (app *app) addFragment(f VideoFragment) error {
+
+	if err := f.Parse(); err != nil {
+		return err
+	}
+
+	app.videosMutex.Lock()
+	defer app.videosMutex.Unlock()
+
+	// Fragments sharing an ID are told apart by time once all are added, see [VideoList.group]
+	if _, ok := app.videoList[f.Id]; !ok {
+		app.videoList[f.Id] = &VideoWhole{
+			Video:     Video{Id: f.Id, app: app},
+			Fragments: []VideoFragment{},
+		}
+	}
+
+	app.videoList[f.Id].Fragments = append(app.videoList[f.Id].Fragments, f)
+
+	return nil
+
+}
+
+// Regroup fragments added under their ID into recordings: fragments further apart in time than --rollover-gap are different recordings that happen to share an ID.
+func (app *app) group() {
+
+	fragments := []VideoFragment{}
+	for key, vw := range app.videoList {
+		fragments = append(fragments, vw.Fragments...)
+		delete(app.videoList, key)
+	}
+
+	for _, group := range scan.Split(fragments, VideoFragment.scanned, app.root.RolloverGap) {
+
+		scanned := []scan.Fragment{}
+		for _, f := range group {
+			scanned = append(scanned, f.scanned())
+		}
+		recording := scan.Join(scanned)
+
+		// Mixed variants are warned about before merging
+		merged := &VideoWhole{Video: Video{Id: recording.Id, Metadata: recording.Metadata, app: app}, Fragments: []VideoFragment{}, Expected: recording.Expected}
+		for i, f := range group {
+			f.Metadata = recording.Fragments[i].Metadata
+			merged.Fragments = append(merged.Fragments, f)
+		}
+
+		app.videoList[merged.key()] = merged
+	}
+
+	// A reused ID may surprise, so say how it was told apart
+	collisions := app.videoList.collisions()
+
+	ids := []string{}
+	for id := range collisions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+
+		times := []string{}
+		for _, vw := range collisions[id] {
+			times = append(times, vw.CreationTime.Format("2006-01-02 15:04"))
+		}
+
+		log.Warn(locale.Td("IdCollision", "ID {{.Id}} is shared by recordings made {{.Times}}, as after formatting the card or the counter wrapping past 9999; merging each on its own", map[string]any{"Id": id, "Times": strings.Join(times, ", ")}))
+	}
+
+}
+
+// Recordings of list sharing their ID with another, by ID, oldest first.
+func (vl VideoList) collisions() map[string][]*VideoWhole {
+
+	byId := map[string][]*VideoWhole{}
+	for _, vw := range vl.ordered("oldest-first") {
+		byId[vw.Id] = append(byId[vw.Id], vw)
+	}
+
+	for id, videos := range byId {
+		if len(videos) < 2 {
+			delete(byId, id)
+		}
+	}
+
+	return byId
+}
+
+// Move catalog entries kept under bare IDs, as by earlier versions, to the keys of [VideoList]'s recordings.
+// Of recordings sharing an ID, only the one whose fragments were merged into an entry takes it.
+func (app *app) migrateCatalog() {
+
+	collisions := app.videoList.collisions()
+
+	for _, vw := range app.videoList {
+		vw := vw
+		app.videoCatalog.Migrate(vw.key(), func(r *catalog.Recording) bool {
+			return len(collisions[vw.Id]) == 0 || vw.mergedInto(r.Merge)
+		})
+	}
+}
+
+// Whether merge was made of [VideoWhole]'s fragments, going by their names.
+func (vw VideoWhole) mergedInto(m *catalog.Merge) bool {
+
+	if m == nil {
+		return false
+	}
+
+	for _, path := range m.Fragments {
+		for _, f := range vw.Fragments {
+			if filepath.Base(path) == f.CurrentName {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ID of [VideoWhole] with its time of creation, if known, e.g. "0042 (2024-05-01 10:00)".
+func (vw VideoWhole) label() string {
+
+	if vw.CreationTime == nil {
+		return vw.Id
+	}
+
+	return vw.Id + " (" + vw.CreationTime.Format("2006-01-02 15:04") + ")"
+}
+
+// Error if two recordings of list would be merged into the same file, as when a name template leaves out the date of recordings sharing an ID.
+func (vl VideoList) checkNames() error {
+
+	owners := map[string]*VideoWhole{}
+
+	for _, vw := range vl.ordered("oldest-first") {
+
+		if other, ok := owners[vw.Name]; ok {
+			return errors.New(locale.Td("NameCollision", "recordings {{.First}} and {{.Second}} would both be merged into {{.Name}}; put the date in --name-template to tell them apart", map[string]any{"First": other.label(), "Second": vw.label(), "Name": vw.Name}))
+		}
+
+		owners[vw.Name] = vw
+	}
+
+	return nil
+}
+
+// Whether no other recording in video list was created on the same day as [VideoWhole].
+func (vw VideoWhole) aloneOnDay() bool {
+
+	if vw.CreationTime == nil {
+		return false
+	}
+
+	day := vw.CreationTime.Format("2006-01-02")
+
+	for _, other := range vw.app.videoList {
+		if other.Id != vw.Id && other.CreationTime != nil && other.CreationTime.Format("2006-01-02") == day {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Name merged output of [VideoWhole], once all of its [VideoFragment]s are known.
+func (vw *VideoWhole) nameOutput() error {
+
+	ctr, reason := vw.container()
+	extension := merging.ContainerExtensions[ctr]
+
+	if vw.app.root.Verbose {
+		log.Info(locale.Td("ContainerPicked", "Recording {{.Id}} goes into {{.Container}}: {{.Reason}}", map[string]any{"Id": vw.Id, "Container": ctr, "Reason": reason}))
+	}
+
+	name := ""
+	switch {
+	case vw.app.mergeTemplate == nil && format.MergedNoId != nil && vw.aloneOnDay():
+		name = format.MergedNoId.Format(vw.layoutValues(extension))
+	case vw.app.mergeTemplate == nil:
+		name = format.Merged.Format(vw.layoutValues(extension))
+	default:
+		d := vw.namingData()
+		d.Extension = extension
+
+		var err error
+		if name, err = vw.app.mergeTemplate.Execute(d); err != nil {
+			return err
+		}
+	}
+
+	vw.Name = vw.app.newRenamer().SafeName(name, vw.app.outputDir())
+
+	// Commands working on earlier merges find them where they are, whatever container is picked now
+	if vw.app.root.Merge == nil && vw.app.outputDir() != "" {
+		vw.Name = vw.existingName()
+	}
+
+	return nil
+}
+
+// Name of [VideoWhole]'s merged video as found on disk, as earlier merges may have gone into another container than picked now:
+// the name picked, else the one the catalog recorded for the merge, else the name picked with the extension of another container; the name picked if none is there.
+func (vw VideoWhole) existingName() string {
+
+	dir := filepath.Dir(vw.OutputPath())
+	stem := strings.TrimSuffix(vw.Name, filepath.Ext(vw.Name))
+
+	candidates := []string{vw.Name}
+
+	if r := vw.app.videoCatalog.Lookup(vw.key()); r != nil && r.Merge != nil {
+		candidates = append(candidates, filepath.Base(r.Merge.Output))
+	}
+
+	// Sorted so the same file is found every run
+	extensions := []string{}
+	for _, extension := range merging.ContainerExtensions {
+		extensions = append(extensions, extension)
+	}
+	sort.Strings(extensions)
+
+	for _, extension := range extensions {
+		candidates = append(candidates, stem+"."+extension)
+	}
+
+	for _, name := range candidates {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return name
+		}
+	}
+
+	return vw.Name
+}
+
+// Print what will be renamed.
+func (app *app) renameInfo(old string, new string) error {
+
+	// Label each path on its own line, instead of relying on layout
+	if app.root.Plain {
+		fmt.Printf("%s: %s\n%s: %s\n", locale.T("RenameFrom", "From"), old, locale.T("RenameTo", "To"), new)
+		return nil
+	}
+
+	fmt.Printf("%4s\n%s\n%4s\n%s\n", styleBold.Render(locale.T("RenameFrom", "From")), old, styleBold.Render(locale.T("RenameTo", "To")), styleDestination.Render(new))
+
+	return nil
+}
+
+// Rename action of renamer, renaming old file into new file.
+func (app *app) renameCommit(r *renamer.Renamer) func(old string, new string) error {
+	return func(old string, new string) error {
+		return r.Rename(app.runCtx, old, new)
+	}
+}
+
+// Renamer naming and renaming fragments as told by the command line.
+func (app *app) newRenamer() *renamer.Renamer {
+
+	return renamer.New(renamer.Options{
+		Template: app.renameTemplate,
+		Raw:      app.root.Rename != nil && app.root.Rename.To == "raw",
+		Catalog:  app.videoCatalog,
+		Copy:     app.root.CopyDirPath != "",
+		SMB:      app.smb,
+		Retries:  app.root.SmbRetries,
+		Timeout:  app.root.SmbTimeout,
+		WSL:      app.wsl,
+		Cache:    app.probeCache,
+		Journal:  app.journalled,
+	})
+}
+
+// Load journal from directory receiving stopcon's files.
+func (app *app) openJournal() error {
+
+	j, err := journal.Open(filepath.Join(app.stateDir(), journal.FileName))
+	if err != nil {
+		return err
+	}
+
+	app.runJournal = j
+
+	return nil
+}
+
+// Record change in journal, beginning this run with the first one; a journal that cannot be written does not stop the change.
+func (app *app) journalled(kind string, from string, to string) {
+
+	if !app.journalBegun {
+		app.runJournal.Begin(os.Args[1:])
+		app.journalBegun = true
+	}
+
+	if err := app.runJournal.Record(journal.Entry{Kind: kind, From: from, To: to}); err != nil {
+		log.Warn(locale.Td("JournalNotWritten", "Cannot write journal, this change cannot be undone: {{.Error}}", map[string]any{"Error": styleError.Render(err.Error())}))
+	}
+}
+
+// Reverse changes of latest run in the journal, newest first.
+func (app *app) undo() error {
+
+	run := app.runJournal.Last()
+	if run == nil {
+		return errors.New(locale.T("NothingToUndo", "nothing to undo"))
+	}
+
+	undoMessage := locale.T("UndoingDryRun", "Undoing (Dry Run)")
+	if app.committing(app.root.Undo.Commit) {
+		undoMessage = locale.T("Undoing", "Undoing")
+	}
+
+	fmt.Printf("%s: %s, stopcon %s\n\n", undoMessage, run.Started.Format("2006-01-02 15:04:05"), strings.Join(run.Args, " "))
+
+	failed := 0
+
+	for i := len(run.Entries) - 1; i >= 0; i-- {
+
+		e := run.Entries[i]
+		var err error
+
+		switch e.Kind {
+
+		case journal.Rename:
+
+			// Already undone by an earlier, interrupted undo
+			if _, statErr := os.Stat(e.To); errors.Is(statErr, fs.ErrNotExist) {
+				if _, statErr := os.Stat(e.From); statErr == nil {
+					continue
+				}
+			}
+
+			fmt.Printf("%s\n  %s\n%s\n\n", e.To, locale.T("RenameTo", "To"), styleDestination.Render(e.From))
+
+			if app.committing(app.root.Undo.Commit) {
+				if _, statErr := os.Stat(e.From); statErr == nil {
+					err = errors.New(locale.Td("UndoTargetExists", "{{.Path}} already exists", map[string]any{"Path": e.From}))
+				} else {
+					err = os.Rename(e.To, e.From)
+				}
+			}
+
+		case journal.Copy, journal.Merge:
+
+			fmt.Printf("%s %s\n\n", locale.T("UndoRemove", "Remove"), styleDestination.Render(e.To))
+
+			if app.committing(app.root.Undo.Commit) {
+				if err = os.Remove(e.To); errors.Is(err, fs.ErrNotExist) {
+					err = nil
+				}
+			}
+
+		}
+
+		if err != nil {
+			failed++
+			log.Warnf("%v", err)
+		}
+
+	}
+
+	if !app.committing(app.root.Undo.Commit) {
+		return nil
+	}
+
+	// Keep the run, so undoing again picks up what is left
+	if failed > 0 {
+		return errors.New(locale.Td("UndoIncomplete", "{{.Count}} changes could not be undone; run them again once fixed", map[string]any{"Count": failed}))
+	}
+
+	if !app.root.Undo.Keep {
+		app.runJournal.Pop()
+	}
+
+	return app.runJournal.Save()
+}
+
+// Whether a subcommand's --commit takes effect, i.e. was given and not overridden by --dry-run.
+func (app *app) committing(commit bool) bool {
+	return commit && !app.root.DryRun
+}
+
+// Copy input directory into a writable staging directory if it is read-only and renaming would write to it.
+func (app *app) stageReadOnly() error {
+
+	// Only committed renames write into the input directory, and never in copy mode or to explicitly given files
+	if app.root.Rename == nil || !app.committing(app.root.Rename.Commit) || app.root.CopyDirPath != "" || len(app.explicitFiles()) > 0 {
+		return nil
+	}
+
+	writable, err := utils.IsWritable(app.root.InputDirPath)
+	if err != nil || writable {
+		return err
+	}
+
+	staging := app.root.StagingDirPath
+	if staging == "" {
+		if staging, err = os.MkdirTemp("", "stopcon-staging-"); err != nil {
+			return err
+		}
+	}
+
+	log.Warn(locale.Td("ReadOnlyStaging", "Input directory is read-only, copying to {{.Dir}} first", map[string]any{"Dir": styleDestination.Render(staging)}))
+
+	if err := utils.CopyDir(app.root.InputDirPath, staging); err != nil {
+		return err
+	}
+
+	// Continue as if staging were the input directory
+	app.root.InputDirPath = staging
+
+	return nil
+}
+
+// Decide whether input directory should be handled as an SMB share.
+// Take up WSL interop if asked, or if running under WSL: Windows paths given on the command line are translated to their mounts.
+func (app *app) detectWSL() {
+
+	switch app.root.WslMode {
+	case "on":
+		app.wsl = true
+	case "off":
+		app.wsl = false
+	default:
+		app.wsl = utils.IsWSL()
+	}
+
+	if app.wsl {
+		app.root.MapPaths(utils.FromWindowsPath)
+	}
+}
+
+func (app *app) detectSMB() error {
+
+	switch app.root.SmbMode {
+	case "on":
+		app.smb = true
+		return nil
+	case "off":
+		app.smb = false
+		return nil
+	}
+
+	isSMB, err := utils.IsSMB(app.root.InputDirPath)
+	if err != nil {
+		return err
+	}
+
+	if isSMB {
+		log.Info(locale.T("SMBDetected", "Input directory is on an SMB share, renaming by copy and delete"))
+	}
+
+	app.smb = isSMB
+
+	return nil
+}
+
+func renameActionBuilder(actionList ...func(old string, new string) error) func(old string, new string) error {
+	return func(old, new string) error {
+
+		if old == new {
+
+			log.Info(locale.Td("AlreadyRenamed", "Already renamed: {{.Name}}", map[string]any{"Name": old}))
+
+			return nil
+		}
+
+		for _, action := range actionList {
+			if err := action(old, new); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// Entries of input directory holding complete files, skipping placeholders and files still being written.
+func (app *app) discover() ([]fs.DirEntry, error) {
+
+	// Archived files are complete and unchanging, so only hidden files need skipping
+	if app.inputArchive != nil {
+
+		entries := []fs.DirEntry{}
+		for _, entry := range app.inputArchive.Entries() {
+			if app.root.IncludeHidden || !utils.IsSystemFile(entry.Name()) {
+				entries = append(entries, entry)
+			}
+		}
+
+		return app.policed(entries), nil
+	}
+
+	sizes := map[string]int64{}
+	complete := []fs.DirEntry{}
+
+	for _, base := range app.inputDirs() {
+
+		// Patterns of files the user never wants processed
+		ignored, err := ignore.Load(filepath.Join(base, ignore.FileName))
+		if err != nil {
+			return nil, err
+		}
+
+		dirs, err := app.scanDirs(base, ignored)
+		if err != nil {
+			return nil, err
+		}
+
+		found, err := app.discoverDirs(base, dirs, ignored, sizes)
+		if err != nil {
+			return nil, err
+		}
+
+		complete = append(complete, found...)
+
+	}
+
+	app.saveListings()
+
+	if app.root.SettleTime <= 0 || len(complete) == 0 {
+		return app.policed(complete), nil
+	}
+
+	// Wait, then skip files whose size changed in the meantime
+	time.Sleep(app.root.SettleTime)
+
+	paths := make([]string, len(complete))
+	for i, entry := range complete {
+		paths[i] = app.entryPath(entry)
+	}
+
+	// Files may also be held open by a writer that is momentarily stalled
+	writing, err := utils.OpenForWriting(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	stable := []fs.DirEntry{}
+	for i, entry := range complete {
+
+		info, err := os.Stat(paths[i])
+		if err != nil || info.Size() != sizes[paths[i]] || writing[paths[i]] {
+			log.Info(locale.Td("SkipGrowing", "Skipping file still being written: {{.Name}}", map[string]any{"Name": entry.Name()}))
+			continue
+		}
+
+		stable = append(stable, entry)
+
+	}
+
+	return app.policed(stable), nil
+}
+
+// Complete entries of dirs found below input directory base, noting their sizes.
+func (app *app) discoverDirs(base string, dirs []string, ignored *ignore.Matcher, sizes map[string]int64) ([]fs.DirEntry, error) {
+
+	complete := []fs.DirEntry{}
+
+	for _, dir := range dirs {
+
+		dirEntries, err := app.readDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip sync temporaries and cloud placeholders outright
+		for _, entry := range dirEntries {
+
+			if entry.Name() == ignore.FileName || ignored.Match(relPath(base, filepath.Join(dir, entry.Name())), entry.IsDir()) {
+				continue
+			}
+
+			// Hidden files and OS artifacts are never recordings, so skip them quietly
+			if !app.root.IncludeHidden && utils.IsSystemFile(entry.Name()) {
+				continue
+			}
+
+			// Directories worth scanning were found already, including linked ones
+			if app.root.Recursive && (entry.IsDir() || entry.Type()&fs.ModeSymlink != 0) {
+				if info, err := os.Stat(filepath.Join(dir, entry.Name())); err == nil && info.IsDir() {
+					continue
+				}
+			}
+
+			if dir != app.root.InputDirPath {
+				entry = nestedEntry{DirEntry: entry, dir: dir}
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				log.Warn(locale.Td("EntryUnreadable", "entry {{.Name}} cannot be read: {{.Error}}", map[string]any{"Name": styleExample.Render(entry.Name()), "Error": styleError.Render(err.Error())}))
+				continue
+			}
+
+			if utils.IsPlaceholder(info) {
+				log.Info(locale.Td("SkipIncomplete", "Skipping incomplete file: {{.Name}}", map[string]any{"Name": entry.Name()}))
+				continue
+			}
+
+			sizes[app.entryPath(entry)] = info.Size()
+			complete = append(complete, entry)
+
+		}
+
+	}
+
+	return complete, nil
+}
+
+// Entries left to process once policies are carried out; only settled files are acted upon.
+func (app *app) policed(entries []fs.DirEntry) []fs.DirEntry {
+
+	kept := []fs.DirEntry{}
+
+	for _, entry := range entries {
+		if entry.IsDir() || app.applyPolicy(app.entryDir(entry), entry.Name()) {
+			kept = append(kept, entry)
+		}
+	}
+
+	return kept
+}
+
+// Entry of a directory other than the first input directory, e.g. another --input-dir or one below it found with --recursive.
+type nestedEntry struct {
+	fs.DirEntry
+	dir string
+}
+
+// Directory holding discovered entry.
+func (app *app) entryDir(entry fs.DirEntry) string {
+
+	if nested, ok := entry.(nestedEntry); ok {
+		return nested.dir
+	}
+
+	return app.root.InputDirPath
+}
+
+// "/"-separated path relative to input directory base, as ignore patterns match against.
+func relPath(base string, path string) string {
+
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return filepath.Base(path)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// Path of discovered entry.
+func (app *app) entryPath(entry fs.DirEntry) string {
+	return filepath.Join(app.entryDir(entry), entry.Name())
+}
+
+// Each input directory given, first one first.
+func (app *app) inputDirs() []string {
+
+	if len(app.root.InputDirPaths) == 0 {
+		return []string{app.root.InputDirPath}
+	}
+
+	return app.root.InputDirPaths
+}
+
+// Input directory base and, with --recursive, directories below it up to --max-depth levels deep, e.g. DCIM/100GOPRO.
+// Hidden and ignored directories are skipped, as are directories stopcon writes into and, unless followed, symbolic links.
+func (app *app) scanDirs(base string, ignored *ignore.Matcher) ([]string, error) {
+
+	dirs := []string{base}
+
+	if !app.root.Recursive {
+		return dirs, nil
+	}
+
+	// Merged videos and copies would otherwise be picked up as fragments
+	skipped := map[string]bool{}
+	for _, dir := range []string{app.root.CopyDirPath, app.outputDir(), filepath.Join(app.outputDir(), app.root.LapseDir), app.quarantineDir()} {
+		if abs, err := filepath.Abs(dir); dir != "" && err == nil {
+			skipped[abs] = true
+		}
+	}
+
+	// Real paths of directories scanned so far, so linked loops are walked once
+	seen := map[string]bool{}
+
+	var walk func(dir string, depth int)
+	walk = func(dir string, depth int) {
+
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil || seen[real] {
+			return
+		}
+		seen[real] = true
+
+		if depth > 0 {
+			dirs = append(dirs, dir)
+		}
+
+		if depth >= app.root.MaxDepth {
+			return
+		}
+
+		_, names, err := app.listDir(dir)
+		if err != nil {
+			log.Warn(locale.Td("EntryUnreadable", "entry {{.Name}} cannot be read: {{.Error}}", map[string]any{"Name": styleExample.Render(dir), "Error": styleError.Render(err.Error())}))
+			return
+		}
+
+		for _, name := range names {
+
+			path := filepath.Join(dir, name)
+
+			if (!app.root.IncludeHidden && utils.IsSystemFile(name)) || ignored.Match(relPath(base, path), true) {
+				continue
+			}
+
+			entry, err := os.Lstat(path)
+			if err != nil {
+				continue
+			}
+
+			isDir := entry.IsDir()
+
+			// Links on Windows drives are mostly junctions Windows keeps for compatibility, which loop or deny access
+			if entry.Mode()&fs.ModeSymlink != 0 && app.root.FollowSymlinks && !(app.wsl && utils.OnWindowsDrive(path)) {
+				info, err := os.Stat(path)
+				isDir = err == nil && info.IsDir()
+			}
+
+			if abs, err := filepath.Abs(path); !isDir || err != nil || skipped[abs] {
+				continue
+			}
+
+			walk(path, depth+1)
+
+		}
+	}
+
+	walk(base, 0)
+
+	return dirs, nil
+}
+
+// Names of entries of directory at path, and of those among them that are directories or links that may lead to one.
+// Unchanged directories are taken from the manifest instead of being read again, so repeat scans of large trees only read directories that changed.
+func (app *app) listDir(path string) ([]string, []string, error) {
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if d, ok := app.videoManifest.Listing(abs, info); ok {
+		return d.Entries, d.Subdirs, nil
+	}
+
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := []string{}
+	subdirs := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+		if entry.IsDir() || entry.Type()&fs.ModeSymlink != 0 {
+			subdirs = append(subdirs, entry.Name())
+		}
+	}
+
+	app.videoManifest.StoreDir(abs, info, names, subdirs)
+	app.listingsChanged = true
+
+	return names, subdirs, nil
+}
+
+// Entries of directory dir, sorted by name, listed by [listDir]; entries gone since they were listed are left out.
+func (app *app) readDir(dir string) ([]fs.DirEntry, error) {
+
+	names, _, err := app.listDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []fs.DirEntry{}
+	for _, name := range names {
+		if info, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+			entries = append(entries, fs.FileInfoToDirEntry(info))
+		}
+	}
+
+	return entries, nil
+}
+
+// Save directory listings learned by discovery for the next run, unless nothing changed or this run is a preview.
+// A dry run or rename without --commit leaves every file alone, and discovery works without the manifest.
+func (app *app) saveListings() {
+
+	if !app.listingsChanged || app.root.DryRun || (app.root.Rename != nil && !app.root.Rename.Commit) {
+		return
+	}
+
+	if err := app.videoManifest.Save(); err != nil {
+		log.Warnf("%v", err)
+	}
+
+	app.listingsChanged = false
+}
+
+// Discover and parse fragments into the video list, grouped into recordings.
+func (app *app) parseVideos() error {
+
+	fragments := []VideoFragment{}
+
+	if files := app.explicitFiles(); len(files) > 0 {
+
+		for _, file := range files {
+			fragments = append(fragments, VideoFragment{Video: Video{app: app}, CurrentName: filepath.Base(file), Dir: filepath.Dir(file)})
+		}
+
+	} else {
+
+		dirEntries, err := app.discover()
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range dirEntries {
+
+			// Nested files are renamed where they are, like explicitly given ones
+			f := VideoFragment{Video: Video{app: app}, CurrentName: entry.Name()}
+			if nested, ok := entry.(nestedEntry); ok {
+				f.Dir = nested.dir
+			}
+
+			fragments = append(fragments, f)
+
+		}
+
+	}
+
+	addWG := sync.WaitGroup{}
+	queue := make(chan VideoFragment)
+
+	// First entry that could not be added, for strict mode
+	var strictErr error
+	strictOnce := sync.Once{}
+
+	// Probe a bounded number of entries at once, so a big card dump does not start an ffprobe per file
+	for i := 0; i < app.jobs(); i++ {
+
+		addWG.Add(1)
+
+		// Parse and add entry to list of video entries, store error if any.
+		go func() {
+			defer addWG.Done()
+
+			for f := range queue {
+
+				// Left for the next run once interrupted
+				if app.runCtx.Err() != nil {
+					continue
+				}
+
+				err := app.addFragment(f)
+				if err == nil || app.runCtx.Err() != nil {
+					continue
+				}
+
+				if app.root.Strict {
+					strictOnce.Do(func() {
+						strictErr = failure.Wrap(failure.ClassOf(err), errors.New(locale.Td("EntryNotAdded", "entry {{.Name}} cannot be added: {{.Error}}", map[string]any{"Name": f.CurrentName, "Error": err.Error()})))
+					})
+					continue
+				}
+
+				// Input directories hold all sorts of files besides videos; only those that are videos but could not be read fail the run
+				if failure.ClassOf(err) != failure.NotGoProFile {
+					app.recordFailure(err)
+				}
+
+				log.Warn(locale.Td("EntryNotAdded", "entry {{.Name}} cannot be added: {{.Error}}", map[string]any{"Name": styleExample.Render(f.CurrentName), "Error": styleError.Render(err.Error())}))
+			}
+		}()
+
+	}
+
+	// For each entry in input directory...
+	for _, fragment := range fragments {
+		queue <- fragment
+	}
+
+	close(queue)
+	addWG.Wait()
+
+	if app.runCtx.Err() != nil {
+		return interrupted()
+	}
+
+	if strictErr != nil {
+		return strictErr
+	}
+
+	app.group()
+	app.migrateCatalog()
+
+	if err := app.reconcileChapters(); err != nil {
+		return err
+	}
+
+	// Error if no videos to process
+	if len(app.videoList) == 0 {
+		return errors.New(locale.T("NoVideos", "directory does not contain GoPro-named videos"))
+	}
+
+	// For each video...
+	for id, vw := range app.videoList {
+
+		// Drop if user only wants starred recordings
+		if app.root.OnlyStarred && !vw.namingData().Starred {
+			delete(app.videoList, id)
+			continue
+		}
+
+		// Drop if too short or outside the age window
+		if reason := vw.filtered(); reason != "" {
+			log.Info(locale.Td("Filtered", "Skipping recording {{.Id}}: {{.Reason}}", map[string]any{"Id": vw.Id, "Reason": reason}))
+			delete(app.videoList, id)
+			continue
+		}
+
+		// Fragments were added concurrently, so put them back in chapter order
+		sort.SliceStable(vw.Fragments, func(i, j int) bool {
+			return vw.Fragments[i].Index < vw.Fragments[j].Index
+		})
+
+		if err := vw.nameOutput(); err != nil {
+			return err
+		}
+
+	}
+
+	// Error if filtering left nothing to process
+	if len(app.videoList) == 0 && app.root.OnlyStarred {
+		return errors.New(locale.T("NoStarredVideos", "directory does not contain starred videos"))
+	}
+
+	if len(app.videoList) == 0 {
+		return errors.New(locale.T("NoFilteredVideos", "filters left no videos to process"))
+	}
+
+	if err := app.videoList.checkNames(); err != nil {
+		return err
+	}
+
+	for _, vw := range app.videoList.ordered("date") {
+		r := report.Recording{Id: vw.Id, Fragments: len(vw.Fragments), Duration: vw.duration().Seconds()}
+		if vw.CreationTime != nil {
+			r.Created = *vw.CreationTime
+		}
+		app.reporter.Discovered(r)
+	}
+
+	return nil
+}
+
+// Path of media list recording which chapters the camera held.
+func (app *app) mediaListPath() string {
+
+	if app.root.MediaListPath != "" {
+		return app.root.MediaListPath
+	}
+
+	// An archive cannot hold one, so look beside it
+	if app.inputArchive != nil {
+		return filepath.Join(filepath.Dir(app.root.InputDirPath), medialist.FileName)
+	}
+
+	return filepath.Join(app.root.InputDirPath, medialist.FileName)
+}
+
+// Take expected chapter counts from the camera's media list, so chapters missing at the end are noticed too.
+func (app *app) reconcileChapters() error {
+
+	list, err := medialist.Load(app.mediaListPath())
+	if err != nil {
+		return err
+	}
+
+	recordings := list.Recordings()
+
+	for _, vw := range app.videoList {
+
+		created := time.Time{}
+		if vw.CreationTime != nil {
+			created = *vw.CreationTime
+		}
+
+		r, ok := medialist.Find(recordings, vw.Id, created)
+		if !ok {
+			continue
+		}
+
+		vw.Listed = true
+		if r.Chapters > vw.Expected {
+			vw.Expected = r.Chapters
+		}
+
+	}
+
+	return nil
+}
+
+func (app *app) rename() error {
+
+	renameMessage := locale.T("RenamingDryRun", "Renaming (Dry Run)")
+	if app.committing(app.root.Rename.Commit) {
+		renameMessage = locale.T("Renaming", "Renaming")
+	}
+
+	// Print renaming message
+	fmt.Printf("%s\n\n", renameMessage)
+
+	// Set default renaming action: only print, don't actually rename.
+	renameAction := app.renameInfo
+
+	// Set renaming function to also rename if specified by user
+	if app.committing(app.root.Rename.Commit) {
+		renameAction = renameActionBuilder(app.renameInfo, app.renameCommit(app.newRenamer()))
+	}
+
+	// Run rename action on each video [Fragment]
+	totalFragments := 0
+	for _, vm := range app.videoList {
+		for i, vf := range vm.Fragments {
+
+			if app.runCtx.Err() != nil {
+				return interrupted()
+			}
+
+			old := vf.InputPath()
+			new := vf.NewPath()
+
+			if totalFragments > 0 {
+				fmt.Println()
+			}
+
+			totalFragments++
+
+			if err := renameAction(old, new); err != nil {
+				log.Warn("%v", err)
+				continue
+			}
+
+			if app.root.Rename.SetMtime && app.committing(app.root.Rename.Commit) {
+				if err := vm.stampChapter(i, new); err != nil {
+					vf.logger().Warnf("%v", err)
+				}
+			}
+
+		}
+	}
+
+	return nil
+}
+
+// Set modification time of file at path, the i-th fragment of [VideoWhole], to when that chapter started: the recording's creation time plus the length of chapters before it, so chapters sort in order.
+func (vw VideoWhole) stampChapter(i int, path string) error {
+
+	if vw.CreationTime == nil {
+		return nil
+	}
+
+	start := *vw.CreationTime
+	for _, f := range vw.Fragments[:i] {
+		start = start.Add(f.Duration)
+	}
+
+	return merging.Stamp(path, start, vw.app.timeZone)
+}
+
+// Indices of fragments missing from [VideoWhole], up to the highest index found.
+func (vw VideoWhole) missing() []int {
+	return vw.scanned().Missing()
+}
+
+// Distinct picture variants of a [VideoWhole]'s fragments, "sdr" standing in for the plain one.
+func (vw VideoWhole) variants() []string {
+
+	seen := map[string]bool{}
+	variants := []string{}
+
+	for _, f := range vw.Fragments {
+
+		v := f.Variant
+		if v == "" {
+			v = "sdr"
+		}
+
+		if !seen[v] {
+			seen[v] = true
+			variants = append(variants, v)
+		}
+
+	}
+
+	sort.Strings(variants)
+
+	return variants
+}
+
+// Codec, size and frame rate of [VideoFragment]'s picture, e.g. "hevc 3840x2160 59.94fps"; empty if not probed.
+func (vf VideoFragment) picture() string {
+
+	if vf.Codec == "" || vf.Width == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s %dx%d %sfps", vf.Codec, vf.Width, vf.Height, strconv.FormatFloat(frameRate(vf.FrameRate), 'f', -1, 64))
+}
+
+// Frames per second of fraction s, e.g. 59.94 for "60000/1001", rounded to two decimals; 0 if unparseable.
+func frameRate(s string) float64 {
+
+	num, den, found := strings.Cut(s, "/")
+	if !found {
+		den = "1"
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+
+	return math.Round(n/d*100) / 100
+}
+
+// Error listing pictures of [VideoWhole]'s fragments if they differ, as after changing settings mid-session under a reused ID; joining those without re-encoding breaks playback.
+func (vw VideoWhole) checkPictures() error {
+
+	first := vw.Fragments[0].picture()
+	differ := false
+
+	for _, f := range vw.Fragments[1:] {
+		if p := f.picture(); p != "" && first != "" && p != first {
+			differ = true
+		}
+	}
+
+	if !differ {
+		return nil
+	}
+
+	pictures := []string{}
+	for _, f := range vw.Fragments {
+		pictures = append(pictures, fmt.Sprintf("%s: %s", f.CurrentName, f.picture()))
+	}
+
+	return errors.New(locale.Td("MismatchedPictures", "recording {{.Id}} joins fragments recorded with different settings ({{.Pictures}}); merge with --mismatched transcode to re-encode them alike", map[string]any{"Id": vw.Id, "Pictures": strings.Join(pictures, ", ")}))
+}
+
+// Position of first fragment of [VideoWhole] repeating the chapter before it, or 0 if none does; fragments must already be sorted by index.
+func (vw VideoWhole) duplicateChapter() int {
+
+	for i := 1; i < len(vw.Fragments); i++ {
+		if vw.Fragments[i].Index == vw.Fragments[i-1].Index {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// Error if chapters of [VideoWhole] are not numbered 1, 2, 3 and so on, as when one is missing or present twice.
+// Fragments must already be sorted by index.
+func (vw VideoWhole) checkChapters() error {
+
+	if i := vw.duplicateChapter(); i > 0 {
+		return failure.Wrap(failure.MissingChapter, errors.New(locale.Td("DuplicateChapter", "recording {{.Id}} has part {{.Index}} twice: {{.First}} and {{.Second}}", map[string]any{"Id": vw.Id, "Index": vw.Fragments[i].Index, "First": vw.Fragments[i-1].CurrentName, "Second": vw.Fragments[i].CurrentName})))
+	}
+
+	if missing := vw.missing(); len(missing) > 0 {
+		return failure.Wrap(failure.MissingChapter, errors.New(locale.Td("MissingChapters", "recording {{.Id}} is missing parts {{.Missing}}", map[string]any{"Id": vw.Id, "Missing": fmt.Sprint(missing)})))
+	}
+
+	return nil
+}
+
+// Total size in bytes of a [VideoWhole]'s fragments.
+func (vw VideoWhole) size() int64 {
+
+	total := int64(0)
+	for _, f := range vw.Fragments {
+		if info, err := os.Stat(f.InputPath()); err == nil {
+			total += info.Size()
+		}
+	}
+
+	return total
+}
+
+// Videos of list sorted by order, one of "smallest-first", "newest-first" or "oldest-first".
+func (vl VideoList) ordered(order string) []*VideoWhole {
+
+	videos := make([]*VideoWhole, 0, len(vl))
+	for _, vw := range vl {
+		videos = append(videos, vw)
+	}
+
+	// Time of video, treating unknown as oldest
+	created := func(vw *VideoWhole) time.Time {
+		if vw.CreationTime == nil {
+			return time.Time{}
+		}
+		return *vw.CreationTime
+	}
+
+	// Cache sizes, as each one needs a stat per fragment
+	sizes := map[*VideoWhole]int64{}
+	if order == "smallest-first" {
+		for _, vw := range videos {
+			sizes[vw] = vw.size()
+		}
+	}
+
+	sort.SliceStable(videos, func(i, j int) bool {
+		switch order {
+		case "smallest-first":
+			return sizes[videos[i]] < sizes[videos[j]]
+		case "newest-first":
+			return created(videos[i]).After(created(videos[j]))
+		default:
+			return created(videos[i]).Before(created(videos[j]))
+		}
+	})
+
+	return videos
+}
+
+// Total duration of fragments, as probed; zero if they were not.
+func (vw VideoWhole) duration() time.Duration {
+
+	total := time.Duration(0)
+	for _, f := range vw.Fragments {
+		total += f.Duration
+	}
+
+	return total
+}
+
+// Reason [VideoWhole] is left out by discovery filters, or empty if it is kept; recordings not probed are kept, as nothing tells otherwise.
+func (vw VideoWhole) filtered() string {
+
+	if d := vw.duration(); vw.app.root.MinDuration > 0 && d > 0 && d < vw.app.root.MinDuration {
+		return locale.Td("FilteredShort", "{{.Duration}} long, shorter than --min-duration", map[string]any{"Duration": d.Round(time.Second)})
+	}
+
+	if vw.CreationTime == nil {
+		return ""
+	}
+
+	age := time.Since(*vw.CreationTime)
+
+	if vw.app.root.MaxAge > 0 && age > vw.app.root.MaxAge {
+		return locale.Td("FilteredOld", "recorded {{.Date}}, longer ago than --max-age", map[string]any{"Date": vw.CreationTime.Format("2006-01-02")})
+	}
+
+	if vw.app.root.MinAge > 0 && age < vw.app.root.MinAge {
+		return locale.Td("FilteredNew", "recorded {{.Date}}, more recently than --min-age", map[string]any{"Date": vw.CreationTime.Format("2006-01-02 15:04")})
+	}
+
+	return ""
+}
+
+// Verify merged output of [VideoWhole] is probeable and as long as its fragments combined.
+func (vw VideoWhole) verify() error {
+
+	jsonBuf, err := utils.Output(vw.app.newCmdFor(vw.logger(), ffprobeCmd(vw.OutputPath()), ""), vw.Name)
+	if err != nil {
+		return err
+	}
+
+	data := ff.ProbeData{}
+	if err := json.Unmarshal(jsonBuf, &data); err != nil {
+		return err
+	}
+
+	expected := vw.duration()
+
+	// Allow a second of slack per fragment for container rounding
+	actual := scan.Seconds(data.Format.Duration)
+	slack := time.Duration(len(vw.Fragments)) * time.Second
+
+	if actual < expected-slack || actual > expected+slack {
+		return fmt.Errorf("merged duration %v does not match fragments' %v", actual, expected)
+	}
+
+	return nil
+}
+
+// Whether merged video of [VideoWhole] holds sound, read natively from MP4 and by ffprobe otherwise; taken to if neither can tell.
+func (vw VideoWhole) hasAudio() bool {
+
+	output := vw.OutputPath()
+
+	if audio, err := mp4.HasAudio(output); err == nil {
+		return audio
+	}
+
+	if vw.app.probeless {
+		return true
+	}
+
+	buf, err := utils.Output(vw.app.newCmdFor(vw.logger(), []string{"ffprobe", "-v", "error", "-select_streams", "a", "-show_entries", "stream=index", "-of", "csv=p=0", output}, ""), vw.Name)
+	if err != nil {
+		return true
+	}
+
+	return len(bytes.TrimSpace(buf)) > 0
+}
+
+// Make sure spherical metadata of 360 and Max Lens fragments survived merging, re-injecting it into MP4 output if dropped.
+func (vw VideoWhole) keepSpherical() error {
+
+	// Fragments that are not MP4 or carry no such metadata have nothing to lose
+	want, err := mp4.ReadSpherical(vw.Fragments[0].InputPath())
+	if err != nil || !want.Present() {
+		return nil
+	}
+
+	output := vw.OutputPath()
+
+	switch strings.ToLower(filepath.Ext(output)) {
+
+	case ".mp4", ".mov", ".m4v":
+
+		got, err := mp4.ReadSpherical(output)
+		if err != nil {
+			return err
+		}
+
+		if got.Covers(want) {
+			return nil
+		}
+
+		log.Info(locale.Td("SphericalRestored", "Restoring 360 metadata of {{.Name}}", map[string]any{"Name": vw.Name}))
+
+		return mp4.InjectSpherical(output, want)
+
+	}
+
+	// Nothing to check with, which was warned about up front
+	if vw.app.probeless {
+		return nil
+	}
+
+	// Other containers carry projection natively, which ffmpeg only fills in from V2 metadata
+	jsonBuf, err := utils.Output(vw.app.newCmdFor(vw.logger(), ffprobeCmd(output), ""), vw.Name)
+	if err != nil {
+		return err
+	}
+
+	data := ff.ProbeData{}
+	if err := json.Unmarshal(jsonBuf, &data); err != nil {
+		return err
+	}
+
+	for _, s := range data.Streams {
+		for _, side := range s.SideDataList {
+			if side["side_data_type"] == "Spherical Mapping" {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("projection missing; merge with --container mp4 to keep it")
+}
+
+// Copy files attached by policy to fragments of merged [VideoWhole] next to it, e.g. "NAME.GX010042.WAV" for external audio of GX010042.MP4.
+// Attachments are matched to fragments by name without extension, current or as the camera named them; copies already there are left alone.
+func (vw VideoWhole) keepAttached() error {
+
+	stems := map[string]bool{}
+	for _, f := range vw.Fragments {
+		stems[strings.ToUpper(stem(filepath.Base(f.InputPath())))] = true
+		if raw, err := f.rawName(); err == nil {
+			stems[strings.ToUpper(stem(raw))] = true
+		}
+	}
+
+	output := vw.OutputPath()
+
+	for _, path := range vw.app.attached {
+
+		if !stems[strings.ToUpper(stem(filepath.Base(path)))] {
+			continue
+		}
+
+		to := stem(output) + "." + filepath.Base(path)
+		if _, err := os.Lstat(to); err == nil {
+			continue
+		}
+
+		log.Info(locale.Td("PolicyAttach", "Keeping {{.Name}} alongside {{.Output}} as per policy", map[string]any{"Name": filepath.Base(path), "Output": filepath.Base(output)}))
+
+		if err := utils.CopyFile(vw.app.runCtx, path, to); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+}
+
+// Write provenance of merged [VideoWhole] next to it as NAME.json or NAME.md, if asked to.
+func (vw VideoWhole) writeSidecar(verified bool) error {
+
+	if vw.app.root.Merge.Sidecar == "" {
+		return nil
+	}
+
+	paths := []string{}
+	for _, f := range vw.Fragments {
+		paths = append(paths, f.InputPath())
+	}
+
+	// Hashes are cached in the manifest, which other merges may be writing to
+	vw.app.recordMutex.Lock()
+	sums, err := vw.app.hashFiles(paths, 0)
+	vw.app.recordMutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	s := sidecar.Sidecar{
+		Id:       vw.Id,
+		Output:   filepath.Base(vw.OutputPath()),
+		Created:  vw.CreationTime,
+		Lapse:    vw.Lapse,
+		Verified: verified,
+		Merged:   time.Now(),
+		Version:  sidecar.Version(),
+		Args:     os.Args[1:],
+	}
+
+	for i, f := range vw.Fragments {
+		s.Fragments = append(s.Fragments, sidecar.Fragment{
+			Name:     f.CurrentName,
+			SHA256:   sums[paths[i]],
+			Codec:    f.Codec,
+			Created:  f.CreationTime,
+			Duration: f.Duration.Round(time.Millisecond).String(),
+			Variant:  f.Variant,
+			Source:   f.TimeSource,
+		})
+	}
+
+	output := strings.TrimSuffix(vw.OutputPath(), filepath.Ext(vw.OutputPath())) + "." + vw.app.root.Merge.Sidecar
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	if vw.app.root.Merge.Sidecar == "md" {
+		err = s.WriteMarkdown(file)
+	} else {
+		err = s.WriteJSON(file)
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Record merge of [VideoWhole] in the catalog.
+func (vw VideoWhole) recordMerge(verified bool) error {
+
+	fragments := make([]string, len(vw.Fragments))
+	for i, f := range vw.Fragments {
+		fragments[i] = f.InputPath()
+	}
+
+	// A merge going through resolves earlier failures to merge; verification follows and reports its own
+	vw.app.videoCatalog.Recording(vw.key()).Failure = nil
+
+	vw.app.videoCatalog.Recording(vw.key()).Merge = &catalog.Merge{
+		Output:    vw.OutputPath(),
+		Fragments: fragments,
+		At:        time.Now(),
+		Verified:  verified,
+		Batches:   vw.batches(),
+	}
+
+	if vw.UUID != "" {
+		vw.app.videoCatalog.RecordProvenance(vw.UUID, catalog.Provenance{
+			Id:      vw.Id,
+			Owner:   vw.app.root.Merge.Owner,
+			Batches: vw.batches(),
+			Output:  vw.OutputPath(),
+			At:      time.Now(),
+		})
+	}
+
+	return vw.app.videoCatalog.Save()
+}
+
+// Print which fragments would be merged into which output.
+func (app *app) mergeInfo(videos []*VideoWhole) {
+
+	fmt.Printf("%s\n\n", locale.T("MergingDryRun", "Merging (Dry Run)"))
+
+	for i, vw := range videos {
+
+		if i > 0 {
+			fmt.Println()
+		}
+
+		for _, f := range vw.Fragments {
+			fmt.Println(f.InputPath())
+		}
+
+		if audio := vw.externalAudio(); audio != nil {
+			fmt.Printf("%s %s (%+.1fs)\n", styleBold.Render(locale.T("MergeWithAudio", "with audio")), audio.Path, audio.Offset.Seconds())
+		}
+
+		fmt.Printf("%s %s\n", styleBold.Render(locale.T("MergeInto", "into")), styleDestination.Render(vw.OutputPath()))
+
+		job := vw.mergeJob()
+
+		// Auto merges natively what it can, and falls back to ffmpeg for the rest or if chapters turn out to differ
+		var f *merger.FFmpeg
+		switch m := app.videoMerger.(type) {
+		case *merger.FFmpeg:
+			f = m
+		case *merger.Auto:
+			f = m.FFmpeg
+			if m.Native.Check(job) == nil {
+				fmt.Println(styleBold.Render(locale.T("MergeNatively", "natively, else with")))
+			}
+		}
+
+		// Building the command prints it; the list is only written when merging for real
+		if f != nil {
+
+			if _, err := f.ConcatList(job); err != nil {
+				vw.logger().Warnf("%v", err)
+			}
+
+			f.Cmd(app.runCtx, job, filepath.Join(os.TempDir(), "stopcon-concat-"+vw.Id+".txt"))
+
+		}
+
+	}
+
+}
+
+// [report.Reporter] printing progress of merges for people at a terminal.
+type statusPrinter struct {
+	app *app
+}
+
+func (statusPrinter) Discovered(report.Recording)   {}
+func (statusPrinter) Planned(string, []report.Step) {}
+
+func (p statusPrinter) Progress(id string, stage string, fraction float64) {
+
+	if stage != "merge" {
+		return
+	}
+
+	merging := locale.Td("Merging", "merging videos with ID \"{{.Id}}\"...", map[string]any{"Id": id})
+
+	// Merges side by side report in whole lines once done, instead of sharing one status line
+	if p.app.parallelMerges {
+		return
+	}
+
+	if fraction == 0 {
+		fmt.Fprint(p.app.status, merging)
+		return
+	}
+
+	if !p.app.root.Plain {
+		fmt.Fprintf(p.app.status, "\r%s %3.0f%% ", merging, fraction*100)
+	}
+}
+
+func (p statusPrinter) Completed(id string, stage string, err error) {
+
+	if stage != "merge" {
+		return
+	}
+
+	outcome := locale.T("StepDone", "done!")
+	if err != nil {
+		outcome = locale.T("StepError", "error!")
+	}
+
+	if p.app.parallelMerges {
+		fmt.Fprintf(p.app.status, "%s%s\n", locale.Td("Merging", "merging videos with ID \"{{.Id}}\"...", map[string]any{"Id": id}), outcome)
+	} else {
+		fmt.Fprintln(p.app.status, outcome)
+	}
+}
+
+func (app *app) merge() error {
+
+	if err := app.openMerger(); err != nil {
+		return err
+	}
+
+	videos := []*VideoWhole{}
+	for _, vw := range app.videoList.ordered(app.root.Merge.Order) {
+		if picked(app.root.Merge.Ids, vw.key()) && app.batchPicked(vw.batches()) {
+			videos = append(videos, vw)
+		}
+	}
+
+	// A single output file or stream can only hold one recording
+	if app.root.Merge.OutputFilePath != "" && len(videos) != 1 {
+		return errors.New(locale.Td("OutputNeedsOne", "--output needs exactly one recording, found {{.Count}}; pick one with --id", map[string]any{"Count": len(videos)}))
+	}
+
+	if app.streaming() {
+		app.status = os.Stderr
+	}
+
+	if app.root.Merge.ExternalAudio != "" {
+		if err := app.findExternalAudio(); err != nil {
+			return err
+		}
+	}
+
+	// Gaps are merged over with a warning unless asked to abort; a chapter present twice would repeat footage, so it is never merged
+	complete := []*VideoWhole{}
+	for _, vw := range videos {
+
+		err := vw.checkChapters()
+		if err != nil && app.root.Merge.MissingChapters == "abort" {
+			return err
+		}
+
+		if err != nil {
+			log.Warnf("%v", err)
+		}
+
+		if vw.duplicateChapter() > 0 {
+			app.quarantine(vw.key(), "chapters", err)
+			continue
+		}
+
+		// Joined as they are, fragments of different settings play back broken
+		if err := vw.checkPictures(); err != nil && app.root.Merge.Mismatched != "transcode" {
+			vw.logger().Warnf("%v", err)
+			app.quarantine(vw.key(), "pictures", err)
+			continue
+		}
+
+		complete = append(complete, vw)
+
+	}
+	videos = complete
+
+	steps := []report.Step{}
+	for _, vw := range videos {
+		steps = append(steps, report.Step{Id: vw.Id, Output: vw.OutputPath()})
+	}
+	app.reporter.Planned("merge", steps)
+
+	if app.root.DryRun {
+		app.mergeInfo(videos)
+		return nil
+	}
+
+	if app.root.Merge.OutputFilePath == "" {
+		if err := app.removeStaleParts(); err != nil {
+			return err
+		}
+	}
+
+	workers := app.jobs()
+	if workers > len(videos) {
+		workers = len(videos)
+	}
+
+	app.parallelMerges = workers > 1
+
+	mergeWG := sync.WaitGroup{}
+	queue := make(chan *VideoWhole)
+
+	// First bookkeeping error, which stops further merges
+	var firstErr error
+	errMutex := sync.Mutex{}
+
+	// Outcomes, told once interrupted
+	merged, failed, skipped := 0, 0, 0
+
+	for i := 0; i < workers; i++ {
+
+		mergeWG.Add(1)
+
+		go func() {
+			defer mergeWG.Done()
+
+			for vw := range queue {
+
+				errMutex.Lock()
+				stop := firstErr != nil || app.runCtx.Err() != nil
+				if stop {
+					skipped++
+				}
+				errMutex.Unlock()
+
+				if stop {
+					continue
+				}
+
+				ok, err := vw.mergeRecorded()
+
+				errMutex.Lock()
+				switch {
+				case ok:
+					merged++
+				case app.runCtx.Err() != nil:
+					skipped++
+				default:
+					failed++
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				errMutex.Unlock()
+			}
+		}()
+
+	}
+
+	for _, vw := range videos {
+		queue <- vw
+	}
+
+	close(queue)
+	mergeWG.Wait()
+
+	if firstErr == nil && app.runCtx.Err() != nil {
+		log.Warn(locale.Td("MergeInterrupted", "Interrupted: {{.Merged}} merged, {{.Failed}} failed, {{.Skipped}} left for the next run", map[string]any{"Merged": merged, "Failed": failed, "Skipped": skipped}))
+		return interrupted()
+	}
+
+	return firstErr
+
+}
+
+// Merge [VideoWhole], then verify and record it, telling whether it was merged; failing merges are only warned about, failing bookkeeping is returned.
+// Merges cut short by an interrupt are neither warned about nor quarantined, as the recording is not at fault.
+func (vw *VideoWhole) mergeRecorded() (bool, error) {
+
+	if variants := vw.variants(); len(variants) > 1 {
+		log.Warn(locale.Td("MixedVariants", "Recording {{.Id}} mixes picture variants {{.Variants}}; the merge may play back inconsistently", map[string]any{"Id": vw.Id, "Variants": strings.Join(variants, ", ")}))
+	}
+
+	vw.app.reporter.Progress(vw.Id, "merge", 0)
+
+	// Every merge is tagged anew, so copies of earlier merges remain told apart
+	if vw.app.root.Merge.Provenance {
+		uuid, err := utils.NewUUID()
+		if err != nil {
+			return false, err
+		}
+		vw.UUID = uuid
+	}
+
+	usage := vw.app.startJob("merge", vw.Id, vw.OutputPath())
+
+	err := failure.Wrap(failure.MergeFailed, vw.merge(usage))
+	if err != nil && vw.app.runCtx.Err() != nil {
+		err = interrupted()
+	}
+
+	vw.app.reporter.Completed(vw.Id, "merge", err)
+
+	if err != nil && vw.app.runCtx.Err() != nil {
+		return false, nil
+	}
+
+	if err != nil {
+		vw.logger().Warnf("%v", err)
+		vw.app.quarantine(vw.key(), "merge", err)
+		return false, nil
+	}
+
+	read := int64(0)
+	for _, f := range vw.Fragments {
+		if info, err := os.Stat(f.InputPath()); err == nil {
+			read += info.Size()
+		}
+	}
+
+	written := int64(0)
+	if info, err := os.Stat(vw.OutputPath()); err == nil && !vw.app.streaming() {
+		written = info.Size()
+	}
+
+	vw.app.recordMutex.Lock()
+	err = usage.finish(read, written)
+	vw.app.recordMutex.Unlock()
+
+	if err != nil {
+		return true, err
+	}
+
+	// Nothing left to verify or record once streamed away
+	if vw.app.streaming() {
+		return true, nil
+	}
+
+	vw.app.recordMutex.Lock()
+	vw.app.journalled(journal.Merge, "", vw.OutputPath())
+	vw.app.recordMutex.Unlock()
+
+	// Output cannot be probed either, so it is recorded as unverified
+	verifyErr := errors.New("ffprobe missing")
+	if !vw.app.probeless {
+		verifyErr = failure.Wrap(failure.VerifyFailed, vw.verify())
+		if verifyErr != nil {
+			log.Warn(locale.Td("VerifyFailed", "merged video {{.Name}} failed verification: {{.Error}}", map[string]any{"Name": vw.Name, "Error": verifyErr}))
+		}
+	}
+
+	if err := vw.keepSpherical(); err != nil {
+		log.Warn(locale.Td("SphericalLost", "merged video {{.Name}} lost its 360 metadata: {{.Error}}", map[string]any{"Name": vw.Name, "Error": err}))
+	}
+
+	if err := vw.keepAttached(); err != nil {
+		log.Warnf("%v", err)
+	}
+
+	vw.app.recordMutex.Lock()
+	err = vw.recordMerge(verifyErr == nil)
+	vw.app.recordMutex.Unlock()
+
+	if err != nil {
+		return true, err
+	}
+
+	if err := vw.writeSidecar(verifyErr == nil); err != nil {
+		log.Warnf("%v", err)
+	}
+
+	// Verification needs ffprobe, so its absence is no failure of the recording
+	if verifyErr != nil && !vw.app.probeless && vw.app.runCtx.Err() == nil {
+		vw.app.quarantine(vw.key(), "verify", verifyErr)
+	}
+
+	return true, nil
+}
+
+// Total size in bytes of regular files under dir.
+func dirUsage(dir string) int64 {
+
+	total := int64(0)
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+
+		return nil
+	})
+
+	return total
+}
+
+// Write static HTML report of recordings, merges, disk usage and duplicates.
+func (app *app) auditReport() error {
+
+	report := audit.Report{Generated: time.Now(), Root: app.root.InputDirPath}
+
+	// Index of each day within report
+	days := map[string]int{}
+
+	for _, vw := range app.videoList.ordered("oldest-first") {
+
+		r := audit.Recording{Id: vw.Id, Fragments: len(vw.Fragments), Missing: vw.missing()}
+
+		if vw.CreationTime != nil {
+			r.Start = *vw.CreationTime
+		}
+
+		for _, f := range vw.Fragments {
+			r.Duration += f.Duration
+		}
+
+		if c := app.videoCatalog.Lookup(vw.key()); c != nil && c.Merge != nil {
+			r.Merged = true
+			r.Verified = c.Merge.Verified
+		}
+
+		if len(r.Missing) > 0 {
+			report.Missing = append(report.Missing, r)
+		}
+
+		if r.Merged && !r.Verified {
+			report.Unverified = append(report.Unverified, r)
+		}
+
+		// Group by day; videos are sorted, so days come out in order too.
+		date := r.Start.Format("2006-01-02")
+		if _, ok := days[date]; !ok {
+			days[date] = len(report.Days)
+			report.Days = append(report.Days, audit.Day{Date: date})
+		}
+
+		day := &report.Days[days[date]]
+		day.Recordings = append(day.Recordings, r)
+
+	}
+
+	// Disk usage of library directories, or just the input directory
+	if app.videoLibrary != nil {
+		report.Root = app.videoLibrary.Root
+		for _, dir := range []string{library.DirIncoming, library.DirMasters, library.DirProxies, library.DirArchive} {
+			report.Usage = append(report.Usage, audit.Usage{Name: dir, Bytes: dirUsage(filepath.Join(app.videoLibrary.Root, dir))})
+		}
+	} else {
+		report.Usage = append(report.Usage, audit.Usage{Name: app.root.InputDirPath, Bytes: dirUsage(app.root.InputDirPath)})
+	}
+
+	// Files sharing a hash in the manifest are duplicate candidates
+	byHash := map[string][]string{}
+	for path, f := range app.videoManifest.Files {
+		if f.SHA256 != "" {
+			byHash[f.SHA256] = append(byHash[f.SHA256], path)
+		}
+	}
+
+	for sum, paths := range byHash {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			report.Duplicates = append(report.Duplicates, audit.Duplicate{Hash: sum, Paths: paths})
+		}
+	}
+
+	f, err := os.Create(app.root.Audit.HtmlFilePath)
+	if err != nil {
+		return err
+	}
+
+	if err := report.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	log.Info(locale.Td("AuditWritten", "Wrote audit report to {{.Path}}", map[string]any{"Path": styleDestination.Render(app.root.Audit.HtmlFilePath)}))
+
+	return nil
+}
+
+// Archive or delete raw fragments of recordings verified as merged longer ago than retention allows.
+func (app *app) prune() error {
+
+	opts := app.root.Prune
+	commit := app.committing(opts.Commit)
+
+	archiveDir := opts.ArchiveDirPath
+	if archiveDir == "" && app.videoLibrary != nil {
+		archiveDir = app.videoLibrary.Archive()
+	}
+
+	if opts.Action == "archive" && archiveDir == "" {
+		return errors.New(locale.T("ArchiveDirRequired", "--archive-dir is required outside of a library"))
+	}
+
+	if !commit {
+		fmt.Printf("%s\n\n", locale.T("PruningDryRun", "Pruning (Dry Run)"))
+	}
+
+	if commit && opts.Action == "archive" {
+		if err := os.MkdirAll(archiveDir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	action := locale.T("PruneArchive", "archive")
+	if opts.Action == "delete" {
+		action = locale.T("PruneDelete", "delete")
+	}
+
+	cutoff := time.Now().Add(-opts.Keep)
+	pruned := 0
+	freed := int64(0)
+
+	for key, r := range app.videoCatalog.Recordings {
+
+		// A pipeline prunes only the recording it is working on
+		if app.root.Run != nil && !app.listed(key) {
+			continue
+		}
+
+		// Only fragments of verified merges past retention are eligible
+		if r.Merge == nil || !r.Merge.Verified || r.Merge.At.After(cutoff) {
+			continue
+		}
+
+		for _, fragment := range r.Merge.Fragments {
+
+			info, err := os.Stat(fragment)
+			if err != nil {
+				continue
+			}
+
+			fmt.Println(locale.Td("PruneFragment", "{{.Action}} {{.Path}} (recording {{.Id}}, merged {{.Date}})", map[string]any{
+				"Action": styleBold.Render(action),
+				"Path":   fragment,
+				"Id":     catalog.KeyId(key),
+				"Date":   r.Merge.At.Format("2006-01-02"),
+			}))
+
+			pruned++
+			freed += info.Size()
+
+			if !commit {
+				continue
+			}
+
+			if opts.Action == "delete" {
+				err = os.Remove(fragment)
+			} else {
+				err = app.newRenamer().Rename(app.runCtx, fragment, filepath.Join(archiveDir, filepath.Base(fragment)))
+			}
+
+			if err != nil {
+				log.Warnf("%v", err)
+			}
+
+		}
+
+	}
+
+	fmt.Printf("\n%s\n", locale.Td("PruneSummary", "{{.Count}} fragments, {{.Size}} GiB", map[string]any{"Count": pruned, "Size": fmt.Sprintf("%.1f", float64(freed)/(1<<30))}))
+
+	return nil
+}
+
+// Whether recording of given catalog key is in the video list.
+func (app *app) listed(key string) bool {
+
+	for _, vw := range app.videoList {
+		if vw.key() == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether f went into a verified merge of vw recorded in the catalog.
+func (app *app) mergedFrom(vw *VideoWhole, f VideoFragment) bool {
+
+	r := app.videoCatalog.Lookup(vw.key())
+	if r == nil || r.Merge == nil || !r.Merge.Verified {
+		return false
+	}
+
+	for _, fragment := range r.Merge.Fragments {
+		if fragment == f.InputPath() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Remove fragments of import batches picked by --batch from input directory, forgetting their imports so the batches can be imported again.
+// Merged videos made from them are kept; fragments without a verified merge are kept too, unless --unmerged is given.
+func (app *app) rollback() error {
+
+	commit := app.committing(app.root.Rollback.Commit)
+
+	if !commit {
+		fmt.Printf("%s\n\n", locale.T("RollingBackDryRun", "Rolling Back (Dry Run)"))
+	}
+
+	removed := 0
+	failed := 0
+	kept := 0
+	freed := int64(0)
+
+	for _, vw := range app.videoList.ordered("oldest-first") {
+		for _, f := range vw.Fragments {
+
+			name, size, ok := f.imported()
+			if !ok {
+				continue
+			}
+
+			batch := app.videoCatalog.Batch(name, size)
+			if !app.pickedBatches[batch] {
+				continue
+			}
+
+			// Removing fragments never merged would lose their footage
+			if !app.root.Rollback.Unmerged && !app.mergedFrom(vw, f) {
+				log.Warn(locale.Td("RollbackUnmerged", "Keeping {{.Path}}, which has no verified merge; give --unmerged to remove it anyway", map[string]any{"Path": f.InputPath()}))
+				kept++
+				continue
+			}
+
+			fmt.Println(locale.Td("RollbackFragment", "{{.Action}} {{.Path}} (batch {{.Batch}})", map[string]any{
+				"Action": styleBold.Render(locale.T("PruneDelete", "delete")),
+				"Path":   f.InputPath(),
+				"Batch":  batch,
+			}))
+
+			removed++
+			freed += size
+
+			if !commit {
+				continue
+			}
+
+			if err := os.Remove(f.InputPath()); err != nil {
+				log.Warnf("%v", err)
+				failed++
+				continue
+			}
+
+			app.videoCatalog.ForgetImport(name, size)
+			delete(app.videoManifest.Files, f.InputPath())
+
+		}
+	}
+
+	fmt.Printf("\n%s\n", locale.Td("PruneSummary", "{{.Count}} fragments, {{.Size}} GiB", map[string]any{"Count": removed, "Size": fmt.Sprintf("%.1f", float64(freed)/(1<<30))}))
+
+	if !commit {
+		return nil
+	}
+
+	// Batches rolled back in full are not picked again
+	if failed == 0 && kept == 0 {
+		now := time.Now()
+		for _, b := range app.videoManifest.Batches {
+			if app.pickedBatches[b.Name] && b.RolledBack == nil {
+				b.RolledBack = &now
+			}
+		}
+	}
+
+	if err := app.videoCatalog.Save(); err != nil {
+		return err
+	}
+
+	if err := app.videoManifest.Save(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return errors.New(locale.Td("RollbackIncomplete", "{{.Count}} fragments could not be removed; run rollback again once fixed", map[string]any{"Count": failed}))
+	}
+
+	return nil
+}
+
+// Package each picked merged video as HLS or DASH into a directory of its own.
+func (app *app) packageVideos() error {
+
+	opts := app.root.Package
+
+	options := packaging.Options{Format: opts.Format, Segment: opts.Segment}
+
+	if opts.Ladder != "" {
+		ladder, err := packaging.ParseLadder(opts.Ladder)
+		if err != nil {
+			return err
+		}
+		options.Ladder = ladder
+	}
+
+	for _, vw := range app.videoList.ordered("oldest-first") {
+
+		if !picked(opts.Ids, vw.key()) {
+			continue
+		}
+
+		// Skip recordings not merged yet
+		if _, err := os.Stat(vw.OutputPath()); err != nil {
+			log.Debugf("Skipping unmerged recording %s", vw.Id)
+			continue
+		}
+
+		options.Silent = !vw.hasAudio()
+
+		dir := filepath.Join(opts.OutputDirPath, stem(vw.Name)+"."+opts.Format)
+		cmd := app.newCmdFor(vw.logger(), packaging.Args(vw.OutputPath(), dir, options), "")
+
+		// Building the command prints it
+		if app.root.DryRun {
+			continue
+		}
+
+		fmt.Print(locale.Td("Packaging", "packaging \"{{.Name}}\"...", map[string]any{"Name": vw.Name}))
+
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			fmt.Println(locale.T("StepError", "error!"))
+			return err
+		}
+
+		usage := app.startJob("package", vw.Id, dir)
+
+		_, err := utils.Output(cmd, vw.Name)
+		usage.ran(cmd)
+
+		if err != nil {
+			fmt.Println(locale.T("StepError", "error!"))
+			log.Warnf("%v", err)
+			continue
+		}
+
+		fmt.Println(locale.T("StepDone", "done!"))
+
+		read := int64(0)
+		if info, err := os.Stat(vw.OutputPath()); err == nil {
+			read = info.Size()
+		}
+
+		if err := usage.finish(read, dirUsage(dir)); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+}
+
+// Sample rate audio is decoded at for waveforms; plenty for peaks, and cheap to read.
+const waveformSampleRate = 8000
+
+// Write audio peaks of video at path into dst as waveform JSON.
+func (app *app) writeWaveform(path string, dst string) error {
+
+	cmd := app.newCmd([]string{"ffmpeg", "-hide_banner", "-loglevel", "error", "-i", path, "-vn", "-ac", "1", "-ar", strconv.Itoa(waveformSampleRate), "-f", "s16le", "-"}, "")
+	if app.root.DryRun {
+		return nil
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	waveform, err := preview.ReadWaveform(stdout, waveformSampleRate, waveformSampleRate/app.root.Preview.WaveformRate)
+
+	if waitErr := cmd.Wait(); err == nil && waitErr != nil {
+		err = utils.CmdError(cmd, filepath.Base(path), stderr.String(), waitErr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(waveform)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dst, buf, 0o644)
+}
+
+// Write thumbnail sprite sheets of [VideoWhole]'s merged video next to base, with WebVTT cues pointing into them.
+func (vw VideoWhole) writeSprites(base string) error {
+
+	opts := vw.app.root.Preview
+	sprites := preview.Sprites{Interval: opts.Interval, Width: opts.ThumbWidth, Height: opts.ThumbWidth * 9 / 16, Columns: opts.Columns, Rows: opts.Rows, ToneMap: vw.toneMapped()}
+
+	// Keep aspect ratio of video, rounded to an even height as encoders prefer
+	if jsonBuf, err := utils.Output(vw.app.newCmdFor(vw.logger(), ffprobeCmd(vw.OutputPath()), ""), vw.Name); err == nil {
+		data := ff.ProbeData{}
+		if json.Unmarshal(jsonBuf, &data) == nil && len(data.Streams) > 0 && data.Streams[0].StreamVideo != nil && data.Streams[0].Width > 0 {
+			sprites.Height = opts.ThumbWidth * data.Streams[0].Height / data.Streams[0].Width / 2 * 2
+		}
+	}
+
+	cmd := vw.app.newCmdFor(vw.logger(), []string{"ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-i", vw.OutputPath(), "-vf", sprites.Filter(), "-q:v", "4", base + ".sprite-%03d.jpg"}, "")
+	if vw.app.root.DryRun {
+		return nil
+	}
+
+	if _, err := utils.Output(cmd, vw.Name); err != nil {
+		return err
+	}
+
+	duration := time.Duration(0)
+	for _, f := range vw.Fragments {
+		duration += f.Duration
+	}
+
+	// Sheets sit beside the cue file, so refer to them by name alone
+	vtt := sprites.VTT(duration, func(n int) string {
+		return fmt.Sprintf("%s.sprite-%03d.jpg", filepath.Base(base), n)
+	})
+
+	return os.WriteFile(base+".vtt", []byte(vtt), 0o644)
+}
+
+// Whether stills of [VideoWhole] are tone-mapped to SDR, as picked by --tonemap; never without zscale.
+func (vw VideoWhole) toneMapped() bool {
+
+	if vw.app.noZscale {
+		return false
+	}
+
+	switch vw.app.root.Preview.ToneMap {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+
+	return vw.Variant == "hdr"
+}
+
+// Frames of a merged video sampled as poster candidates, and size they are judged at.
+const (
+	posterCandidates = 8
+	posterWidth      = 160
+	posterHeight     = 90
+)
+
+// Write poster frame of [VideoWhole]'s merged video to base.jpg: the best of evenly spaced frames by [preview.PosterScore], rather than the first, which is often a blurry start.
+func (vw VideoWhole) writePoster(base string) error {
+
+	duration := time.Duration(0)
+	for _, f := range vw.Fragments {
+		duration += f.Duration
+	}
+
+	// Without a known length, the start is all there is
+	best, bestScore := time.Duration(0), -1.0
+
+	for i := 0; i < posterCandidates && duration > 0; i++ {
+
+		// Evenly spaced, keeping clear of both ends
+		at := duration * time.Duration(2*i+1) / time.Duration(2*posterCandidates)
+		seek := strconv.FormatFloat(at.Seconds(), 'f', 3, 64)
+
+		filter := preview.WithToneMap(fmt.Sprintf("scale=%d:%d,format=gray", posterWidth, posterHeight), vw.toneMapped())
+
+		gray, err := utils.Output(vw.app.newCmdFor(vw.logger(), []string{"ffmpeg", "-hide_banner", "-loglevel", "error", "-ss", seek, "-i", vw.OutputPath(), "-frames:v", "1", "-vf", filter, "-f", "rawvideo", "-"}, ""), vw.Name)
+		if err != nil {
+			return err
+		}
+
+		if score := preview.PosterScore(gray, posterWidth, posterHeight); score > bestScore {
+			best, bestScore = at, score
+		}
+
+	}
+
+	seek := strconv.FormatFloat(best.Seconds(), 'f', 3, 64)
+	filter := preview.WithToneMap("scale=-2:720", vw.toneMapped())
+
+	_, err := utils.Output(vw.app.newCmdFor(vw.logger(), []string{"ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-ss", seek, "-i", vw.OutputPath(), "-frames:v", "1", "-vf", filter, "-q:v", "2", base + ".jpg"}, ""), vw.Name)
+
+	return err
+}
+
+// Verify each picked merged video again, recording the outcome in the catalog; failing any of them is an error, so pipelines stop before archiving its fragments.
+func (app *app) verifyVideos() error {
+
+	if err := app.requireProbe(); err != nil {
+		return err
+	}
+
+	failed := 0
+
+	for _, vw := range app.videoList.ordered("oldest-first") {
+
+		if !picked(app.root.Verify.Ids, vw.key()) {
+			continue
+		}
+
+		// Skip recordings not merged yet
+		if _, err := os.Stat(vw.OutputPath()); err != nil {
+			log.Debugf("Skipping unmerged recording %s", vw.Id)
+			continue
+		}
+
+		fmt.Print(locale.Td("Verifying", "verifying \"{{.Name}}\"...", map[string]any{"Name": vw.Name}))
+
+		err := failure.Wrap(failure.VerifyFailed, vw.verify())
+		if err != nil {
+			fmt.Println(locale.T("StepError", "error!"))
+			log.Warn(locale.Td("VerifyFailed", "merged video {{.Name}} failed verification: {{.Error}}", map[string]any{"Name": vw.Name, "Error": err}))
+			failed++
+		} else {
+			fmt.Println(locale.T("StepDone", "done!"))
+		}
+
+		// Only the merge on record can be vouched for, not one of another name
+		if r := app.videoCatalog.Lookup(vw.key()); r != nil && r.Merge != nil && filepath.Base(r.Merge.Output) == vw.Name {
+			r.Merge.Verified = err == nil
+		}
+
+	}
+
+	if err := app.videoCatalog.Save(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return errors.New(locale.Td("VerifiesFailed", "{{.Count}} merged videos failed verification", map[string]any{"Count": failed}))
+	}
+
+	return nil
+}
+
+// Generate waveform and thumbnail sprites of each picked merged video.
+func (app *app) previewVideos() error {
+
+	opts := app.root.Preview
+
+	if !app.root.DryRun {
+		if err := os.MkdirAll(opts.OutputDirPath, 0o755); err != nil {
+			return err
+		}
+	}
+
+	for _, vw := range app.videoList.ordered("oldest-first") {
+
+		if !picked(opts.Ids, vw.key()) {
+			continue
+		}
+
+		// Skip recordings not merged yet
+		if _, err := os.Stat(vw.OutputPath()); err != nil {
+			log.Debugf("Skipping unmerged recording %s", vw.Id)
+			continue
+		}
+
+		base := filepath.Join(opts.OutputDirPath, stem(vw.Name))
+
+		if !app.root.DryRun {
+			fmt.Print(locale.Td("Previewing", "generating previews of \"{{.Name}}\"...", map[string]any{"Name": vw.Name}))
+		}
+
+		// Each preview stands on its own, so one failing leaves the others
+		errs := []error{}
+
+		// Silent videos, e.g. lapses, have no waveform to draw
+		if vw.hasAudio() {
+			if err := app.writeWaveform(vw.OutputPath(), base+".waveform.json"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if err := vw.writeSprites(base); err != nil {
+			errs = append(errs, err)
+		}
+
+		// Candidates are sampled by running ffmpeg, which a dry run does not
+		if opts.Poster && !app.root.DryRun {
+			if err := vw.writePoster(base); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if app.root.DryRun {
+			continue
+		}
+
+		if len(errs) > 0 {
+			fmt.Println(locale.T("StepError", "error!"))
+			for _, err := range errs {
+				log.Warnf("%v", err)
+			}
+			continue
+		}
+
+		fmt.Println(locale.T("StepDone", "done!"))
+
+	}
+
+	return nil
+}
+
+// Cut --start to --end out of the merged video of the recording given by --id, re-encoding only the groups of pictures around the cut points.
+// Recordings sharing the ID after the camera's counter wrapped are each trimmed alike, unless one is picked by ID@DATE.
+func (app *app) trimVideos() error {
+
+	opts := app.root.Trim
+	trimmed := 0
+
+	for _, vw := range app.videoList.ordered("oldest-first") {
+
+		if !picked([]string{opts.Id}, vw.key()) {
+			continue
+		}
+
+		if _, err := os.Stat(vw.OutputPath()); err != nil {
+			return errors.New(locale.Td("TrimUnmerged", "recording {{.Id}} is not merged yet", map[string]any{"Id": vw.Id}))
+		}
+
+		if err := vw.trim(); err != nil {
+			return err
+		}
+
+		trimmed++
+
+	}
+
+	if trimmed == 0 {
+		return errors.New(locale.Td("TrimNotFound", "no recording with ID {{.Id}}", map[string]any{"Id": opts.Id}))
+	}
+
+	return nil
+}
+
+// Trim merged video of [VideoWhole] as told by the trim options.
+func (vw VideoWhole) trim() error {
+
+	opts := vw.app.root.Trim
+	input := vw.OutputPath()
+
+	output := opts.OutputFilePath
+	if output == "" {
+		output = filepath.Join(filepath.Dir(input), stem(vw.Name)+".trim"+filepath.Ext(vw.Name))
+	}
+
+	buf, err := utils.Output(vw.app.newCmdFor(vw.logger(), trim.ProbeArgs(input), ""), vw.Name)
+	if err != nil {
+		return err
+	}
+
+	keyframes, duration, err := trim.ParseProbe(buf)
+	if err != nil {
+		return err
+	}
+
+	if opts.Start >= duration {
+		return errors.New(locale.Td("TrimPastEnd", "{{.Name}} is only {{.Duration}} long", map[string]any{"Name": vw.Name, "Duration": duration.Round(time.Millisecond)}))
+	}
+
+	segments := trim.Plan(keyframes, opts.Start, opts.End, duration)
+
+	for _, s := range segments {
+		how := locale.T("TrimCopy", "copy")
+		if s.Encode {
+			how = locale.T("TrimEncode", "re-encode")
+		}
+		vw.logger().Info(locale.Td("TrimSegment", "{{.Start}} to {{.End}}: {{.How}}", map[string]any{"Start": s.Start, "End": s.End, "How": how}))
+	}
+
+	if vw.app.root.DryRun {
+		return nil
+	}
+
+	fmt.Print(locale.Td("Trimming", "trimming \"{{.Name}}\"...", map[string]any{"Name": vw.Name}))
+
+	err = vw.cut(input, segments, output)
+	if err != nil {
+		fmt.Println(locale.T("StepError", "error!"))
+		os.Remove(output)
+		return err
+	}
+
+	fmt.Println(locale.T("StepDone", "done!"))
+
+	return nil
+}
+
+// Write segments of input into temporary files, then join them with input's audio into output.
+func (vw VideoWhole) cut(input string, segments []trim.Segment, output string) error {
+
+	encoder, ok := merger.Encoders[vw.Codec]
+	if !ok {
+		encoder = "libx264"
+	}
+
+	tmp, err := os.MkdirTemp("", "stopcon-trim-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	paths := []string{}
+	for i, s := range segments {
+
+		path := filepath.Join(tmp, fmt.Sprintf("%03d.ts", i))
+		if _, err := utils.Output(vw.app.newCmdFor(vw.logger(), trim.SegmentArgs(input, s, encoder, path), ""), vw.Name); err != nil {
+			return err
+		}
+
+		paths = append(paths, path)
+
+	}
+
+	list, err := (&merger.FFmpeg{}).WriteList(merger.Job{Inputs: paths})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(list)
+
+	_, err = utils.Output(vw.app.newCmdFor(vw.logger(), trim.JoinArgs(list, input, vw.app.root.Trim.Start, vw.app.root.Trim.End, output), ""), vw.Name)
+
+	return err
+}
+
+// Whether merged [VideoWhole] was last merged from fragments of batches picked by --batch, as recorded in the catalog, or none need be.
+func (vw VideoWhole) mergedFromBatch() bool {
+
+	if vw.app.pickedBatches == nil {
+		return true
+	}
+
+	r := vw.app.videoCatalog.Lookup(vw.key())
+	if r == nil || r.Merge == nil {
+		return false
+	}
+
+	return vw.app.batchPicked(r.Merge.Batches)
+}
+
+// Whether recording of given catalog key is among ids picked by the user, as IDs or ID@DATE, see [catalog.Picks]; picking none means all.
+func picked(ids []string, key string) bool {
+
+	if len(ids) == 0 {
+		return true
+	}
+
+	for _, pick := range ids {
+		if catalog.Picks(pick, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Upload each picked merged video with uploadFn, recording returned remote IDs in the catalog under service.
+func (app *app) uploadEach(service string, uploadFn func(vw *VideoWhole) (string, error)) error {
+
+	for _, vw := range app.videoList {
+
+		if !picked(app.root.Upload.Ids, vw.key()) || !vw.mergedFromBatch() {
+			continue
+		}
+
+		// Skip recordings uploaded by an earlier run
+		if r := app.videoCatalog.Lookup(vw.key()); r != nil && r.Uploads[service] != "" {
+			log.Info(locale.Td("AlreadyUploaded", "Already uploaded: {{.Name}}", map[string]any{"Name": vw.Name}))
+			continue
+		}
+
+		fmt.Print(locale.Td("Uploading", "uploading \"{{.Name}}\" to {{.Service}}...", map[string]any{"Name": vw.Name, "Service": service}))
+
+		id, err := uploadFn(vw)
+		if err != nil {
+			fmt.Println(locale.T("StepError", "error!"))
+			log.Warnf("%v", err)
+			continue
+		}
+
+		fmt.Println(locale.T("StepDone", "done!"))
+
+		// Remember upload right away so an interrupted run does not upload twice
+		r := app.videoCatalog.Recording(vw.key())
+		if r.Uploads == nil {
+			r.Uploads = map[string]string{}
+		}
+		r.Uploads[service] = id
+
+		if err := app.videoCatalog.Save(); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+}
+
+// First GPS position in the telemetry of a [VideoWhole]'s first fragment.
+func (vw VideoWhole) gpsFix() (gpmf.Fix, error) {
+
+	if len(vw.Fragments) == 0 {
+		return gpmf.Fix{}, errors.New("video has no fragments")
+	}
+
+	return vw.app.newScanner().GPSFix(vw.app.runCtx, vw.Fragments[0].InputPath())
+}
+
+// Creation time and GPS position of a [VideoWhole], as expected by photo libraries.
+func (vw VideoWhole) position() (created time.Time, lat *float64, lon *float64) {
+
+	if vw.CreationTime != nil {
+		created = *vw.CreationTime
+	}
+
+	fix, err := vw.gpsFix()
+	if err != nil {
+		log.Debugf("no GPS position for %s: %v", vw.Name, err)
+		return created, nil, nil
+	}
+
+	return created, &fix.Latitude, &fix.Longitude
+}
+
+// Import merged videos into Immich.
+func (app *app) uploadImmich() error {
+
+	client := immich.New(app.root.Upload.Immich.Url, app.root.Upload.Immich.ApiKey)
+
+	return app.uploadEach("immich", func(vw *VideoWhole) (string, error) {
+
+		a := immich.Asset{}
+		a.CreatedAt, a.Latitude, a.Longitude = vw.position()
+
+		return client.Upload(vw.OutputPath(), a)
+	})
+}
+
+// Import merged videos into PhotoPrism.
+func (app *app) uploadPhotoprism() error {
+
+	opts := app.root.Upload.Photoprism
+	client := photoprism.New(opts.Url, opts.Token, opts.UserUid)
+
+	return app.uploadEach("photoprism", func(vw *VideoWhole) (string, error) {
+
+		a := photoprism.Asset{}
+		a.CreatedAt, a.Latitude, a.Longitude = vw.position()
+
+		// PhotoPrism does not hand back an ID for uploads
+		return vw.Name, client.Upload(vw.OutputPath(), a)
+	})
+}
+
+// Import merged videos into Apple Photos.
+func (app *app) uploadPhotos() error {
+
+	library := photos.Library{Album: app.root.Upload.Photos.Album, Command: app.newCmd}
+
+	return app.uploadEach("photos", func(vw *VideoWhole) (string, error) {
+
+		a := photos.Asset{}
+		a.CreatedAt, a.Latitude, a.Longitude = vw.position()
+
+		return library.Import(vw.OutputPath(), a)
+	})
+}
+
+// Upload merged videos to YouTube, recording their video IDs in the catalog.
+func (app *app) uploadYoutube() error {
+
+	opts := app.root.Upload.Youtube
+
+	title, err := naming.Parse(opts.TitleTemplate)
+	if err != nil {
+		return err
+	}
+
+	description, err := naming.Parse(opts.DescriptionTemplate)
+	if err != nil {
+		return err
+	}
+
+	tokenPath := opts.TokenFilePath
+	if tokenPath == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return err
+		}
+		tokenPath = filepath.Join(configDir, "stopcon", "youtube-token.json")
+	}
+
+	client, err := youtube.Authorize(opts.ClientId, opts.ClientSecret, tokenPath, func(verificationURL string, userCode string) {
+		fmt.Println(locale.Td("DeviceCode", "Visit {{.URL}} and enter code {{.Code}}", map[string]any{"URL": styleExample.Render(verificationURL), "Code": styleBold.Render(userCode)}))
+	})
+	if err != nil {
+		return err
+	}
+
+	return app.uploadEach("youtube", func(vw *VideoWhole) (string, error) {
+
+		v := youtube.Video{Privacy: opts.Privacy}
+		if vw.CreationTime != nil {
+			v.RecordingDate = *vw.CreationTime
+		}
+
+		var err error
+
+		if v.Title, err = title.Execute(vw.namingData()); err != nil {
+			return "", err
+		}
+
+		if v.Description, err = description.Execute(vw.namingData()); err != nil {
+			return "", err
+		}
+
+		return client.Upload(vw.OutputPath(), v)
+	})
+}
+
+// Store rating and note of a recording in the catalog.
+func (app *app) tag() error {
+
+	key, err := app.tagKey(app.root.Tag.Id)
+	if err != nil {
+		return err
+	}
+
+	r := app.videoCatalog.Recording(key)
+
+	if app.root.Tag.Rating != nil {
+		r.Rating = *app.root.Tag.Rating
+	}
+
+	if app.root.Tag.Note != nil {
+		r.Note = *app.root.Tag.Note
+	}
+
+	if app.root.Tag.Star != nil {
+		r.Starred = *app.root.Tag.Star
+	}
+
+	// Drop entries left with nothing worth keeping
+	if r.IsEmpty() {
+		delete(app.videoCatalog.Recordings, key)
+	}
+
+	if err := app.videoCatalog.Save(); err != nil {
+		return err
+	}
+
+	log.Info(locale.Td("Tagged", "Tagged recording {{.Id}}", map[string]any{"Id": styleExample.Render(catalog.Pick(key))}))
+
+	return nil
+}
+
+// Catalog key of the recording tag picks by pick, an ID or ID@DATE; recordings not cataloged yet are kept under their ID until found with their time of creation.
+// An ID shared by several cataloged recordings has to be given with a date.
+func (app *app) tagKey(pick string) (string, error) {
+
+	keys := []string{}
+	for key := range app.videoCatalog.Recordings {
+		if catalog.Picks(pick, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	switch {
+	case len(keys) == 1:
+		return keys[0], nil
+	case len(keys) > 1:
+		picks := []string{}
+		for _, key := range keys {
+			picks = append(picks, catalog.Pick(key))
+		}
+		return "", errors.New(locale.Td("TagAmbiguous", "{{.Id}} picks several recordings, {{.Picks}}; give one of them", map[string]any{"Id": pick, "Picks": strings.Join(picks, ", ")}))
+	case strings.Contains(pick, "@"):
+		return "", errors.New(locale.Td("TagUnknown", "no cataloged recording is picked by {{.Id}}", map[string]any{"Id": pick}))
+	}
+
+	return pick, nil
+}
+
+// Tag merged videos in --merged-dir that carry no provenance tag yet, as merge --provenance would have, recording each tag in the catalog.
+// Recording and batches come from the catalog's record of the merge; videos it does not know of go by the ID in their name alone.
+func (app *app) tagProvenance() error {
+
+	if err := app.requireProbe(); err != nil {
+		return err
+	}
+
+	opts := app.root.Tag
+	commit := app.committing(opts.Commit)
+
+	if !commit {
+		fmt.Printf("%s\n\n", locale.T("TaggingDryRun", "Tagging (Dry Run)"))
+	}
+
+	// Merges by file name, as the catalog may have recorded them by another path to the same directory
+	merges := map[string]string{}
+	for key, r := range app.videoCatalog.Recordings {
+		if r.Merge != nil {
+			merges[filepath.Base(r.Merge.Output)] = key
+		}
+	}
+
+	tagged := 0
+	failed := 0
+
+	for _, dir := range []string{opts.MergedDirPath, filepath.Join(opts.MergedDirPath, app.root.LapseDir)} {
+
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) && dir != opts.MergedDirPath {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+
+			ctr, ok := merging.ExtensionContainers[strings.ToLower(strings.TrimPrefix(filepath.Ext(e.Name()), "."))]
+			if e.IsDir() || !ok {
+				continue
+			}
+
+			path := filepath.Join(dir, e.Name())
+
+			p := catalog.Provenance{Owner: opts.Owner, Output: path}
+
+			if key, ok := merges[e.Name()]; ok {
+				m := app.videoCatalog.Lookup(key).Merge
+				p.Id, p.Batches, p.At = catalog.KeyId(key), m.Batches, m.At
+			} else if f, err := scan.ParseName(e.Name()); err == nil {
+				p.Id = f.Id
+			} else {
+				continue
+			}
+
+			tags, err := app.containerTags(path)
+			if err != nil {
+				log.Warnf("%v", err)
+				failed++
+				continue
+			}
+
+			// Copies of tagged videos may be around already, carrying the tag they have
+			if tags[tagUUID] != "" {
+				continue
+			}
+
+			fmt.Println(locale.Td("TagProvenance", "{{.Action}} {{.Path}} (recording {{.Id}})", map[string]any{
+				"Action": styleBold.Render(locale.T("TagAction", "tag")),
+				"Path":   path,
+				"Id":     p.Id,
+			}))
+
+			tagged++
+
+			if !commit {
+				continue
+			}
+
+			if err := app.retag(path, ctr, &p); err != nil {
+				log.Warnf("%s: %v", path, err)
+				failed++
+				continue
+			}
+
+		}
+	}
+
+	fmt.Printf("\n%s\n", locale.Td("TagSummary", "{{.Count}} merged videos", map[string]any{"Count": tagged}))
+
+	if failed > 0 {
+		return errors.New(locale.Td("TagFailed", "{{.Count}} merged videos could not be tagged", map[string]any{"Count": failed}))
+	}
+
+	return nil
+}
+
+// Rewrite merged video at path in container ctr with a new provenance tag filled in from p, recording it in the catalog.
+// Its modification time is kept, as it tells when it was recorded.
+func (app *app) retag(path string, ctr string, p *catalog.Provenance) error {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	uuid, err := utils.NewUUID()
+	if err != nil {
+		return err
+	}
+
+	tags := map[string]string{tagUUID: uuid}
+	if p.Owner != "" {
+		tags[tagOwner] = p.Owner
+	}
+	if len(p.Batches) > 0 {
+		tags[tagBatch] = strings.Join(p.Batches, ",")
+	}
+
+	part := path + merging.PartSuffix
+	job := merger.Job{Output: part, Format: ctr, Provenance: tags}
+
+	if _, err := utils.Output(app.newCmd((&merger.FFmpeg{}).RetagArgs(path, job), ""), filepath.Base(path)); err != nil {
+		os.Remove(part)
+		return err
+	}
+
+	if err := os.Chtimes(part, info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(part)
+		return err
+	}
+
+	if err := os.Rename(part, path); err != nil {
+		os.Remove(part)
+		return err
+	}
+
+	// Masters merged before the catalog recorded merges date from when they were written
+	if p.At.IsZero() {
+		p.At = info.ModTime()
+	}
+
+	app.videoCatalog.RecordProvenance(uuid, *p)
+
+	return app.videoCatalog.Save()
+}
+
+// Directory fragments of accidental recordings are moved to.
+func (app *app) quarantineDir() string {
+
+	if app.root.Cleanup != nil && app.root.Cleanup.QuarantineDirPath != "" {
+		return app.root.Cleanup.QuarantineDirPath
+	}
+
+	return filepath.Join(app.stateDir(), ".stopcon-quarantine")
+}
+
+// What tells whether [VideoWhole] was recorded by accident: its length, the brightness of its middle frame and the peak of its audio.
+func (vw VideoWhole) signs() cleanup.Signs {
+
+	s := cleanup.Signs{Duration: vw.duration()}
+
+	// Only the first fragment is sampled; accidents rarely run longer
+	f := vw.Fragments[0]
+
+	middle := strconv.FormatFloat((f.Duration / 2).Seconds(), 'f', 3, 64)
+	if gray, err := utils.Output(vw.app.newCmdFor(vw.logger(), []string{"ffmpeg", "-hide_banner", "-loglevel", "error", "-ss", middle, "-i", f.InputPath(), "-frames:v", "1", "-vf", "scale=64:36,format=gray", "-f", "rawvideo", "-"}, ""), f.CurrentName); err == nil && len(gray) > 0 {
+		luma := cleanup.MeanLuma(gray)
+		s.Luma = &luma
+	} else if err != nil {
+		vw.logger().Warnf("%v", err)
+	}
+
+	// Lapses are recorded without sound, so silence tells nothing; a bounded stretch of audio is enough to tell
+	if !vw.Lapse {
+		if out, err := vw.app.newCmdFor(vw.logger(), []string{"ffmpeg", "-hide_banner", "-nostats", "-t", "30", "-i", f.InputPath(), "-vn", "-af", "volumedetect", "-f", "null", "-"}, "").CombinedOutput(); err == nil {
+			if peak, ok := cleanup.ParseMaxVolume(string(out)); ok {
+				s.MaxVolume = &peak
+			}
+		}
+	}
+
+	return s
+}
+
+// List likely accidental recordings with the reasons they were flagged, then move those picked by flag or, interactively, by keystroke to quarantine.
+func (app *app) cleanupVideos() error {
+
+	opts := app.root.Cleanup
+	thresholds := cleanup.Thresholds{Duration: opts.MaxDuration, Luma: opts.DarkLevel, MaxVolume: opts.SilentLevel}
+
+	reasonText := map[string]string{
+		cleanup.Short:  locale.T("CleanupShort", "short"),
+		cleanup.Dark:   locale.T("CleanupDark", "dark"),
+		cleanup.Silent: locale.T("CleanupSilent", "silent"),
+	}
+
+	flagged := []*VideoWhole{}
+
+	for _, vw := range app.videoList.ordered("oldest-first") {
+
+		reasons := vw.signs().Reasons(thresholds)
+		if len(reasons) == 0 {
+			continue
+		}
+
+		flagged = append(flagged, vw)
+
+		for i, r := range reasons {
+			reasons[i] = reasonText[r]
+		}
+
+		fmt.Printf("%s %s\n", styleBold.Render(fmt.Sprintf("%d)", len(flagged))), locale.Td("CleanupEntry", "Recording {{.Id}} ({{.Duration}}, {{.Fragments}} fragments): {{.Reasons}}", map[string]any{"Id": styleExample.Render(vw.Id), "Duration": vw.duration().Round(time.Second), "Fragments": len(vw.Fragments), "Reasons": strings.Join(reasons, ", ")}))
+
+	}
+
+	if len(flagged) == 0 {
+		log.Info(locale.T("CleanupNone", "No recordings look accidental"))
+		return nil
+	}
+
+	picks := opts.Quarantine
+
+	// Offer quarantine right away when someone is at the keyboard
+	if info, err := os.Stdin.Stat(); len(picks) == 0 && !app.root.DryRun && err == nil && info.Mode()&os.ModeCharDevice != 0 {
+
+		answer := app.ask(locale.T("CleanupPrompt", "Quarantine which? [numbers, a for all, Enter for none]"))
+
+		if answer == "a" {
+			picks = []string{"all"}
+		}
+
+		for _, field := range strings.Fields(answer) {
+			if n, err := strconv.Atoi(field); err == nil && n >= 1 && n <= len(flagged) {
+				picks = append(picks, catalog.Pick(flagged[n-1].key()))
+			}
+		}
+
+	}
+
+	all := len(picks) == 1 && picks[0] == "all"
+
+	moved := []*VideoWhole{}
+	for _, vw := range flagged {
+		if all || len(picks) > 0 && picked(picks, vw.key()) {
+			moved = append(moved, vw)
+		}
+	}
+
+	if len(moved) == 0 {
+		return nil
+	}
+
+	// Originals are left untouched in copy mode, and an archive cannot be changed at all
+	if app.root.CopyDirPath != "" || app.inputArchive != nil {
+		return errors.New(locale.T("CleanupReadOnly", "fragments cannot be quarantined in copy mode or from an archive"))
+	}
+
+	dir := app.quarantineDir()
+
+	if app.root.DryRun {
+		for _, vw := range moved {
+			log.Info(locale.Td("QuarantineDryRun", "Would quarantine recording {{.Id}} into {{.Dir}}", map[string]any{"Id": vw.Id, "Dir": dir}))
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, vw := range moved {
+
+		for _, f := range vw.Fragments {
+			if err := app.newRenamer().Rename(app.runCtx, f.InputPath(), filepath.Join(dir, f.CurrentName)); err != nil {
+				return err
+			}
+		}
+
+		log.Info(locale.Td("Quarantined", "Quarantined recording {{.Id}} into {{.Dir}}", map[string]any{"Id": vw.Id, "Dir": styleDestination.Render(dir)}))
+
+	}
+
+	return nil
+}
+
+// Mark recording of given catalog key as needing attention after failing stage, so triage can show and retry it.
+func (app *app) quarantine(key string, stage string, err error) {
+
+	app.recordFailure(err)
+
+	if app.root.DryRun {
+		return
+	}
+
+	dir, _ := os.Getwd()
+
+	// Narrow the command down to the recording, unless it already is
+	retry := append([]string{}, os.Args[1:]...)
+	if app.root.Run != nil && len(app.root.Run.Ids) == 0 || app.root.Run == nil && app.root.Merge != nil && len(app.root.Merge.Ids) == 0 {
+		retry = append(retry, "--id", catalog.Pick(key))
+	}
+
+	app.recordMutex.Lock()
+	defer app.recordMutex.Unlock()
+
+	app.videoCatalog.Recording(key).Failure = &catalog.Failure{
+		Stage:  stage,
+		Reason: err.Error(),
+		Fix:    suggestFix(stage, err),
+		Dir:    dir,
+		Retry:  retry,
+		At:     time.Now(),
+	}
+
+	if err := app.videoCatalog.Save(); err != nil {
+		log.Warnf("%v", err)
+	}
+}
+
+// Forget failure of recording of given catalog key if it was at one of stages, which have since gone through.
+func (app *app) resolve(key string, stages ...string) error {
+
+	r := app.videoCatalog.Lookup(key)
+	if r == nil || r.Failure == nil {
+		return nil
+	}
+
+	for _, stage := range stages {
+		if r.Failure.Stage == stage {
+			app.videoCatalog.Resolve(key)
+			return app.videoCatalog.Save()
+		}
+	}
+
+	return nil
+}
+
+// Suggested way to resolve failure at stage, going by its error.
+func suggestFix(stage string, err error) string {
+
+	reason := strings.ToLower(err.Error())
+
+	switch {
+
+	case strings.Contains(reason, "executable file not found"):
+		return locale.T("FixInstall", "install ffmpeg and ffprobe, or put them on PATH")
+
+	case strings.Contains(reason, "no space left"):
+		return locale.T("FixSpace", "free up disk space, or write to another drive with --output-dir")
+
+	case strings.Contains(reason, "permission denied"):
+		return locale.T("FixPermission", "check permissions of the input and output directories")
+
+	case strings.Contains(reason, "moov atom not found"), strings.Contains(reason, "invalid data found"):
+		return locale.T("FixCorrupt", "a fragment is truncated or corrupt; copy it off the card again, or repair it with a tool such as untrunc")
+
+	case stage == "chapters":
+		return locale.T("FixChapters", "remove the extra copy of the chapter")
+
+	case stage == "pictures":
+		return locale.T("FixPictures", "merge again with --mismatched transcode, or move the odd fragments apart")
+
+	case stage == "verify":
+		return locale.T("FixVerify", "compare the merged video against its fragments, or merge again with --merger ffmpeg")
+
+	case stage == "upload":
+		return locale.T("FixUpload", "check network access and credentials of the upload service")
+
+	}
+
+	return locale.T("FixDefault", "look into the reason, then retry")
+}
+
+// List recordings needing attention, then retry or clear those picked by flag or, interactively, by keystroke.
+func (app *app) triage() error {
+
+	for _, key := range app.failedPicked(app.root.Triage.Clear) {
+		app.videoCatalog.Resolve(key)
+	}
+
+	if len(app.root.Triage.Clear) > 0 {
+		if err := app.videoCatalog.Save(); err != nil {
+			return err
+		}
+	}
+
+	keys := app.videoCatalog.Failed()
+	if len(keys) == 0 {
+		log.Info(locale.T("TriageEmpty", "No recordings need attention"))
+		return nil
+	}
+
+	for i, key := range keys {
+
+		f := app.videoCatalog.Lookup(key).Failure
+
+		fmt.Printf("%s %s\n", styleBold.Render(fmt.Sprintf("%d)", i+1)), locale.Td("TriageEntry", "Recording {{.Id}} failed at {{.Stage}} on {{.At}}", map[string]any{"Id": styleExample.Render(catalog.Pick(key)), "Stage": f.Stage, "At": f.At.Format("2006-01-02 15:04")}))
+		fmt.Printf("   %s %s\n", locale.T("TriageReason", "reason:"), f.Reason)
+		fmt.Printf("   %s %s\n", locale.T("TriageFix", "fix:"), f.Fix)
+
+	}
+
+	retry := app.failedPicked(app.root.Triage.Retry)
+
+	// Offer retry right away when someone is at the keyboard
+	if info, err := os.Stdin.Stat(); len(app.root.Triage.Retry) == 0 && !app.root.DryRun && err == nil && info.Mode()&os.ModeCharDevice != 0 {
+
+		answer := app.ask(locale.T("TriagePrompt", "Retry which? [number, a for all, Enter for none]"))
+
+		if answer == "a" {
+			retry = keys
+		} else if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(keys) {
+			retry = []string{keys[n-1]}
+		}
+
+	}
+
+	for _, key := range retry {
+		if err := app.retryFailure(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Catalog keys of recordings needing attention picked by picks, as IDs, ID@DATE or "all"; picks matching none are kept as they are, to be reported.
+func (app *app) failedPicked(picks []string) []string {
+
+	failed := app.videoCatalog.Failed()
+
+	if len(picks) == 1 && picks[0] == "all" {
+		return failed
+	}
+
+	keys := []string{}
+	for _, pick := range picks {
+
+		found := false
+		for _, key := range failed {
+			if catalog.Picks(pick, key) {
+				keys = append(keys, key)
+				found = true
+			}
+		}
+
+		if !found {
+			keys = append(keys, pick)
+		}
+
+	}
+
+	return keys
+}
+
+// Run the failed command of recording of given catalog key again, then tell whether it still needs attention.
+func (app *app) retryFailure(key string) error {
+
+	id := catalog.Pick(key)
+
+	r := app.videoCatalog.Lookup(key)
+	if r == nil || r.Failure == nil {
+		return errors.New(locale.Td("TriageUnknown", "recording {{.Id}} does not need attention", map[string]any{"Id": id}))
+	}
+
+	f := *r.Failure
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	if app.root.DryRun {
+		log.Info(locale.Td("TriageRetryDryRun", "Would retry recording {{.Id}}: stopcon {{.Args}}", map[string]any{"Id": id, "Args": strings.Join(f.Retry, " ")}))
+		return nil
+	}
+
+	log.Info(locale.Td("TriageRetry", "Retrying recording {{.Id}}: stopcon {{.Args}}", map[string]any{"Id": id, "Args": strings.Join(f.Retry, " ")}))
+
+	c := exec.Command(exe, f.Retry...)
+	c.Dir = f.Dir
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	if err := c.Run(); err != nil {
+		return err
+	}
+
+	// The retry wrote its outcome to the catalog
+	if err := app.openCatalog(); err != nil {
+		return err
+	}
+
+	if r := app.videoCatalog.Lookup(key); r != nil && r.Failure != nil {
+		log.Warn(locale.Td("TriageStillFailing", "Recording {{.Id}} still needs attention: {{.Reason}}", map[string]any{"Id": id, "Reason": r.Failure.Reason}))
+		return nil
+	}
+
+	log.Info(locale.Td("TriageResolved", "Recording {{.Id}} resolved", map[string]any{"Id": id}))
+
+	return nil
+}
+
+// Compile user-specified naming templates.
+func (app *app) parseTemplates() error {
+
+	var err error
+
+	// Layouts with tokens in braces replace the built-in names, keeping them parseable when read back
+	if app.root.Rename != nil && format.IsLayout(app.root.Rename.NameTemplate) {
+		if err := format.Customize(app.root.Rename.NameTemplate, ""); err != nil {
+			return err
+		}
+	} else if app.root.Rename != nil && app.root.Rename.NameTemplate != "" {
+		if app.renameTemplate, err = naming.Parse(app.root.Rename.NameTemplate); err != nil {
+			return err
+		}
+	}
+
+	if app.root.Merge != nil && format.IsLayout(app.root.Merge.NameTemplate) {
+		if err := format.Customize("", app.root.Merge.NameTemplate); err != nil {
+			return err
+		}
+	} else if app.root.Merge != nil && app.root.Merge.NameTemplate != "" {
+		if app.mergeTemplate, err = naming.Parse(app.root.Merge.NameTemplate); err != nil {
+			return err
+		}
+	}
+
+	if app.root.Simulate != nil && app.root.Simulate.NameTemplate != "" {
+		if app.renameTemplate, err = naming.Parse(app.root.Simulate.NameTemplate); err != nil {
+			return err
+		}
+	}
+
+	if app.root.Simulate != nil && app.root.Simulate.MergeTemplate != "" {
+		if app.mergeTemplate, err = naming.Parse(app.root.Simulate.MergeTemplate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Create library skeleton.
+func (app *app) initLibrary() error {
+
+	l, err := library.Init(app.root.Init.LibraryDirPath)
+	if err != nil {
+		return err
+	}
+
+	log.Info(locale.Td("LibraryInitialized", "Initialized library in {{.Dir}}", map[string]any{"Dir": styleDestination.Render(l.Root)}))
+
+	return nil
+}
+
+// Fill in paths the user left out from library, erroring if still missing.
+func (app *app) applyLibrary() error {
+
+	// Look for a library around the working directory if none was given
+	if app.root.LibraryDirPath == "" {
+		if l, err := library.Find("."); err == nil {
+			log.Debugf("Using library %s", l.Root)
+			app.root.LibraryDirPath = l.Root
+		}
+	}
+
+	if app.root.LibraryDirPath != "" {
+
+		l, err := library.Open(app.root.LibraryDirPath)
+		if err != nil {
+			return err
+		}
+
+		app.videoLibrary = l
+
+		if app.root.InputDirPath == "" {
+			app.root.InputDirPath = l.Incoming()
+		}
+
+		if app.root.CatalogFilePath == "" {
+			app.root.CatalogFilePath = l.CatalogPath()
+		}
+
+		if app.root.ConfigFilePath == "" {
+			app.root.ConfigFilePath = l.ConfigPath()
+		}
+
+		if app.root.ManifestFilePath == "" {
+			app.root.ManifestFilePath = l.ManifestPath()
+		}
+
+		if app.root.Merge != nil && app.root.Merge.OutputDirPath == "" {
+			app.root.Merge.OutputDirPath = l.Masters()
+		}
+
+		if app.root.Package != nil && app.root.Package.MergedDirPath == "" {
+			app.root.Package.MergedDirPath = l.Masters()
+		}
+
+		if app.root.Package != nil && app.root.Package.OutputDirPath == "" {
+			app.root.Package.OutputDirPath = l.Proxies()
+		}
+
+		if app.root.Preview != nil && app.root.Preview.MergedDirPath == "" {
+			app.root.Preview.MergedDirPath = l.Masters()
+		}
+
+		if app.root.Preview != nil && app.root.Preview.OutputDirPath == "" {
+			app.root.Preview.OutputDirPath = l.Proxies()
+		}
+
+		if app.root.Trim != nil && app.root.Trim.MergedDirPath == "" {
+			app.root.Trim.MergedDirPath = l.Masters()
+		}
+
+		if app.root.Verify != nil && app.root.Verify.MergedDirPath == "" {
+			app.root.Verify.MergedDirPath = l.Masters()
+		}
+
+		if app.root.Clean != nil && app.root.Clean.MergedDirPath == "" {
+			app.root.Clean.MergedDirPath = l.Masters()
+		}
+
+		if app.root.Clean != nil && app.root.Clean.PreviewDirPath == "" {
+			app.root.Clean.PreviewDirPath = l.Proxies()
+		}
+
+		if app.root.Tag != nil && app.root.Tag.MergedDirPath == "" {
+			app.root.Tag.MergedDirPath = l.Masters()
+		}
+
+	}
+
+	// Explicitly given files stand in for the input directory
+	if files := app.explicitFiles(); len(files) > 0 {
+
+		if app.root.InputDirPath == "" {
+			app.root.InputDirPath = filepath.Dir(files[0])
+		}
+
+		if app.root.Merge != nil && app.root.Merge.OutputDirPath == "" {
+			app.root.Merge.OutputDirPath = filepath.Dir(files[0])
+		}
+
+	}
+
+	// Configuration is about the library, not its videos
+	if app.root.InputDirPath == "" && app.root.Config == nil {
+		return errors.New(locale.T("InputDirRequired", "--input-dir is required outside of a library"))
+	}
+
+	// Merged videos land beside renamed copies in copy mode
+	if app.root.CopyDirPath != "" && app.root.Merge != nil && app.root.Merge.OutputDirPath == "" {
+		app.root.Merge.OutputDirPath = app.root.CopyDirPath
+	}
+
+	if app.root.CopyDirPath != "" && app.committing(true) {
+		if err := os.MkdirAll(app.root.CopyDirPath, 0o755); err != nil {
+			return err
+		}
+	}
+
+	if app.root.Merge != nil && app.root.Merge.OutputDirPath == "" && app.root.Merge.OutputFilePath == "" {
+		return errors.New(locale.T("OutputDirRequired", "--output-dir is required outside of a library"))
+	}
+
+	if app.root.Package != nil && (app.root.Package.MergedDirPath == "" || app.root.Package.OutputDirPath == "") {
+		return errors.New(locale.T("PackageDirsRequired", "--merged-dir and --output-dir are required outside of a library"))
+	}
+
+	if app.root.Preview != nil && (app.root.Preview.MergedDirPath == "" || app.root.Preview.OutputDirPath == "") {
+		return errors.New(locale.T("PackageDirsRequired", "--merged-dir and --output-dir are required outside of a library"))
+	}
+
+	if app.root.Trim != nil && app.root.Trim.MergedDirPath == "" {
+		return errors.New(locale.T("MergedDirRequired", "--merged-dir is required outside of a library"))
+	}
+
+	if app.root.Verify != nil && app.root.Merge == nil && app.root.Verify.MergedDirPath == "" {
+		return errors.New(locale.T("MergedDirRequired", "--merged-dir is required outside of a library"))
+	}
+
+	if app.root.Tag != nil && app.root.Tag.Provenance && app.root.Tag.MergedDirPath == "" {
+		return errors.New(locale.T("MergedDirRequired", "--merged-dir is required outside of a library"))
+	}
+
+	return nil
+}
+
+// Load configuration and its policies, if any.
+func (app *app) loadConfig() error {
+
+	if app.root.ConfigFilePath == "" {
+		return nil
+	}
+
+	c, err := config.Load(app.root.ConfigFilePath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", app.root.ConfigFilePath, err)
+	}
+
+	app.loadedConfig = c
+
+	if app.policies, err = policy.New(c.Policies); err != nil {
+		return fmt.Errorf("%s: %w", app.root.ConfigFilePath, err)
+	}
+
+	if err := format.Abbreviate(c.Names.Abbreviations, c.Names.DropUniqueId); err != nil {
+		return fmt.Errorf("%s: %w", app.root.ConfigFilePath, err)
+	}
+
+	if err := format.Customize(c.Names.Renamed, c.Names.Merged); err != nil {
+		return fmt.Errorf("%s: %w", app.root.ConfigFilePath, err)
+	}
+
+	return nil
+}
+
+// Report configuration as valid, or print it, with root options as resolved if asked.
+func (app *app) showConfig() error {
+
+	path := app.root.ConfigFilePath
+	if path == "" {
+		path = locale.T("ConfigNone", "no configuration file, defaults apply")
+	}
+
+	if app.root.Config.Check != nil {
+
+		// Policies moving files away are quietly kept in copy mode, which is likely not what was meant
+		for ext, action := range app.loadedConfig.Policies {
+			if a := policy.Action(strings.ToLower(action)); app.root.CopyDirPath != "" && (a == policy.Delete || a == policy.Organize) {
+				log.Warn(locale.Td("PolicyIgnoredInCopyMode", "Policy {{.Action}} for {{.Extension}} is ignored with --copy-mode; files are kept instead", map[string]any{"Action": action, "Extension": ext}))
+			}
+		}
+
+		fmt.Println(locale.Td("ConfigValid", "Configuration is valid: {{.Path}}", map[string]any{"Path": path}))
+
+		return nil
+	}
+
+	fmt.Printf("# %s\n", path)
+
+	if err := app.loadedConfig.Encode(os.Stdout); err != nil {
+		return err
+	}
+
+	if !app.root.Config.Show.Effective {
+		return nil
+	}
+
+	fmt.Printf("\n# %s\n", locale.T("ConfigOptions", "Options from flags, environment and defaults"))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for _, s := range app.root.Settings() {
+
+		env := ""
+		if s.Env != "" {
+			env = "$" + s.Env
+		}
+
+		fmt.Fprintf(w, "# %s\t%s\t%s\n", s.Flag, s.Value, env)
+
+	}
+
+	return w.Flush()
+}
+
+// Carry out policy of file in input directory, returning whether it should still be processed.
+func (app *app) applyPolicy(dir string, name string) bool {
+
+	path := filepath.Join(dir, name)
+	organized := filepath.Join(app.root.InputDirPath, strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")))
+
+	action := app.policies.For(name)
+
+	// Nothing is deleted or moved out from under the source in copy mode, nor out of an archive
+	if (app.root.CopyDirPath != "" || app.inputArchive != nil) && (action == policy.Delete || action == policy.Organize) {
+		action = policy.Keep
+	}
+
+	// Only renames change the input directory; other subcommands merely leave such files out
+	if app.root.Rename == nil && (action == policy.Delete || action == policy.Organize) {
+		action = policy.Keep
+	}
+
+	// Already organized files are found again when scanning recursively
+	if action == policy.Organize && dir == organized {
+		action = policy.Keep
+	}
+
+	switch action {
+
+	case policy.Keep:
+		return false
+
+	case policy.Attach:
+		app.attached = append(app.attached, path)
+		return false
+
+	case policy.Delete:
+
+		log.Info(locale.Td("PolicyDelete", "Deleting {{.Name}} as per policy", map[string]any{"Name": name}))
+
+		if app.committing(app.root.Rename.Commit) {
+			if err := os.Remove(path); err != nil {
+				log.Warnf("%v", err)
+			}
+		}
+
+		return false
+
+	case policy.Organize:
+
+		log.Info(locale.Td("PolicyOrganize", "Moving {{.Name}} into {{.Dir}} as per policy", map[string]any{"Name": name, "Dir": organized}))
+
+		if app.committing(app.root.Rename.Commit) {
+
+			if err := os.MkdirAll(organized, 0o755); err != nil {
+				log.Warnf("%v", err)
+				return false
+			}
+
+			if err := os.Rename(path, filepath.Join(organized, name)); err != nil {
+				log.Warnf("%v", err)
+			}
+
+		}
+
+		return false
+
+	}
+
+	return true
+}
+
+// Name without its extension.
+func stem(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// Remove library files belonging to deleted masters, prune stale manifest entries and report reclaimable space.
+func (app *app) gc() error {
+
+	if app.videoLibrary == nil {
+		return errors.New(locale.T("GcOutsideLibrary", "gc only works inside a library"))
+	}
+
+	masters, err := os.ReadDir(app.videoLibrary.Masters())
+	if err != nil {
+		return err
+	}
+
+	// Lapses are filed below masters, but their previews sit with everyone else's
+	if app.root.LapseDir != "" {
+		lapses, err := os.ReadDir(filepath.Join(app.videoLibrary.Masters(), app.root.LapseDir))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		masters = append(masters, lapses...)
+	}
+
+	stems := []string{}
+	for _, m := range masters {
+		if !m.IsDir() {
+			stems = append(stems, stem(m.Name()))
+		}
+	}
+
+	// Proxies and thumbnails are named after their master, e.g. "NAME.jpg" or "NAME.proxy.mp4"
+	isOrphan := func(name string) bool {
+		for _, s := range stems {
+			if strings.HasPrefix(name, s+".") {
+				return false
+			}
+		}
+		return true
+	}
+
+	derived, err := os.ReadDir(app.videoLibrary.Proxies())
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for _, d := range derived {
+
+		if !d.Type().IsRegular() || !isOrphan(d.Name()) {
+			continue
+		}
+
+		if app.root.DryRun {
+			log.Info(locale.Td("OrphanFound", "Would remove orphan: {{.Name}}", map[string]any{"Name": d.Name()}))
+			removed++
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(app.videoLibrary.Proxies(), d.Name())); err != nil {
+			log.Warnf("%v", err)
+			continue
+		}
+
+		log.Info(locale.Td("OrphanRemoved", "Removed orphan: {{.Name}}", map[string]any{"Name": d.Name()}))
+		removed++
+
+	}
+
+	// Prune manifest entries of vanished files, leaving the file itself alone on a dry run
+	pruned := app.videoManifest.Prune()
+	if !app.root.DryRun {
+		if err := app.videoManifest.Save(); err != nil {
+			return err
+		}
+	}
+
+	// Sum up archived originals past retention
+	reclaimable := int64(0)
+	expired := 0
+	cutoff := time.Now().Add(-app.root.Gc.Retention)
+
+	err = filepath.WalkDir(app.videoLibrary.Archive(), func(path string, d fs.DirEntry, err error) error {
+
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.ModTime().Before(cutoff) {
+			reclaimable += info.Size()
+			expired++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	orphansLabel, prunedLabel := locale.T("GcOrphans", "Orphans removed:"), locale.T("GcPruned", "Manifest entries pruned:")
+	if app.root.DryRun {
+		orphansLabel, prunedLabel = locale.T("GcOrphansDryRun", "Orphans to remove:"), locale.T("GcPrunedDryRun", "Manifest entries to prune:")
+	}
+
+	fmt.Printf("%s %d\n", styleBold.Render(orphansLabel), removed)
+	fmt.Printf("%s %d\n", styleBold.Render(prunedLabel), pruned)
+	fmt.Printf("%s %s\n", styleBold.Render(locale.T("GcReclaimable", "Reclaimable from archive:")), locale.Td("GcReclaimableSize", "{{.Count}} files, {{.Size}} GiB", map[string]any{
+		"Count": expired,
+		"Size":  fmt.Sprintf("%.1f", float64(reclaimable)/(1<<30)),
+	}))
+
+	return nil
+}
+
+// Kind of artifact left behind by earlier runs, with how long it is kept.
+type artifactKind struct {
+	Name      string
+	Retention time.Duration // 0 to keep forever.
+	Patterns  []string      // Globs of artifacts; directories are removed with their contents.
+	Walk      string        // Directory whose files are all artifacts, if any.
+}
+
+// Artifact kinds swept by clean, in report order.
+func (app *app) artifactKinds() []artifactKind {
+
+	c := app.root.Clean
+
+	temp := []string{
+		filepath.Join(os.TempDir(), "stopcon-concat-*.txt"),
+		filepath.Join(os.TempDir(), "stopcon-archive-*"),
+		filepath.Join(os.TempDir(), "stopcon-trim-*"),
+		filepath.Join(app.stateDir(), ".stopcon-probe-*"),
+		filepath.Join(app.stateDir(), ".catalog-*"),
+		filepath.Join(app.stateDir(), ".manifest-*"),
+		filepath.Join(app.stateDir(), ".journal-*"),
+		filepath.Join(app.stateDir(), ".cache-*"),
+	}
+
+	if app.outputDir() != "" {
+		temp = append(temp, filepath.Join(app.outputDir(), "*"+merging.PartSuffix), filepath.Join(app.outputDir(), app.root.LapseDir, "*"+merging.PartSuffix))
+	}
+
+	// Renames of a read-only input directory only live on in its staging copy
+	if c.Staging {
+		temp = append(temp, filepath.Join(os.TempDir(), "stopcon-staging-*"))
+	}
+
+	previews := []string{}
+	if c.PreviewDirPath != "" {
+		for _, pattern := range []string{"*.jpg", "*.vtt", "*.waveform.json"} {
+			previews = append(previews, filepath.Join(c.PreviewDirPath, pattern))
+		}
+	}
+
+	return []artifactKind{
+		{Name: locale.T("CleanTemp", "temporary"), Retention: c.Temp, Patterns: temp},
+		{Name: locale.T("CleanReports", "reports"), Retention: c.Reports, Patterns: []string{filepath.Join(app.root.InputDirPath, ".stopcon-import-*.txt")}},
+		{Name: locale.T("CleanPreviews", "previews"), Retention: c.Previews, Patterns: previews},
+		{Name: locale.T("CleanQuarantine", "quarantine"), Retention: c.Quarantine, Walk: app.quarantineDir()},
+	}
+}
+
+// Paths of kind's artifacts last modified before cutoff, with their sizes; directories count the files within.
+func (k artifactKind) expired(cutoff time.Time) (map[string]int64, error) {
+
+	sizes := map[string]int64{}
+
+	add := func(path string, info fs.FileInfo) error {
+
+		if !info.ModTime().Before(cutoff) {
+			return nil
+		}
+
+		if !info.IsDir() {
+			sizes[path] = info.Size()
+			return nil
+		}
+
+		size := int64(0)
+		err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			size += info.Size()
+			return nil
+		})
+
+		sizes[path] = size
+		return err
+	}
+
+	for _, pattern := range k.Patterns {
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range matches {
+
+			info, err := os.Lstat(path)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := add(path, info); err != nil {
+				return nil, err
+			}
+
+		}
+
+	}
+
+	if k.Walk == "" {
+		return sizes, nil
+	}
+
+	err := filepath.WalkDir(k.Walk, func(path string, d fs.DirEntry, err error) error {
+
+		// Nothing quarantined yet
+		if errors.Is(err, fs.ErrNotExist) && path == k.Walk {
+			return nil
+		}
+
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		return add(path, info)
+	})
+
+	return sizes, err
+}
+
+// Remove artifacts of earlier runs past their retention and report the space freed by kind; without --commit, only list them.
+func (app *app) clean() error {
+
+	commit := app.committing(app.root.Clean.Commit)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !commit {
+		fmt.Fprintln(w, locale.T("CleanHeaderDryRun", "KIND\tRETENTION\tTO REMOVE\tMiB"))
+	} else {
+		fmt.Fprintln(w, locale.T("CleanHeader", "KIND\tRETENTION\tREMOVED\tMiB"))
+	}
+
+	now := time.Now()
+	total := int64(0)
+
+	for _, k := range app.artifactKinds() {
+
+		if k.Retention <= 0 {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\n", k.Name, locale.T("CleanKeep", "kept"))
+			continue
+		}
+
+		sizes, err := k.expired(now.Add(-k.Retention))
+		if err != nil {
+			return err
+		}
+
+		paths := []string{}
+		for path := range sizes {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		// Artifacts still being written belong to a running job, however old
+		writing, err := utils.OpenForWriting(paths)
+		if err != nil {
+			return err
+		}
+
+		removed, freed := 0, int64(0)
+		for _, path := range paths {
+
+			if writing[path] {
+				continue
+			}
+
+			if !commit {
+				log.Info(locale.Td("ArtifactFound", "Would remove: {{.Path}}", map[string]any{"Path": path}))
+			} else if err := os.RemoveAll(path); err != nil {
+				log.Warnf("%v", err)
+				continue
+			} else {
+				log.Debugf("removed %s", path)
+			}
+
+			removed++
+			freed += sizes[path]
+
+		}
+
+		total += freed
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.1f\n", k.Name, k.Retention, removed, float64(freed)/(1<<20))
+
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	label := locale.T("CleanFreed", "Freed:")
+	if !commit {
+		label = locale.T("CleanFreedDryRun", "Would free:")
+	}
+
+	fmt.Printf("\n%s %.1f MiB\n", styleBold.Render(label), float64(total)/(1<<20))
+
+	return nil
+}
+
+// Load manifest from user-specified path or input directory.
+func (app *app) openManifest() error {
+
+	path := app.root.ManifestFilePath
+	if path == "" {
+		path = filepath.Join(app.stateDir(), ".stopcon-manifest.json")
+	}
+
+	m, err := manifest.Open(path)
+	if err != nil {
+		return err
+	}
+
+	app.videoManifest = m
+
+	return nil
+}
+
+// Hash files in parallel with progress shown, caching results in the manifest.
+func (app *app) hashFiles(paths []string, workers int) (map[string]string, error) {
+
+	h := hash.Hasher{
+		Workers:  workers,
+		Manifest: app.videoManifest,
+		Progress: func(done int, total int, path string) {
+
+			// Screen readers cannot follow a line rewritten in place
+			if app.root.Plain {
+				fmt.Println(locale.Td("Hashed", "hashed {{.Done}} of {{.Total}}: {{.Name}}", map[string]any{"Done": done, "Total": total, "Name": filepath.Base(path)}))
+				return
+			}
+
+			fmt.Print("\r" + locale.Td("Hashing", "hashing {{.Done}}/{{.Total}}", map[string]any{"Done": done, "Total": total}))
+			if done == total {
+				fmt.Println()
+			}
+		},
+	}
+
+	sums, err := h.Hash(paths)
+
+	// Keep whatever was hashed, even on failure
+	if saveErr := app.videoManifest.Save(); err == nil {
+		err = saveErr
+	}
+
+	return sums, err
+}
+
+// Rehash a share of checksummed files, erroring if any no longer match their stored checksum.
+func (app *app) scrub() error {
+
+	due := app.videoManifest.DueForScrub(app.root.Scrub.Fraction)
+
+	// Files changed on purpose since being hashed cannot tell bit rot apart, so only intact-looking files are checked
+	paths := []string{}
+	for _, path := range due {
+
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Warn(locale.Td("ScrubMissing", "{{.Path}} is gone", map[string]any{"Path": path}))
+			continue
+		}
+
+		if f := app.videoManifest.Files[path]; f.Size != info.Size() || !f.ModTime.Equal(info.ModTime()) {
+			log.Info(locale.Td("ScrubChanged", "{{.Path}} changed since it was hashed, skipping", map[string]any{"Path": path}))
+			continue
+		}
+
+		paths = append(paths, path)
+
+	}
+
+	// Hash afresh, as the manifest would only hand back its own sums
+	h := hash.Hasher{Workers: app.root.Scrub.Workers}
+	sums, err := h.Hash(paths)
+	if err != nil {
+		log.Warnf("%v", err)
+	}
+
+	now := time.Now()
+	corrupt := 0
+
+	for _, path := range paths {
+
+		sum, ok := sums[path]
+		if !ok {
+			continue
+		}
+
+		if sum != app.videoManifest.Files[path].SHA256 {
+			corrupt++
+			log.Error(locale.Td("ScrubMismatch", "{{.Path}} no longer matches its checksum", map[string]any{"Path": styleError.Render(path)}))
+			continue
+		}
+
+		app.videoManifest.Files[path].Scrubbed = &now
+
+	}
+
+	if err := app.videoManifest.Save(); err != nil {
+		return err
+	}
+
+	fmt.Println(locale.Td("ScrubSummary", "Scrubbed {{.Count}} of {{.Total}} files", map[string]any{"Count": len(sums), "Total": len(due)}))
+
+	if corrupt > 0 {
+		return errors.New(locale.Td("ScrubCorrupt", "{{.Count}} files failed scrubbing; restore them from a backup", map[string]any{"Count": corrupt}))
+	}
+
+	return nil
+}
+
+// Manifest of files as they are now: those in the stored manifest plus any in input directory, rehashed if asked.
+func (app *app) currentManifest() (*manifest.Manifest, error) {
+
+	current := &manifest.Manifest{Files: map[string]*manifest.File{}}
+
+	paths := []string{}
+	for path := range app.videoManifest.Files {
+		paths = append(paths, path)
+	}
+
+	entries, err := os.ReadDir(app.root.InputDirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+
+		if !entry.Type().IsRegular() || utils.IsSystemFile(entry.Name()) {
+			continue
+		}
+
+		path, err := filepath.Abs(filepath.Join(app.root.InputDirPath, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := app.videoManifest.Files[path]; !ok {
+			paths = append(paths, path)
+		}
+
+	}
+
+	existing := []string{}
+
+	for _, path := range paths {
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		current.Files[path] = &manifest.File{Size: info.Size(), ModTime: info.ModTime()}
+		existing = append(existing, path)
+
+	}
+
+	if !app.root.Diff.Verify {
+		return current, nil
+	}
+
+	// Hash afresh, as the stored manifest would only hand back its own sums
+	h := hash.Hasher{}
+	sums, err := h.Hash(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	for path, sum := range sums {
+		current.Files[path].SHA256 = sum
+	}
+
+	return current, nil
+}
+
+// Show files that differ between two manifests, or between the stored manifest and files on disk.
+func (app *app) diff() error {
+
+	older, newer := app.videoManifest, (*manifest.Manifest)(nil)
+
+	var err error
+
+	if app.root.Diff.NewFilePath != "" {
+
+		if older, err = manifest.Open(app.root.Diff.OldFilePath); err != nil {
+			return err
+		}
+
+		if newer, err = manifest.Open(app.root.Diff.NewFilePath); err != nil {
+			return err
+		}
+
+	} else if newer, err = app.currentManifest(); err != nil {
+		return err
+	}
+
+	changes := manifest.Diff(older, newer)
+
+	symbols := map[string]string{manifest.Added: "+", manifest.Removed: "-", manifest.Changed: "~", manifest.Corrupt: "!"}
+	counts := map[string]int{}
+
+	for _, c := range changes {
+
+		counts[c.Kind]++
+
+		line := fmt.Sprintf("%s %s", symbols[c.Kind], c.Path)
+
+		switch c.Kind {
+		case manifest.Changed:
+			line += fmt.Sprintf(" (%d -> %d bytes, %s -> %s)", c.Old.Size, c.New.Size, c.Old.ModTime.Format("2006-01-02 15:04:05"), c.New.ModTime.Format("2006-01-02 15:04:05"))
+			fmt.Println(line)
+		case manifest.Corrupt:
+			fmt.Println(styleError.Render(line + " " + locale.T("DiffCorrupt", "(contents changed, size and time did not)")))
+		default:
+			fmt.Println(line)
+		}
+
+	}
+
+	if len(changes) > 0 {
+		fmt.Println()
+	}
+
+	fmt.Println(locale.Td("DiffSummary", "{{.Added}} added, {{.Removed}} removed, {{.Changed}} changed, {{.Corrupt}} corrupt", map[string]any{
+		"Added": counts[manifest.Added], "Removed": counts[manifest.Removed], "Changed": counts[manifest.Changed], "Corrupt": counts[manifest.Corrupt],
+	}))
+
+	return nil
+}
+
+// Resource usage of a job in progress.
+type jobUsage struct {
+	app *app
+	job manifest.Job
+}
+
+// Start measuring resources used by a job.
+func (app *app) startJob(kind string, id string, output string) *jobUsage {
+	return &jobUsage{app: app, job: manifest.Job{Kind: kind, Id: id, Output: output, Started: time.Now()}}
+}
+
+// Add CPU time of exited process cmd to the job that ran it.
+// Each process is measured on its own, as the CPU time of all children together mixes in those of jobs running alongside.
+func (u *jobUsage) ran(cmd *exec.Cmd) {
+
+	if cmd.ProcessState == nil {
+		return
+	}
+
+	u.job.CPU += cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+}
+
+// Record finished job in manifest, with bytes it read and wrote.
+func (u *jobUsage) finish(read int64, written int64) error {
+
+	u.job.Wall = time.Since(u.job.Started)
+	u.job.BytesRead = read
+	u.job.BytesWritten = written
+
+	u.app.videoManifest.Record(u.job)
+
+	return u.app.videoManifest.Save()
+}
+
+// Summarize manifest, listing recorded jobs if asked.
+func (app *app) stats() error {
+
+	size := int64(0)
+	for _, f := range app.videoManifest.Files {
+		size += f.Size
+	}
+
+	fmt.Printf("%s %d (%.1f GiB)\n", styleBold.Render(locale.T("StatsFiles", "Files:")), len(app.videoManifest.Files), float64(size)/(1<<30))
+	fmt.Printf("%s %d\n", styleBold.Render(locale.T("StatsJobs", "Jobs:")), len(app.videoManifest.Jobs))
+
+	if !app.root.Stats.ListJobs || len(app.videoManifest.Jobs) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, locale.T("StatsJobsHeader", "STARTED\tKIND\tID\tWALL\tCPU\tREAD MiB\tWRITTEN MiB\tMiB/s"))
+
+	for _, j := range app.videoManifest.Jobs {
+
+		throughput := 0.0
+		if j.Wall > 0 {
+			throughput = float64(j.BytesRead) / (1 << 20) / j.Wall.Seconds()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%.1f\t%.1f\t%.1f\n",
+			j.Started.Format("2006-01-02 15:04:05"), j.Kind, j.Id,
+			j.Wall.Round(time.Millisecond), j.CPU.Round(time.Millisecond),
+			float64(j.BytesRead)/(1<<20), float64(j.BytesWritten)/(1<<20), throughput)
+
+	}
+
+	return w.Flush()
+}
+
+// Write SHA-256 checksums of files in input directory in sha256sum format.
+func (app *app) checksum() error {
+
+	output := app.root.Checksum.OutputFilePath
+	if output == "" {
+		output = filepath.Join(app.stateDir(), "SHA256SUMS")
+	}
+
+	entries, err := app.discover()
+	if err != nil {
+		return err
+	}
+
+	// Skip stopcon's own files and any previous checksum output
+	paths := []string{}
+	for _, entry := range entries {
+
+		path := app.entryPath(entry)
+
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".stopcon") || path == filepath.Clean(output) {
+			continue
+		}
+
+		paths = append(paths, path)
+
+	}
+
+	sums, err := app.hashFiles(paths, app.root.Checksum.Workers)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Builder{}
+	// Nested files are listed relative to input directory, so sha256sum -c finds them
+	for _, path := range paths {
+
+		fmt.Fprintf(&lines, "%s  %s\n", sums[path], relPath(app.root.InputDirPath, path))
+
+	}
+
+	if err := os.WriteFile(output, []byte(lines.String()), 0o644); err != nil {
+		return err
+	}
+
+	log.Info(locale.Td("ChecksumsWritten", "Wrote checksums of {{.Count}} files to {{.Path}}", map[string]any{"Count": len(paths), "Path": styleDestination.Render(output)}))
+
+	return nil
+}
+
+// Layout of import batch names, the time the import started.
+const batchLayout = "2006-01-02-150405"
+
+// Copy or download videos from import source into input directory.
+func (app *app) importFiles() error {
+
+	opts := app.root.Import
+
+	// Files of this run are recorded together, so merged videos can be traced back to it
+	batch := time.Now().Format(batchLayout)
+
+	var source importer.Source = importer.DirSource{Dir: opts.FromDirPath, Resume: opts.MTP}
+
+	// Enumerating a camera over MTP is slow, so reuse the listing of an interrupted import
+	if opts.MTP && app.committing(true) {
+
+		key, err := filepath.Abs(opts.FromDirPath)
+		if err != nil {
+			return err
+		}
+
+		cache := filepath.Join(app.root.InputDirPath, ".stopcon-mtp-listing.json")
+		if opts.Relist {
+			os.Remove(cache)
+		}
+
+		source = importer.CachedSource{Source: source, Key: key, Path: cache}
+	}
+
+	if len(opts.Urls) > 0 {
+
+		rate := int64(0)
+		if opts.LimitRate != "" {
+			var err error
+			if rate, err = utils.ParseSize(opts.LimitRate); err != nil {
+				return err
+			}
+		}
+
+		chunk, err := utils.ParseSize(opts.ChunkSize)
+		if err != nil {
+			return err
+		}
+
+		source = importer.HTTPSource{URLs: opts.Urls, Retries: opts.Retries, RateLimit: rate, Connections: opts.Connections, ChunkSize: chunk}
+	}
+
+	if err := app.openCatalog(); err != nil {
+		return err
+	}
+
+	// Leave out files imported before, even if renamed or merged since; downloads of unknown size cannot be told apart
+	known := []importer.Item{}
+	if !opts.Reimport {
+		source = importer.FilteredSource{Source: source, Skip: func(item importer.Item) bool {
+			if item.Size >= 0 && app.videoCatalog.Imported(item.Name, item.Size) {
+				known = append(known, item)
+				return true
+			}
+			return false
+		}}
+	}
+
+	// List what would be fetched; nothing is verified or formatted either
+	if app.root.DryRun {
+
+		pending, err := importer.Plan(source, app.root.InputDirPath)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s\n\n", locale.T("ImportingDryRun", "Importing (Dry Run)"))
+
+		for _, item := range pending {
+			fmt.Printf("%s -> %s\n", item.Location, styleDestination.Render(filepath.Join(app.root.InputDirPath, item.Name)))
+		}
+
+		fmt.Printf("\n%s\n", locale.Td("ImportSummary", "{{.New}} new, {{.Known}} already imported", map[string]any{"New": len(pending), "Known": len(known)}))
+
+		return nil
+	}
+
+	failed := []importer.Item{}
+
+	items, err := importer.Import(source, app.root.InputDirPath, func(item importer.Item, err error) {
+
+		if err != nil {
+			failed = append(failed, item)
+			log.Error(locale.Td("ImportFailed", "Failed to import {{.Name}}: {{.Error}}", map[string]any{"Name": item.Name, "Error": styleError.Render(err.Error())}))
+			return
+		}
+
+		log.Info(locale.Td("Imported", "Imported {{.Name}}", map[string]any{"Name": styleDestination.Render(item.Name)}))
+
+	})
+	importErr := err
+
+	log.Info(locale.Td("ImportSummary", "{{.New}} new, {{.Known}} already imported", map[string]any{"New": len(items), "Known": len(known)}))
+
+	if len(items) > 0 {
+		log.Info(locale.Td("ImportBatch", "Recorded as import batch {{.Batch}}", map[string]any{"Batch": batch}))
+	}
+
+	for _, item := range items {
+		if item.Size >= 0 {
+			app.videoCatalog.RecordImport(item.Name, item.Size, batch)
+		}
+	}
+
+	if saveErr := app.videoCatalog.Save(); err == nil {
+		err = saveErr
+	}
+
+	if batchErr := app.recordBatch(batch, items); err == nil {
+		err = batchErr
+	}
+
+	if listErr := app.saveMediaList(items); listErr != nil {
+		log.Warn(locale.Td("MediaListNotSaved", "Cannot save media list: {{.Error}}", map[string]any{"Error": styleError.Render(listErr.Error())}))
+	}
+
+	// Only a card can be verified end to end and wiped afterwards
+	if opts.FromDirPath == "" {
+		return err
+	}
+
+	// Report even a partial import, so it is clear what is safe
+	if reportErr := app.verifyImport(items, failed, known, importErr != nil); err == nil {
+		err = reportErr
+	}
+
+	return err
+}
+
+// Record files imported by this run in the manifest as batch, so they can be merged, uploaded and rolled back together.
+func (app *app) recordBatch(batch string, items []importer.Item) error {
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	source := app.root.Import.FromDirPath
+	if source == "" && len(app.root.Import.Urls) > 0 {
+		source = app.root.Import.Urls[0]
+	}
+
+	b := manifest.Batch{Name: batch, Source: source, Files: []string{}}
+	for _, item := range items {
+		b.Files = append(b.Files, item.Name)
+		if item.Size > 0 {
+			b.Bytes += item.Size
+		}
+	}
+
+	app.videoManifest.RecordBatch(b)
+
+	return app.videoManifest.Save()
+}
+
+// Whether dir is the root of a GoPro card, recognized by the files the camera writes beside DCIM.
+func isGoProCard(dir string) bool {
+
+	for _, name := range []string{"Get_started_with_GoPro.url", "MISC"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Camera's own media list for files downloaded from its WiFi server, found beside the media URLs.
+func fetchMediaList(u string) (medialist.List, error) {
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return medialist.List{}, err
+	}
+
+	// A camera dropping off WiFi would otherwise hang the import after all files were fetched
+	client := http.Client{Timeout: 30 * time.Second}
+
+	resp, err := client.Get(parsed.Scheme + "://" + parsed.Host + "/gopro/media/list")
+	if err != nil {
+		return medialist.List{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return medialist.List{}, fmt.Errorf("media list: %s", resp.Status)
+	}
+
+	return medialist.Parse(resp.Body)
+}
+
+// Record which chapters the camera or card held, so missing ones can be told apart from ones never recorded.
+func (app *app) saveMediaList(items []importer.Item) error {
+
+	found := medialist.List{}
+
+	switch {
+
+	case len(app.root.Import.Urls) > 0:
+		if !strings.Contains(app.root.Import.Urls[0], "/videos/DCIM/") {
+			return nil
+		}
+
+		list, err := fetchMediaList(app.root.Import.Urls[0])
+		if err != nil {
+			return err
+		}
+		found = list
+
+	case isGoProCard(app.root.Import.FromDirPath):
+		for _, item := range items {
+
+			f := medialist.File{Name: filepath.Base(item.Location)}
+			if info, err := os.Stat(item.Location); err == nil {
+				f.Created = strconv.FormatInt(info.ModTime().Unix(), 10)
+			}
+
+			found.Add(filepath.Base(filepath.Dir(item.Location)), f)
+
+		}
+
+	default:
+		return nil
+
+	}
+
+	if !app.committing(true) {
+		return nil
+	}
+
+	// Replace what earlier imports listed, whose IDs may since have been reused by the camera
+	return found.Save(app.mediaListPath())
+}
+
+// Hash imported card files at both ends and write a report stating whether the card is safe to format.
+// Files that failed to import, or were left out as imported before, are reported unverified; the card is never safe after an import error.
+func (app *app) verifyImport(items []importer.Item, failed []importer.Item, known []importer.Item, importFailed bool) error {
+
+	output := app.root.Import.ReportPath
+	if output == "" {
+		output = filepath.Join(app.root.InputDirPath, ".stopcon-import-"+time.Now().Format("20060102-150405")+".txt")
+	}
+
+	// Read card and copies afresh rather than trusting cached hashes
+	sourceHasher := &hash.Hasher{}
+
+	// Except for a camera over MTP, where files verified by an interrupted import are not read again
+	if app.root.Import.MTP {
+
+		m, err := manifest.Open(filepath.Join(app.root.InputDirPath, ".stopcon-mtp-hashes.json"))
+		if err != nil {
+			return err
+		}
+
+		sourceHasher.Manifest = m
+	}
+
+	report, err := importer.Verify(app.root.Import.FromDirPath, items, app.root.InputDirPath, &hash.Hasher{}, sourceHasher)
+	if err != nil {
+		log.Warnf("%v", err)
+	}
+
+	report.Unverified(failed, app.root.InputDirPath, "FAILED")
+	report.Unverified(known, app.root.InputDirPath, "SKIPPED")
+
+	if sourceHasher.Manifest != nil {
+		if err := sourceHasher.Manifest.Save(); err != nil {
+			log.Warnf("%v", err)
+		}
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	err = report.Write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Info(locale.Td("ImportReportWritten", "Wrote import report to {{.Path}}", map[string]any{"Path": styleDestination.Render(output)}))
+
+	if !report.Safe() || importFailed {
+		return errors.New(locale.T("NotSafeToFormat", "some files could not be verified; do not format card"))
+	}
+
+	log.Info(locale.T("SafeToFormat", "All files verified; safe to format card"))
+
+	if app.root.Import.FormatCard {
+		return app.formatCard(report)
+	}
+
+	return nil
+}
+
+// Read a line of user input after printing question.
+func (app *app) ask(question string) string {
+
+	fmt.Print(question + " ")
+
+	answer, _ := app.stdin.ReadString('\n')
+
+	return strings.TrimSpace(answer)
+}
+
+// Delete verified media from card once the user has confirmed twice.
+func (app *app) formatCard(report importer.Report) error {
+
+	media := report.Media()
+	if len(media) == 0 {
+		log.Warn(locale.T("NoCardMedia", "No verified files under a DCIM directory; nothing to format"))
+		return nil
+	}
+
+	// First confirmation: a plain yes
+	question := locale.Td("FormatConfirm", "Delete {{.Count}} verified files from DCIM on {{.Dir}}? [y/N]", map[string]any{"Count": len(media), "Dir": app.root.Import.FromDirPath})
+	if answer := strings.ToLower(app.ask(question)); answer != "y" && answer != "yes" {
+		log.Info(locale.T("FormatCancelled", "Card left untouched"))
+		return nil
+	}
+
+	// Second confirmation: typed out, so it cannot be a reflex
+	if app.ask(locale.T("FormatConfirmAgain", "This cannot be undone. Type \"format\" to continue:")) != "format" {
+		log.Info(locale.T("FormatCancelled", "Card left untouched"))
+		return nil
+	}
+
+	removed, err := report.WipeMedia()
+
+	log.Info(locale.Td("CardFormatted", "Deleted {{.Count}} files from card", map[string]any{"Count": removed}))
+
+	return err
+}
+
+// Load catalog from user-specified path or input directory.
+func (app *app) openCatalog() error {
+
+	path := app.root.CatalogFilePath
+	if path == "" {
+		path = filepath.Join(app.stateDir(), ".stopcon-catalog.json")
+	}
+
+	c, err := catalog.Open(path)
+	if err != nil {
+		return err
+	}
+
+	app.videoCatalog = c
+
+	return nil
+}
+
+// Upload merged videos to the service picked.
+func (app *app) upload() error {
+
+	if app.root.Upload.Immich != nil {
+		return app.uploadImmich()
+	}
+
+	if app.root.Upload.Photoprism != nil {
+		return app.uploadPhotoprism()
+	}
+
+	if app.root.Upload.Photos != nil {
+		return app.uploadPhotos()
+	}
+
+	return app.uploadYoutube()
+}
+
+// Step of pipeline, named after its subcommand.
+type pipelineStep struct {
+	name string
+	run  func() error
+}
+
+// Take up pipeline steps of configuration as if their subcommands were given on the command line, defaults and validation included.
+func (app *app) loadPipeline() error {
+
+	steps := app.loadedConfig.Pipeline.Steps
+	if len(steps) == 0 {
+		return errors.New(locale.T("NoPipeline", "configuration defines no pipeline steps"))
+	}
+
+	for _, step := range steps {
+
+		s := cmd.CmdRoot{}
+
+		p, err := arg.NewParser(arg.Config{Program: "stopcon"}, &s)
+		if err != nil {
+			return err
+		}
+
+		args, err := utils.ShellSplit(step)
+		if err != nil {
+			return err
+		}
+
+		// Archiving is pruning with the recording just merged already past retention, unless the step says otherwise
+		if len(args) > 0 && args[0] == "archive" {
+			args = append([]string{"prune", "--action", "archive", "--keep", "0"}, args[1:]...)
+		}
+
+		if err := p.Parse(args); err != nil {
+			return fmt.Errorf("%s: %w", step, err)
+		}
+
+		if err := s.PostProcess(); err != nil {
+			return fmt.Errorf("%s: %w", step, err)
+		}
+
+		// Each subcommand has one set of options, so it can only be a step once
+		twice := errors.New(locale.Td("StepTwice", "pipeline step \"{{.Step}}\" given more than once", map[string]any{"Step": step}))
+
+		switch {
+
+		case s.Rename != nil:
+			if app.root.Rename != nil {
+				return twice
+			}
+			app.root.Rename = s.Rename
+			app.pipeline = append(app.pipeline, pipelineStep{"rename", app.renameStep})
+
+		case s.Merge != nil:
+			if app.root.Merge != nil {
+				return twice
+			}
+			app.root.Merge = s.Merge
+			app.pipeline = append(app.pipeline, pipelineStep{"merge", app.merge})
+
+		case s.Verify != nil:
+			if app.root.Verify != nil {
+				return twice
+			}
+			app.root.Verify = s.Verify
+			app.pipeline = append(app.pipeline, pipelineStep{"verify", app.verifyVideos})
+
+		case s.Prune != nil:
+			if app.root.Prune != nil {
+				return twice
+			}
+			app.root.Prune = s.Prune
+			app.pipeline = append(app.pipeline, pipelineStep{args[0], app.prune})
+
+		case s.Preview != nil:
+			if app.root.Preview != nil {
+				return twice
+			}
+			app.root.Preview = s.Preview
+			app.pipeline = append(app.pipeline, pipelineStep{"preview", app.previewVideos})
+
+		case s.Package != nil:
+			if app.root.Package != nil {
+				return twice
+			}
+			app.root.Package = s.Package
+			app.pipeline = append(app.pipeline, pipelineStep{"package", app.packageVideos})
+
+		case s.Upload != nil:
+			if app.root.Upload != nil {
+				return twice
+			}
+			app.root.Upload = s.Upload
+			app.pipeline = append(app.pipeline, pipelineStep{"upload", app.upload})
+
+		default:
+			return errors.New(locale.Td("UnknownStep", "unknown pipeline step \"{{.Step}}\"; steps are rename, merge, verify, preview, package, upload and archive or prune", map[string]any{"Step": step}))
+
+		}
+
+	}
+
+	return nil
+}
+
+// Rename fragments, then have later steps find them under their new names.
+func (app *app) renameStep() error {
+
+	if err := app.rename(); err != nil {
+		return err
+	}
+
+	if !app.committing(app.root.Rename.Commit) {
+		return nil
+	}
+
+	for _, vw := range app.videoList {
+		for i := range vw.Fragments {
+
+			f := &vw.Fragments[i]
+			path := f.NewPath()
+
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+
+			f.CurrentName = f.NewName
+			if dir := filepath.Dir(path); dir != app.root.InputDirPath {
+				f.Dir = dir
+			}
+
+		}
+	}
+
+	return nil
+}
+
+// Carry out pipeline on each recording in turn, so each one is finished before the next starts; a failing step skips the rest for its recording.
+func (app *app) runPipeline() error {
+
+	all := app.videoList
+	defer func() { app.videoList = all }()
+
+	for _, vw := range all.ordered("oldest-first") {
+
+		if !picked(app.root.Run.Ids, vw.key()) {
+			continue
+		}
+
+		log.Info(locale.Td("PipelineRecording", "Processing recording {{.Id}}", map[string]any{"Id": vw.Id}))
+
+		// Steps act on the video list, so narrow it down to this recording
+		app.videoList = VideoList{vw.key(): vw}
+
+		passed := []string{}
+		for _, step := range app.pipeline {
+
+			started := time.Now()
+
+			if err := step.run(); err != nil {
+
+				if app.runCtx.Err() != nil {
+					return interrupted()
+				}
+
+				vw.logger().Warnf("%v", err)
+				app.quarantine(vw.key(), step.name, err)
+				break
+			}
+
+			// Merges resolve their own failures, as they only warn about failing recordings and quarantine them, which leaves nothing for later steps
+			if step.name == "merge" {
+				if r := app.videoCatalog.Lookup(vw.key()); r != nil && r.Failure != nil && !r.Failure.At.Before(started) {
+					break
+				}
+				continue
+			}
+
+			passed = append(passed, step.name)
+
+		}
+
+		if err := app.resolve(vw.key(), passed...); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+}
+
+// Oldest major version of FFmpeg known to take every filter and option passed to it, such as loudnorm.
+const minToolVersion = 4
+
+// Version in the first line of -version output, e.g. "ffprobe version 6.1.1-3ubuntu5"; builds from git name no release.
+var toolVersionRegexp = regexp.MustCompile(`^\S+ version n?(\d+)\.`)
+
+// Resolve tool, e.g. ffprobe, from path given with its --TOOL-path flag, and check that it runs and is not too old.
+func (app *app) findTool(tool string, path string) (string, error) {
+
+	data := map[string]any{"Tool": tool, "Path": path, "Flag": "--" + tool + "-path", "Env": "STOPCON_" + strings.ToUpper(tool), "Min": minToolVersion}
+
+	found, err := exec.LookPath(path)
+	if err != nil {
+		return "", errors.New(locale.Td("ToolMissing", "{{.Tool}} not found as \"{{.Path}}\"; install FFmpeg, or point {{.Flag}} or {{.Env}} at the binary", data))
+	}
+
+	data["Path"] = found
+
+	out, err := exec.CommandContext(app.runCtx, found, "-version").Output()
+	if err != nil {
+		data["Error"] = err
+		return "", errors.New(locale.Td("ToolBroken", "{{.Tool}} at {{.Path}} does not run: {{.Error}}; reinstall FFmpeg, or point {{.Flag}} or {{.Env}} at a working binary", data))
+	}
+
+	// Unknown versions are given the benefit of the doubt
+	if m := toolVersionRegexp.FindSubmatch(out); m != nil {
+		if major, _ := strconv.Atoi(string(m[1])); major < minToolVersion {
+			data["Version"] = major
+			return "", errors.New(locale.Td("ToolTooOld", "{{.Tool}} at {{.Path}} is version {{.Version}}, older than the {{.Min}}.0 needed; upgrade FFmpeg, or point {{.Flag}} or {{.Env}} at a newer binary", data))
+		}
+	}
+
+	return found, nil
+}
+
+// Check ffprobe, and ffmpeg where it will be run, once up front, rather than have every file fail on its own.
+// Merges go ahead by names alone if ffprobe is missing, since stream copying does not strictly need it, and probe results from --probe-data may stand in for it.
+func (app *app) checkTools() error {
+
+	path, err := app.findTool("ffprobe", app.root.FFprobePath)
+	_, missing := exec.LookPath(app.root.FFprobePath)
+	switch {
+	case err == nil:
+		app.root.FFprobePath = path
+	case app.root.Merge != nil && missing != nil:
+		app.goProbeless()
+	// Files it does not list fail on their own
+	case app.root.Merge == nil && app.probeSnapshot != nil:
+		log.Warnf("%v", err)
+	// MP4 files need no ffprobe to be renamed and the like
+	case app.root.Merge == nil && missing != nil && app.root.MetadataReader == "auto":
+		app.probeMissing = true
+		log.Warn(locale.T("ProbeMissingNative", "ffprobe not found; reading MP4 files natively, other containers cannot be read"))
+	default:
+		return err
+	}
+
+	needed := app.root.Trim != nil || app.root.Preview != nil || app.root.Package != nil || (app.root.Merge != nil && app.root.Merge.Merger == "ffmpeg")
+	optional := app.root.Merge != nil && app.root.Merge.Merger == "auto"
+
+	// Dry runs only show what ffmpeg would be run with
+	if app.root.DryRun || !needed && !optional {
+		return nil
+	}
+
+	path, err = app.findTool("ffmpeg", app.root.FFmpegPath)
+	switch {
+	case err == nil:
+		app.root.FFmpegPath = path
+	case needed:
+		return err
+	// Recordings the native merger cannot take fail on their own
+	default:
+		log.Warnf("%v", err)
+	}
+
+	// Tone mapping needs zscale, which builds without zimg lack
+	if err == nil && app.root.Preview != nil && app.root.Preview.ToneMap != "off" && !app.hasFilter("zscale") {
+		app.noZscale = true
+		log.Warn(locale.T("ZscaleMissing", "ffmpeg lacks the zscale filter; stills of HDR footage are not tone-mapped and may look washed out"))
+	}
+
+	return nil
+}
+
+// Whether ffmpeg was built with filter name, going by its -filters listing; if it cannot be listed, filters are taken to be there.
+func (app *app) hasFilter(name string) bool {
+
+	out, err := exec.CommandContext(app.runCtx, app.root.FFmpegPath, "-hide_banner", "-filters").Output()
+	if err != nil {
+		return true
+	}
+
+	// Lines list flags, name, pads and description, e.g. " ... zscale  V->V  Apply resizing, colorspace and bit depth conversion."
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[1] == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Let merges go ahead by names alone, ffprobe being missing.
+func (app *app) goProbeless() {
+
+	app.probeless = true
+
+	if app.probeSnapshot != nil {
+		log.Warn(locale.T("ProbeMissingSnapshot", "ffprobe not found; taking probe results from --probe-data, and dates from names of files it does not list. Merges cannot be verified"))
+		return
+	}
+
+	log.Warn(locale.T("ProbeMissing", "ffprobe not found; merging by names alone, taking dates from renamed names and order from chapter indexes. Codecs, picture variants and durations go unchecked, and merges cannot be verified"))
+}
+
+// Load probe cache from directory receiving stopcon's files, unless told not to.
+// Files unpacked from an archive are new on every run, so there is nothing to cache.
+func (app *app) openProbeCache() {
+
+	if app.root.NoCache || app.inputArchive != nil {
+		return
+	}
+
+	c, err := cache.Open(filepath.Join(app.stateDir(), ".stopcon-cache.json"))
+	if err != nil {
+		log.Warn(locale.Td("CacheUnreadable", "probe cache unreadable, probing every file: {{.Error}}", map[string]any{"Error": err}))
+		return
+	}
+
+	app.probeCache = c
+}
+
+// Keep probe cache for the next run; a dry run leaves every file alone, and probing works without it.
+func (app *app) saveProbeCache() {
+
+	if app.probeCache == nil || app.root.DryRun {
+		return
+	}
+
+	app.probeCache.Prune()
+
+	if err := app.probeCache.Save(); err != nil {
+		log.Warnf("%v", err)
+	}
+}
+
+// Load probe results given with --probe-data.
+func (app *app) openProbeData() error {
+
+	if app.root.ProbeDataPath == "" {
+		return nil
+	}
+
+	s, err := snapshot.Load(app.root.ProbeDataPath)
+	if err != nil {
+		return err
+	}
+
+	app.probeSnapshot = s
+
+	return nil
+}
+
+// Take metadata of [VideoFragment] from probe results given with --probe-data, if they list it as it is now.
+func (vf *VideoFragment) fromSnapshot() (bool, error) {
+
+	if vf.app.probeSnapshot == nil || vf.app.simulating {
+		return false, nil
+	}
+
+	info, err := os.Stat(vf.InputPath())
+	if err != nil {
+		return false, nil
+	}
+
+	metadata := Metadata{}
+	found, err := vf.app.probeSnapshot.Lookup(vf.CurrentName, info.Size(), &metadata)
+	if err != nil || !found {
+		return false, err
+	}
+
+	vf.Metadata = metadata
+
+	return true, nil
+}
+
+// Write probe results of parsed fragments to snapshot at path, for planning elsewhere with --probe-data.
+func (app *app) exportProbes(path string) error {
+
+	s := snapshot.New()
+
+	for _, vw := range app.videoList {
+		for _, f := range vw.Fragments {
+
+			info, err := os.Stat(f.InputPath())
+			if err != nil {
+				return err
+			}
+
+			if err := s.Store(f.CurrentName, info.Size(), f.Metadata); err != nil {
+				return err
+			}
+
+		}
+	}
+
+	if err := s.Save(path); err != nil {
+		return err
+	}
+
+	log.Info(locale.Td("ProbesExported", "Wrote probe results of {{.Count}} files to {{.Path}}", map[string]any{"Count": len(s.Fragments), "Path": path}))
+
+	return nil
+}
+
+// Print how each name in listing would be parsed, grouped and renamed.
+func (app *app) simulate() error {
+
+	buf, err := os.ReadFile(app.root.Simulate.ListingFilePath)
+	if err != nil {
+		return err
+	}
+
+	if err := app.parseTemplates(); err != nil {
+		return err
+	}
+
+	app.simulating = true
+
+	unparsed := []string{}
+
+	for _, line := range strings.Split(string(buf), "\n") {
+
+		// Accept full paths, as pasted from find or ls -R
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name := filepath.Base(line)
+
+		if err := app.addVideo(name); err != nil {
+
+			if app.root.Strict {
+				return errors.New(locale.Td("EntryNotAdded", "entry {{.Name}} cannot be added: {{.Error}}", map[string]any{"Name": name, "Error": err.Error()}))
+			}
+
+			unparsed = append(unparsed, fmt.Sprintf("%s: %v", name, err))
+		}
+
+	}
+
+	app.group()
+	app.migrateCatalog()
+
+	// A listing has no input directory to find a media list in
+	if app.root.MediaListPath != "" {
+		if err := app.reconcileChapters(); err != nil {
+			return err
+		}
+	}
+
+	videos := make([]*VideoWhole, 0, len(app.videoList))
+	for _, vw := range app.videoList {
+		videos = append(videos, vw)
+	}
+
+	// Raw names carry no date, so order recordings by ID
+	sort.SliceStable(videos, func(i, j int) bool {
+		return videos[i].Id < videos[j].Id
+	})
+
+	for _, vw := range videos {
+
+		if err := vw.nameOutput(); err != nil {
+			return err
+		}
+
+		sort.SliceStable(vw.Fragments, func(i, j int) bool {
+			return vw.Fragments[i].Index < vw.Fragments[j].Index
+		})
+
+		fmt.Printf("%s %s\n", styleBold.Render(locale.T("SimulateRecording", "Recording")), vw.Id)
+
+		for _, f := range vw.Fragments {
+			fmt.Printf("  %02d  %s -> %s\n", f.Index, f.CurrentName, styleDestination.Render(f.NewName))
+		}
+
+		if missing := vw.missing(); len(missing) > 0 {
+			fmt.Printf("  %s %v\n", styleBold.Render(locale.T("SimulateMissing", "missing parts:")), missing)
+		}
+
+		fmt.Printf("  %s %s\n\n", styleBold.Render(locale.T("MergeInto", "into")), styleDestination.Render(vw.Name))
+
+	}
+
+	if len(unparsed) > 0 {
+		fmt.Println(styleBold.Render(locale.T("SimulateUnparsed", "Not parseable:")))
+		for _, u := range unparsed {
+			fmt.Printf("  %s\n", styleError.Render(u))
+		}
+		fmt.Println()
+	}
+
+	fmt.Println(locale.Td("SimulateSummary", "{{.Recordings}} recordings, {{.Unparsed}} names not parseable; dates are only known from renamed names", map[string]any{"Recordings": len(videos), "Unparsed": len(unparsed)}))
+
+	return nil
+}
+
+// Print what was parsed from each explicitly given file.
+func (app *app) probe() {
+
+	for i, vw := range app.videoList.ordered("oldest-first") {
+
+		if i > 0 {
+			fmt.Println()
+		}
+
+		sort.SliceStable(vw.Fragments, func(i, j int) bool {
+			return vw.Fragments[i].Index < vw.Fragments[j].Index
+		})
+
+		for _, f := range vw.Fragments {
+
+			fmt.Println(styleBold.Render(f.InputPath()))
+
+			fields := [][2]string{
+				{locale.T("ProbeId", "ID"), f.Id},
+				{locale.T("ProbeIndex", "Part"), strconv.Itoa(f.Index)},
+				{locale.T("ProbeCodec", "Codec"), f.Codec},
+				{locale.T("ProbeCreated", "Created"), f.CreationTimeString()},
+				{locale.T("ProbeTimeSource", "Created from"), f.TimeSource},
+				{locale.T("ProbeDuration", "Duration"), f.Duration.Round(time.Millisecond).String()},
+				{locale.T("ProbeStarred", "Starred"), strconv.FormatBool(f.Starred)},
+				{locale.T("ProbeLapse", "Lapse"), strconv.FormatBool(f.Lapse)},
+				{locale.T("ProbeVariant", "Variant"), f.Variant},
+				{locale.T("ProbeNewName", "New name"), f.NewName},
+				{locale.T("ProbeMergedName", "Merged name"), vw.Name},
+			}
+
+			for _, field := range fields {
+				fmt.Printf("  %-12s %s\n", field[0]+":", field[1])
+			}
+
+		}
+
+		if missing := vw.missing(); len(missing) > 0 {
+			fmt.Printf("  %-12s %v\n", locale.T("SimulateMissing", "missing parts:"), missing)
+		}
+
+	}
+
+}
+
+// Trace files given to lookup back to their recording and import batches by their provenance tag; files that cannot be probed are warned about.
+func (app *app) lookup() error {
+
+	if err := app.requireProbe(); err != nil {
+		return err
+	}
+
+	for i, path := range app.root.Lookup.Files {
+
+		if i > 0 {
+			fmt.Println()
+		}
+
+		fmt.Println(styleBold.Render(path))
+
+		tags, err := app.containerTags(path)
+		if err != nil {
+			log.Warnf("%v", err)
+			app.recordFailure(failure.Wrap(failure.ProbeFailed, err))
+			continue
+		}
+
+		uuid := tags[tagUUID]
+		if uuid == "" {
+			fmt.Println("  " + locale.T("LookupNoTag", "carries no provenance tag"))
+			continue
+		}
+
+		fields := [][2]string{{locale.T("LookupUUID", "UUID"), uuid}}
+
+		p, ok := app.videoCatalog.Provenance[uuid]
+		if !ok {
+
+			// Tagged by another library, or one whose catalog was lost; the tag still tells a little
+			fields = append(fields,
+				[2]string{locale.T("LookupOwner", "Owner"), tags[tagOwner]},
+				[2]string{locale.T("LookupBatches", "Batches"), tags[tagBatch]},
+				[2]string{locale.T("LookupCatalog", "Catalog"), locale.T("LookupUnknown", "not merged into this library")},
+			)
+
+		} else {
+
+			fields = append(fields,
+				[2]string{locale.T("LookupId", "Recording"), p.Id},
+				[2]string{locale.T("LookupOwner", "Owner"), p.Owner},
+				[2]string{locale.T("LookupMerged", "Merged"), p.At.Local().Format("2006-01-02 15:04:05")},
+				[2]string{locale.T("LookupOutput", "Merged to"), p.Output},
+			)
+
+			for _, batch := range p.Batches {
+				fields = append(fields, [2]string{locale.T("LookupBatch", "Batch"), batch + ": " + strings.Join(app.videoCatalog.BatchFiles(batch), ", ")})
+			}
+
+		}
+
+		for _, field := range fields {
+			if field[1] != "" {
+				fmt.Printf("  %-12s %s\n", field[0]+":", field[1])
+			}
+		}
+
+	}
+
+	return nil
+}
+
+// Resolve ffprobe for commands that cannot do without it, not even for MP4 files.
+func (app *app) requireProbe() error {
+
+	path, err := app.findTool("ffprobe", app.root.FFprobePath)
+	if err != nil {
+		return err
+	}
+
+	app.root.FFprobePath = path
+
+	return nil
+}
+
+// Container tags of file at path, keyed in lowercase, as Matroska keeps them in uppercase.
+func (app *app) containerTags(path string) (map[string]string, error) {
+
+	buf, err := utils.Output(app.newCmd([]string{"ffprobe", "-v", "error", "-show_entries", "format_tags", "-print_format", "json", path}, ""), filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+
+	data := ff.ProbeData{}
+	if err := json.Unmarshal(buf, &data); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+
+	tags := map[string]string{}
+	for key, value := range data.Format.Tags {
+		tags[strings.ToLower(key)] = fmt.Sprint(value)
+	}
+
+	return tags, nil
+}
+
+// Show probe data of the files given with --compare side by side, marking fields that keep them from merging by stream copying.
+func (app *app) inspectFiles() error {
+
+	if err := app.requireProbe(); err != nil {
+		return err
+	}
+
+	probes := []map[string]string{}
+	for _, path := range app.root.Inspect.Compare {
+
+		buf, err := utils.Output(app.newCmd(inspect.ProbeArgs(path), ""), filepath.Base(path))
+		if err != nil {
+			return failure.Wrap(failure.ProbeFailed, err)
+		}
+
+		fields, err := inspect.Flatten(buf)
+		if err != nil {
+			return failure.Wrap(failure.ProbeFailed, fmt.Errorf("%s: %w", filepath.Base(path), err))
+		}
+
+		probes = append(probes, fields)
+
+	}
+
+	fields := inspect.Compare(probes[0], probes[1], app.root.Inspect.All)
+
+	// Fields one file lacks
+	value := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+
+	differ, critical := 0, 0
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, " \t%s\t%s\t%s\n", locale.T("InspectField", "FIELD"), app.root.Inspect.Compare[0], app.root.Inspect.Compare[1])
+
+	for _, f := range fields {
+
+		mark := " "
+		if f.Critical {
+			mark = "!"
+			critical++
+		}
+
+		if !f.Same() {
+			differ++
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, f.Key, value(f.A), value(f.B))
+
+	}
+
+	w.Flush()
+	fmt.Println()
+
+	if differ == 0 {
+		fmt.Println(locale.T("InspectSame", "Files agree on every field"))
+		return nil
+	}
+
+	fmt.Println(locale.Td("InspectSummary", "{{.Differ}} fields differ, {{.Critical}} of them keeping the files from merging by stream copying", map[string]any{"Differ": differ, "Critical": critical}))
+
+	return nil
+}
+
+// Add or remove file manager context-menu entries running stopcon on a folder.
+func (app *app) installShell() error {
+
+	if app.root.InstallShell.Uninstall {
+		if err := shell.Uninstall(); err != nil {
+			return err
+		}
+		log.Info(locale.T("ShellUninstalled", "Removed context-menu entry"))
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	command := []string{exe}
+
+	// Entry runs from wherever the file manager pleases, so pin down paths now
+	libraryDir := app.root.LibraryDirPath
+	if libraryDir == "" {
+		if l, err := library.Find("."); err == nil {
+			libraryDir = l.Root
+		}
+	}
+
+	switch {
+	case libraryDir != "":
+		command = append(command, "--library", libraryDir)
+	case app.root.InputDirPath != "":
+		abs, err := filepath.Abs(app.root.InputDirPath)
+		if err != nil {
+			return err
+		}
+		command = append(command, "--input-dir", abs)
+	}
+
+	command = append(command, strings.Fields(app.root.InstallShell.Run)...)
+
+	locations, err := shell.Install(command)
+	if err != nil {
+		return err
+	}
+
+	for _, location := range locations {
+		log.Info(locale.Td("ShellInstalled", "Installed context-menu entry at {{.Location}}", map[string]any{"Location": styleDestination.Render(location)}))
+	}
+
+	return nil
+}
+
+// Switch to screen-reader friendly output: no colors, no timestamps, full level names.
+func usePlainOutput() {
+
+	lipgloss.SetColorProfile(termenv.Ascii)
+	log.SetColorProfile(termenv.Ascii)
+	log.SetReportTimestamp(false)
+
+	styles := log.DefaultStyles()
+	styles.Levels = map[log.Level]lipgloss.Style{
+		log.DebugLevel: lipgloss.NewStyle().SetString("DEBUG"),
+		log.InfoLevel:  lipgloss.NewStyle().SetString("INFO"),
+		log.WarnLevel:  lipgloss.NewStyle().SetString("WARNING"),
+		log.ErrorLevel: lipgloss.NewStyle().SetString("ERROR"),
+		log.FatalLevel: lipgloss.NewStyle().SetString("FATAL"),
+	}
+	log.SetStyles(styles)
+
+}
+
+// Error of a run cut short by the user.
+func interrupted() error {
+	return failure.Wrap(failure.Interrupted, errors.New(locale.T("Interrupted", "interrupted")))
+}
+
+// Record err as a failure of the run, unless another came first.
+func (app *app) recordFailure(err error) {
+
+	app.failureMutex.Lock()
+	defer app.failureMutex.Unlock()
+
+	if app.firstFailure == nil {
+		app.firstFailure = err
+	}
+}
+
+// Log err as ending the run, and record it as its failure.
+func (app *app) fail(err error) {
+	log.Errorf("%v", err)
+	app.recordFailure(err)
+}
+
+// Report the run's outcome and exit with the status of its first failure, see package [failure].
+func (app *app) exit() {
+
+	if app.reporter != nil {
+		app.reporter.Completed("", "run", app.firstFailure)
+	}
+
+	if app.firstFailure != nil {
+		os.Exit(int(failure.ClassOf(app.firstFailure)))
+	}
+}
+
+// Run stopcon as told by the command line.
+func Main() {
+	newApp(Reporter).run()
+}
+
+// Carry out the run as told by the command line.
+func (app *app) run() {
+
+	// Registered first, so it runs once everything else has been cleaned up
+	defer app.exit()
+
+	// Ctrl-C and termination cancel running jobs instead of killing stopcon outright, so half-written files are removed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	app.runCtx = ctx
+
+	// Loggers of concurrent jobs share one output, so whole lines reach it one at a time
+	log.SetOutput(&utils.LockedWriter{W: os.Stderr})
+	log.SetLevel(log.DebugLevel)
+
+	// Pick message language from environment
+	if err := locale.Init(); err != nil {
+		log.Warnf("%v", err)
+	}
+
+	// Parse options
+	arg.MustParse(&app.root)
+
+	// Translate Windows paths before anything else looks at them
+	app.detectWSL()
+
+	// Creation times are read in the user's zone from the start
+	if err := app.loadTimeZone(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	if err := app.loadAssumedDate(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// First input directory receives stopcon's files; others only contribute videos
+	if len(app.root.InputDirPaths) > 0 {
+		app.root.InputDirPath = app.root.InputDirPaths[0]
+	}
+
+	if app.root.Plain {
+		usePlainOutput()
+	}
+
+	// Events go wherever the merged video does not
+	if app.reporter == nil {
+		switch {
+		case app.root.Events == "json" && app.streaming():
+			app.reporter = &report.JSON{W: os.Stderr}
+		case app.root.Events == "json":
+			app.reporter = &report.JSON{W: os.Stdout}
+		default:
+			app.reporter = statusPrinter{app: app}
+		}
+	}
+
+	// Post process of command stuff
+	if err := app.root.PostProcess(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// Create library; no other paths are needed.
+	if app.root.Init != nil {
+		if err := app.initLibrary(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Simulate parsing of listed names; no files are needed.
+	if app.root.Simulate != nil {
+		if err := app.simulate(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Compare probe data of two files; no other paths are needed.
+	if app.root.Inspect != nil {
+		if err := app.inspectFiles(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Register context-menu entry; only the library or input directory is baked in.
+	if app.root.InstallShell != nil {
+		if err := app.installShell(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Compare two manifest files; no other paths are needed.
+	if app.root.Diff != nil && app.root.Diff.NewFilePath != "" {
+		if err := app.diff(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Infer paths from library
+	if err := app.applyLibrary(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// Load configuration, such as per-extension policies
+	if err := app.loadConfig(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// Check or show configuration; a configuration that does not load has already been reported.
+	if app.root.Config != nil {
+		if err := app.showConfig(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Take up pipeline steps as if given on the command line, then infer their paths from the library too
+	if app.root.Run != nil {
+
+		if err := app.loadPipeline(); err != nil {
+			app.fail(err)
+			return
+		}
+
+		if err := app.applyLibrary(); err != nil {
+			app.fail(err)
+			return
+		}
+
+	}
+
+	// Read input from archive, extracting files as needed
+	if err := app.openArchive(); err != nil {
+		app.fail(err)
+		return
+	}
+	defer app.inputArchive.Close()
+
+	// Load manifest of seen files
+	if err := app.openManifest(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// Import videos; nothing else to do until they are in place.
+	if app.root.Import != nil {
+		if err := app.importFiles(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Load catalog of recording details
+	if err := app.openCatalog(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// Resolve import batches picked by --batch
+	if err := app.loadBatches(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// Load journal of changes made by earlier runs
+	if err := app.openJournal(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// Undo latest run; works off the journal alone.
+	if app.root.Undo != nil {
+		if err := app.undo(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Collect garbage; does not need any videos parsed.
+	if app.root.Gc != nil {
+		if err := app.gc(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Clean up expired artifacts; does not need any videos parsed.
+	if app.root.Clean != nil {
+		if err := app.clean(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Scrub checksummed files; works off the manifest alone.
+	if app.root.Scrub != nil {
+		if err := app.scrub(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Compare stored manifest against files on disk.
+	if app.root.Diff != nil {
+		if err := app.diff(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Show statistics; works off the manifest alone.
+	if app.root.Stats != nil {
+		if err := app.stats(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Prune fragments; works off the catalog alone, unless a pipeline step.
+	if app.root.Prune != nil && app.root.Run == nil {
+		if err := app.prune(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Write checksums; does not need any videos parsed.
+	if app.root.Checksum != nil {
+		if err := app.checksum(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// List and retry failed recordings; works off the catalog alone.
+	if app.root.Triage != nil {
+		if err := app.triage(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Trace merged videos back by their provenance tag; works off the catalog alone.
+	if app.root.Lookup != nil {
+		if err := app.lookup(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Tag recording, or merged videos with provenance; does not need any videos parsed.
+	if app.root.Tag != nil && app.root.Tag.Provenance {
+		if err := app.tagProvenance(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	if app.root.Tag != nil {
+		if err := app.tag(); err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Compile naming templates
+	if err := app.parseTemplates(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// Pivot to a staging copy if input directory is read-only
+	if err := app.stageReadOnly(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// Detect SMB share for input directory
+	if err := app.detectSMB(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// Probe results taken elsewhere stand in for probing
+	if err := app.openProbeData(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	// Check ffmpeg and ffprobe; merges fall back to names alone without ffprobe
+	if err := app.checkTools(); err != nil {
+		app.fail(err)
+		return
+	}
+
+	app.openProbeCache()
+
+	// Parse directory supposedly containing GoPro videos, keeping what was probed even if that fails
+	parseErr := app.parseVideos()
+	app.saveProbeCache()
+
+	if parseErr != nil {
+		app.fail(parseErr)
+		return
+	}
+
+	// Show parsed files
+	if app.root.Probe != nil {
+		app.probe()
+		if app.root.Probe.ExportFilePath != "" {
+			if err := app.exportProbes(app.root.Probe.ExportFilePath); err != nil {
+				app.fail(err)
+			}
+		}
+		return
+	}
+
+	// Carry out pipeline; its steps are not run on their own below.
+	if app.root.Run != nil {
+		err := app.runPipeline()
+		app.saveProbeCache()
+		if err != nil {
+			app.fail(err)
+		}
+		return
+	}
+
+	// Rename videos, their probe results following them
+	if app.root.Rename != nil {
+		err := app.rename()
+		app.saveProbeCache()
+		if err != nil {
+			app.fail(err)
 			return
 		}
 	}
 
 	// Merge videos
-	if root.Merge != nil {
-		if err := merge(); err != nil {
-			log.Errorf("%v", err)
+	if app.root.Merge != nil {
+		if err := app.merge(); err != nil {
+			app.fail(err)
+			return
+		}
+	}
+
+	// Verify merged videos again
+	if app.root.Verify != nil {
+		if err := app.verifyVideos(); err != nil {
+			app.fail(err)
+			return
+		}
+	}
+
+	// Write audit report
+	if app.root.Audit != nil {
+		if err := app.auditReport(); err != nil {
+			app.fail(err)
+			return
+		}
+	}
+
+	// Package merged videos for streaming
+	if app.root.Package != nil {
+		if err := app.packageVideos(); err != nil {
+			app.fail(err)
+			return
+		}
+	}
+
+	// Generate scrubbing previews of merged videos
+	if app.root.Preview != nil {
+		if err := app.previewVideos(); err != nil {
+			app.fail(err)
+			return
+		}
+	}
+
+	// Trim merged video
+	if app.root.Trim != nil {
+		if err := app.trimVideos(); err != nil {
+			app.fail(err)
+			return
+		}
+	}
+
+	// Upload merged videos
+	if app.root.Upload != nil {
+		if err := app.upload(); err != nil {
+			app.fail(err)
+			return
+		}
+	}
+
+	// Remove fragments of import batches
+	if app.root.Rollback != nil {
+		if err := app.rollback(); err != nil {
+			app.fail(err)
+			return
+		}
+	}
+
+	// Review likely accidental recordings
+	if app.root.Cleanup != nil {
+		if err := app.cleanupVideos(); err != nil {
+			app.fail(err)
 			return
 		}
 	}
@@ -0,0 +1,132 @@
+package entrypoint
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Fragment of recording id, chapter index, created at created and lasting duration; no time if created is zero.
+func fragment(id string, index int, created time.Time, duration time.Duration) VideoFragment {
+
+	f := VideoFragment{Video: Video{Id: id}, Index: index, Extension: "MP4"}
+	f.CurrentName = "GX0" + string(rune('0'+index)) + id + ".MP4"
+	f.Duration = duration
+
+	if !created.IsZero() {
+		f.CreationTime = &created
+	}
+
+	return f
+}
+
+// Fragments are grouped by ID, and split where the camera's counter wrapped or cards were mixed.
+func TestGroup(t *testing.T) {
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	chapter := 8*time.Minute + 51*time.Second
+
+	tests := []struct {
+		name      string
+		gap       time.Duration
+		fragments []VideoFragment
+		want      map[string][]int // Chapters of each recording, by key.
+	}{
+		{
+			name: "chapters",
+			gap:  time.Hour,
+			fragments: []VideoFragment{
+				fragment("0042", 2, start.Add(chapter), chapter),
+				fragment("0042", 1, start, chapter),
+				fragment("0043", 1, start.Add(time.Hour), chapter),
+			},
+			want: map[string][]int{
+				"0042 2024-05-01T10:00:00Z": {1, 2},
+				"0043 2024-05-01T11:00:00Z": {1},
+			},
+		},
+		{
+			name: "rollover",
+			gap:  time.Hour,
+			fragments: []VideoFragment{
+				fragment("0042", 1, start, chapter),
+				fragment("0042", 2, start.Add(chapter), chapter),
+				fragment("0042", 1, start.AddDate(1, 0, 0), chapter),
+			},
+			want: map[string][]int{
+				"0042 2024-05-01T10:00:00Z": {1, 2},
+				"0042 2025-05-01T10:00:00Z": {1},
+			},
+		},
+		{
+			name: "within gap",
+			gap:  time.Hour,
+			fragments: []VideoFragment{
+				fragment("0042", 1, start, chapter),
+				fragment("0042", 2, start.Add(chapter+59*time.Minute), chapter),
+			},
+			want: map[string][]int{
+				"0042 2024-05-01T10:00:00Z": {1, 2},
+			},
+		},
+		{
+			name: "no gap",
+			fragments: []VideoFragment{
+				fragment("0042", 1, start, chapter),
+				fragment("0042", 2, start.AddDate(1, 0, 0), chapter),
+			},
+			want: map[string][]int{
+				"0042 2024-05-01T10:00:00Z": {1, 2},
+			},
+		},
+		{
+			name: "no times",
+			gap:  time.Hour,
+			fragments: []VideoFragment{
+				fragment("0042", 2, time.Time{}, chapter),
+				fragment("0042", 1, time.Time{}, chapter),
+			},
+			want: map[string][]int{
+				"0042": {1, 2},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			app := newApp(nil)
+			app.root.RolloverGap = test.gap
+
+			// Each fragment on its own, as they are added while parsed
+			for i, f := range test.fragments {
+				f.app = app
+				app.videoList[string(rune('a'+i))] = &VideoWhole{Video: f.Video, Fragments: []VideoFragment{f}}
+			}
+
+			app.group()
+
+			got := map[string][]int{}
+			for key, vw := range app.videoList {
+				for _, f := range vw.Fragments {
+					got[key] = append(got[key], f.Index)
+				}
+				if vw.Expected != len(vw.Fragments) {
+					t.Errorf("%s expects %d fragments, has %d", key, vw.Expected, len(vw.Fragments))
+				}
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("grouped into %v, want %v", got, test.want)
+			}
+
+			for key, indexes := range test.want {
+				if fmt.Sprint(got[key]) != fmt.Sprint(indexes) {
+					t.Errorf("%s has chapters %v, want %v", key, got[key], indexes)
+				}
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,90 @@
+// Package failure sorts errors into classes, so wrappers can branch on what went wrong by exit status or by the class named in JSON events.
+//
+// Exit statuses:
+//
+//	0    success
+//	1    any other failure, e.g. bad options or an unreadable directory
+//	3    not-gopro-file: a name stopcon cannot parse, with --strict
+//	4    missing-chapter: a recording lacks parts or has one twice, and was not merged
+//	5    probe-failed: ffprobe could not read a file, or it lacks a creation time
+//	6    merge-failed: merging a recording failed
+//	7    verify-failed: a merged video does not match its fragments
+//	130  interrupted: the run was cut short with Ctrl-C or terminated
+//	255  invalid command line
+//
+// When several recordings fail, the status is that of the first failure.
+package failure
+
+import "errors"
+
+// Class of failure; its value is the exit status.
+type Class int
+
+const (
+	Other          Class = 1
+	NotGoProFile   Class = 3
+	MissingChapter Class = 4
+	ProbeFailed    Class = 5
+	MergeFailed    Class = 6
+	VerifyFailed   Class = 7
+	Interrupted    Class = 130
+)
+
+// Name of class as written in JSON events.
+func (c Class) String() string {
+
+	switch c {
+	case NotGoProFile:
+		return "not-gopro-file"
+	case MissingChapter:
+		return "missing-chapter"
+	case ProbeFailed:
+		return "probe-failed"
+	case MergeFailed:
+		return "merge-failed"
+	case VerifyFailed:
+		return "verify-failed"
+	case Interrupted:
+		return "interrupted"
+	}
+
+	return "other"
+}
+
+// Error of a known class.
+type Error struct {
+	Class Class
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Err marked as of class; nil stays nil, and errors already classified keep their class.
+func Wrap(class Class, err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	if e := (*Error)(nil); errors.As(err, &e) {
+		return err
+	}
+
+	return &Error{Class: class, Err: err}
+}
+
+// Class of err; [Other] if it was never classified.
+func ClassOf(err error) Class {
+
+	if e := (*Error)(nil); errors.As(err, &e) {
+		return e.Class
+	}
+
+	return Other
+}
@@ -59,13 +59,14 @@ type Stream struct {
 	StartTime     string `json:"start_time"`
 	ExtradataSize int    `json:"extradata_size"`
 
-	Tags           map[string]interface{} `json:"tags,omitempty"`
-	SampleFormat   string                 `json:"sample_fmt,omitempty"`
-	SampleRate     string                 `json:"sample_rate,omitempty"`
-	Channels       int                    `json:"channels,omitempty"`
-	ChannelLayout  string                 `json:"channel_layout,omitempty"`
-	BitsPerSample  int                    `json:"bits_per_sample,omitempty"`
-	InitialPadding int                    `json:"initial_padding,omitempty"`
+	Tags           map[string]interface{}   `json:"tags,omitempty"`
+	SampleFormat   string                   `json:"sample_fmt,omitempty"`
+	SampleRate     string                   `json:"sample_rate,omitempty"`
+	Channels       int                      `json:"channels,omitempty"`
+	ChannelLayout  string                   `json:"channel_layout,omitempty"`
+	BitsPerSample  int                      `json:"bits_per_sample,omitempty"`
+	InitialPadding int                      `json:"initial_padding,omitempty"`
+	SideDataList   []map[string]interface{} `json:"side_data_list,omitempty"`
 }
 
 type Format struct {
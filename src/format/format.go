@@ -3,6 +3,7 @@ package format
 import (
 	"fmt"
 	"regexp"
+	"strings"
 )
 
 type token struct {
@@ -18,11 +19,12 @@ type tokens struct {
 }
 
 type matcher struct {
-	base     string
-	Tokens   tokens
-	Layout   string
-	regexStr string
-	Regex    *regexp.Regexp
+	base      string
+	regexBase string // Base of regex, if literal text needs escaping unlike in base.
+	Tokens    tokens
+	Layout    string
+	regexStr  string
+	Regex     *regexp.Regexp
 }
 
 func (m matcher) compile() matcher {
@@ -58,8 +60,13 @@ func (m matcher) compile() matcher {
 	// Create format
 	m.Layout = fmt.Sprintf(m.base, formatSpecifiers...)
 
+	regexBase := m.base
+	if m.regexBase != "" {
+		regexBase = m.regexBase
+	}
+
 	// Create regex string
-	m.regexStr = fmt.Sprintf("^"+m.base+"$", captureGroups...)
+	m.regexStr = fmt.Sprintf("^"+regexBase+"$", captureGroups...)
 
 	// Create regex
 	m.Regex = regexp.MustCompile(m.regexStr)
@@ -67,14 +74,37 @@ func (m matcher) compile() matcher {
 	return m
 }
 
+// Name in layout, filling in each token from values by token name, e.g. "id".
+func (m matcher) Format(values map[string]any) string {
+
+	args := make([]any, len(m.Tokens.Slice))
+	for i, t := range m.Tokens.Slice {
+		args[i] = values[t.name]
+	}
+
+	return fmt.Sprintf(m.Layout, args...)
+}
+
 var (
 	tokenDate      = token{name: "date", captureGroup: "[0-9]{4}-[0-9]{2}-[0-9]{2} [0-9]{2}_[0-9]{2}_[0-9]{2}", formatSpecifier: "%s"}
 	tokenId        = token{name: "id", captureGroup: "[0-9]{4}", formatSpecifier: "%s"}
 	tokenIndex     = token{name: "index", captureGroup: "[0-9]{2}", formatSpecifier: "%02d"}
 	tokenExtension = token{name: "extension", captureGroup: "[a-zA-Z0-9]+", formatSpecifier: "%s"}
-	tokenCodec     = token{name: "codec", captureGroup: "[XH]", formatSpecifier: "%s"}
+	tokenCodec     = token{name: "codec", captureGroup: "[XHS]", formatSpecifier: "%s"}
+	tokenCodecName = token{name: "codec", captureGroup: "[a-z0-9]*", formatSpecifier: "%s"}
+	tokenCamera    = token{name: "camera", captureGroup: "[A-Za-z0-9]*", formatSpecifier: "%s"}
 )
 
+// Tokens of custom layouts, by name as written in braces.
+var layoutTokens = map[string]token{
+	"date":   tokenDate,
+	"id":     tokenId,
+	"index":  tokenIndex,
+	"ext":    tokenExtension,
+	"codec":  tokenCodecName,
+	"camera": tokenCamera,
+}
+
 // Regex and format for a raw video.
 var Raw = matcher{
 	base:   "G%s%s%s.%s",
@@ -92,3 +122,209 @@ var Merged = matcher{
 	base:   "Recording _-_ Date %s _-_ ID %s.%s",
 	Tokens: tokens{Slice: []token{tokenDate, tokenId, tokenExtension}},
 }.compile()
+
+// Regex and format for a merged video of a recording alone on its day, when IDs of such recordings are dropped; nil otherwise.
+var MergedNoId *matcher
+
+// Full layouts, which names written before abbreviating keep parsing in.
+var (
+	fullRenamed = Renamed
+	fullMerged  = Merged
+)
+
+// Words of renamed and merged layouts that may be abbreviated.
+var Words = []string{"Recording", "Date", "ID", "Part"}
+
+// Alphabet of abbreviations, which must not clash with the separators and tokens of layouts.
+var abbreviationRegex = regexp.MustCompile("^[a-zA-Z0-9]*$")
+
+// Rebuild renamed and merged layouts with each word replaced by its abbreviation, e.g. "Recording" by "Rec"; an empty abbreviation leaves the word out.
+// If dropId is set, [MergedNoId] is built as well.
+func Abbreviate(words map[string]string, dropId bool) error {
+
+	abbreviate := func(base string) string {
+
+		fields := []string{}
+		for _, field := range strings.Split(base, " ") {
+
+			abbreviation, ok := words[field]
+			if !ok {
+				fields = append(fields, field)
+			} else if abbreviation != "" {
+				fields = append(fields, abbreviation)
+			}
+
+		}
+
+		// Dropping the first word leaves a dangling separator
+		return strings.TrimPrefix(strings.Join(fields, " "), "_-_ ")
+	}
+
+	for word, abbreviation := range words {
+
+		known := false
+		for _, w := range Words {
+			known = known || w == word
+		}
+
+		if !known {
+			return fmt.Errorf("unknown word \"%s\" to abbreviate", word)
+		}
+
+		if !abbreviationRegex.MatchString(abbreviation) {
+			return fmt.Errorf("abbreviation \"%s\" may only hold letters and digits", abbreviation)
+		}
+
+	}
+
+	Renamed = matcher{base: abbreviate(fullRenamed.base), Tokens: tokens{Slice: []token{tokenDate, tokenId, tokenIndex, tokenExtension}}}.compile()
+	Merged = matcher{base: abbreviate(fullMerged.base), Tokens: tokens{Slice: []token{tokenDate, tokenId, tokenExtension}}}.compile()
+
+	MergedNoId = nil
+	if dropId {
+		noId := matcher{base: abbreviate("Recording _-_ Date %s.%s"), Tokens: tokens{Slice: []token{tokenDate, tokenExtension}}}.compile()
+		MergedNoId = &noId
+	}
+
+	return nil
+}
+
+// Matcher for custom layout, e.g. "{date} {id} P{index}.{ext}", requiring each of tokens named required.
+func layout(text string, required ...string) (matcher, error) {
+
+	m := matcher{}
+	base, regexBase := strings.Builder{}, strings.Builder{}
+
+	// Literal text is kept as is in names, so it must not act as a format verb or regex
+	literal := func(s string) {
+		base.WriteString(strings.ReplaceAll(s, "%", "%%"))
+		regexBase.WriteString(strings.ReplaceAll(regexp.QuoteMeta(s), "%", "%%"))
+	}
+
+	rest := text
+	for {
+
+		open := strings.Index(rest, "{")
+		if open < 0 {
+			break
+		}
+
+		end := strings.Index(rest[open:], "}")
+		if end < 0 {
+			return m, fmt.Errorf("unclosed \"{\" in layout \"%s\"", text)
+		}
+
+		name := rest[open+1 : open+end]
+
+		t, ok := layoutTokens[name]
+		if !ok {
+			return m, fmt.Errorf("unknown token \"{%s}\" in layout \"%s\"; tokens are {date}, {id}, {index}, {ext}, {codec} and {camera}", name, text)
+		}
+
+		if _, ok := m.Tokens.Map[t.name]; ok {
+			return m, fmt.Errorf("token \"{%s}\" given twice in layout \"%s\"", name, text)
+		}
+
+		if m.Tokens.Map == nil {
+			m.Tokens.Map = map[string]*token{}
+		}
+		m.Tokens.Map[t.name] = &t
+
+		literal(rest[:open])
+		base.WriteString("%s")
+		regexBase.WriteString("%s")
+		m.Tokens.Slice = append(m.Tokens.Slice, t)
+
+		rest = rest[open+end+1:]
+
+	}
+
+	literal(rest)
+
+	for _, name := range required {
+		if _, ok := m.Tokens.Map[layoutTokens[name].name]; !ok {
+			return m, fmt.Errorf("layout \"%s\" needs token \"{%s}\"", text, name)
+		}
+	}
+
+	m.base = base.String()
+	m.regexBase = regexBase.String()
+
+	return m.compile(), nil
+}
+
+// Whether m has a token named name, e.g. "codec".
+func (m matcher) Has(name string) bool {
+	_, ok := m.Tokens.Map[name]
+	return ok
+}
+
+// Whether text is a custom layout with tokens in braces, rather than a Go template.
+func IsLayout(text string) bool {
+	return strings.Contains(text, "{") && !strings.Contains(text, "{{")
+}
+
+// Replace renamed and merged layouts with custom ones, e.g. "{date} {id} P{index}.{ext}"; an empty layout keeps the current one.
+// Renamed names need an ID, index and extension to be grouped again, and merged names an ID and extension.
+func Customize(renamed string, merged string) error {
+
+	if renamed != "" {
+
+		m, err := layout(renamed, "id", "index", "ext")
+		if err != nil {
+			return err
+		}
+
+		Renamed = m
+
+	}
+
+	if merged != "" {
+
+		m, err := layout(merged, "id", "ext")
+		if err != nil {
+			return err
+		}
+
+		Merged = m
+		MergedNoId = nil
+
+	}
+
+	return nil
+}
+
+// Token values of name by token name, in the first of layouts it matches; nil if none does.
+func match(name string, layouts ...*matcher) map[string]string {
+
+	for _, m := range layouts {
+
+		if m == nil {
+			continue
+		}
+
+		matches := m.Regex.FindStringSubmatch(name)
+		if matches == nil {
+			continue
+		}
+
+		values := map[string]string{}
+		for _, t := range m.Tokens.Slice {
+			values[t.name] = matches[t.Index+1]
+		}
+
+		return values
+	}
+
+	return nil
+}
+
+// Token values of renamed video name, in the current layout or the full one.
+func ParseRenamed(name string) map[string]string {
+	return match(name, &Renamed, &fullRenamed)
+}
+
+// Token values of merged video name, in the current layout, without ID, or the full one; "id" is absent without ID.
+func ParseMerged(name string) map[string]string {
+	return match(name, &Merged, MergedNoId, &fullMerged)
+}
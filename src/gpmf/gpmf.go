@@ -0,0 +1,196 @@
+package gpmf
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Single GPS position reported by the camera.
+type Fix struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64   // Meters.
+	Time      time.Time // UTC time from GPS, zero if not reported.
+}
+
+// Key-length-value entry of a GPMF stream.
+type klv struct {
+	key    string
+	kind   byte   // Value type; 0 means nested entries.
+	size   int    // Size of a single structure.
+	repeat int    // Number of structures.
+	data   []byte // Raw value, without padding.
+}
+
+// Parse consecutive KLV entries from buf.
+func parse(buf []byte) ([]klv, error) {
+
+	entries := []klv{}
+
+	for len(buf) >= 8 {
+
+		e := klv{
+			key:    string(buf[:4]),
+			kind:   buf[4],
+			size:   int(buf[5]),
+			repeat: int(binary.BigEndian.Uint16(buf[6:8])),
+		}
+
+		length := e.size * e.repeat
+		padded := (length + 3) &^ 3
+
+		if 8+padded > len(buf) {
+			return nil, errors.New("GPMF entry is truncated")
+		}
+
+		e.data = buf[8 : 8+length]
+		entries = append(entries, e)
+		buf = buf[8+padded:]
+	}
+
+	return entries, nil
+}
+
+// Read integer at index i of a value, honoring its type.
+func (e klv) int(i int) (int64, bool) {
+
+	switch e.kind {
+	case 'l':
+		if 4*i+4 > len(e.data) {
+			return 0, false
+		}
+		return int64(int32(binary.BigEndian.Uint32(e.data[4*i:]))), true
+	case 'L':
+		if 4*i+4 > len(e.data) {
+			return 0, false
+		}
+		return int64(binary.BigEndian.Uint32(e.data[4*i:])), true
+	case 's':
+		if 2*i+2 > len(e.data) {
+			return 0, false
+		}
+		return int64(int16(binary.BigEndian.Uint16(e.data[2*i:]))), true
+	case 'S':
+		if 2*i+2 > len(e.data) {
+			return 0, false
+		}
+		return int64(binary.BigEndian.Uint16(e.data[2*i:])), true
+	}
+
+	return 0, false
+}
+
+// Scale divisor for the n-th field of a sample; SCAL holds either one value for all or one per field.
+func scale(scal klv, n int) float64 {
+
+	if scal.repeat <= 1 {
+		n = 0
+	}
+
+	v, ok := scal.int(n)
+	if !ok || v == 0 {
+		return 1
+	}
+
+	return float64(v)
+}
+
+// First locked GPS position found in a raw GPMF telemetry stream.
+func FirstFix(buf []byte) (Fix, error) {
+
+	devices, err := parse(buf)
+	if err != nil {
+		return Fix{}, err
+	}
+
+	// For each device...
+	for _, device := range devices {
+
+		if device.key != "DEVC" || device.kind != 0 {
+			continue
+		}
+
+		streams, err := parse(device.data)
+		if err != nil {
+			return Fix{}, err
+		}
+
+		// For each stream of device...
+		for _, stream := range streams {
+
+			if stream.key != "STRM" || stream.kind != 0 {
+				continue
+			}
+
+			if fix, ok := streamFix(stream.data); ok {
+				return fix, nil
+			}
+
+		}
+
+	}
+
+	return Fix{}, errors.New("no GPS fix in telemetry")
+}
+
+// GPS position of a single stream, if it carries one with a lock.
+func streamFix(buf []byte) (Fix, bool) {
+
+	entries, err := parse(buf)
+	if err != nil {
+		return Fix{}, false
+	}
+
+	fix := Fix{}
+	scal := klv{}
+	locked := true
+	found := false
+
+	for _, e := range entries {
+
+		switch e.key {
+
+		case "SCAL":
+			scal = e
+
+		// Fix type; 0 means no satellite lock
+		case "GPSF":
+			if v, ok := e.int(0); ok && v == 0 {
+				locked = false
+			}
+
+		// UTC time as "yymmddhhmmss.sss"
+		case "GPSU":
+			if t, err := time.Parse("060102150405.000", string(e.data)); err == nil {
+				fix.Time = t
+			}
+
+		// Older cameras report GPS5, newer ones GPS9; both begin with latitude, longitude and altitude.
+		case "GPS5", "GPS9":
+
+			if e.repeat == 0 {
+				continue
+			}
+
+			// GPS9 is a complex structure, but its leading fields are signed 32-bit integers
+			sample := klv{kind: 'l', data: e.data[:e.size]}
+
+			lat, okLat := sample.int(0)
+			lon, okLon := sample.int(1)
+			alt, okAlt := sample.int(2)
+			if !okLat || !okLon || !okAlt {
+				continue
+			}
+
+			fix.Latitude = float64(lat) / scale(scal, 0)
+			fix.Longitude = float64(lon) / scale(scal, 1)
+			fix.Altitude = float64(alt) / scale(scal, 2)
+			found = true
+
+		}
+
+	}
+
+	return fix, found && locked
+}
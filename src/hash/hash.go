@@ -0,0 +1,137 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/thatpix3l/stopcon/src/manifest"
+)
+
+// Pool of workers hashing files in parallel, caching results in a manifest so no file is hashed twice.
+type Hasher struct {
+	Workers  int                                    // Number of files hashed at once; defaults to number of CPUs.
+	Manifest *manifest.Manifest                     // Cache of earlier results; may be nil.
+	Progress func(done int, total int, path string) // Called after each file; may be nil.
+	mutex    sync.Mutex
+}
+
+// SHA-256 of file at path, as lowercase hex.
+func File(path string) (string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Hash single file, consulting and updating the manifest.
+func (h *Hasher) hashOne(path string) (string, error) {
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+
+	if h.Manifest != nil {
+		h.mutex.Lock()
+		sum, ok := h.Manifest.Hash(abs, info)
+		h.mutex.Unlock()
+
+		if ok {
+			return sum, nil
+		}
+	}
+
+	sum, err := File(abs)
+	if err != nil {
+		return "", err
+	}
+
+	if h.Manifest != nil {
+		h.mutex.Lock()
+		h.Manifest.Store(abs, info, sum)
+		h.mutex.Unlock()
+	}
+
+	return sum, nil
+}
+
+// SHA-256 of each path, keyed by path as given. Hashing continues past failures; the first error is returned.
+func (h *Hasher) Hash(paths []string) (map[string]string, error) {
+
+	workers := h.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	sums := map[string]string{}
+	queue := make(chan string)
+	done := 0
+
+	var firstErr error
+
+	wg := sync.WaitGroup{}
+
+	// Start workers
+	for i := 0; i < workers; i++ {
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for path := range queue {
+
+				sum, err := h.hashOne(path)
+
+				h.mutex.Lock()
+
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("hashing %s: %w", path, err)
+				}
+
+				if err == nil {
+					sums[path] = sum
+				}
+
+				done++
+				if h.Progress != nil {
+					h.Progress(done, len(paths), path)
+				}
+
+				h.mutex.Unlock()
+
+			}
+		}()
+
+	}
+
+	// Feed paths to workers
+	for _, path := range paths {
+		queue <- path
+	}
+	close(queue)
+
+	wg.Wait()
+
+	return sums, firstErr
+}
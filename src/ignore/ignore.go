@@ -0,0 +1,179 @@
+package ignore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// Name of ignore file looked for in input directory.
+const FileName = ".stopconignore"
+
+// Single line of an ignore file.
+type rule struct {
+	pattern  string // Glob, with "/" separators and "**" for any number of directories.
+	negate   bool   // Re-include matches of an earlier rule, from a leading "!".
+	dirOnly  bool   // Only match directories, from a trailing "/".
+	anchored bool   // Match from root of input directory, instead of at any depth.
+}
+
+// Gitignore-style set of patterns; later rules override earlier ones.
+type Matcher struct {
+	rules []rule
+}
+
+// Parse patterns, one per line; blank lines and lines starting with "#" are skipped.
+func Parse(r io.Reader) (*Matcher, error) {
+
+	m := &Matcher{}
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ru := rule{}
+
+		if strings.HasPrefix(line, "!") {
+			ru.negate = true
+			line = line[1:]
+		}
+
+		// Escaped leading characters are taken literally
+		if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			ru.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		// A slash anywhere but the end ties pattern to the root
+		if strings.Contains(line, "/") {
+			ru.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		if line == "" {
+			continue
+		}
+
+		// Validate glob syntax up front, so mistakes surface when loading
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, errors.New("invalid pattern \"" + scanner.Text() + "\"")
+		}
+
+		ru.pattern = line
+		m.rules = append(m.rules, ru)
+
+	}
+
+	return m, scanner.Err()
+}
+
+// Load ignore file at path; a missing file ignores nothing.
+func Load(p string) (*Matcher, error) {
+
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Matcher{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Whether rel, a "/"-separated path relative to the input directory, is ignored.
+func (m *Matcher) Match(rel string, dir bool) bool {
+
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+
+	segments := strings.Split(strings.Trim(rel, "/"), "/")
+
+	// Files inside an ignored directory cannot be re-included, as with git
+	for i := 1; i < len(segments); i++ {
+		if m.matchPath(segments[:i], true) {
+			return true
+		}
+	}
+
+	return m.matchPath(segments, dir)
+}
+
+// Outcome of last rule matching path.
+func (m *Matcher) matchPath(segments []string, dir bool) bool {
+
+	ignored := false
+
+	for _, ru := range m.rules {
+
+		if ru.dirOnly && !dir {
+			continue
+		}
+
+		if ru.matches(segments) {
+			ignored = !ru.negate
+		}
+
+	}
+
+	return ignored
+}
+
+func (ru rule) matches(segments []string) bool {
+
+	// Unanchored patterns match the name at any depth
+	if !ru.anchored {
+		ok, _ := path.Match(ru.pattern, segments[len(segments)-1])
+		return ok
+	}
+
+	return matchSegments(strings.Split(ru.pattern, "/"), segments)
+}
+
+// Match pattern segments against path segments, with "**" spanning zero or more segments.
+func matchSegments(pattern []string, segments []string) bool {
+
+	for len(pattern) > 0 {
+
+		if pattern[0] == "**" {
+
+			// Try each possible number of directories the wildcard spans
+			for skip := 0; skip <= len(segments); skip++ {
+				if matchSegments(pattern[1:], segments[skip:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+
+		pattern = pattern[1:]
+		segments = segments[1:]
+
+	}
+
+	return len(segments) == 0
+}
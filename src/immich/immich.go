@@ -0,0 +1,146 @@
+package immich
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Client of a self-hosted Immich server.
+type Client struct {
+	URL    string // Base URL of server, e.g. "https://photos.example.com".
+	APIKey string
+	http   *http.Client
+}
+
+// Details of an uploaded asset.
+type Asset struct {
+	CreatedAt time.Time
+	Latitude  *float64 // Nil when position is unknown.
+	Longitude *float64
+}
+
+// Create client for server at url authenticating with an API key.
+func New(url string, apiKey string) *Client {
+	return &Client{URL: strings.TrimSuffix(url, "/"), APIKey: apiKey, http: &http.Client{}}
+}
+
+// Send request with API key, decoding a JSON response into dest if non-nil.
+func (c *Client) do(req *http.Request, dest any) error {
+
+	req.Header.Set("x-api-key", c.APIKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if dest == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+// Upload file at path, then set its creation time and position so it lands correctly on the timeline and map.
+// Returns the asset ID.
+func (c *Client) Upload(path string, a Asset) (string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	// Stream multipart body instead of buffering whole video in memory
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+
+		fields := map[string]string{
+			"deviceAssetId":  fmt.Sprintf("%s-%d", filepath.Base(path), info.Size()),
+			"deviceId":       "stopcon",
+			"fileCreatedAt":  a.CreatedAt.Format(time.RFC3339),
+			"fileModifiedAt": info.ModTime().Format(time.RFC3339),
+		}
+
+		for k, v := range fields {
+			if err := mw.WriteField(k, v); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+
+		part, err := mw.CreateFormFile("assetData", filepath.Base(path))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		if _, err := io.Copy(part, f); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		pw.CloseWithError(mw.Close())
+
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, c.URL+"/api/assets", pr)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	uploaded := struct {
+		Id string `json:"id"`
+	}{}
+
+	if err := c.do(req, &uploaded); err != nil {
+		return "", err
+	}
+
+	// Override whatever the server extracted from the file itself
+	update := map[string]any{"dateTimeOriginal": a.CreatedAt.Format(time.RFC3339)}
+	if a.Latitude != nil && a.Longitude != nil {
+		update["latitude"] = *a.Latitude
+		update["longitude"] = *a.Longitude
+	}
+
+	buf, err := json.Marshal(update)
+	if err != nil {
+		return "", err
+	}
+
+	req, err = http.NewRequest(http.MethodPut, c.URL+"/api/assets/"+uploaded.Id, bytes.NewReader(buf))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if err := c.do(req, nil); err != nil {
+		return "", err
+	}
+
+	return uploaded.Id, nil
+}
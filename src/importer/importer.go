@@ -0,0 +1,655 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/utils"
+)
+
+// Suffix of files still being transferred; discovery skips these.
+const partialSuffix = ".part"
+
+// File offered by a [Source].
+type Item struct {
+	Name     string // File name at destination.
+	Size     int64  // Size in bytes, -1 if unknown.
+	Location string // Path or URL within source.
+}
+
+// Place files are imported from, such as a card or a camera's web server.
+type Source interface {
+	List() ([]Item, error)
+	Fetch(item Item, dst string) error
+}
+
+// Files on a mounted card or any local directory, found recursively.
+type DirSource struct {
+	Dir    string
+	Resume bool // Keep partially copied files and copy only the rest, for sources where starting over is slow.
+}
+
+func (s DirSource) List() ([]Item, error) {
+
+	items := []Item{}
+
+	err := filepath.WalkDir(s.Dir, func(p string, d fs.DirEntry, err error) error {
+
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		items = append(items, Item{Name: d.Name(), Size: info.Size(), Location: p})
+
+		return nil
+	})
+
+	return items, err
+}
+
+func (s DirSource) Fetch(item Item, dst string) error {
+
+	tmp := dst + partialSuffix
+
+	if s.Resume {
+		if err := resumeCopy(item.Location, tmp); err != nil {
+			return err
+		}
+		return os.Rename(tmp, dst)
+	}
+
+	os.Remove(tmp)
+
+	if err := utils.CopyFile(context.Background(), item.Location, tmp); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, dst)
+}
+
+// Copy src into tmp, starting after whatever tmp already holds.
+func resumeCopy(src string, tmp string) error {
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := out.Stat()
+	if err == nil {
+		_, err = in.Seek(info.Size(), io.SeekStart)
+	}
+
+	if err == nil {
+		_, err = io.Copy(out, in)
+	}
+
+	if err == nil {
+		err = out.Sync()
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Files served over HTTP, downloaded resumably with retries and an optional bandwidth cap.
+type HTTPSource struct {
+	URLs        []string
+	Retries     int   // Attempts per file.
+	RateLimit   int64 // Bytes per second, 0 for unlimited.
+	Connections int   // Ranged requests per file at once; 1 or less downloads sequentially.
+	ChunkSize   int64 // Bytes per ranged request; files smaller than two chunks download sequentially.
+	Client      *http.Client
+}
+
+func (s HTTPSource) List() ([]Item, error) {
+
+	items := []Item{}
+
+	for _, u := range s.URLs {
+
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, Item{Name: path.Base(parsed.Path), Size: -1, Location: u})
+	}
+
+	return items, nil
+}
+
+func (s HTTPSource) Fetch(item Item, dst string) error {
+
+	var err error
+
+	for attempt := 1; attempt <= s.Retries; attempt++ {
+
+		// Back off a little longer after each failed attempt
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * 2 * time.Second)
+		}
+
+		if err = s.fetchOnce(item.Location, dst+partialSuffix); err == nil {
+			return os.Rename(dst+partialSuffix, dst)
+		}
+
+	}
+
+	return fmt.Errorf("downloading after %d attempts: %w", s.Retries, err)
+}
+
+func (s HTTPSource) client() *http.Client {
+
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+
+	return s.Client
+}
+
+// Download url into tmp once, in parallel chunks where the server allows.
+func (s HTTPSource) fetchOnce(u string, tmp string) error {
+
+	state := chunksPath(tmp)
+
+	if s.Connections > 1 && s.ChunkSize > 0 {
+
+		size, err := s.rangedSize(u)
+		if err != nil {
+			return err
+		}
+
+		if size >= 2*s.ChunkSize {
+			return s.downloadChunked(u, tmp, size)
+		}
+
+	}
+
+	// A chunked attempt leaves holes, so a sequential one cannot resume from it
+	if _, err := os.Stat(state); err == nil {
+		os.Remove(tmp)
+		os.Remove(state)
+	}
+
+	return s.download(u, tmp)
+}
+
+// Size of file at url, or 0 if the server does not serve byte ranges.
+func (s HTTPSource) rangedSize(u string) (int64, error) {
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, nil
+	}
+
+	// Content-Range reads "bytes 0-0/SIZE"
+	contentRange := resp.Header.Get("Content-Range")
+	slash := strings.LastIndex(contentRange, "/")
+	if slash < 0 {
+		return 0, nil
+	}
+
+	size, err := strconv.ParseInt(contentRange[slash+1:], 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+
+	return size, nil
+}
+
+// Hidden file listing chunks of tmp already downloaded, one "START END" byte range per line.
+func chunksPath(tmp string) string {
+	return filepath.Join(filepath.Dir(tmp), "."+filepath.Base(tmp)+".chunks")
+}
+
+// Chunks of tmp already downloaded as recorded by an earlier attempt, by start; nil if tmp cannot be resumed as chunks of size bytes.
+// Resuming takes the same file size and the same chunk size, as chunks of another layout leave holes the recorded ones do not tell.
+func (s HTTPSource) doneChunks(tmp string, size int64) map[int64]bool {
+
+	data, err := os.ReadFile(chunksPath(tmp))
+	if err != nil {
+		return nil
+	}
+
+	if info, err := os.Stat(tmp); err != nil || info.Size() != size {
+		return nil
+	}
+
+	done := map[int64]bool{}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+
+		if line == "" {
+			continue
+		}
+
+		var start, end int64
+		if _, err := fmt.Sscanf(line, "%d %d", &start, &end); err != nil {
+			return nil
+		}
+
+		want := start + s.ChunkSize
+		if want > size {
+			want = size
+		}
+
+		if start%s.ChunkSize != 0 || end != want {
+			return nil
+		}
+
+		done[start] = true
+
+	}
+
+	return done
+}
+
+// Download url of given size into tmp as ranged chunks over several connections, skipping chunks done by earlier attempts.
+// Each chunk is only checked to come back as the range and length asked for; the camera serves no hashes to check contents against.
+// The first chunk to fail stops the others.
+func (s HTTPSource) downloadChunked(u string, tmp string, size int64) error {
+
+	state := chunksPath(tmp)
+
+	done := s.doneChunks(tmp, size)
+	if done == nil {
+		// Whatever tmp holds came from a sequential attempt or another layout, which cannot be told apart from holes
+		os.Remove(tmp)
+		os.Remove(state)
+		done = map[int64]bool{}
+	}
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+
+	stateFile, err := os.OpenFile(state, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	// Closed on the first error, so no further chunks are handed out
+	stop := make(chan struct{})
+
+	offsets := make(chan int64)
+	go func() {
+		defer close(offsets)
+		for offset := int64(0); offset < size; offset += s.ChunkSize {
+			if done[offset] {
+				continue
+			}
+			select {
+			case offsets <- offset:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var firstErr error
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < s.Connections; i++ {
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for offset := range offsets {
+
+				end := offset + s.ChunkSize
+				if end > size {
+					end = size
+				}
+
+				err := s.downloadChunk(u, f, offset, end)
+
+				mutex.Lock()
+				if err == nil {
+					f.Sync()
+					_, err = fmt.Fprintln(stateFile, offset, end)
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+					close(stop)
+				}
+				failed := firstErr != nil
+				mutex.Unlock()
+
+				if failed {
+					return
+				}
+
+			}
+		}()
+
+	}
+
+	wg.Wait()
+
+	err = firstErr
+
+	if closeErr := stateFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(state)
+}
+
+// Download bytes [start, end) of url into f at the same offset, checking the server sent exactly that range.
+func (s HTTPSource) downloadChunk(u string, f *os.File, start int64, end int64) error {
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-%d/", start, end-1)) {
+		return fmt.Errorf("GET %s: unexpected range %q", u, resp.Header.Get("Content-Range"))
+	}
+
+	// Connections share the rate limit
+	var body io.Reader = resp.Body
+	if s.RateLimit > 0 {
+		rate := s.RateLimit / int64(s.Connections)
+		if rate < 1 {
+			rate = 1
+		}
+		body = &limitedReader{r: resp.Body, rate: rate, start: time.Now()}
+	}
+
+	buf := make([]byte, end-start)
+	if _, err := io.ReadFull(body, buf); err != nil {
+		return fmt.Errorf("GET %s: %w", u, err)
+	}
+
+	_, err = f.WriteAt(buf, start)
+
+	return err
+}
+
+// Download url into tmp, resuming from whatever tmp already holds.
+func (s HTTPSource) download(u string, tmp string) error {
+
+	offset := int64(0)
+	if info, err := os.Stat(tmp); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+
+	switch resp.StatusCode {
+
+	// Server resumed where we left off
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+
+	// Server ignored range; start over
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+
+	// Nothing left to download
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil
+
+	default:
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+
+	f, err := os.OpenFile(tmp, flags, 0o644)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader = resp.Body
+	if s.RateLimit > 0 {
+		body = &limitedReader{r: resp.Body, rate: s.RateLimit, start: time.Now()}
+	}
+
+	_, err = io.Copy(f, body)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Reader that sleeps as needed to stay under rate bytes per second.
+type limitedReader struct {
+	r     io.Reader
+	rate  int64
+	start time.Time
+	read  int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+
+	// Read at most a tenth of a second's worth at once so sleeps stay short
+	if max := l.rate / 10; max > 0 && int64(len(p)) > max {
+		p = p[:max]
+	}
+
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+
+	// Sleep until time taken catches up with what the rate allows
+	expected := time.Duration(float64(l.read) / float64(l.rate) * float64(time.Second))
+	if ahead := expected - time.Since(l.start); ahead > 0 {
+		time.Sleep(ahead)
+	}
+
+	return n, err
+}
+
+// Source whose listing is saved to a file and reused, for devices slow to enumerate such as cameras mounted over MTP.
+type CachedSource struct {
+	Source
+	Key  string // What the listing belongs to, e.g. the mount point; a cache saved under another key is ignored.
+	Path string // File holding the listing.
+}
+
+// Listing saved by [CachedSource].
+type listing struct {
+	Key   string
+	Items []Item
+}
+
+func (s CachedSource) List() ([]Item, error) {
+
+	if data, err := os.ReadFile(s.Path); err == nil {
+		l := listing{}
+		if err := json.Unmarshal(data, &l); err == nil && l.Key == s.Key {
+			return l.Items, nil
+		}
+	}
+
+	items, err := s.Source.List()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(listing{Key: s.Key, Items: items})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, os.WriteFile(s.Path, data, 0o644)
+}
+
+// Source leaving out items Skip returns true for, e.g. files imported into the library before.
+type FilteredSource struct {
+	Source
+	Skip func(item Item) bool
+}
+
+func (s FilteredSource) List() ([]Item, error) {
+
+	items, err := s.Source.List()
+	if err != nil {
+		return nil, err
+	}
+
+	kept := []Item{}
+	for _, item := range items {
+		if !s.Skip(item) {
+			kept = append(kept, item)
+		}
+	}
+
+	return kept, nil
+}
+
+// Items of source not yet present in dstDir, i.e. what [Import] would fetch.
+func Plan(source Source, dstDir string) ([]Item, error) {
+
+	items, err := source.List()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []Item{}
+	for _, item := range items {
+		if !imported(item, filepath.Join(dstDir, item.Name)) {
+			pending = append(pending, item)
+		}
+	}
+
+	return pending, nil
+}
+
+// Whether item was already imported into dst by an earlier run.
+func imported(item Item, dst string) bool {
+
+	info, err := os.Stat(dst)
+
+	return err == nil && (item.Size < 0 || info.Size() == item.Size)
+}
+
+// Import every item of source not already present in dstDir, calling progress after each.
+// Returns the items now present in dstDir, including those imported by earlier runs.
+func Import(source Source, dstDir string, progress func(item Item, err error)) ([]Item, error) {
+
+	items, err := source.List()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dstDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	present := []Item{}
+	failed := 0
+
+	for _, item := range items {
+
+		dst := filepath.Join(dstDir, item.Name)
+
+		// Skip files imported by an earlier run
+		if imported(item, dst) {
+			present = append(present, item)
+			continue
+		}
+
+		err := source.Fetch(item, dst)
+		if err != nil {
+			failed++
+		} else {
+			present = append(present, item)
+		}
+
+		if progress != nil {
+			progress(item, err)
+		}
+
+	}
+
+	if failed > 0 {
+		return present, errors.New(strconv.Itoa(failed) + " files failed to import")
+	}
+
+	return present, nil
+}
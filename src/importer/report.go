@@ -0,0 +1,183 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/hash"
+)
+
+// Card file and the copy it was verified against.
+type Entry struct {
+	Source      string
+	Destination string
+	SHA256      string // Hash of source; empty if it could not be read.
+	Verified    bool   // Whether destination hashes the same.
+	Status      string // Why it was not hashed at all, e.g. "FAILED"; empty if it was.
+}
+
+// Record of an import, stating for every source file whether its copy is intact.
+type Report struct {
+	Time        time.Time
+	Source      string
+	Destination string
+	Entries     []Entry
+}
+
+// Whether every file was verified, so the source may be wiped.
+func (r Report) Safe() bool {
+
+	for _, e := range r.Entries {
+		if !e.Verified {
+			return false
+		}
+	}
+
+	return len(r.Entries) > 0
+}
+
+// Hash each imported item at both ends and compare; source files are hashed by sourceHasher, so a slow source may keep its own cache.
+func Verify(source string, items []Item, dstDir string, hasher *hash.Hasher, sourceHasher *hash.Hasher) (Report, error) {
+
+	report := Report{Time: time.Now(), Source: source, Destination: dstDir}
+
+	sources := []string{}
+	copies := []string{}
+	for _, item := range items {
+		sources = append(sources, item.Location)
+		copies = append(copies, filepath.Join(dstDir, item.Name))
+	}
+
+	// Unreadable files simply stay unverified
+	sums, err := sourceHasher.Hash(sources)
+
+	copySums, copyErr := hasher.Hash(copies)
+	if err == nil {
+		err = copyErr
+	}
+
+	for _, item := range items {
+
+		dst := filepath.Join(dstDir, item.Name)
+		sum := sums[item.Location]
+
+		report.Entries = append(report.Entries, Entry{
+			Source:      item.Location,
+			Destination: dst,
+			SHA256:      sum,
+			Verified:    sum != "" && sum == copySums[dst],
+		})
+
+	}
+
+	return report, err
+}
+
+// Add items this run did not copy as unverified entries with status, e.g. "FAILED" for failed imports or "SKIPPED" for ones imported before.
+func (r *Report) Unverified(items []Item, dstDir string, status string) {
+
+	for _, item := range items {
+		r.Entries = append(r.Entries, Entry{Source: item.Location, Destination: filepath.Join(dstDir, item.Name), Status: status})
+	}
+
+}
+
+// Source files of verified entries inside a DCIM directory, i.e. the camera's media rather than anything else on the card.
+func (r Report) Media() []string {
+
+	media := []string{}
+
+	for _, e := range r.Entries {
+
+		if !e.Verified {
+			continue
+		}
+
+		for _, part := range strings.Split(filepath.ToSlash(e.Source), "/") {
+			if strings.EqualFold(part, "DCIM") {
+				media = append(media, e.Source)
+				break
+			}
+		}
+
+	}
+
+	return media
+}
+
+// Delete verified media from the card, leaving its directories and any other files in place.
+// Refuses unless the whole report is safe.
+func (r Report) WipeMedia() (int, error) {
+
+	if !r.Safe() {
+		return 0, errors.New("refusing to wipe card with unverified files")
+	}
+
+	removed := 0
+
+	for _, path := range r.Media() {
+
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+
+		removed++
+
+	}
+
+	return removed, nil
+}
+
+// Write human-readable report, closed by a digest of everything above it so later edits are evident.
+func (r Report) Write(w io.Writer) error {
+
+	b := strings.Builder{}
+
+	fmt.Fprintf(&b, "stopcon import report\n")
+	fmt.Fprintf(&b, "Date:        %s\n", r.Time.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Source:      %s\n", r.Source)
+	fmt.Fprintf(&b, "Destination: %s\n\n", r.Destination)
+
+	verified := 0
+	for _, e := range r.Entries {
+
+		status := "MISMATCH"
+		if e.Status != "" {
+			status = e.Status
+		}
+		if e.Verified {
+			status = "OK"
+			verified++
+		}
+
+		sum := e.SHA256
+		if sum == "" {
+			sum = strings.Repeat("-", 64)
+		}
+
+		fmt.Fprintf(&b, "%s  %-8s  %s -> %s\n", sum, status, e.Source, e.Destination)
+
+	}
+
+	fmt.Fprintf(&b, "\n%d of %d files verified.\n", verified, len(r.Entries))
+
+	if r.Safe() {
+		fmt.Fprintf(&b, "Safe to format card.\n")
+	} else {
+		fmt.Fprintf(&b, "NOT safe to format card.\n")
+	}
+
+	digest := sha256.Sum256([]byte(b.String()))
+	fmt.Fprintf(&b, "Report SHA-256: %s\n", hex.EncodeToString(digest[:]))
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
@@ -0,0 +1,142 @@
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Arguments of ffprobe showing everything about input's container and streams, as read by [Flatten].
+func ProbeArgs(input string) []string {
+	return []string{"ffprobe", "-v", "error", "-print_format", "json", "-show_format", "-show_streams", input}
+}
+
+// Fields of ffprobe output, keyed by path such as "streams[0].codec_name" or "format.tags.creation_time".
+func Flatten(buf []byte) (map[string]string, error) {
+
+	var data any
+	if err := json.Unmarshal(buf, &data); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{}
+	flatten(fields, "", data)
+
+	return fields, nil
+}
+
+func flatten(fields map[string]string, key string, v any) {
+
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if key != "" {
+				k = key + "." + k
+			}
+			flatten(fields, k, child)
+		}
+	case []any:
+		for i, child := range v {
+			flatten(fields, fmt.Sprintf("%s[%d]", key, i), child)
+		}
+	case nil:
+	default:
+		fields[key] = fmt.Sprint(v)
+	}
+}
+
+// Stream fields that must match for the concat demuxer to copy streams of one file after another's.
+var critical = map[string]bool{
+	"codec_type": true, "codec_name": true, "codec_tag_string": true, "profile": true,
+	"width": true, "height": true, "pix_fmt": true, "sample_aspect_ratio": true, "field_order": true,
+	"r_frame_rate": true, "time_base": true, "color_space": true, "color_transfer": true, "color_primaries": true,
+	"sample_fmt": true, "sample_rate": true, "channels": true, "channel_layout": true,
+}
+
+// Field of two files' probe data; a missing value is empty.
+type Field struct {
+	Key      string
+	A        string
+	B        string
+	Critical bool // Differs in a way that keeps stream copying from merging the files.
+}
+
+// Whether the files agree on field.
+func (f Field) Same() bool {
+	return f.A == f.B
+}
+
+// Fields of a and b in order, streams by index; with all unset, only those that differ.
+// Files with different numbers of streams differ critically in format.nb_streams.
+func Compare(a, b map[string]string, all bool) []Field {
+
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+
+	fields := []Field{}
+	for k := range keys {
+
+		f := Field{Key: k, A: a[k], B: b[k]}
+		if f.Same() && !all {
+			continue
+		}
+
+		if !f.Same() {
+			// Tags and dispositions, nested deeper, do not matter
+			_, rest, ok := streamIndex(k)
+			f.Critical = k == "format.nb_streams" || ok && strings.Count(rest, ".") == 1 && critical[strings.TrimPrefix(rest, ".")]
+		}
+
+		fields = append(fields, f)
+
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return less(fields[i].Key, fields[j].Key) })
+
+	return fields
+}
+
+// Order of keys, format before streams and streams by number rather than text, so streams[10] follows streams[9].
+func less(a, b string) bool {
+
+	sa, ra, okA := streamIndex(a)
+	sb, rb, okB := streamIndex(b)
+
+	switch {
+	case okA && okB && sa != sb:
+		return sa < sb
+	case okA && okB:
+		return ra < rb
+	case okA != okB:
+		return okB
+	}
+
+	return a < b
+}
+
+// Index of stream key a belongs to, and what follows it.
+func streamIndex(key string) (int, string, bool) {
+
+	if !strings.HasPrefix(key, "streams[") {
+		return 0, "", false
+	}
+
+	end := strings.Index(key, "]")
+	if end < 0 {
+		return 0, "", false
+	}
+
+	i, err := strconv.Atoi(key[len("streams["):end])
+	if err != nil {
+		return 0, "", false
+	}
+
+	return i, key[end+1:], true
+}
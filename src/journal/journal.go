@@ -0,0 +1,125 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Name of journal file kept beside videos.
+const FileName = ".stopcon-journal.json"
+
+// Kinds of recorded changes.
+const (
+	Rename = "rename" // From was renamed to To.
+	Copy   = "copy"   // From was copied to To, e.g. in copy mode.
+	Merge  = "merge"  // To was written by merging.
+)
+
+// Single change to the file system.
+type Entry struct {
+	Kind string `json:"kind"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// Changes made by one invocation, in order.
+type Run struct {
+	Started time.Time `json:"started"`
+	Args    []string  `json:"args"`
+	Entries []Entry   `json:"entries"`
+}
+
+// Record of runs, so the latest one can be undone.
+type Journal struct {
+	path string
+	Runs []Run `json:"runs"`
+}
+
+// Load journal stored at path; a missing file results in an empty journal.
+func Open(path string) (*Journal, error) {
+
+	j := Journal{path: path}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &j, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, &j); err != nil {
+		return nil, err
+	}
+
+	return &j, nil
+}
+
+// Start a new run invoked with args.
+func (j *Journal) Begin(args []string) {
+	j.Runs = append(j.Runs, Run{Started: time.Now(), Args: args})
+}
+
+// Add entry to the latest run and save right away, so changes made before a crash can still be undone.
+func (j *Journal) Record(e Entry) error {
+
+	if len(j.Runs) == 0 {
+		return errors.New("no run begun")
+	}
+
+	last := &j.Runs[len(j.Runs)-1]
+	last.Entries = append(last.Entries, e)
+
+	return j.Save()
+}
+
+// Latest run, or nil if none.
+func (j *Journal) Last() *Run {
+
+	if len(j.Runs) == 0 {
+		return nil
+	}
+
+	return &j.Runs[len(j.Runs)-1]
+}
+
+// Forget latest run, once undone.
+func (j *Journal) Pop() {
+
+	if len(j.Runs) > 0 {
+		j.Runs = j.Runs[:len(j.Runs)-1]
+	}
+}
+
+// Write journal back to where it was loaded from.
+func (j *Journal) Save() error {
+
+	buf, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated journal
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), ".journal-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), j.path)
+}
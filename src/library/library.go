@@ -0,0 +1,185 @@
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Name of file stamped at the root of every library.
+const MarkerName = ".stopcon-library"
+
+// Standard directories of a library.
+const (
+	DirIncoming = "incoming" // Fresh footage waiting to be processed.
+	DirMasters  = "masters"  // Merged recordings.
+	DirProxies  = "proxies"  // Low-resolution copies for editing and previews.
+	DirArchive  = "archive"  // Original fragments kept after merging.
+)
+
+// Starting configuration written by [Init].
+const defaultConfig = `# stopcon library configuration.
+# Paths are relative to the library root.
+
+# What to do with each file extension found in incoming:
+# process, keep, delete, organize (move into a subdirectory) or attach.
+# [policies]
+# LRV = "delete"
+# THM = "keep"
+# JPG = "organize"
+# WAV = "attach"
+
+# Shorter default names: words may be abbreviated or left out (""),
+# and the ID dropped from merged names of recordings alone on their day.
+# Names written before keep being recognized.
+# [names]
+# drop_unique_id = true
+# Or lay names out anew; tokens are {date}, {id}, {index}, {ext}, {codec} and {camera}.
+# renamed = "{date} {id} P{index}.{ext}"
+# merged = "{date} {camera} {id}.{ext}"
+# [names.abbreviations]
+# Recording = "Rec"
+# Date = ""
+# Part = "P"
+
+# Steps of "stopcon run", carried out on each recording in turn:
+# rename, merge (which also verifies), verify, preview, package, upload,
+# and prune or archive (prune --action archive --keep 0), each with the
+# flags it takes on the command line.
+# [pipeline]
+# steps = ["rename --commit", "merge --sidecar json", "verify", "preview", "package", "archive --commit"]
+`
+
+// Contents of the marker file.
+type marker struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Library of footage rooted at a directory containing a marker file.
+type Library struct {
+	Root string
+}
+
+// Create library skeleton at root and stamp its marker; existing files are left alone.
+func Init(root string) (*Library, error) {
+
+	l := Library{Root: root}
+
+	for _, dir := range []string{DirIncoming, DirMasters, DirProxies, DirArchive} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeIfMissing(l.ConfigPath(), []byte(defaultConfig)); err != nil {
+		return nil, err
+	}
+
+	if err := writeIfMissing(l.CatalogPath(), []byte("{\"recordings\": {}}\n")); err != nil {
+		return nil, err
+	}
+
+	buf, err := json.MarshalIndent(marker{Version: 1, CreatedAt: time.Now()}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeIfMissing(filepath.Join(root, MarkerName), buf); err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// Write file unless it already exists.
+func writeIfMissing(path string, buf []byte) error {
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Open library at root, erroring if it was never initialized.
+func Open(root string) (*Library, error) {
+
+	if _, err := os.Stat(filepath.Join(root, MarkerName)); err != nil {
+		return nil, fmt.Errorf("%s is not a stopcon library: %w", root, err)
+	}
+
+	return &Library{Root: root}, nil
+}
+
+// Find library containing dir by walking up towards the filesystem root, like git does.
+func Find(dir string) (*Library, error) {
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+
+		if _, err := os.Stat(filepath.Join(dir, MarkerName)); err == nil {
+			return &Library{Root: dir}, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errors.New("not inside a stopcon library")
+		}
+
+		dir = parent
+	}
+}
+
+// Directory of fresh footage.
+func (l Library) Incoming() string {
+	return filepath.Join(l.Root, DirIncoming)
+}
+
+// Directory of merged recordings.
+func (l Library) Masters() string {
+	return filepath.Join(l.Root, DirMasters)
+}
+
+// Directory of proxies.
+func (l Library) Proxies() string {
+	return filepath.Join(l.Root, DirProxies)
+}
+
+// Directory of archived originals.
+func (l Library) Archive() string {
+	return filepath.Join(l.Root, DirArchive)
+}
+
+// Path of library catalog.
+func (l Library) CatalogPath() string {
+	return filepath.Join(l.Root, "catalog.json")
+}
+
+// Path of library configuration.
+func (l Library) ConfigPath() string {
+	return filepath.Join(l.Root, "config.toml")
+}
+
+// Path of library manifest.
+func (l Library) ManifestPath() string {
+	return filepath.Join(l.Root, ".stopcon-manifest.json")
+}
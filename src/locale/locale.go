@@ -0,0 +1,82 @@
+package locale
+
+import (
+	"embed"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+// Translations of messages; English lives in code as each message's default.
+//
+//go:embed locales/*.toml
+var locales embed.FS
+
+var localizer = i18n.NewLocalizer(i18n.NewBundle(language.English))
+
+// Language requested by the environment, e.g. "de-DE" from LANG=de_DE.UTF-8, honoring LC_ALL and LC_MESSAGES first.
+func envLanguage() string {
+
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+
+		// Strip encoding and modifier, e.g. ".UTF-8" or "@euro"
+		if i := strings.IndexAny(value, ".@"); i >= 0 {
+			value = value[:i]
+		}
+
+		return strings.ReplaceAll(value, "_", "-")
+	}
+
+	return ""
+}
+
+// Load bundled translations and pick language from the environment.
+func Init() error {
+
+	bundle := i18n.NewBundle(language.English)
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if _, err := bundle.LoadMessageFileFS(locales, "locales/"+f.Name()); err != nil {
+			return err
+		}
+	}
+
+	localizer = i18n.NewLocalizer(bundle, envLanguage())
+
+	return nil
+}
+
+// Translate message with given ID, falling back to English text other.
+func T(id string, other string) string {
+	return Td(id, other, nil)
+}
+
+// Translate message with given ID and template data, falling back to English text other.
+func Td(id string, other string, data map[string]any) string {
+
+	msg, err := localizer.Localize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{ID: id, Other: other},
+		TemplateData:   data,
+	})
+
+	// A missing translation still yields the English default
+	if msg == "" && err != nil {
+		return other
+	}
+
+	return msg
+}
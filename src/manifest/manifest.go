@@ -0,0 +1,278 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// State of a single file when it was last seen.
+type File struct {
+	Size     int64      `json:"size"`
+	ModTime  time.Time  `json:"mod_time"`
+	SHA256   string     `json:"sha256,omitempty"`
+	Scrubbed *time.Time `json:"scrubbed,omitempty"` // When contents were last rehashed and found intact.
+}
+
+// State of a directory when it was last scanned.
+type Dir struct {
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	Entries []string  `json:"entries"`           // Names of all entries, so the directory need not be read again while unchanged.
+	Subdirs []string  `json:"subdirs,omitempty"` // Names of entries that are directories, or links that may lead to one.
+}
+
+// Resources used by a single merge or packaging job.
+type Job struct {
+	Kind         string        `json:"kind"` // "merge" or "package".
+	Id           string        `json:"id"`   // Recording ID.
+	Output       string        `json:"output"`
+	Started      time.Time     `json:"started"`
+	Wall         time.Duration `json:"wall"`
+	CPU          time.Duration `json:"cpu"` // User and system time of the tools it ran, such as ffmpeg; merges done in-process take none.
+	BytesRead    int64         `json:"bytes_read"`
+	BytesWritten int64         `json:"bytes_written"`
+}
+
+// Files brought in by a single import run.
+type Batch struct {
+	Name       string     `json:"name"`                  // Time the import started, e.g. "2024-06-14-153012".
+	Source     string     `json:"source"`                // Card directory or URL imported from.
+	Files      []string   `json:"files"`                 // Names of files imported, as on the camera.
+	Bytes      int64      `json:"bytes"`                 // Total size of files imported.
+	RolledBack *time.Time `json:"rolled_back,omitempty"` // When its files were removed by rollback; nil while in place.
+}
+
+// Persistent record of files seen by stopcon, keyed by absolute path.
+type Manifest struct {
+	path    string
+	Files   map[string]*File `json:"files"`
+	Dirs    map[string]*Dir  `json:"dirs,omitempty"`
+	Jobs    []Job            `json:"jobs,omitempty"`
+	Batches []*Batch         `json:"batches,omitempty"` // Import runs, oldest first.
+}
+
+// Load manifest stored at path; a missing file results in an empty manifest.
+func Open(path string) (*Manifest, error) {
+
+	m := Manifest{path: path, Files: map[string]*File{}, Dirs: map[string]*Dir{}}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &m, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, err
+	}
+
+	// File may contain an explicit null
+	if m.Files == nil {
+		m.Files = map[string]*File{}
+	}
+
+	if m.Dirs == nil {
+		m.Dirs = map[string]*Dir{}
+	}
+
+	return &m, nil
+}
+
+// Cached SHA-256 of file at path, if recorded and the file has not changed since.
+func (m *Manifest) Hash(path string, info fs.FileInfo) (string, bool) {
+
+	f, ok := m.Files[path]
+	if !ok || f.SHA256 == "" || f.Size != info.Size() || !f.ModTime.Equal(info.ModTime()) {
+		return "", false
+	}
+
+	return f.SHA256, true
+}
+
+// Record state and SHA-256 of file at path.
+func (m *Manifest) Store(path string, info fs.FileInfo, sum string) {
+	m.Files[path] = &File{Size: info.Size(), ModTime: info.ModTime(), SHA256: sum}
+}
+
+// Cached listing of directory at path, if recorded with its entries and the directory has not changed since.
+// Adding, removing or renaming an entry changes a directory's modification time, and on most file systems its size.
+func (m *Manifest) Listing(path string, info fs.FileInfo) (Dir, bool) {
+
+	d, ok := m.Dirs[path]
+	if !ok || d.Entries == nil || d.Size != info.Size() || !d.ModTime.Equal(info.ModTime()) {
+		return Dir{}, false
+	}
+
+	return *d, true
+}
+
+// Record state, entry names and subdirectory names of directory at path.
+func (m *Manifest) StoreDir(path string, info fs.FileInfo, entries []string, subdirs []string) {
+	m.Dirs[path] = &Dir{ModTime: info.ModTime(), Size: info.Size(), Entries: entries, Subdirs: subdirs}
+}
+
+// Paths of the given fraction of hashed files due for scrubbing, least recently scrubbed first.
+func (m *Manifest) DueForScrub(fraction float64) []string {
+
+	paths := []string{}
+	for path, f := range m.Files {
+		if f.SHA256 != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	// Never scrubbed files go first, then the longest unchecked
+	scrubbed := func(path string) time.Time {
+		if s := m.Files[path].Scrubbed; s != nil {
+			return *s
+		}
+		return time.Time{}
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		a, b := scrubbed(paths[i]), scrubbed(paths[j])
+		if a.Equal(b) {
+			return paths[i] < paths[j]
+		}
+		return a.Before(b)
+	})
+
+	count := int(math.Ceil(fraction * float64(len(paths))))
+	if count > len(paths) {
+		count = len(paths)
+	}
+
+	return paths[:count]
+}
+
+// Record resources used by a finished job.
+func (m *Manifest) Record(job Job) {
+	m.Jobs = append(m.Jobs, job)
+}
+
+// Record batch of a finished import.
+func (m *Manifest) RecordBatch(b Batch) {
+	m.Batches = append(m.Batches, &b)
+}
+
+// Batches named prefix or starting with it, e.g. every one of a day for "2024-06-14", oldest first; those rolled back are left out.
+func (m *Manifest) FindBatches(prefix string) []*Batch {
+
+	found := []*Batch{}
+	for _, b := range m.Batches {
+		if b.RolledBack == nil && strings.HasPrefix(b.Name, prefix) {
+			found = append(found, b)
+		}
+	}
+
+	return found
+}
+
+// Kind of difference between two manifests.
+const (
+	Added   = "added"   // Only in the newer manifest.
+	Removed = "removed" // Only in the older manifest.
+	Changed = "changed" // Size or modification time differ.
+	Corrupt = "corrupt" // Contents differ although size and modification time match, as with bit rot.
+)
+
+// Difference of a single file between two manifests.
+type Change struct {
+	Path string
+	Kind string
+	Old  *File // Nil if added.
+	New  *File // Nil if removed.
+}
+
+// Files that differ from older to newer manifest, sorted by path.
+func Diff(older *Manifest, newer *Manifest) []Change {
+
+	changes := []Change{}
+
+	for path, o := range older.Files {
+
+		n, ok := newer.Files[path]
+
+		switch {
+		case !ok:
+			changes = append(changes, Change{Path: path, Kind: Removed, Old: o})
+		case o.Size != n.Size || !o.ModTime.Equal(n.ModTime):
+			changes = append(changes, Change{Path: path, Kind: Changed, Old: o, New: n})
+		case o.SHA256 != "" && n.SHA256 != "" && o.SHA256 != n.SHA256:
+			changes = append(changes, Change{Path: path, Kind: Corrupt, Old: o, New: n})
+		}
+
+	}
+
+	for path, n := range newer.Files {
+		if _, ok := older.Files[path]; !ok {
+			changes = append(changes, Change{Path: path, Kind: Added, New: n})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes
+}
+
+// Drop entries of files that no longer exist, returning how many were dropped.
+func (m *Manifest) Prune() int {
+
+	pruned := 0
+
+	for path := range m.Files {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			delete(m.Files, path)
+			pruned++
+		}
+	}
+
+	// Directories are only a cache of scans, so they go uncounted
+	for path := range m.Dirs {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			delete(m.Dirs, path)
+		}
+	}
+
+	return pruned
+}
+
+// Write manifest back to where it was loaded from.
+func (m *Manifest) Save() error {
+
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated manifest
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), ".manifest-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), m.path)
+}
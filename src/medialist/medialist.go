@@ -0,0 +1,190 @@
+package medialist
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/format"
+)
+
+// Name of media list saved in input directory by imports.
+const FileName = ".stopcon-media-list.json"
+
+// Files a camera holds, in the shape served by its WiFi API at /gopro/media/list.
+type List struct {
+	Media []Dir `json:"media"`
+}
+
+// Directory under DCIM, e.g. "100GOPRO".
+type Dir struct {
+	Name  string `json:"d"`
+	Files []File `json:"fs"`
+}
+
+// File within a [Dir]; only name and creation time are relied upon, as other fields differ between models.
+type File struct {
+	Name    string `json:"n"`
+	Created string `json:"cre,omitempty"` // Creation time in seconds since the epoch, as the camera serves it; empty if unknown.
+}
+
+// Parse media list from JSON.
+func Parse(r io.Reader) (List, error) {
+
+	l := List{}
+	if err := json.NewDecoder(r).Decode(&l); err != nil {
+		return l, err
+	}
+
+	return l, nil
+}
+
+// Load media list at path; a missing file lists nothing.
+func Load(path string) (List, error) {
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return List{}, nil
+	}
+
+	if err != nil {
+		return List{}, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Save media list to path as JSON.
+func (l List) Save(path string) error {
+
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Add file f within directory dir, unless already listed.
+func (l *List) Add(dir string, f File) {
+
+	for i := range l.Media {
+		if l.Media[i].Name == dir {
+			for _, other := range l.Media[i].Files {
+				if other.Name == f.Name {
+					return
+				}
+			}
+			l.Media[i].Files = append(l.Media[i].Files, f)
+			return
+		}
+	}
+
+	l.Media = append(l.Media, Dir{Name: dir, Files: []File{f}})
+}
+
+// Chapters listed of one recording.
+type Recording struct {
+	Id       string
+	Created  time.Time // Creation time of its earliest listed chapter; zero if the list has none.
+	Chapters int       // Highest chapter index listed.
+}
+
+// Recordings listed; names other than GoPro's own are ignored.
+// IDs repeat once the camera's counter wraps, so files sharing one are told apart by their chapters starting over in order of creation.
+func (l List) Recordings() []Recording {
+
+	type listed struct {
+		id      string
+		index   int
+		created time.Time
+	}
+
+	files := []listed{}
+
+	for _, d := range l.Media {
+		for _, f := range d.Files {
+
+			matches := format.Raw.Regex.FindStringSubmatch(f.Name)
+			if len(matches) < len(format.Raw.Tokens.Slice) {
+				continue
+			}
+
+			index, err := strconv.Atoi(matches[2])
+			if err != nil {
+				continue
+			}
+
+			created := time.Time{}
+			if seconds, err := strconv.ParseInt(f.Created, 10, 64); err == nil {
+				created = time.Unix(seconds, 0).UTC()
+			}
+
+			files = append(files, listed{matches[3], index, created})
+
+		}
+	}
+
+	sort.SliceStable(files, func(a, b int) bool {
+		if files[a].id != files[b].id {
+			return files[a].id < files[b].id
+		}
+		if !files[a].created.Equal(files[b].created) {
+			return files[a].created.Before(files[b].created)
+		}
+		return files[a].index < files[b].index
+	})
+
+	recordings := []Recording{}
+
+	for _, f := range files {
+
+		n := len(recordings)
+		if n == 0 || recordings[n-1].Id != f.id || f.index <= recordings[n-1].Chapters {
+			recordings = append(recordings, Recording{Id: f.id, Created: f.created})
+			n++
+		}
+
+		recordings[n-1].Chapters = f.index
+
+	}
+
+	return recordings
+}
+
+// Recording of recordings with id created closest to created.
+// Listed times may be the camera's wall-clock time rather than UTC, so ones further apart than a day do not match; without either time, the ID alone does.
+func Find(recordings []Recording, id string, created time.Time) (Recording, bool) {
+
+	found, ok := Recording{}, false
+	distance := time.Duration(0)
+
+	for _, r := range recordings {
+
+		if r.Id != id {
+			continue
+		}
+
+		if r.Created.IsZero() || created.IsZero() {
+			return r, true
+		}
+
+		d := r.Created.Sub(created)
+		if d < 0 {
+			d = -d
+		}
+
+		if d <= 24*time.Hour && (!ok || d < distance) {
+			found, ok, distance = r, true, d
+		}
+
+	}
+
+	return found, ok
+}
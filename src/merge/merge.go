@@ -0,0 +1,34 @@
+// Package merge picks containers of recordings and merges them, under a temporary name until done.
+package merge
+
+// Suffix of merges being written, so an interrupted one is never mistaken for a finished one.
+const PartSuffix = ".part"
+
+// File extension of each merge container.
+var ContainerExtensions = map[string]string{"mkv": "mkv", "mp4": "mp4", "fmp4": "mp4", "mov": "mov", "mpegts": "ts"}
+
+// Containers by file name extension of fragments, for merging into the container they came in.
+var ExtensionContainers = map[string]string{"mp4": "mp4", "m4v": "mp4", "mov": "mov", "mkv": "mkv", "ts": "mpegts"}
+
+// Containers able to hold each video codec without re-encoding, by ffprobe codec name.
+var CodecContainers = map[string][]string{
+	"h264": {"mp4", "mov", "mkv", "mpegts"},
+	"hevc": {"mp4", "mov", "mkv", "mpegts"},
+}
+
+// Whether video of codec fits into container ctr without re-encoding; unknown codecs only fit mkv.
+func Fits(codec string, ctr string) bool {
+
+	fits, ok := CodecContainers[codec]
+	if !ok {
+		return ctr == "mkv"
+	}
+
+	for _, fit := range fits {
+		if fit == ctr {
+			return true
+		}
+	}
+
+	return false
+}
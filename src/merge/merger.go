@@ -0,0 +1,243 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/merger"
+	"github.com/thatpix3l/stopcon/src/scan"
+	"github.com/thatpix3l/stopcon/src/utils"
+)
+
+// What a [Merger] goes by.
+type Options struct {
+	Backend    merger.Merger  // Joins fragments, e.g. a [merger.FFmpeg]; required.
+	Container  string         // Container of every merge, e.g. "mkv"; empty to pick one by Preference.
+	Preference []string       // Containers to pick from, most preferred first, "source" standing for the fragments' own; default source, mp4 and mkv.
+	Streaming  bool           // Whether merges go to stdout, which cannot be seeked back into.
+	Single     string         // What becomes of recordings of a single fragment needing no change: "link" (hard link, falling back to copy), "copy", or "remux" like any other; default "remux".
+	Location   *time.Location // Zone of creation times, see [scan.Options]; nil for local wall-clock time marked as UTC, as GoPro writes it.
+
+	// Told why a single fragment is copied rather than linked; nil to copy silently.
+	LinkFailed func(err error)
+}
+
+// Picks containers of recordings and merges them under a temporary name, going by its [Options] alone.
+type Merger struct {
+	opts Options
+}
+
+// Merger going by opts, unset ones defaulted.
+func New(opts Options) *Merger {
+
+	if len(opts.Preference) == 0 {
+		opts.Preference = []string{"source", "mp4", "mkv"}
+	}
+
+	if opts.Single == "" {
+		opts.Single = "remux"
+	}
+
+	return &Merger{opts: opts}
+}
+
+// Container fragments with extensions came in; empty if unknown or mixed.
+func SourceContainer(extensions []string) string {
+
+	ctr := ""
+	for i, extension := range extensions {
+		c := ExtensionContainers[strings.ToLower(strings.TrimPrefix(extension, "."))]
+		if i > 0 && c != ctr {
+			return ""
+		}
+		ctr = c
+	}
+
+	return ctr
+}
+
+// Container of merged recording r, as given, or else the most preferred one fitting its codec; also says why.
+func (m *Merger) Container(r scan.Recording) (string, string) {
+
+	if m.opts.Container != "" {
+		return m.opts.Container, "given"
+	}
+
+	// A pipe cannot be seeked back into, so default to a container written strictly front to back
+	if m.opts.Streaming {
+		return "mpegts", "streaming to stdout"
+	}
+
+	extensions := []string{}
+	for _, f := range r.Fragments {
+		extensions = append(extensions, f.Extension)
+	}
+
+	preferred := []string{}
+	for _, c := range m.opts.Preference {
+		if c == "source" {
+			c = SourceContainer(extensions)
+		}
+		if c != "" {
+			preferred = append(preferred, c)
+		}
+	}
+
+	order := strings.Join(m.opts.Preference, ",")
+
+	// Fragments of unknown container and nothing else preferred
+	if len(preferred) == 0 {
+		return "mkv", "source container unknown"
+	}
+
+	// Codec is unknown when names alone were parsed
+	if r.Codec == "" {
+		return preferred[0], "codec unknown, first preference"
+	}
+
+	if _, ok := CodecContainers[r.Codec]; !ok {
+		return "mkv", fmt.Sprintf("%s only fits mkv for sure", r.Codec)
+	}
+
+	for _, c := range preferred {
+		if Fits(r.Codec, c) {
+			return c, fmt.Sprintf("%s fits %s, first of preference %s", r.Codec, c, order)
+		}
+	}
+
+	return "mkv", fmt.Sprintf("%s fits none of preference %s", r.Codec, order)
+}
+
+// Merge job's inputs into its output, written under [PartSuffix] until done so an interrupted merge is never mistaken for a finished one.
+// The output's modification time is set to its creation time, so it sorts with the footage instead of by when it was merged.
+func (m *Merger) Merge(ctx context.Context, job merger.Job) error {
+
+	final := job.Output
+	if final == "-" {
+		return m.opts.Backend.Merge(ctx, job)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(final), 0o755); err != nil {
+		return err
+	}
+
+	// A lone fragment already is the recording, unless something about it has to change on the way
+	if len(job.Inputs) == 1 && m.opts.Single != "remux" && job.Audio == nil && job.Sound == nil && len(job.Provenance) == 0 && !job.NoData && job.Format == SourceContainer([]string{filepath.Ext(job.Inputs[0])}) {
+		return m.placeSingle(ctx, job.Inputs[0], final, job.Created)
+	}
+
+	job.Output = final + PartSuffix
+
+	if err := m.opts.Backend.Merge(ctx, job); err != nil {
+		os.Remove(job.Output)
+		return err
+	}
+
+	if err := os.Rename(job.Output, final); err != nil {
+		return err
+	}
+
+	return m.stamp(final, job.Created)
+}
+
+// Put fragment src at final as it is, by hard link or copy, instead of remuxing it.
+func (m *Merger) placeSingle(ctx context.Context, src string, final string, created time.Time) error {
+
+	part := final + PartSuffix
+
+	// Leftover of an interrupted run given an output path, which is not cleaned up beforehand
+	os.Remove(part)
+
+	if m.opts.Single == "link" {
+
+		// A link shares the fragment's modification time, so neither is stamped
+		err := os.Link(src, part)
+		if err == nil {
+			return os.Rename(part, final)
+		}
+
+		// Other file systems, and some shares, cannot link
+		if m.opts.LinkFailed != nil {
+			m.opts.LinkFailed(err)
+		}
+	}
+
+	if err := utils.CopyFile(ctx, src, part); err != nil {
+		return err
+	}
+
+	if err := os.Rename(part, final); err != nil {
+		return err
+	}
+
+	return m.stamp(final, created)
+}
+
+// Set modification time of file at path to creation time t; zero leaves it as it is.
+func (m *Merger) stamp(path string, t time.Time) error {
+
+	if t.IsZero() {
+		return nil
+	}
+
+	return Stamp(path, t, m.opts.Location)
+}
+
+// Set modification time of file at path to creation time t, in zone loc as for [Options.Location].
+// Files with other hard links are left alone, as their fragments or merges would change along with them.
+func Stamp(path string, t time.Time, loc *time.Location) error {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if utils.HardLinked(info) {
+		return nil
+	}
+
+	// Without a zone, t is local wall-clock time marked as UTC
+	if loc == nil {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+	}
+
+	return os.Chtimes(path, time.Now(), t)
+}
+
+// Remove merges left half-written in dirs by interrupted runs, returning their paths; those still being written by another run are left alone.
+func RemoveStaleParts(dirs []string) ([]string, error) {
+
+	paths := []string{}
+	for _, dir := range dirs {
+		matches, err := filepath.Glob(filepath.Join(dir, "*"+PartSuffix))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+
+	writing, err := utils.OpenForWriting(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for _, path := range paths {
+
+		if writing[path] {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+
+		removed = append(removed, path)
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,117 @@
+package merge
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/merger"
+	"github.com/thatpix3l/stopcon/src/scan"
+)
+
+// Containers are picked as given, else by preference among those fitting the codec.
+func TestContainer(t *testing.T) {
+
+	recording := func(codec string, extensions ...string) scan.Recording {
+		r := scan.Recording{Metadata: scan.Metadata{Codec: codec}}
+		for _, extension := range extensions {
+			r.Fragments = append(r.Fragments, scan.Fragment{Extension: extension})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name      string
+		opts      Options
+		recording scan.Recording
+		want      string
+	}{
+		{name: "source", recording: recording("hevc", "MP4"), want: "mp4"},
+		{name: "given", opts: Options{Container: "mov"}, recording: recording("hevc", "MP4"), want: "mov"},
+		{name: "streaming", opts: Options{Streaming: true}, recording: recording("hevc", "MP4"), want: "mpegts"},
+		{name: "mixed sources", opts: Options{Preference: []string{"source", "mov"}}, recording: recording("hevc", "MP4", "MOV"), want: "mov"},
+		{name: "unknown source", opts: Options{Preference: []string{"source"}}, recording: recording("hevc", "360"), want: "mkv"},
+		{name: "unknown codec", recording: recording("prores", "MOV"), want: "mkv"},
+		{name: "codec not probed", opts: Options{Preference: []string{"mov", "mkv"}}, recording: recording("", "MP4"), want: "mov"},
+	}
+
+	for _, test := range tests {
+		if got, reason := New(test.opts).Container(test.recording); got != test.want {
+			t.Errorf("%s: picked %s (%s), want %s", test.name, got, reason, test.want)
+		}
+	}
+
+}
+
+// Backend writing each merge's inputs' count, remembering the jobs it got.
+type backend struct {
+	jobs []merger.Job
+}
+
+func (b *backend) Merge(ctx context.Context, job merger.Job) error {
+	b.jobs = append(b.jobs, job)
+	return os.WriteFile(job.Output, []byte{byte(len(job.Inputs))}, 0o644)
+}
+
+// Merges are written under a temporary name and stamped with their creation time; lone fragments are placed as they are unless remuxed.
+func TestMerge(t *testing.T) {
+
+	dir := t.TempDir()
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	src := filepath.Join(dir, "GX010042.MP4")
+	if err := os.WriteFile(src, []byte("fragment"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		single string
+		job    merger.Job
+		merged bool // Whether the backend merged, rather than the fragment being placed.
+	}{
+		{name: "remux", single: "remux", job: merger.Job{Inputs: []string{src}, Format: "mp4"}, merged: true},
+		{name: "link", single: "link", job: merger.Job{Inputs: []string{src}, Format: "mp4"}},
+		{name: "copy", single: "copy", job: merger.Job{Inputs: []string{src}, Format: "mp4"}},
+		{name: "other container", single: "copy", job: merger.Job{Inputs: []string{src}, Format: "mkv"}, merged: true},
+		{name: "no data", single: "copy", job: merger.Job{Inputs: []string{src}, Format: "mp4", NoData: true}, merged: true},
+		{name: "chapters", single: "copy", job: merger.Job{Inputs: []string{src, src}, Format: "mp4"}, merged: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			b := &backend{}
+			test.job.Output = filepath.Join(dir, test.name, "merged.mp4")
+			test.job.Created = created
+
+			if err := New(Options{Backend: b, Single: test.single, Location: time.UTC}).Merge(context.Background(), test.job); err != nil {
+				t.Fatal(err)
+			}
+
+			if merged := len(b.jobs) == 1; merged != test.merged {
+				t.Fatalf("merged %t, want %t", merged, test.merged)
+			}
+			if test.merged && b.jobs[0].Output != test.job.Output+PartSuffix {
+				t.Errorf("written to %s", b.jobs[0].Output)
+			}
+
+			info, err := os.Stat(test.job.Output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(test.job.Output + PartSuffix); !os.IsNotExist(err) {
+				t.Errorf("part left behind: %v", err)
+			}
+
+			// Links share the fragment's modification time
+			if test.single != "link" && !info.ModTime().Equal(created) {
+				t.Errorf("modified %s, want %s", info.ModTime(), created)
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,310 @@
+package merger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/utils"
+)
+
+func init() {
+	Register("ffmpeg", func() Merger { return &FFmpeg{} })
+}
+
+// Backend running the ffmpeg CLI with the concat demuxer.
+type FFmpeg struct {
+	Command func(args []string, stdin string) *exec.Cmd // Builds the process; defaults to [exec.Command].
+}
+
+// Concat demuxer list of job's inputs, quoted so paths with quotes, spaces or backslashes survive.
+// The list is read line by line, so paths with line breaks cannot be listed at all.
+func (f *FFmpeg) ConcatList(job Job) (string, error) {
+
+	sources := strings.Builder{}
+
+	for _, input := range job.Inputs {
+
+		if strings.ContainsAny(input, "\r\n") {
+			return "", fmt.Errorf("path %q holds a line break, which ffmpeg's concat list cannot express; rename it first", input)
+		}
+
+		// Relative paths would be resolved against the list's own directory
+		abs, err := filepath.Abs(input)
+		if err != nil {
+			return "", err
+		}
+
+		// Within single quotes only the quote itself is special; close, escape and reopen around it
+		sources.WriteString("file '" + strings.ReplaceAll(abs, "'", `'\''`) + "'\n")
+
+	}
+
+	return sources.String(), nil
+}
+
+// Write concat list of job's inputs to a temporary file, returning its path; remove it once merged.
+func (f *FFmpeg) WriteList(job Job) (string, error) {
+
+	list, err := f.ConcatList(job)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp("", "stopcon-concat-*.txt")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tmp.WriteString(list); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
+
+// Encoders of re-encoded output, by ffprobe codec name.
+var Encoders = map[string]string{"hevc": "libx265", "h264": "libx264"}
+
+// Arguments merging concat list at path list into job's output; list is not read when inputs are re-encoded.
+func (f *FFmpeg) Args(job Job, list string) []string {
+
+	if job.Convert != nil {
+		return f.convertArgs(job)
+	}
+
+	args := []string{
+		"ffmpeg",
+		"-f", "concat",
+		"-safe", "0",
+		"-i", list,
+	}
+
+	if job.Audio != nil {
+		args = append(args, audioArgs(job)...)
+	} else {
+		// Every stream, not just the best video and audio ffmpeg picks by default
+		args = append(args, "-map", "0")
+		if !job.keepsData() {
+			args = append(args, "-map", "-0:d")
+		}
+		args = append(args, "-codec", "copy")
+		if job.Sound != nil {
+			args = append(args, soundArgs(job.Sound)...)
+		}
+	}
+
+	// Telemetry streams are of no type ffmpeg knows
+	if job.keepsData() {
+		args = append(args, "-copy_unknown")
+	}
+
+	return f.outputArgs(job, args)
+}
+
+// Arguments rewriting merged video at input into job's output with every stream copied, adding job's tags to those it carries, e.g. to tag masters merged before with provenance.
+func (f *FFmpeg) RetagArgs(input string, job Job) []string {
+
+	args := []string{"ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-i", input, "-map", "0", "-codec", "copy"}
+	if job.keepsData() {
+		args = append(args, "-copy_unknown")
+	}
+
+	return f.outputArgs(job, args)
+}
+
+// Arguments re-encoding job's inputs to one picture and joining them with the concat filter, which unlike the concat demuxer takes inputs of any settings.
+func (f *FFmpeg) convertArgs(job Job) []string {
+
+	p := job.Convert
+	args := []string{"ffmpeg"}
+
+	for _, input := range job.Inputs {
+		args = append(args, "-i", input)
+	}
+
+	// Scaled to fit, padded to fill, then resampled in time, so every input ends up alike
+	filter := strings.Builder{}
+	for i := range job.Inputs {
+		fmt.Fprintf(&filter, "[%d:v:0]scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=%s[v%d];", i, p.Width, p.Height, p.Width, p.Height, p.Rate, i)
+		if p.Audio {
+			fmt.Fprintf(&filter, "[%d:a:0]aformat=sample_rates=48000:channel_layouts=stereo[a%d];", i, i)
+		}
+	}
+
+	for i := range job.Inputs {
+		fmt.Fprintf(&filter, "[v%d]", i)
+		if p.Audio {
+			fmt.Fprintf(&filter, "[a%d]", i)
+		}
+	}
+
+	audio := 0
+	if p.Audio {
+		audio = 1
+	}
+	fmt.Fprintf(&filter, "concat=n=%d:v=1:a=%d[v]", len(job.Inputs), audio)
+	if p.Audio && job.Sound != nil {
+		fmt.Fprintf(&filter, "[joined];[joined]%s[a]", job.Sound.Filter())
+	} else if p.Audio {
+		filter.WriteString("[a]")
+	}
+
+	encoder, ok := Encoders[p.Codec]
+	if !ok {
+		encoder = "libx264"
+	}
+
+	args = append(args, "-filter_complex", filter.String(), "-map", "[v]", "-codec:v", encoder, "-crf", "18", "-preset", "medium")
+	if p.Audio {
+		args = append(args, "-map", "[a]", "-codec:a", "aac", "-b:a", "320k")
+	}
+
+	return f.outputArgs(job, args)
+}
+
+// Metadata, muxer and output arguments following inputs and mapping in args.
+func (f *FFmpeg) outputArgs(job Job, args []string) []string {
+
+	args = append(args, "-map_metadata", "0")
+
+	tags := job.tags()
+
+	// Sorted so the command line is stable
+	keys := []string{}
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		args = append(args, "-metadata", key+"="+tags[key])
+	}
+
+	if name, options := muxer(job); name != "" {
+		args = append(args, "-f", name)
+		for _, o := range options {
+			args = append(args, "-"+o.Key, o.Value)
+		}
+	}
+
+	if job.Output == "-" {
+		return append(args, "pipe:1")
+	}
+
+	return append(args, job.Output)
+}
+
+// Input, mapping and codec arguments adding job's external audio, cut to the video's span.
+func audioArgs(job Job) []string {
+
+	a := job.Audio
+	seconds := func(d time.Duration) string { return strconv.FormatFloat(d.Seconds(), 'f', 3, 64) }
+
+	args := []string{}
+
+	// Delay audio that started late; skip into audio that started early
+	length := a.Duration
+	if a.Offset >= 0 {
+		args = append(args, "-itsoffset", seconds(a.Offset))
+		length -= a.Offset
+	} else {
+		args = append(args, "-ss", seconds(-a.Offset))
+	}
+
+	if length > 0 {
+		args = append(args, "-t", seconds(length))
+	}
+
+	args = append(args, "-i", a.Path, "-map", "0:v")
+
+	if job.keepsData() {
+		args = append(args, "-map", "0:d?")
+	}
+
+	external := "0"
+	if !a.Replace {
+		args = append(args, "-map", "0:a:0")
+		external = "1"
+	}
+
+	args = append(args, "-map", "1:a:0", "-codec", "copy")
+
+	switch {
+	// Camera and external audio alike
+	case job.Sound != nil:
+		args = append(args, soundArgs(job.Sound)...)
+	// PCM fits Matroska untouched; other containers get AAC
+	case job.Format != "mkv":
+		args = append(args, "-codec:a:"+external, "aac", "-b:a:"+external, "320k")
+	}
+
+	return append(args, "-metadata:s:a:"+external, "title=External audio")
+}
+
+// Codec and filter arguments re-encoding every audio stream with preset p.
+func soundArgs(p *AudioPreset) []string {
+	return []string{"-filter:a", p.Filter(), "-codec:a", "aac", "-b:a", "320k"}
+}
+
+// Process that would run job off concat list at path list, killed once ctx is done unless built by Command.
+func (f *FFmpeg) Cmd(ctx context.Context, job Job, list string) *exec.Cmd {
+
+	args := f.Args(job, list)
+
+	if f.Command != nil {
+		return f.Command(args, "")
+	}
+
+	return exec.CommandContext(ctx, args[0], args[1:]...)
+}
+
+func (f *FFmpeg) Merge(ctx context.Context, job Job) error {
+
+	if job.Convert != nil && job.Audio != nil {
+		return errors.New("cannot add external audio while re-encoding mismatched fragments")
+	}
+
+	// Re-encoded inputs are given one by one, without a list
+	list := ""
+	if job.Convert == nil {
+		var err error
+		if list, err = f.WriteList(job); err != nil {
+			return err
+		}
+		defer os.Remove(list)
+	}
+
+	cmd := f.Cmd(ctx, job, list)
+
+	if job.Output == "-" {
+		cmd.Stdout = os.Stdout
+	}
+
+	_, err := utils.Output(cmd, "")
+
+	if job.Ran != nil && cmd.ProcessState != nil {
+		job.Ran(cmd)
+	}
+
+	// Killed rather than failed; output is removed by the caller, as ffmpeg leaves it behind either way
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
@@ -0,0 +1,173 @@
+//go:build libav
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <libavformat/avformat.h>
+#include <libavutil/avutil.h>
+#include "libav.h"
+#include "_cgo_export.h"
+
+// Write libav's description of ret, prefixed by what failed, into errbuf.
+static int fail(int ret, const char *what, char *errbuf, int errlen) {
+
+	char reason[AV_ERROR_MAX_STRING_SIZE] = {0};
+	av_strerror(ret, reason, sizeof(reason));
+	snprintf(errbuf, errlen, "%s: %s", what, reason);
+
+	return ret < 0 ? ret : -1;
+}
+
+int stopcon_concat(char **inputs, int count, char *output, char *format, char **optKeys, char **optValues, int opts, char **keys, char **values, int tags, uintptr_t handle, char *errbuf, int errlen) {
+
+	AVFormatContext **in = calloc(count, sizeof(AVFormatContext *));
+	AVFormatContext *out = NULL;
+	AVPacket *pkt = av_packet_alloc();
+	int ret = 0;
+	int64_t total = 0;
+
+	// Open every input up front so total duration is known for progress
+	for (int i = 0; i < count; i++) {
+
+		if ((ret = avformat_open_input(&in[i], inputs[i], NULL, NULL)) < 0) {
+			ret = fail(ret, inputs[i], errbuf, errlen);
+			goto end;
+		}
+
+		if ((ret = avformat_find_stream_info(in[i], NULL)) < 0) {
+			ret = fail(ret, inputs[i], errbuf, errlen);
+			goto end;
+		}
+
+		total += in[i]->duration;
+	}
+
+	// Same streams the ffmpeg CLI picks by default: best video and best audio
+	int map[2] = {
+		av_find_best_stream(in[0], AVMEDIA_TYPE_VIDEO, -1, -1, NULL, 0),
+		av_find_best_stream(in[0], AVMEDIA_TYPE_AUDIO, -1, -1, NULL, 0),
+	};
+
+	if ((ret = avformat_alloc_output_context2(&out, NULL, format, output)) < 0) {
+		ret = fail(ret, output, errbuf, errlen);
+		goto end;
+	}
+
+	int outIndex[2] = {-1, -1};
+	for (int m = 0; m < 2; m++) {
+
+		if (map[m] < 0) {
+			continue;
+		}
+
+		AVStream *s = avformat_new_stream(out, NULL);
+		if (s == NULL || (ret = avcodec_parameters_copy(s->codecpar, in[0]->streams[map[m]]->codecpar)) < 0) {
+			ret = fail(ret, "copying stream parameters", errbuf, errlen);
+			goto end;
+		}
+
+		s->codecpar->codec_tag = 0;
+		s->time_base = in[0]->streams[map[m]]->time_base;
+		outIndex[m] = s->index;
+	}
+
+	// Keep first fragment's tags, like -map_metadata 0, then add ours
+	av_dict_copy(&out->metadata, in[0]->metadata, 0);
+	for (int t = 0; t < tags; t++) {
+		av_dict_set(&out->metadata, keys[t], values[t], 0);
+	}
+
+	if ((ret = avio_open(&out->pb, output, AVIO_FLAG_WRITE)) < 0) {
+		ret = fail(ret, output, errbuf, errlen);
+		goto end;
+	}
+
+	AVDictionary *muxerOpts = NULL;
+	for (int o = 0; o < opts; o++) {
+		av_dict_set(&muxerOpts, optKeys[o], optValues[o], 0);
+	}
+
+	ret = avformat_write_header(out, &muxerOpts);
+	av_dict_free(&muxerOpts);
+
+	if (ret < 0) {
+		ret = fail(ret, "writing header", errbuf, errlen);
+		goto end;
+	}
+
+	// Shift each fragment's timestamps past the end of the one before
+	int64_t offset = 0;
+	int64_t reported = -1;
+
+	for (int i = 0; i < count; i++) {
+
+		while ((ret = av_read_frame(in[i], pkt)) >= 0) {
+
+			int m = pkt->stream_index == map[0] ? 0 : pkt->stream_index == map[1] ? 1 : -1;
+			if (m < 0 || outIndex[m] < 0) {
+				av_packet_unref(pkt);
+				continue;
+			}
+
+			AVRational inBase = in[i]->streams[pkt->stream_index]->time_base;
+			AVRational outBase = out->streams[outIndex[m]]->time_base;
+			int64_t shift = av_rescale_q(offset, AV_TIME_BASE_Q, outBase);
+
+			av_packet_rescale_ts(pkt, inBase, outBase);
+			if (pkt->pts != AV_NOPTS_VALUE) {
+				pkt->pts += shift;
+			}
+			if (pkt->dts != AV_NOPTS_VALUE) {
+				pkt->dts += shift;
+			}
+			pkt->stream_index = outIndex[m];
+			pkt->pos = -1;
+
+			// Report at most once a second of output
+			int64_t done = av_rescale_q(pkt->dts, outBase, AV_TIME_BASE_Q);
+			if (done / AV_TIME_BASE != reported) {
+				reported = done / AV_TIME_BASE;
+				if (stopconProgress(handle, done, total)) {
+					ret = fail(AVERROR_EXIT, "merging", errbuf, errlen);
+					goto end;
+				}
+			}
+
+			if ((ret = av_interleaved_write_frame(out, pkt)) < 0) {
+				ret = fail(ret, "writing packet", errbuf, errlen);
+				goto end;
+			}
+		}
+
+		if (ret != AVERROR_EOF) {
+			ret = fail(ret, inputs[i], errbuf, errlen);
+			goto end;
+		}
+
+		offset += in[i]->duration;
+	}
+
+	if ((ret = av_write_trailer(out)) < 0) {
+		ret = fail(ret, "writing trailer", errbuf, errlen);
+		goto end;
+	}
+
+	stopconProgress(handle, total, total);
+	ret = 0;
+
+end:
+	av_packet_free(&pkt);
+
+	for (int i = 0; i < count; i++) {
+		avformat_close_input(&in[i]);
+	}
+	free(in);
+
+	if (out != NULL) {
+		if (out->pb != NULL) {
+			avio_closep(&out->pb);
+		}
+		avformat_free_context(out);
+	}
+
+	return ret;
+}
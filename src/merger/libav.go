@@ -0,0 +1,147 @@
+//go:build libav
+
+package merger
+
+/*
+#cgo pkg-config: libavformat libavcodec libavutil
+#include <stdlib.h>
+#include "libav.h"
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"runtime/cgo"
+	"unsafe"
+)
+
+func init() {
+	Register("libav", func() Merger { return &Libav{} })
+}
+
+// Backend remuxing through linked libav libraries, without spawning ffmpeg.
+// Only built with the "libav" build tag, as it needs the libav development files.
+type Libav struct{}
+
+// Copy of strs as a C array of C strings, to be released with freeStrings.
+func cStrings(strs []string) **C.char {
+
+	arr := (**C.char)(C.malloc(C.size_t(len(strs)+1) * C.size_t(unsafe.Sizeof(uintptr(0)))))
+	slice := unsafe.Slice(arr, len(strs)+1)
+
+	for i, s := range strs {
+		slice[i] = C.CString(s)
+	}
+	slice[len(strs)] = nil
+
+	return arr
+}
+
+func freeStrings(arr **C.char, n int) {
+
+	for _, s := range unsafe.Slice(arr, n) {
+		C.free(unsafe.Pointer(s))
+	}
+
+	C.free(unsafe.Pointer(arr))
+}
+
+// What a running merge reports to and is stopped by.
+type callback struct {
+	ctx      context.Context
+	progress func(float64)
+}
+
+// Report progress of merge behind handle, returning nonzero once it is to stop.
+//
+//export stopconProgress
+func stopconProgress(handle C.uintptr_t, done C.int64_t, total C.int64_t) C.int {
+
+	cb, ok := cgo.Handle(handle).Value().(callback)
+	if !ok {
+		return 0
+	}
+
+	if cb.ctx.Err() != nil {
+		return 1
+	}
+
+	if cb.progress != nil && total > 0 {
+		cb.progress(float64(done) / float64(total))
+	}
+
+	return 0
+}
+
+func (l *Libav) Merge(ctx context.Context, job Job) error {
+
+	if len(job.Inputs) == 0 {
+		return errors.New("nothing to merge")
+	}
+
+	if job.Audio != nil {
+		return errors.New("libav backend cannot add external audio; use ffmpeg")
+	}
+
+	if job.Convert != nil {
+		return errors.New("libav backend cannot re-encode mismatched fragments; use ffmpeg")
+	}
+
+	if job.Sound != nil {
+		return errors.New("libav backend cannot apply audio presets; use ffmpeg")
+	}
+
+	keys, values := []string{}, []string{}
+	for key, value := range job.tags() {
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	inputs, cKeys, cValues := cStrings(job.Inputs), cStrings(keys), cStrings(values)
+	defer freeStrings(inputs, len(job.Inputs))
+	defer freeStrings(cKeys, len(keys))
+	defer freeStrings(cValues, len(values))
+
+	path := job.Output
+	if path == "-" {
+		path = "pipe:1"
+	}
+
+	output := C.CString(path)
+	defer C.free(unsafe.Pointer(output))
+
+	// Empty format lets libav guess from output's extension
+	name, options := muxer(job)
+
+	var format *C.char
+	if name != "" {
+		format = C.CString(name)
+		defer C.free(unsafe.Pointer(format))
+	}
+
+	optKeys, optValues := []string{}, []string{}
+	for _, o := range options {
+		optKeys = append(optKeys, o.Key)
+		optValues = append(optValues, o.Value)
+	}
+
+	cOptKeys, cOptValues := cStrings(optKeys), cStrings(optValues)
+	defer freeStrings(cOptKeys, len(optKeys))
+	defer freeStrings(cOptValues, len(optValues))
+
+	errBuf := (*C.char)(C.malloc(512))
+	defer C.free(unsafe.Pointer(errBuf))
+
+	handle := cgo.NewHandle(callback{ctx: ctx, progress: job.Progress})
+	defer handle.Delete()
+
+	if C.stopcon_concat(inputs, C.int(len(job.Inputs)), output, format, cOptKeys, cOptValues, C.int(len(optKeys)), cKeys, cValues, C.int(len(keys)), C.uintptr_t(handle), errBuf, 512) < 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return errors.New(C.GoString(errBuf))
+	}
+
+	return nil
+}
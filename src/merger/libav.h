@@ -0,0 +1,6 @@
+#include <stdint.h>
+
+// Remux inputs one after another into output, tagging it with keys and values.
+// Format may be NULL to guess the container from output's name; optKeys and optValues are passed to its muxer.
+// Returns negative on failure, with a message in errbuf.
+int stopcon_concat(char **inputs, int count, char *output, char *format, char **optKeys, char **optValues, int opts, char **keys, char **values, int tags, uintptr_t handle, char *errbuf, int errlen);
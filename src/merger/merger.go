@@ -0,0 +1,196 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fragments to join into one output.
+type Job struct {
+	Inputs   []string               // Fragment paths, in order.
+	Output   string                 // Path of merged video, or "-" for stdout.
+	Format   string                 // Container to write: "mkv", "mp4", "fmp4", "mov" or "mpegts"; empty to infer from Output's extension.
+	Fragment time.Duration          // Target length of each fragment of "fmp4" output.
+	Metadata map[string]string      // Container tags set on output, e.g. "comment".
+	Progress func(fraction float64) // Called with share of output written so far; may be nil, and not every backend reports it.
+	Audio    *Audio                 // External audio track to add; nil for none.
+	NoData   bool                   // Leave out data streams, e.g. GPMF telemetry and timecode.
+	Convert  *Picture               // Picture to re-encode every input to, for inputs recorded with different settings; nil to copy streams as they are.
+	Created  time.Time              // Creation time tagged on output; zero to leave it to the backend. The native backend keeps the first input's.
+	Sound    *AudioPreset           // Processing of audio, which is then re-encoded while video is still copied; nil to copy audio as it is.
+
+	// Provenance tags set on output, e.g. "stopcon_uuid"; unlike Metadata, MP4 and QuickTime output keeps them as metadata keys, having no field for them.
+	Provenance map[string]string
+
+	// Called with each process run for job once it exited, e.g. to account the CPU time it took; may be nil. Backends working in-process run none.
+	Ran func(cmd *exec.Cmd)
+}
+
+// Container tags of job's output: its metadata and provenance along with its creation time, if set.
+func (job Job) tags() map[string]string {
+
+	tags := map[string]string{}
+	for key, value := range job.Metadata {
+		tags[key] = value
+	}
+
+	for key, value := range job.Provenance {
+		tags[key] = value
+	}
+
+	if !job.Created.IsZero() {
+		tags["creation_time"] = job.Created.UTC().Format("2006-01-02T15:04:05.000000Z")
+	}
+
+	return tags
+}
+
+// Video stream settings that inputs must share to be joined without re-encoding.
+type Picture struct {
+	Codec  string // ffprobe codec name, e.g. "hevc".
+	Width  int
+	Height int
+	Rate   string // Frame rate as a fraction, e.g. "60000/1001".
+	Audio  bool   // Whether every input has audio to carry over.
+}
+
+// Whether job's output keeps data streams; only MP4 and QuickTime can hold GoPro's.
+func (job Job) keepsData() bool {
+	return !job.NoData && (job.Format == "mp4" || job.Format == "fmp4" || job.Format == "mov")
+}
+
+// Audio processing bundled under a name, applied while re-encoding audio.
+type AudioPreset struct {
+	Loudness float64 // Integrated loudness target in LUFS.
+	Peak     float64 // True peak ceiling in dBTP.
+	Range    float64 // Loudness range target in LU.
+	HighPass int     // Cutoff in Hz of the high-pass filter taking out wind rumble; 0 for none.
+	Channels int     // Channels to downmix to, 1 or 2; 0 to keep them.
+}
+
+// Audio presets by name, as given with --audio-preset.
+var AudioPresets = map[string]AudioPreset{
+	"voice":  {Loudness: -16, Peak: -1.5, Range: 7, HighPass: 120, Channels: 1}, // Speech to camera: wind cut hard, mono, dynamics evened out.
+	"action": {Loudness: -14, Peak: -1, Range: 11, HighPass: 80, Channels: 2},   // Helmet and board mounts: wind cut, loud but not squashed.
+	"music":  {Loudness: -14, Peak: -1, Range: 15, Channels: 2},                 // Concerts and instruments: full range kept.
+}
+
+// Filter chain applying p to an audio stream, resampled to 48 kHz.
+func (p AudioPreset) Filter() string {
+
+	filters := []string{}
+
+	if p.HighPass > 0 {
+		filters = append(filters, fmt.Sprintf("highpass=f=%d", p.HighPass))
+	}
+
+	// Downmixed first, so loudness is measured on what is heard
+	switch p.Channels {
+	case 1:
+		filters = append(filters, "aformat=channel_layouts=mono")
+	case 2:
+		filters = append(filters, "aformat=channel_layouts=stereo")
+	}
+
+	// loudnorm upsamples to 192 kHz to find true peaks
+	filters = append(filters, fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g", p.Loudness, p.Peak, p.Range), "aresample=48000")
+
+	return strings.Join(filters, ",")
+}
+
+// External audio recorded alongside the video, e.g. by a Media Mod or field recorder.
+type Audio struct {
+	Path     string        // Audio file.
+	Offset   time.Duration // Start of audio relative to start of video; negative if audio started first.
+	Duration time.Duration // Length of video, beyond which audio is cut.
+	Replace  bool          // Drop camera audio instead of keeping it as the first audio track.
+}
+
+// Muxer option, as passed to ffmpeg or libav.
+type option struct {
+	Key   string
+	Value string
+}
+
+// Muxer name and options writing job's container, as understood by both ffmpeg and libav.
+func muxer(job Job) (string, []option) {
+
+	switch job.Format {
+
+	case "mkv":
+		return "matroska", nil
+
+	// Index moved ahead of the media once written, so playback can start before the whole file is downloaded
+	case "mp4":
+		return "mp4", []option{{"movflags", "+faststart" + keyFlags(job)}}
+
+	case "mov":
+		return "mov", []option{{"movflags", "+faststart" + keyFlags(job)}}
+
+	// Self-contained fragments led by an empty moov, so output is playable while still being written
+	case "fmp4":
+		fragment := job.Fragment
+		if fragment <= 0 {
+			fragment = 2 * time.Second
+		}
+		return "mp4", []option{
+			{"movflags", "+frag_keyframe+empty_moov+default_base_moof" + keyFlags(job)},
+			{"frag_duration", strconv.FormatInt(fragment.Microseconds(), 10)},
+		}
+
+	}
+
+	return job.Format, nil
+}
+
+// Further movflags writing job's provenance tags as metadata keys, as MP4 and QuickTime otherwise drop tags they have no field for.
+func keyFlags(job Job) string {
+
+	if len(job.Provenance) == 0 {
+		return ""
+	}
+
+	return "+use_metadata_tags"
+}
+
+// Backend joining fragments of a recording without re-encoding.
+type Merger interface {
+	Merge(ctx context.Context, job Job) error // Stops early, removing any output written, once ctx is done.
+}
+
+// Constructors of backends by name; build-tagged backends add themselves from init.
+var backends = map[string]func() Merger{}
+
+// Make backend available under name.
+func Register(name string, constructor func() Merger) {
+	backends[name] = constructor
+}
+
+// Names of available backends, sorted.
+func Names() []string {
+
+	names := []string{}
+	for name := range backends {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Backend registered under name.
+func New(name string) (Merger, error) {
+
+	constructor, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown merger \"%s\", available: %v", name, Names())
+	}
+
+	return constructor(), nil
+}
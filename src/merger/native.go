@@ -0,0 +1,96 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/thatpix3l/stopcon/src/mp4"
+)
+
+func init() {
+	Register("native", func() Merger { return &Native{} })
+	Register("auto", func() Merger { return &Auto{Native: &Native{}, FFmpeg: &FFmpeg{}} })
+}
+
+// Backend joining MP4 chapters in pure Go, needing no ffmpeg at all.
+// Only chapters recorded with identical settings are supported, and no tags can be embedded.
+type Native struct{}
+
+// Whether job can be merged natively, as far as its options tell; an error wrapping [mp4.ErrUnsupported] says why not.
+// Inputs recorded with differing settings are only found out while merging.
+func (n *Native) Check(job Job) error {
+
+	if len(job.Metadata) > 0 || len(job.Provenance) > 0 {
+		return fmt.Errorf("%w: embedding tags", mp4.ErrUnsupported)
+	}
+
+	if job.Output == "-" {
+		return fmt.Errorf("%w: streamed output", mp4.ErrUnsupported)
+	}
+
+	if job.Audio != nil {
+		return fmt.Errorf("%w: external audio", mp4.ErrUnsupported)
+	}
+
+	if job.Convert != nil || job.Sound != nil {
+		return fmt.Errorf("%w: re-encoding", mp4.ErrUnsupported)
+	}
+
+	// Every track is carried over as it is
+	if job.NoData {
+		return fmt.Errorf("%w: leaving out data streams", mp4.ErrUnsupported)
+	}
+
+	// Only plain MP4 can be written natively
+	switch strings.ToLower(filepath.Ext(job.Output)) {
+	case ".mp4", ".mov", ".m4v":
+	default:
+		if job.Format != "mp4" {
+			return fmt.Errorf("%w: %s output", mp4.ErrUnsupported, filepath.Ext(job.Output))
+		}
+	}
+
+	if job.Format != "" && job.Format != "mp4" {
+		return fmt.Errorf("%w: %s output", mp4.ErrUnsupported, job.Format)
+	}
+
+	return nil
+}
+
+func (n *Native) Merge(ctx context.Context, job Job) error {
+
+	if err := n.Check(job); err != nil {
+		return err
+	}
+
+	var progress func(int64, int64)
+
+	if job.Progress != nil {
+		progress = func(done int64, total int64) {
+			if total > 0 {
+				job.Progress(float64(done) / float64(total))
+			}
+		}
+	}
+
+	return mp4.Concat(ctx, job.Inputs, job.Output, progress)
+}
+
+// Backend merging natively where possible, and with ffmpeg for anything unusual.
+type Auto struct {
+	Native *Native
+	FFmpeg *FFmpeg
+}
+
+func (a *Auto) Merge(ctx context.Context, job Job) error {
+
+	// Native merging leaves no output behind when it fails, so ffmpeg starts clean
+	err := a.Native.Merge(ctx, job)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	return a.FFmpeg.Merge(ctx, job)
+}
@@ -0,0 +1,915 @@
+package mp4
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// Returned by [Concat] for inputs it cannot join, such as fragmented files or chapters recorded with different settings.
+var ErrUnsupported = errors.New("unsupported for native concatenation")
+
+// Run of samples sharing a value, as stored in stts and ctts.
+type run struct {
+	Count uint32
+	Value uint32
+}
+
+// Contiguous samples of one track, stored at Offset in the source file.
+type chunk struct {
+	source      int // Index of input holding chunk.
+	Offset      int64
+	Size        int64
+	Samples     uint32
+	Description uint32
+}
+
+// Sample tables of a track, either as read from one input or merged across all of them.
+type track struct {
+	Handler     string
+	Timescale   uint32
+	Duration    uint64 // In media timescale.
+	TrackDur    uint64 // In movie timescale.
+	Description []byte // Raw stsd payload.
+	Samples     uint32
+	UniformSize uint32 // Size of every sample, or 0 if Sizes holds them.
+	Sizes       []uint32
+	Times       []run
+	Offsets     []run // Composition offsets; nil without ctts.
+	CttsVersion byte
+	Sync        []uint32 // 1-based sync sample numbers; nil if every sample is sync.
+	Chunks      []chunk
+}
+
+// Parsed input of [Concat].
+type movie struct {
+	file      *os.File
+	ftyp      []byte // Whole box, header included.
+	moov      Box
+	Timescale uint32
+	Duration  uint64
+	Tracks    []*track
+	HiLights  []uint32 // Milliseconds.
+}
+
+// Payload of box b.
+func payload(r io.ReaderAt, b Box) ([]byte, error) {
+
+	p := make([]byte, b.Size)
+	if _, err := r.ReadAt(p, b.Offset); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Payload of first child of parent with type boxType, or nil if none.
+func child(r io.ReaderAt, parent Box, boxType string) ([]byte, error) {
+
+	children, err := Children(r, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range children {
+		if c.Type == boxType {
+			return payload(r, c)
+		}
+	}
+
+	return nil, nil
+}
+
+// Child box of parent with type boxType.
+func childBox(r io.ReaderAt, parent Box, boxType string) (Box, bool, error) {
+
+	children, err := Children(r, parent)
+	if err != nil {
+		return Box{}, false, err
+	}
+
+	for _, c := range children {
+		if c.Type == boxType {
+			return c, true, nil
+		}
+	}
+
+	return Box{}, false, nil
+}
+
+// Offset of duration field in mvhd, tkhd or mdhd payload p, by box version.
+func durationOffset(boxType string, p []byte) int {
+
+	v1 := len(p) > 0 && p[0] == 1
+
+	switch {
+	case boxType == "tkhd" && v1:
+		return 28
+	case boxType == "tkhd":
+		return 20
+	case v1:
+		return 24
+	default:
+		return 16
+	}
+}
+
+// Read duration field of mvhd, tkhd or mdhd payload p.
+func readDuration(boxType string, p []byte) (uint64, error) {
+
+	at := durationOffset(boxType, p)
+
+	if p[0] == 1 {
+		if len(p) < at+8 {
+			return 0, fmt.Errorf("%s box is truncated", boxType)
+		}
+		return binary.BigEndian.Uint64(p[at:]), nil
+	}
+
+	if len(p) < at+4 {
+		return 0, fmt.Errorf("%s box is truncated", boxType)
+	}
+
+	return uint64(binary.BigEndian.Uint32(p[at:])), nil
+}
+
+// Copy of mvhd, tkhd or mdhd payload p with its duration set to d.
+func writeDuration(boxType string, p []byte, d uint64) ([]byte, error) {
+
+	out := append([]byte{}, p...)
+	at := durationOffset(boxType, p)
+
+	if p[0] == 1 {
+		binary.BigEndian.PutUint64(out[at:], d)
+		return out, nil
+	}
+
+	if d > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: duration overflows version 0 %s", ErrUnsupported, boxType)
+	}
+
+	binary.BigEndian.PutUint32(out[at:], uint32(d))
+
+	return out, nil
+}
+
+// Entries of a table box laid out as version/flags, count, then fixed-width entries.
+func table(p []byte, width int) ([]byte, uint32, error) {
+
+	if len(p) < 8 {
+		return nil, 0, errors.New("sample table is truncated")
+	}
+
+	count := binary.BigEndian.Uint32(p[4:8])
+	if uint64(len(p)-8) < uint64(count)*uint64(width) {
+		return nil, 0, errors.New("sample table is truncated")
+	}
+
+	return p[8:], count, nil
+}
+
+func readRuns(p []byte) ([]run, error) {
+
+	entries, count, err := table(p, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]run, count)
+	for i := range runs {
+		runs[i] = run{Count: binary.BigEndian.Uint32(entries[i*8:]), Value: binary.BigEndian.Uint32(entries[i*8+4:])}
+	}
+
+	return runs, nil
+}
+
+// Parse sample tables of trak box.
+func readTrack(f *os.File, source int, trak Box) (*track, error) {
+
+	t := &track{}
+
+	tkhd, err := child(f, trak, "tkhd")
+	if err != nil || tkhd == nil {
+		return nil, fmt.Errorf("track without tkhd: %v", err)
+	}
+
+	if t.TrackDur, err = readDuration("tkhd", tkhd); err != nil {
+		return nil, err
+	}
+
+	mdia, ok, err := childBox(f, trak, "mdia")
+	if err != nil || !ok {
+		return nil, fmt.Errorf("track without mdia: %v", err)
+	}
+
+	mdhd, err := child(f, mdia, "mdhd")
+	if err != nil || len(mdhd) < 24 {
+		return nil, fmt.Errorf("track without mdhd: %v", err)
+	}
+
+	t.Timescale = binary.BigEndian.Uint32(mdhd[durationOffset("mdhd", mdhd)-4:])
+	if t.Duration, err = readDuration("mdhd", mdhd); err != nil {
+		return nil, err
+	}
+
+	hdlr, err := child(f, mdia, "hdlr")
+	if err != nil || len(hdlr) < 12 {
+		return nil, fmt.Errorf("track without hdlr: %v", err)
+	}
+	t.Handler = string(hdlr[8:12])
+
+	minf, ok, err := childBox(f, mdia, "minf")
+	if err != nil || !ok {
+		return nil, fmt.Errorf("track without minf: %v", err)
+	}
+
+	stbl, ok, err := childBox(f, minf, "stbl")
+	if err != nil || !ok {
+		return nil, fmt.Errorf("track without stbl: %v", err)
+	}
+
+	boxes, err := Children(f, stbl)
+	if err != nil {
+		return nil, err
+	}
+
+	var stsc []byte
+	var offsets []int64
+
+	for _, b := range boxes {
+
+		p, err := payload(f, b)
+		if err != nil {
+			return nil, err
+		}
+
+		switch b.Type {
+
+		case "stsd":
+			t.Description = p
+
+		case "stts":
+			if t.Times, err = readRuns(p); err != nil {
+				return nil, err
+			}
+
+		case "ctts":
+			t.CttsVersion = p[0]
+			if t.Offsets, err = readRuns(p); err != nil {
+				return nil, err
+			}
+
+		case "stss":
+			entries, count, err := table(p, 4)
+			if err != nil {
+				return nil, err
+			}
+			t.Sync = make([]uint32, count)
+			for i := range t.Sync {
+				t.Sync[i] = binary.BigEndian.Uint32(entries[i*4:])
+			}
+
+		case "stsz":
+			if len(p) < 12 {
+				return nil, errors.New("stsz box is truncated")
+			}
+			t.UniformSize = binary.BigEndian.Uint32(p[4:8])
+			t.Samples = binary.BigEndian.Uint32(p[8:12])
+			if t.UniformSize == 0 {
+				if uint64(len(p)-12) < uint64(t.Samples)*4 {
+					return nil, errors.New("stsz box is truncated")
+				}
+				t.Sizes = make([]uint32, t.Samples)
+				for i := range t.Sizes {
+					t.Sizes[i] = binary.BigEndian.Uint32(p[12+i*4:])
+				}
+			}
+
+		case "stsc":
+			stsc = p
+
+		case "stco", "co64":
+			width := 4
+			if b.Type == "co64" {
+				width = 8
+			}
+			entries, count, err := table(p, width)
+			if err != nil {
+				return nil, err
+			}
+			offsets = make([]int64, count)
+			for i := range offsets {
+				if width == 8 {
+					offsets[i] = int64(binary.BigEndian.Uint64(entries[i*8:]))
+				} else {
+					offsets[i] = int64(binary.BigEndian.Uint32(entries[i*4:]))
+				}
+			}
+
+		case "stz2":
+			return nil, fmt.Errorf("%w: compact sample sizes", ErrUnsupported)
+
+		}
+
+	}
+
+	if t.Description == nil || t.Times == nil || stsc == nil || offsets == nil {
+		return nil, fmt.Errorf("%w: incomplete sample table", ErrUnsupported)
+	}
+
+	// Split samples into chunks as described by stsc
+	entries, count, err := table(stsc, 12)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := uint32(0)
+	for e := uint32(0); e < count; e++ {
+
+		first := binary.BigEndian.Uint32(entries[e*12:])
+		perChunk := binary.BigEndian.Uint32(entries[e*12+4:])
+		description := binary.BigEndian.Uint32(entries[e*12+8:])
+
+		last := uint32(len(offsets))
+		if e+1 < count {
+			last = binary.BigEndian.Uint32(entries[(e+1)*12:]) - 1
+		}
+
+		for c := first; c <= last && c >= 1 && int(c) <= len(offsets); c++ {
+
+			size := int64(0)
+			for s := sample; s < sample+perChunk; s++ {
+				size += int64(t.sampleSize(s))
+			}
+
+			t.Chunks = append(t.Chunks, chunk{source: source, Offset: offsets[c-1], Size: size, Samples: perChunk, Description: description})
+			sample += perChunk
+
+		}
+
+	}
+
+	if sample != t.Samples {
+		return nil, fmt.Errorf("chunks hold %d samples, expected %d", sample, t.Samples)
+	}
+
+	return t, nil
+}
+
+// Size of 0-based sample s.
+func (t *track) sampleSize(s uint32) uint32 {
+
+	if t.UniformSize != 0 {
+		return t.UniformSize
+	}
+
+	if int(s) < len(t.Sizes) {
+		return t.Sizes[s]
+	}
+
+	return 0
+}
+
+// Open and parse input at path.
+func readMovie(path string, source int) (*movie, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	m := &movie{file: f}
+
+	top, err := Children(f, Box{Size: info.Size()})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	for _, b := range top {
+		switch b.Type {
+		case "ftyp":
+			header := b.Offset - 8
+			if m.ftyp, err = payload(f, Box{Offset: header, Size: b.Size + 8}); err != nil {
+				f.Close()
+				return nil, err
+			}
+		case "moov":
+			m.moov = b
+		case "moof":
+			f.Close()
+			return nil, fmt.Errorf("%w: fragmented MP4", ErrUnsupported)
+		}
+	}
+
+	if m.moov.Type == "" {
+		f.Close()
+		return nil, fmt.Errorf("%s: no moov box", path)
+	}
+
+	boxes, err := Children(f, m.moov)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	for _, b := range boxes {
+
+		switch b.Type {
+
+		case "mvhd":
+			p, err := payload(f, b)
+			if err == nil && len(p) < 20 {
+				err = errors.New("mvhd box is truncated")
+			}
+			if err == nil {
+				m.Timescale = binary.BigEndian.Uint32(p[durationOffset("mvhd", p)-4:])
+				m.Duration, err = readDuration("mvhd", p)
+			}
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+
+		case "trak":
+			t, err := readTrack(f, source, b)
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			m.Tracks = append(m.Tracks, t)
+
+		case "mvex":
+			f.Close()
+			return nil, fmt.Errorf("%w: fragmented MP4", ErrUnsupported)
+
+		}
+
+	}
+
+	// HiLights are optional
+	if hilights, err := HiLights(path); err == nil {
+		for _, h := range hilights {
+			m.HiLights = append(m.HiLights, uint32(h.Milliseconds()))
+		}
+	}
+
+	return m, nil
+}
+
+// Append runs of other to runs, joining the seam if values match.
+func appendRuns(runs []run, other []run) []run {
+
+	for _, r := range other {
+		if n := len(runs); n > 0 && runs[n-1].Value == r.Value {
+			runs[n-1].Count += r.Count
+			continue
+		}
+		runs = append(runs, r)
+	}
+
+	return runs
+}
+
+// Join tracks of movies index by index, failing unless every chapter was recorded with the same settings.
+func mergeTracks(movies []*movie) ([]*track, error) {
+
+	first := movies[0]
+	merged := []*track{}
+
+	for i, t := range first.Tracks {
+
+		out := &track{
+			Handler:     t.Handler,
+			Timescale:   t.Timescale,
+			Description: t.Description,
+			UniformSize: t.UniformSize,
+			CttsVersion: t.CttsVersion,
+		}
+
+		hasSync := t.Sync != nil
+		hasOffsets := t.Offsets != nil
+
+		for _, m := range movies {
+
+			if len(m.Tracks) != len(first.Tracks) {
+				return nil, fmt.Errorf("%w: chapters have different track counts", ErrUnsupported)
+			}
+
+			o := m.Tracks[i]
+
+			if o.Handler != t.Handler || o.Timescale != t.Timescale || !bytes.Equal(o.Description, t.Description) {
+				return nil, fmt.Errorf("%w: chapters have different %s track parameters", ErrUnsupported, t.Handler)
+			}
+
+			if (o.Sync != nil) != hasSync || (o.Offsets != nil) != hasOffsets || o.CttsVersion != t.CttsVersion {
+				return nil, fmt.Errorf("%w: chapters have different %s sample tables", ErrUnsupported, t.Handler)
+			}
+
+			// Sizes only stay uniform if every chapter agrees
+			if out.UniformSize != 0 && o.UniformSize != out.UniformSize {
+				for s := uint32(0); s < out.Samples; s++ {
+					out.Sizes = append(out.Sizes, out.UniformSize)
+				}
+				out.UniformSize = 0
+			}
+
+			if out.UniformSize == 0 {
+				for s := uint32(0); s < o.Samples; s++ {
+					out.Sizes = append(out.Sizes, o.sampleSize(s))
+				}
+			}
+
+			for _, s := range o.Sync {
+				out.Sync = append(out.Sync, s+out.Samples)
+			}
+
+			out.Times = appendRuns(out.Times, o.Times)
+			out.Offsets = appendRuns(out.Offsets, o.Offsets)
+			out.Chunks = append(out.Chunks, o.Chunks...)
+			out.Samples += o.Samples
+			out.Duration += o.Duration
+			out.TrackDur += o.TrackDur
+
+		}
+
+		merged = append(merged, out)
+
+	}
+
+	return merged, nil
+}
+
+// Box of boxType around payload.
+func box(boxType string, payload []byte) []byte {
+
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(8+len(payload)))
+	copy(b[4:], boxType)
+
+	return append(b, payload...)
+}
+
+// Full box payload of version 0 and no flags, followed by count and then fields.
+func tableBox(boxType string, version byte, count int, fields func(buf *bytes.Buffer)) []byte {
+
+	buf := bytes.Buffer{}
+	buf.Write([]byte{version, 0, 0, 0})
+	binary.Write(&buf, binary.BigEndian, uint32(count))
+	fields(&buf)
+
+	return box(boxType, buf.Bytes())
+}
+
+// Sample table boxes of merged track, chunk offsets taken from positions.
+func (t *track) sampleTables(positions []int64, large bool) []byte {
+
+	out := bytes.Buffer{}
+
+	out.Write(box("stsd", t.Description))
+
+	out.Write(tableBox("stts", 0, len(t.Times), func(buf *bytes.Buffer) {
+		for _, r := range t.Times {
+			binary.Write(buf, binary.BigEndian, [2]uint32{r.Count, r.Value})
+		}
+	}))
+
+	if t.Offsets != nil {
+		out.Write(tableBox("ctts", t.CttsVersion, len(t.Offsets), func(buf *bytes.Buffer) {
+			for _, r := range t.Offsets {
+				binary.Write(buf, binary.BigEndian, [2]uint32{r.Count, r.Value})
+			}
+		}))
+	}
+
+	if t.Sync != nil {
+		out.Write(tableBox("stss", 0, len(t.Sync), func(buf *bytes.Buffer) {
+			binary.Write(buf, binary.BigEndian, t.Sync)
+		}))
+	}
+
+	// One stsc entry per change in samples per chunk or description
+	type stscEntry struct{ First, Samples, Description uint32 }
+	entries := []stscEntry{}
+	for i, c := range t.Chunks {
+		if n := len(entries); n == 0 || entries[n-1].Samples != c.Samples || entries[n-1].Description != c.Description {
+			entries = append(entries, stscEntry{uint32(i + 1), c.Samples, c.Description})
+		}
+	}
+
+	out.Write(tableBox("stsc", 0, len(entries), func(buf *bytes.Buffer) {
+		binary.Write(buf, binary.BigEndian, entries)
+	}))
+
+	// stsz carries its uniform size before the count, so it is built by hand
+	stsz := bytes.Buffer{}
+	stsz.Write([]byte{0, 0, 0, 0})
+	binary.Write(&stsz, binary.BigEndian, [2]uint32{t.UniformSize, t.Samples})
+	if t.UniformSize == 0 {
+		binary.Write(&stsz, binary.BigEndian, t.Sizes)
+	}
+	out.Write(box("stsz", stsz.Bytes()))
+
+	if large {
+		out.Write(tableBox("co64", 0, len(positions), func(buf *bytes.Buffer) {
+			binary.Write(buf, binary.BigEndian, positions)
+		}))
+	} else {
+		out.Write(tableBox("stco", 0, len(positions), func(buf *bytes.Buffer) {
+			for _, p := range positions {
+				binary.Write(buf, binary.BigEndian, uint32(p))
+			}
+		}))
+	}
+
+	return out.Bytes()
+}
+
+// State of rebuilding the first input's moov around merged tracks.
+type moovWriter struct {
+	movies    []*movie
+	tracks    []*track
+	positions [][]int64 // Output offset of each chunk, per track.
+	large     bool      // Whether chunk offsets need 64 bits.
+	current   int       // Index of trak being written.
+}
+
+// Rebuild children of parent from the first input, replacing everything that depends on samples.
+func (w *moovWriter) children(parent Box) ([]byte, error) {
+
+	f := w.movies[0].file
+
+	boxes, err := Children(f, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.Buffer{}
+
+	for _, b := range boxes {
+
+		switch b.Type {
+
+		// Containers are rebuilt recursively
+		case "moov", "mdia", "minf", "udta":
+			p, err := w.children(b)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(box(b.Type, p))
+
+		case "trak":
+			p, err := w.children(b)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(box(b.Type, p))
+			w.current++
+
+		case "stbl":
+			t := w.tracks[w.current]
+			out.Write(box(b.Type, t.sampleTables(w.positions[w.current], w.large)))
+
+		case "mvhd", "tkhd", "mdhd":
+			p, err := payload(f, b)
+			if err != nil {
+				return nil, err
+			}
+
+			d := uint64(0)
+			switch b.Type {
+			case "mvhd":
+				for _, m := range w.movies {
+					d += m.Duration
+				}
+			case "tkhd":
+				d = w.tracks[w.current].TrackDur
+			case "mdhd":
+				d = w.tracks[w.current].Duration
+			}
+
+			if p, err = writeDuration(b.Type, p, d); err != nil {
+				return nil, err
+			}
+			out.Write(box(b.Type, p))
+
+		// Edit lists describe a single chapter; the merged track plays straight through
+		case "edts":
+
+		// HiLights of later chapters move by the length of those before
+		case "HMMT":
+			hilights := []uint32{}
+			offset := uint64(0)
+			for _, m := range w.movies {
+				for _, h := range m.HiLights {
+					hilights = append(hilights, uint32(offset+uint64(h)))
+				}
+				if m.Timescale > 0 {
+					offset += m.Duration * 1000 / uint64(m.Timescale)
+				}
+			}
+
+			p := bytes.Buffer{}
+			binary.Write(&p, binary.BigEndian, uint32(len(hilights)))
+			binary.Write(&p, binary.BigEndian, hilights)
+			out.Write(box(b.Type, p.Bytes()))
+
+		default:
+			p, err := payload(f, b)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(box(b.Type, p))
+
+		}
+
+	}
+
+	return out.Bytes(), nil
+}
+
+// Lay out moov by build, given where media starts after head, moov and a 64-bit mdat header, and whether chunk offsets need 64 bits.
+// The size of moov does not depend on offsets, only on their width, but offsets depend on its size:
+// build is called again until both stay put.
+func layout(head int64, mediaSize int64, build func(base int64, large bool) ([]byte, error)) ([]byte, error) {
+
+	base, large := head+16, false
+
+	for {
+
+		moov, err := build(base, large)
+		if err != nil {
+			return nil, err
+		}
+
+		next := head + int64(len(moov)) + 16
+		nextLarge := large || next+mediaSize > math.MaxUint32
+
+		if next == base && nextLarge == large {
+			return moov, nil
+		}
+
+		base, large = next, nextLarge
+
+	}
+}
+
+// Join MP4 chapters recorded with identical settings into output, without re-encoding or external tools.
+// The moov box is placed first, so output can play while still downloading.
+// Progress, if not nil, is called with bytes of media copied so far and in total.
+// Once ctx is done, copying stops and output is removed.
+func Concat(ctx context.Context, inputs []string, output string, progress func(done int64, total int64)) error {
+
+	if len(inputs) == 0 {
+		return errors.New("nothing to concatenate")
+	}
+
+	movies := []*movie{}
+	defer func() {
+		for _, m := range movies {
+			m.file.Close()
+		}
+	}()
+
+	for i, input := range inputs {
+		m, err := readMovie(input, i)
+		if err != nil {
+			return err
+		}
+		movies = append(movies, m)
+	}
+
+	tracks, err := mergeTracks(movies)
+	if err != nil {
+		return err
+	}
+
+	// Copy chunks of each chapter in their original order, keeping tracks interleaved
+	type placed struct {
+		track int
+		index int
+		chunk chunk
+	}
+
+	order := []placed{}
+	for i, t := range tracks {
+		for j, c := range t.Chunks {
+			order = append(order, placed{i, j, c})
+		}
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		if order[a].chunk.source != order[b].chunk.source {
+			return order[a].chunk.source < order[b].chunk.source
+		}
+		return order[a].chunk.Offset < order[b].chunk.Offset
+	})
+
+	w := &moovWriter{movies: movies, tracks: tracks, positions: make([][]int64, len(tracks))}
+	for i, t := range tracks {
+		w.positions[i] = make([]int64, len(t.Chunks))
+	}
+
+	mediaSize := int64(0)
+	for _, p := range order {
+		mediaSize += p.chunk.Size
+	}
+
+	moov, err := layout(int64(len(movies[0].ftyp)), mediaSize, func(base int64, large bool) ([]byte, error) {
+
+		position := base
+		for _, p := range order {
+			w.positions[p.track][p.index] = position
+			position += p.chunk.Size
+		}
+
+		w.current = 0
+		w.large = large
+
+		children, err := w.children(movies[0].moov)
+		if err != nil {
+			return nil, err
+		}
+
+		return box("moov", children), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	chunks := make([]chunk, len(order))
+	for i, p := range order {
+		chunks[i] = p.chunk
+	}
+
+	err = writeMovie(ctx, f, movies, moov, chunks, mediaSize, progress)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(output)
+	}
+
+	return err
+}
+
+// Write ftyp, moov and an mdat holding chunks copied from movies.
+func writeMovie(ctx context.Context, f *os.File, movies []*movie, moov []byte, chunks []chunk, mediaSize int64, progress func(int64, int64)) error {
+
+	if _, err := f.Write(movies[0].ftyp); err != nil {
+		return err
+	}
+
+	if _, err := f.Write(moov); err != nil {
+		return err
+	}
+
+	// Always a 64-bit mdat header, so its size is known before laying out moov
+	header := make([]byte, 16)
+	binary.BigEndian.PutUint32(header, 1)
+	copy(header[4:], "mdat")
+	binary.BigEndian.PutUint64(header[8:], uint64(16+mediaSize))
+
+	if _, err := f.Write(header); err != nil {
+		return err
+	}
+
+	done := int64(0)
+	for _, c := range chunks {
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(f, io.NewSectionReader(movies[c.source].file, c.Offset, c.Size)); err != nil {
+			return err
+		}
+
+		done += c.Size
+		if progress != nil {
+			progress(done, mediaSize)
+		}
+
+	}
+
+	return f.Sync()
+}
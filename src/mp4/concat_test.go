@@ -0,0 +1,81 @@
+package mp4
+
+import (
+	"math"
+	"testing"
+)
+
+// Chunk offsets past 4 GiB widen stco to co64, which grows moov and so moves every chunk.
+func TestLayoutLarge(t *testing.T) {
+
+	const head = 32
+	sizes := []int64{math.MaxUint32 / 2, math.MaxUint32 / 2, 1 << 20}
+
+	mediaSize := int64(0)
+	for _, s := range sizes {
+		mediaSize += s
+	}
+
+	var positions []int64
+	var wide bool
+
+	// Stand-in for moov: a fixed part, then one stco or co64 entry per chunk
+	build := func(base int64, large bool) ([]byte, error) {
+
+		positions, wide = positions[:0], large
+		position := base
+		for _, s := range sizes {
+			positions = append(positions, position)
+			position += s
+		}
+
+		entry := 4
+		if large {
+			entry = 8
+		}
+
+		return make([]byte, 1000+entry*len(sizes)), nil
+	}
+
+	moov, err := layout(head, mediaSize, build)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !wide {
+		t.Fatal("offsets past 4 GiB laid out as stco")
+	}
+
+	position := int64(head+len(moov)) + 16
+	for i, s := range sizes {
+		if positions[i] != position {
+			t.Errorf("chunk %d at %d, want %d", i, positions[i], position)
+		}
+		position += s
+	}
+
+}
+
+// Offsets within 4 GiB stay 32-bit.
+func TestLayoutSmall(t *testing.T) {
+
+	var wide bool
+	var base int64
+
+	moov, err := layout(32, 1<<20, func(b int64, large bool) ([]byte, error) {
+		base, wide = b, large
+		return make([]byte, 1004), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wide {
+		t.Error("offsets within 4 GiB laid out as co64")
+	}
+
+	if want := int64(32+len(moov)) + 16; base != want {
+		t.Errorf("media at %d, want %d", base, want)
+	}
+
+}
@@ -0,0 +1,146 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Location of a box's payload within a file.
+type Box struct {
+	Type   string
+	Offset int64 // Offset of payload, just past the header.
+	Size   int64 // Size of payload.
+}
+
+// Read the header of the box starting at offset, bounded by end.
+func readBox(r io.ReaderAt, offset int64, end int64) (Box, error) {
+
+	header := make([]byte, 16)
+	if _, err := r.ReadAt(header[:8], offset); err != nil {
+		return Box{}, err
+	}
+
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	b := Box{Type: string(header[4:8]), Offset: offset + 8}
+
+	switch size {
+
+	// Box extends to end of its parent
+	case 0:
+		size = end - offset
+
+	// Box uses a 64-bit size
+	case 1:
+		if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+			return Box{}, err
+		}
+		size = int64(binary.BigEndian.Uint64(header[8:16]))
+		b.Offset += 8
+	}
+
+	b.Size = offset + size - b.Offset
+
+	if b.Size < 0 || offset+size > end {
+		return Box{}, fmt.Errorf("box \"%s\" at %d has invalid size", b.Type, offset)
+	}
+
+	return b, nil
+}
+
+// Boxes nested directly inside parent; a parent spanning the whole file yields top-level boxes.
+func Children(r io.ReaderAt, parent Box) ([]Box, error) {
+
+	boxes := []Box{}
+
+	end := parent.Offset + parent.Size
+	for offset := parent.Offset; offset+8 <= end; {
+
+		b, err := readBox(r, offset, end)
+		if err != nil {
+			return nil, err
+		}
+
+		boxes = append(boxes, b)
+		offset = b.Offset + b.Size
+	}
+
+	return boxes, nil
+}
+
+// Find nested box by following path of box types from top level.
+func Find(f *os.File, path ...string) (Box, error) {
+
+	info, err := f.Stat()
+	if err != nil {
+		return Box{}, err
+	}
+
+	current := Box{Size: info.Size()}
+
+	// For each box type in path...
+	for _, boxType := range path {
+
+		children, err := Children(f, current)
+		if err != nil {
+			return Box{}, err
+		}
+
+		found := false
+		for _, child := range children {
+			if child.Type == boxType {
+				current = child
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return Box{}, fmt.Errorf("box \"%s\" not found", boxType)
+		}
+
+	}
+
+	return current, nil
+}
+
+// HiLight tags marked on the camera or in the GoPro app, as offsets from the start of the video.
+func HiLights(path string) ([]time.Duration, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b, err := Find(f, "moov", "udta", "HMMT")
+	if err != nil {
+		return nil, err
+	}
+
+	// Payload is a count followed by that many millisecond offsets
+	payload := make([]byte, b.Size)
+	if _, err := f.ReadAt(payload, b.Offset); err != nil {
+		return nil, err
+	}
+
+	if len(payload) < 4 {
+		return nil, errors.New("HMMT box is truncated")
+	}
+
+	count := int(binary.BigEndian.Uint32(payload[:4]))
+	if len(payload) < 4+count*4 {
+		return nil, errors.New("HMMT box is truncated")
+	}
+
+	hilights := make([]time.Duration, count)
+	for i := range hilights {
+		ms := binary.BigEndian.Uint32(payload[4+i*4:])
+		hilights[i] = time.Duration(ms) * time.Millisecond
+	}
+
+	return hilights, nil
+}
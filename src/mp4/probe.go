@@ -0,0 +1,320 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/ff"
+)
+
+// Codec names of video sample entries, as ffprobe reports them.
+var entryCodecs = map[string]string{"avc1": "h264", "avc3": "h264", "hvc1": "hevc", "hev1": "hevc"}
+
+// HEVC profiles by general_profile_idc.
+var hevcProfiles = map[byte]string{1: "Main", 2: "Main 10", 3: "Main Still Picture", 4: "Rext"}
+
+// H.264 profiles by profile_idc.
+var avcProfiles = map[byte]string{66: "Baseline", 77: "Main", 88: "Extended", 100: "High", 110: "High 10", 122: "High 4:2:2", 244: "High 4:4:4 Predictive"}
+
+// Transfer characteristics of colr boxes, as ffprobe names them.
+var transfers = map[uint16]string{1: "bt709", 14: "bt2020-10", 15: "bt2020-12", 16: "smpte2084", 18: "arib-std-b67"}
+
+// Seconds from 1904, when MP4 times start, to 1970.
+const epoch1904 = 2082844800
+
+// Format and first video stream of MP4 file at path as ffprobe shows them when asked for stream v:0, read without running it.
+// Only what names and merges go by is filled in: codec, profile, picture size and format, frame rate, transfer, creation times, duration, handler name and firmware.
+// Files holding codecs it does not know, or no video at all, are an error, so they can be handed to ffprobe instead.
+func Probe(path string) (ff.ProbeData, error) {
+
+	data := ff.ProbeData{Format: ff.Format{Filename: path, Tags: map[string]interface{}{}}}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return data, err
+	}
+	defer f.Close()
+
+	moov, err := Find(f, "moov")
+	if err != nil {
+		return data, err
+	}
+
+	mvhd, err := child(f, moov, "mvhd")
+	if err != nil || len(mvhd) < 20 {
+		return data, fmt.Errorf("movie without mvhd: %v", err)
+	}
+
+	created, timescale, duration, err := header("mvhd", mvhd)
+	if err != nil {
+		return data, err
+	}
+
+	if created != "" {
+		data.Format.Tags["creation_time"] = created
+	}
+	if timescale > 0 {
+		data.Format.Duration = strconv.FormatFloat(float64(duration)/float64(timescale), 'f', 6, 64)
+	}
+
+	// GoPro's firmware version, e.g. "H22.01.01.10.00"
+	if udta, ok, err := childBox(f, moov, "udta"); err == nil && ok {
+		if firm, err := child(f, udta, "FIRM"); err == nil && firm != nil {
+			data.Format.Tags["firmware"] = strings.TrimRight(string(firm), "\x00 ")
+		}
+	}
+
+	children, err := Children(f, moov)
+	if err != nil {
+		return data, err
+	}
+
+	index := 0
+	for _, trak := range children {
+
+		if trak.Type != "trak" {
+			continue
+		}
+
+		data.Format.NbStreams++
+
+		if video, err := isVideo(f, trak); err != nil || !video || len(data.Streams) > 0 {
+			index++
+			continue
+		}
+
+		s, err := videoStream(f, trak)
+		if err != nil {
+			return data, err
+		}
+
+		s.Index = index
+		data.Streams = append(data.Streams, s)
+		index++
+
+	}
+
+	if len(data.Streams) == 0 {
+		return data, fmt.Errorf("no video track in %s", path)
+	}
+
+	return data, nil
+}
+
+// Whether MP4 file at path holds an audio track.
+func HasAudio(path string) (bool, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	moov, err := Find(f, "moov")
+	if err != nil {
+		return false, err
+	}
+
+	children, err := Children(f, moov)
+	if err != nil {
+		return false, err
+	}
+
+	for _, trak := range children {
+
+		if trak.Type != "trak" {
+			continue
+		}
+
+		handler, err := handlerType(f, trak)
+		if err != nil {
+			return false, err
+		}
+
+		if handler == "soun" {
+			return true, nil
+		}
+
+	}
+
+	return false, nil
+}
+
+// Creation time as ffprobe writes it, timescale and duration of mvhd or mdhd payload p; no creation time if unset.
+func header(boxType string, p []byte) (string, uint32, uint64, error) {
+
+	created, at := uint64(0), 12
+	if p[0] == 1 {
+		if len(p) < 24 {
+			return "", 0, 0, fmt.Errorf("%s box is truncated", boxType)
+		}
+		created, at = binary.BigEndian.Uint64(p[4:12]), 20
+	} else {
+		created = uint64(binary.BigEndian.Uint32(p[4:8]))
+	}
+
+	duration, err := readDuration(boxType, p)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	timescale := binary.BigEndian.Uint32(p[at:])
+
+	// Like ffmpeg, take times before 1970 to be counted from it rather than from 1904
+	if created >= epoch1904 {
+		created -= epoch1904
+	}
+
+	if created == 0 {
+		return "", timescale, duration, nil
+	}
+
+	return time.Unix(int64(created), 0).UTC().Format("2006-01-02T15:04:05.000000Z"), timescale, duration, nil
+}
+
+// Video stream of trak, which holds a video track.
+func videoStream(f *os.File, trak Box) (ff.Stream, error) {
+
+	s := ff.Stream{CodecType: "video", StreamVideo: &ff.StreamVideo{}, Tags: map[string]interface{}{}}
+
+	mdia, _, err := childBox(f, trak, "mdia")
+	if err != nil {
+		return s, err
+	}
+
+	mdhd, err := child(f, mdia, "mdhd")
+	if err != nil || len(mdhd) < 20 {
+		return s, fmt.Errorf("track without mdhd: %v", err)
+	}
+
+	created, timescale, _, err := header("mdhd", mdhd)
+	if err != nil {
+		return s, err
+	}
+
+	if created != "" {
+		s.Tags["creation_time"] = created
+	}
+	s.TimeBase = fmt.Sprintf("1/%d", timescale)
+
+	if hdlr, err := child(f, mdia, "hdlr"); err == nil && len(hdlr) > 24 {
+		s.Tags["handler_name"] = handlerName(hdlr[24:])
+	}
+
+	// Walk down to the sample tables of this track
+	stbl := mdia
+	for _, boxType := range []string{"minf", "stbl"} {
+		b, ok, err := childBox(f, stbl, boxType)
+		if err != nil {
+			return s, err
+		}
+		if !ok {
+			return s, fmt.Errorf("track without %s", boxType)
+		}
+		stbl = b
+	}
+
+	stsd, err := child(f, stbl, "stsd")
+	if err != nil {
+		return s, err
+	}
+
+	entry, _ := firstEntry(stsd)
+	if entry == nil {
+		return s, fmt.Errorf("track without sample description")
+	}
+
+	s.CodecTagString = string(entry[4:8])
+	codec, ok := entryCodecs[s.CodecTagString]
+	if !ok {
+		return s, fmt.Errorf("unknown video sample entry \"%s\"", s.CodecTagString)
+	}
+
+	s.CodecName = codec
+	s.Width = int(binary.BigEndian.Uint16(entry[32:34]))
+	s.Height = int(binary.BigEndian.Uint16(entry[34:36]))
+
+	boxes, err := entryChildren(entry)
+	if err != nil {
+		return s, err
+	}
+
+	for _, b := range boxes {
+
+		p := entry[b.Offset : b.Offset+b.Size]
+
+		switch {
+
+		// Profile, chroma format and bit depth follow the configuration version
+		case b.Type == "hvcC" && len(p) >= 19:
+			s.Profile = hevcProfiles[p[1]&0x1f]
+			s.PixFmt = pixFmt(p[16]&0x03, p[17]&0x07+8)
+
+		case b.Type == "avcC" && len(p) >= 2:
+			s.Profile = avcProfiles[p[1]]
+
+		// Only colour information of the nclx kind names a transfer
+		case b.Type == "colr" && len(p) >= 8 && string(p[:4]) == "nclx":
+			s.ColorTransfer = transfers[binary.BigEndian.Uint16(p[6:8])]
+
+		}
+	}
+
+	if stts, err := child(f, stbl, "stts"); err == nil && stts != nil {
+		if runs, err := readRuns(stts); err == nil {
+			s.RFrameRate = frameRate(timescale, runs)
+		}
+	}
+
+	return s, nil
+}
+
+// Handler name of hdlr, which QuickTime writers prefix with its length and others end with a null.
+func handlerName(p []byte) string {
+
+	if len(p) > 0 && int(p[0]) == len(p)-1 {
+		p = p[1:]
+	}
+
+	return strings.TrimRight(string(p), "\x00")
+}
+
+// Pixel format as ffprobe names it, for chroma format idc and bit depth; empty if it has no name here.
+func pixFmt(chroma byte, depth byte) string {
+
+	name := map[byte]string{0: "gray", 1: "yuv420p", 2: "yuv422p", 3: "yuv444p"}[chroma]
+	if name == "" || depth == 8 {
+		return name
+	}
+
+	return fmt.Sprintf("%s%dle", name, depth)
+}
+
+// Frame rate as ffprobe writes r_frame_rate, from the sample duration most samples share, e.g. "60000/1001".
+func frameRate(timescale uint32, runs []run) string {
+
+	counts := map[uint32]uint64{}
+	delta := uint32(0)
+	for _, r := range runs {
+		counts[r.Value] += uint64(r.Count)
+		if counts[r.Value] > counts[delta] {
+			delta = r.Value
+		}
+	}
+
+	if delta == 0 || timescale == 0 {
+		return "0/0"
+	}
+
+	// Reduced, as ffprobe does
+	a, b := timescale, delta
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return fmt.Sprintf("%d/%d", timescale/a, delta/a)
+}
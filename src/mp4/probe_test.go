@@ -0,0 +1,139 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Payload of a version 0 mvhd or mdhd created at created, counted from 1904, with timescale and duration; size is that of the whole payload.
+func header0(created uint32, timescale uint32, duration uint32, size int) []byte {
+
+	p := make([]byte, size)
+	binary.BigEndian.PutUint32(p[4:], created)
+	binary.BigEndian.PutUint32(p[12:], timescale)
+	binary.BigEndian.PutUint32(p[16:], duration)
+
+	return p
+}
+
+// Trak of handler type with one sample entry, as cameras write them; entries of other than visual tracks are left empty.
+func trak(handler string, name string, created uint32, entry string, width uint16, height uint16, config []byte, delta uint32) []byte {
+
+	hdlr := make([]byte, 24)
+	copy(hdlr[8:], handler)
+	hdlr = append(hdlr, name...)
+	hdlr = append(hdlr, 0)
+
+	sample := make([]byte, visualEntryHeader-8)
+	binary.BigEndian.PutUint16(sample[24:], width)
+	binary.BigEndian.PutUint16(sample[26:], height)
+	sample = append(sample, config...)
+
+	stsd := tableBox("stsd", 0, 1, func(buf *bytes.Buffer) { buf.Write(box(entry, sample)) })
+	stts := tableBox("stts", 0, 1, func(buf *bytes.Buffer) {
+		binary.Write(buf, binary.BigEndian, []uint32{100, delta})
+	})
+
+	stbl := box("stbl", append(stsd, stts...))
+	mdia := append(box("mdhd", header0(created, 60000, 100*delta, 24)), box("hdlr", hdlr)...)
+	mdia = append(mdia, box("minf", stbl)...)
+
+	return box("trak", box("mdia", mdia))
+}
+
+// hvcC of profile idc, chroma format idc and bit depth.
+func hvcC(profile byte, chroma byte, depth byte) []byte {
+
+	p := make([]byte, 23)
+	p[1] = profile
+	p[16] = 0xfc | chroma
+	p[17] = 0xf8 | (depth - 8)
+
+	return box("hvcC", p)
+}
+
+// Native probes read what ffprobe would from the boxes cameras write.
+func TestProbe(t *testing.T) {
+
+	// 2024-05-01T10:00:00Z, counted from 1904
+	const created = 1714557600 + epoch1904
+
+	video := trak("vide", "GoPro H.265", created, "hvc1", 3840, 2160, hvcC(2, 1, 10), 1001)
+	audio := trak("soun", "GoPro AAC", created, "mp4a", 0, 0, nil, 1024)
+
+	tests := []struct {
+		name    string
+		traks   [][]byte
+		created uint32
+		codec   string
+		profile string
+		pixFmt  string
+		rate    string
+		index   int
+		err     bool
+	}{
+		{name: "hevc", traks: [][]byte{video, audio}, created: created, codec: "hevc", profile: "Main 10", pixFmt: "yuv420p10le", rate: "60000/1001"},
+		{name: "avc", traks: [][]byte{trak("vide", "GoPro AVC", created, "avc1", 1920, 1080, box("avcC", []byte{1, 100}), 1000)}, created: created, codec: "h264", profile: "High", rate: "60/1"},
+		{name: "audio first", traks: [][]byte{audio, video}, created: created, codec: "hevc", profile: "Main 10", pixFmt: "yuv420p10le", rate: "60000/1001", index: 1},
+		{name: "no creation time", traks: [][]byte{trak("vide", "GoPro H.265", 0, "hvc1", 3840, 2160, hvcC(2, 1, 10), 1001)}, codec: "hevc", profile: "Main 10", pixFmt: "yuv420p10le", rate: "60000/1001"},
+		{name: "unknown codec", traks: [][]byte{trak("vide", "", created, "mp4v", 640, 480, nil, 1001)}, err: true},
+		{name: "no video", traks: [][]byte{audio}, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			moov := box("mvhd", header0(test.created, 600, 1200, 100))
+			for _, trak := range test.traks {
+				moov = append(moov, trak...)
+			}
+
+			path := filepath.Join(t.TempDir(), "GX010042.MP4")
+			if err := os.WriteFile(path, append(box("ftyp", []byte("mp42")), box("moov", moov)...), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := Probe(path)
+			if test.err {
+				if err == nil {
+					t.Fatal("probed without error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if data.Format.Duration != "2.000000" {
+				t.Errorf("duration %s, want 2.000000", data.Format.Duration)
+			}
+
+			want := ""
+			if test.created != 0 {
+				want = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).Format("2006-01-02T15:04:05.000000Z")
+			}
+			if got, _ := data.Format.Tags["creation_time"].(string); got != want {
+				t.Errorf("creation time %q, want %q", got, want)
+			}
+
+			if len(data.Streams) != 1 {
+				t.Fatalf("%d streams, want 1", len(data.Streams))
+			}
+
+			s := data.Streams[0]
+			if s.CodecName != test.codec || s.Profile != test.profile || s.PixFmt != test.pixFmt || s.RFrameRate != test.rate || s.Index != test.index {
+				t.Errorf("stream %d %s %s %s %s, want %d %s %s %s %s", s.Index, s.CodecName, s.Profile, s.PixFmt, s.RFrameRate, test.index, test.codec, test.profile, test.pixFmt, test.rate)
+			}
+
+			if got, _ := s.Tags["creation_time"].(string); got != want {
+				t.Errorf("stream creation time %q, want %q", got, want)
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,393 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// UUID of Spherical Video V1 boxes, as written by Google's spatial-media tools.
+var sphericalUUID = []byte{0xff, 0xcc, 0x82, 0x63, 0xf8, 0x55, 0x4a, 0x93, 0x88, 0x14, 0x58, 0x7a, 0x02, 0x52, 0x1f, 0xdd}
+
+// Size of a visual sample entry before its child boxes.
+const visualEntryHeader = 8 + 78
+
+// Spherical and stereoscopic metadata of a video track, kept as raw box payloads; nil payloads are absent.
+type Spherical struct {
+	UUID []byte // Spherical Video V1 "uuid" payload inside trak: UUID followed by RDF/XML.
+	SV3D []byte // Spherical Video V2 "sv3d" payload inside the sample entry.
+	ST3D []byte // Stereoscopic 3D "st3d" payload inside the sample entry.
+}
+
+// Whether any spherical metadata is present.
+func (s Spherical) Present() bool {
+	return s.UUID != nil || s.SV3D != nil || s.ST3D != nil
+}
+
+// Whether s holds every kind of metadata other holds.
+func (s Spherical) Covers(other Spherical) bool {
+	return (other.UUID == nil || s.UUID != nil) && (other.SV3D == nil || s.SV3D != nil) && (other.ST3D == nil || s.ST3D != nil)
+}
+
+// Whether trak holds a video track.
+func isVideo(r io.ReaderAt, trak Box) (bool, error) {
+	handler, err := handlerType(r, trak)
+	return handler == "vide", err
+}
+
+// Handler type of trak, e.g. "vide" or "soun"; empty if it has none.
+func handlerType(r io.ReaderAt, trak Box) (string, error) {
+
+	mdia, ok, err := childBox(r, trak, "mdia")
+	if err != nil || !ok {
+		return "", err
+	}
+
+	hdlr, err := child(r, mdia, "hdlr")
+	if err != nil || len(hdlr) < 12 {
+		return "", err
+	}
+
+	// Handler type follows version, flags and pre-defined fields
+	return string(hdlr[8:12]), nil
+}
+
+// First sample entry of stsd payload p, with its offset within p; nil if none.
+func firstEntry(p []byte) ([]byte, int) {
+
+	if len(p) < 16 {
+		return nil, 0
+	}
+
+	size := int(binary.BigEndian.Uint32(p[8:12]))
+	if size < visualEntryHeader || 8+size > len(p) {
+		return nil, 0
+	}
+
+	return p[8 : 8+size], 8
+}
+
+// Child boxes of visual sample entry.
+func entryChildren(entry []byte) ([]Box, error) {
+	return Children(bytes.NewReader(entry), Box{Offset: visualEntryHeader, Size: int64(len(entry) - visualEntryHeader)})
+}
+
+// Spherical metadata of first video track in file at path; absent for files without any.
+func ReadSpherical(path string) (Spherical, error) {
+
+	s := Spherical{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+
+	moov, err := Find(f, "moov")
+	if err != nil {
+		return s, err
+	}
+
+	traks, err := Children(f, moov)
+	if err != nil {
+		return s, err
+	}
+
+	for _, trak := range traks {
+
+		if trak.Type != "trak" {
+			continue
+		}
+
+		if video, err := isVideo(f, trak); err != nil || !video {
+			continue
+		}
+
+		children, err := Children(f, trak)
+		if err != nil {
+			return s, err
+		}
+
+		for _, c := range children {
+			if c.Type == "uuid" {
+				p, err := payload(f, c)
+				if err != nil {
+					return s, err
+				}
+				if bytes.HasPrefix(p, sphericalUUID) {
+					s.UUID = p
+				}
+			}
+		}
+
+		// Walk down to the sample description of this track
+		stsd := trak
+		for _, boxType := range []string{"mdia", "minf", "stbl", "stsd"} {
+			b, ok, err := childBox(f, stsd, boxType)
+			if err != nil || !ok {
+				return s, err
+			}
+			stsd = b
+		}
+
+		p, err := payload(f, stsd)
+		if err != nil {
+			return s, err
+		}
+
+		entry, _ := firstEntry(p)
+		if entry == nil {
+			return s, nil
+		}
+
+		boxes, err := entryChildren(entry)
+		if err != nil {
+			return s, err
+		}
+
+		for _, b := range boxes {
+			switch b.Type {
+			case "sv3d":
+				s.SV3D = entry[b.Offset : b.Offset+b.Size]
+			case "st3d":
+				s.ST3D = entry[b.Offset : b.Offset+b.Size]
+			}
+		}
+
+		return s, nil
+	}
+
+	return s, nil
+}
+
+// Rewriter of moov adding spherical metadata to its first video track.
+type injector struct {
+	f     *os.File
+	s     Spherical
+	shift int64 // Amount to move chunk offsets by, as mdat moves when moov grows in front of it.
+	done  bool  // Whether the video track was already handled.
+}
+
+// Rebuild children of parent, adding whatever metadata the first video track lacks.
+func (in *injector) children(parent Box, video bool) ([]byte, error) {
+
+	boxes, err := Children(in.f, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.Buffer{}
+	hasUUID := false
+
+	for _, b := range boxes {
+
+		p, err := payload(in.f, b)
+		if err != nil {
+			return nil, err
+		}
+
+		switch b.Type {
+
+		case "trak":
+			isVideoTrak, err := isVideo(in.f, b)
+			if err != nil {
+				return nil, err
+			}
+
+			if p, err = in.children(b, isVideoTrak && !in.done); err != nil {
+				return nil, err
+			}
+
+			if isVideoTrak {
+				in.done = true
+			}
+
+		case "mdia", "minf", "stbl":
+			if p, err = in.children(b, video); err != nil {
+				return nil, err
+			}
+
+		case "uuid":
+			hasUUID = hasUUID || bytes.HasPrefix(p, sphericalUUID)
+
+		case "stsd":
+			if video {
+				if p, err = in.sampleDescription(p); err != nil {
+					return nil, err
+				}
+			}
+
+		case "stco":
+			shiftOffsets(p, 4, in.shift)
+
+		case "co64":
+			shiftOffsets(p, 8, in.shift)
+
+		}
+
+		out.Write(box(b.Type, p))
+
+	}
+
+	// V1 metadata sits directly in trak
+	if parent.Type == "trak" && video && !hasUUID && in.s.UUID != nil {
+		out.Write(box("uuid", in.s.UUID))
+	}
+
+	return out.Bytes(), nil
+}
+
+// Sample description payload p, with V2 spherical boxes added to its first entry.
+func (in *injector) sampleDescription(p []byte) ([]byte, error) {
+
+	entry, at := firstEntry(p)
+	if entry == nil {
+		return p, nil
+	}
+
+	boxes, err := entryChildren(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	present := map[string]bool{}
+	for _, b := range boxes {
+		present[b.Type] = true
+	}
+
+	extended := append([]byte{}, entry...)
+	if in.s.ST3D != nil && !present["st3d"] {
+		extended = append(extended, box("st3d", in.s.ST3D)...)
+	}
+	if in.s.SV3D != nil && !present["sv3d"] {
+		extended = append(extended, box("sv3d", in.s.SV3D)...)
+	}
+	binary.BigEndian.PutUint32(extended, uint32(len(extended)))
+
+	out := append([]byte{}, p[:at]...)
+	out = append(out, extended...)
+
+	return append(out, p[at+len(entry):]...), nil
+}
+
+// Move each chunk offset in stco or co64 payload p, of given width, by shift.
+func shiftOffsets(p []byte, width int, shift int64) {
+
+	if shift == 0 || len(p) < 8 {
+		return
+	}
+
+	count := int(binary.BigEndian.Uint32(p[4:8]))
+
+	for i := 0; i < count && 8+(i+1)*width <= len(p); i++ {
+		at := p[8+i*width:]
+		if width == 4 {
+			binary.BigEndian.PutUint32(at, uint32(int64(binary.BigEndian.Uint32(at))+shift))
+		} else {
+			binary.BigEndian.PutUint64(at, uint64(int64(binary.BigEndian.Uint64(at))+shift))
+		}
+	}
+}
+
+// Add spherical metadata s to the first video track of file at path, where missing, by rewriting the file.
+func InjectSpherical(path string, s Spherical) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	top, err := Children(f, Box{Size: info.Size()})
+	if err != nil {
+		return err
+	}
+
+	// Offsets of chunks only move when moov grows in front of mdat
+	moovIndex, mdatIndex := -1, -1
+	for i, b := range top {
+		switch b.Type {
+		case "moov":
+			moovIndex = i
+		case "mdat":
+			if mdatIndex < 0 {
+				mdatIndex = i
+			}
+		}
+	}
+
+	if moovIndex < 0 {
+		return errors.New("box \"moov\" not found")
+	}
+
+	moov := top[moovIndex]
+
+	// First pass sizes the new moov, second pass writes it with offsets moved accordingly
+	in := &injector{f: f, s: s}
+	p, err := in.children(moov, false)
+	if err != nil {
+		return err
+	}
+
+	if mdatIndex > moovIndex {
+		in = &injector{f: f, s: s, shift: int64(len(box("moov", p))) - (moov.Offset + moov.Size - boxStart(top, moovIndex))}
+		if p, err = in.children(moov, false); err != nil {
+			return err
+		}
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".spherical")
+
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	for i, b := range top {
+
+		if i == moovIndex {
+			_, err = out.Write(box("moov", p))
+		} else {
+			start := boxStart(top, i)
+			_, err = io.Copy(out, io.NewSectionReader(f, start, b.Offset+b.Size-start))
+		}
+
+		if err != nil {
+			break
+		}
+
+	}
+
+	if err == nil {
+		err = out.Sync()
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Offset of header of top-level box i; top-level boxes follow one another from the start of the file.
+func boxStart(top []Box, i int) int64 {
+
+	if i == 0 {
+		return 0
+	}
+
+	return top[i-1].Offset + top[i-1].Size
+}
@@ -0,0 +1,125 @@
+package naming
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// Helpers available to naming templates. As in sprig, the piped value comes last,
+// e.g. "{{.Date | date \"20060102\"}}_{{.Note | slugify | truncate 20}}".
+var Funcs = template.FuncMap{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"title":    title,
+	"trim":     strings.TrimSpace,
+	"replace":  replace,
+	"slugify":  slugify,
+	"truncate": truncate,
+	"default":  defaultValue,
+	"pad":      pad,
+	"date":     date,
+	"dateAdd":  dateAdd,
+	"addDays":  addDays,
+}
+
+// Capitalize first letter of each word.
+func title(s string) string {
+
+	prev := ' '
+
+	return strings.Map(func(r rune) rune {
+
+		defer func() { prev = r }()
+
+		if unicode.IsSpace(prev) || prev == '-' || prev == '_' {
+			return unicode.ToUpper(r)
+		}
+
+		return r
+
+	}, s)
+}
+
+// Replace every old in s with new.
+func replace(old string, new string, s string) string {
+	return strings.ReplaceAll(s, old, new)
+}
+
+// Lowercase s and join its runs of letters and digits with dashes, e.g. "Big Wave #3!" becomes "big-wave-3".
+func slugify(s string) string {
+
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	return strings.Join(words, "-")
+}
+
+// First n characters of s.
+func truncate(n int, s string) string {
+
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+
+	return string(runes[:n])
+}
+
+// Value, or fallback if value is empty.
+func defaultValue(fallback interface{}, value interface{}) interface{} {
+
+	switch v := value.(type) {
+	case nil:
+		return fallback
+	case string:
+		if v == "" {
+			return fallback
+		}
+	case int:
+		if v == 0 {
+			return fallback
+		}
+	case bool:
+		if !v {
+			return fallback
+		}
+	}
+
+	return value
+}
+
+// Value padded on the left to width, with zeros for numbers and spaces otherwise.
+func pad(width int, value interface{}) string {
+
+	switch v := value.(type) {
+	case int, int64, uint, uint32, uint64:
+		return fmt.Sprintf("%0*d", width, v)
+	}
+
+	return fmt.Sprintf("%*v", width, value)
+}
+
+// Format time t with Go reference layout, e.g. "2006-01-02".
+func date(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+// Time t moved by a duration such as "-1h30m".
+func dateAdd(duration string, t time.Time) (time.Time, error) {
+
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return t, err
+	}
+
+	return t.Add(d), nil
+}
+
+// Time t moved by n calendar days.
+func addDays(n int, t time.Time) time.Time {
+	return t.AddDate(0, 0, n)
+}
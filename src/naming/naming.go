@@ -0,0 +1,49 @@
+package naming
+
+import (
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Values available to naming templates, e.g. "{{.Date.Format \"2006-01-02\"}} {{.Id}}".
+type Data struct {
+	Date      time.Time // Creation time.
+	Id        string    // Recording ID.
+	Index     int       // Fragment index; 0 for merged videos.
+	Extension string    // File name extension, without the dot.
+	Codec     string    // Video codec as named by ffprobe, e.g. "hevc".
+	Camera    string    // Camera model, e.g. "HERO11"; empty if unknown.
+	Starred   bool      // Whether recording carries HiLight tags or was starred in the catalog.
+	Lapse     bool      // Whether recording is a TimeWarp or Night Lapse.
+	Variant   string    // Picture variant: "hdr", "10bit", or empty for 8-bit SDR.
+	Rating    int       // Catalog rating, 0 if unrated.
+	Note      string    // Catalog note.
+}
+
+// Naming template for renamed or merged videos.
+type Template struct {
+	t *template.Template
+}
+
+// Parse template text using Go's text/template syntax, with [Funcs] available.
+func Parse(text string) (*Template, error) {
+
+	t, err := template.New("name").Option("missingkey=error").Funcs(Funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{t: t}, nil
+}
+
+// Render file name from data.
+func (t *Template) Execute(d Data) (string, error) {
+
+	b := strings.Builder{}
+	if err := t.t.Execute(&b, d); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
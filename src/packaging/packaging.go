@@ -0,0 +1,113 @@
+package packaging
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rendition of a multi-bitrate ladder.
+type Rung struct {
+	Height  int    // Picture height in pixels; width follows aspect ratio.
+	Bitrate string // Video bitrate as understood by ffmpeg, e.g. "6M".
+}
+
+// Bitrates of common ladder heights.
+var bitrates = map[int]string{2160: "16M", 1440: "10M", 1080: "6M", 720: "3M", 480: "1500k", 360: "800k"}
+
+// Parse ladder such as "1080p,720p,480p" into rungs.
+func ParseLadder(s string) ([]Rung, error) {
+
+	rungs := []Rung{}
+
+	for _, part := range strings.Split(s, ",") {
+
+		height, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(part), "p"))
+		if err != nil || bitrates[height] == "" {
+			return nil, fmt.Errorf("unknown ladder rung \"%s\"", part)
+		}
+
+		rungs = append(rungs, Rung{Height: height, Bitrate: bitrates[height]})
+
+	}
+
+	return rungs, nil
+}
+
+// How to package a recording.
+type Options struct {
+	Format  string        // "hls" or "dash".
+	Segment time.Duration // Target segment length.
+	Ladder  []Rung        // Renditions to encode; none copies the original stream as the only rendition.
+	Silent  bool          // Whether input holds no sound, so renditions are video only.
+}
+
+// Arguments of ffmpeg packaging input into dir, led by master.m3u8 for HLS or manifest.mpd for DASH; an earlier package in dir is overwritten.
+func Args(input string, dir string, opts Options) []string {
+
+	args := []string{"ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-i", input}
+
+	// Original streams copied as is, or one encoded rendition per rung
+	renditions := len(opts.Ladder)
+	if renditions == 0 {
+		renditions = 1
+		args = append(args, "-map", "0:v:0", "-map", "0:a:0?", "-codec", "copy")
+	} else {
+		for i, rung := range opts.Ladder {
+			args = append(args,
+				"-map", "0:v:0", "-map", "0:a:0?",
+				fmt.Sprintf("-filter:v:%d", i), fmt.Sprintf("scale=-2:%d", rung.Height),
+				fmt.Sprintf("-c:v:%d", i), "libx264",
+				fmt.Sprintf("-b:v:%d", i), rung.Bitrate,
+				fmt.Sprintf("-maxrate:v:%d", i), rung.Bitrate,
+				fmt.Sprintf("-bufsize:v:%d", i), rung.Bitrate,
+			)
+		}
+
+		// Keyframes on segment boundaries so every rendition can switch there
+		args = append(args,
+			"-c:a", "aac", "-b:a", "128k",
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%g)", opts.Segment.Seconds()),
+		)
+	}
+
+	seconds := strconv.FormatFloat(opts.Segment.Seconds(), 'f', -1, 64)
+
+	if opts.Format == "dash" {
+
+		sets := "id=0,streams=v id=1,streams=a"
+		if opts.Silent {
+			sets = "id=0,streams=v"
+		}
+
+		return append(args,
+			"-f", "dash",
+			"-seg_duration", seconds,
+			"-use_template", "1",
+			"-use_timeline", "1",
+			"-adaptation_sets", sets,
+			filepath.Join(dir, "manifest.mpd"),
+		)
+	}
+
+	streams := []string{}
+	for i := 0; i < renditions; i++ {
+		if opts.Silent {
+			streams = append(streams, fmt.Sprintf("v:%d", i))
+		} else {
+			streams = append(streams, fmt.Sprintf("v:%d,a:%d", i, i))
+		}
+	}
+
+	return append(args,
+		"-f", "hls",
+		"-hls_time", seconds,
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, "stream_%v_%05d.ts"),
+		"-master_pl_name", "master.m3u8",
+		"-var_stream_map", strings.Join(streams, " "),
+		filepath.Join(dir, "stream_%v.m3u8"),
+	)
+}
@@ -0,0 +1,141 @@
+package photoprism
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Client of a self-hosted PhotoPrism server.
+type Client struct {
+	URL     string // Base URL of server, e.g. "https://photos.example.com".
+	Token   string // App password or access token.
+	UserUID string // UID of user owning the uploads.
+	http    *http.Client
+}
+
+// Details of an uploaded video.
+type Asset struct {
+	CreatedAt time.Time
+	Latitude  *float64 // Nil when position is unknown.
+	Longitude *float64
+}
+
+// Create client for server at url authenticating as userUID with token.
+func New(url string, token string, userUID string) *Client {
+	return &Client{URL: strings.TrimSuffix(url, "/"), Token: token, UserUID: userUID, http: &http.Client{}}
+}
+
+// Send request with auth token.
+func (c *Client) do(req *http.Request) error {
+
+	req.Header.Set("X-Auth-Token", c.Token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// Exiftool-style JSON sidecar carrying creation time and position, which PhotoPrism prefers over the file's own metadata.
+func sidecar(name string, a Asset) ([]byte, error) {
+
+	meta := map[string]any{
+		"SourceFile": name,
+		"CreateDate": a.CreatedAt.UTC().Format("2006:01:02 15:04:05"),
+	}
+
+	if a.Latitude != nil && a.Longitude != nil {
+		meta["GPSLatitude"] = *a.Latitude
+		meta["GPSLongitude"] = *a.Longitude
+	}
+
+	return json.Marshal([]any{meta})
+}
+
+// Upload file at path along with a metadata sidecar, then have PhotoPrism import it.
+func (c *Client) Upload(path string, a Asset) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	name := filepath.Base(path)
+
+	meta, err := sidecar(name, a)
+	if err != nil {
+		return err
+	}
+
+	// Upload into a fresh batch so only these files are imported
+	batch := fmt.Sprintf("stopcon%d", time.Now().UnixNano())
+	endpoint := fmt.Sprintf("%s/api/v1/users/%s/upload/%s", c.URL, c.UserUID, batch)
+
+	// Stream multipart body instead of buffering whole video in memory
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+
+		part, err := mw.CreateFormFile("files", name)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		if _, err := io.Copy(part, f); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		part, err = mw.CreateFormFile("files", strings.TrimSuffix(name, filepath.Ext(name))+".json")
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		if _, err := part.Write(meta); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		pw.CloseWithError(mw.Close())
+
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, pr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	if err := c.do(req); err != nil {
+		return err
+	}
+
+	// Trigger import of uploaded batch
+	req, err = http.NewRequest(http.MethodPut, endpoint, bytes.NewReader([]byte(`{"albums":[]}`)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(req)
+}
@@ -0,0 +1,100 @@
+package photos
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/utils"
+)
+
+// Apple Photos library of the logged-in macOS user, driven through AppleScript.
+type Library struct {
+	Album   string                                      // Album to add imports to, created if missing; empty for none.
+	Command func(args []string, stdin string) *exec.Cmd // Builds the osascript process; defaults to [exec.Command] fed stdin.
+}
+
+// Details of an imported video, which Photos would otherwise take from the file or the import time.
+type Asset struct {
+	CreatedAt time.Time
+	Latitude  *float64 // Nil when position is unknown.
+	Longitude *float64
+}
+
+// Quote s as an AppleScript string literal.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// AppleScript importing file at path, setting its date and location, and returning its ID.
+func (l *Library) script(path string, a Asset) string {
+
+	b := strings.Builder{}
+
+	b.WriteString("tell application \"Photos\"\n")
+	fmt.Fprintf(&b, "\tset imported to import {POSIX file %s} skip check duplicates true\n", quote(path))
+	b.WriteString("\tif (count of imported) is 0 then error \"Photos imported nothing\"\n")
+	b.WriteString("\tset v to item 1 of imported\n")
+
+	// Dates are built field by field, as parsing a date string depends on the user's locale; the day goes first so no month overflows
+	if !a.CreatedAt.IsZero() {
+		t := a.CreatedAt.Local()
+		b.WriteString("\tset d to current date\n")
+		b.WriteString("\tset day of d to 1\n")
+		fmt.Fprintf(&b, "\tset year of d to %d\n", t.Year())
+		fmt.Fprintf(&b, "\tset month of d to %d\n", int(t.Month()))
+		fmt.Fprintf(&b, "\tset day of d to %d\n", t.Day())
+		fmt.Fprintf(&b, "\tset time of d to %d\n", t.Hour()*3600+t.Minute()*60+t.Second())
+		b.WriteString("\tset date of v to d\n")
+	}
+
+	if a.Latitude != nil && a.Longitude != nil {
+		fmt.Fprintf(&b, "\tset location of v to {%f, %f}\n", *a.Latitude, *a.Longitude)
+	}
+
+	if l.Album != "" {
+		fmt.Fprintf(&b, "\tif not (exists album %s) then make new album named %s\n", quote(l.Album), quote(l.Album))
+		fmt.Fprintf(&b, "\tadd {v} to album %s\n", quote(l.Album))
+	}
+
+	b.WriteString("\treturn id of v\n")
+	b.WriteString("end tell\n")
+
+	return b.String()
+}
+
+// Import file at path into Photos, returning the ID Photos gave it.
+func (l *Library) Import(path string, a Asset) (string, error) {
+
+	if runtime.GOOS != "darwin" {
+		return "", errors.New("Apple Photos is only available on macOS")
+	}
+
+	// Photos resolves POSIX files itself, relative to nothing in particular
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"osascript", "-"}
+	script := l.script(abs, a)
+
+	var cmd *exec.Cmd
+	if l.Command != nil {
+		cmd = l.Command(args, script)
+	} else {
+		cmd = exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(script)
+	}
+
+	out, err := utils.Output(cmd, filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
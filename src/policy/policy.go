@@ -0,0 +1,68 @@
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// What discovery does with a file.
+type Action string
+
+const (
+	Process  Action = "process"  // Parse as a recording fragment.
+	Keep     Action = "keep"     // Leave in place, untouched.
+	Delete   Action = "delete"   // Remove from input directory.
+	Organize Action = "organize" // Move into a subdirectory named after its extension.
+	Attach   Action = "attach"   // Keep alongside the recording it belongs to, e.g. external audio.
+)
+
+var actions = map[Action]bool{Process: true, Keep: true, Delete: true, Organize: true, Attach: true}
+
+// Policy engine mapping file extensions to [Action]s; unlisted extensions are processed.
+type Engine struct {
+	byExtension map[string]Action
+}
+
+// Create engine from extensions and action names, e.g. {"LRV": "delete", "THM": "keep"}.
+func New(policies map[string]string) (*Engine, error) {
+
+	e := &Engine{byExtension: map[string]Action{}}
+
+	for ext, name := range policies {
+
+		action := Action(strings.ToLower(name))
+		if !actions[action] {
+			return nil, fmt.Errorf("unknown action \"%s\" for extension \"%s\"", name, ext)
+		}
+
+		// Extensions differing only in case or a leading dot are the same extension
+		if other, ok := e.byExtension[normalize(ext)]; ok && other != action {
+			return nil, fmt.Errorf("conflicting actions \"%s\" and \"%s\" for extension \"%s\"", other, action, normalize(ext))
+		}
+
+		e.byExtension[normalize(ext)] = action
+
+	}
+
+	return e, nil
+}
+
+// Extension without leading dot, uppercased as GoPro writes it.
+func normalize(ext string) string {
+	return strings.ToUpper(strings.TrimPrefix(ext, "."))
+}
+
+// Action for file with given name.
+func (e *Engine) For(name string) Action {
+
+	if e == nil {
+		return Process
+	}
+
+	if action, ok := e.byExtension[normalize(filepath.Ext(name))]; ok {
+		return action
+	}
+
+	return Process
+}
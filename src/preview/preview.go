@@ -0,0 +1,187 @@
+package preview
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Peaks of an audio track in the JSON format of audiowaveform, as read by peaks.js and similar players.
+type Waveform struct {
+	Version         int    `json:"version"`
+	Channels        int    `json:"channels"`
+	SampleRate      int    `json:"sample_rate"`
+	SamplesPerPixel int    `json:"samples_per_pixel"`
+	Bits            int    `json:"bits"`
+	Length          int    `json:"length"`
+	Data            []int8 `json:"data"` // Minimum and maximum of each pixel, interleaved.
+}
+
+// Waveform of mono signed 16-bit little-endian PCM read from r, one min/max pair per samplesPerPixel samples.
+func ReadWaveform(r io.Reader, sampleRate int, samplesPerPixel int) (Waveform, error) {
+
+	w := Waveform{Version: 2, Channels: 1, SampleRate: sampleRate, SamplesPerPixel: samplesPerPixel, Bits: 8, Data: []int8{}}
+
+	if samplesPerPixel <= 0 {
+		return w, errors.New("samples per pixel must be positive")
+	}
+
+	br := bufio.NewReader(r)
+	sample := make([]byte, 2)
+
+	low, high := int16(0), int16(0)
+	count := 0
+
+	// Close off current pixel, scaled down to 8 bits
+	flush := func() {
+		w.Data = append(w.Data, int8(low>>8), int8(high>>8))
+		w.Length++
+		low, high, count = 0, 0, 0
+	}
+
+	for {
+
+		if _, err := io.ReadFull(br, sample); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return w, err
+		}
+
+		s := int16(binary.LittleEndian.Uint16(sample))
+
+		if count == 0 || s < low {
+			low = s
+		}
+
+		if count == 0 || s > high {
+			high = s
+		}
+
+		count++
+		if count == samplesPerPixel {
+			flush()
+		}
+
+	}
+
+	if count > 0 {
+		flush()
+	}
+
+	return w, nil
+}
+
+// Layout of thumbnails taken every Interval, tiled Columns by Rows into sprite sheets.
+type Sprites struct {
+	Interval time.Duration
+	Width    int
+	Height   int
+	Columns  int
+	Rows     int
+	ToneMap  bool // Whether to tone-map HDR video to SDR first.
+}
+
+// Filter chain mapping HLG or PQ video down to SDR BT.709, so stills of HDR footage are not washed out and grey.
+// Highlights are compressed with the Hable curve instead of being clipped.
+const ToneMap = "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709,tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
+
+// Filters prefixed by the tone-mapping chain if toneMap is set.
+func WithToneMap(filters string, toneMap bool) string {
+
+	if !toneMap {
+		return filters
+	}
+
+	return ToneMap + "," + filters
+}
+
+// Format duration as a WebVTT timestamp.
+func timestamp(d time.Duration) string {
+
+	ms := d.Milliseconds()
+
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// WebVTT cues pointing each stretch of a video lasting duration at its thumbnail, in sheets named by sheet (counting from 1).
+func (s Sprites) VTT(duration time.Duration, sheet func(n int) string) string {
+
+	vtt := strings.Builder{}
+	vtt.WriteString("WEBVTT\n")
+
+	perSheet := s.Columns * s.Rows
+
+	for i := 0; time.Duration(i)*s.Interval < duration; i++ {
+
+		start := time.Duration(i) * s.Interval
+
+		end := start + s.Interval
+		if end > duration {
+			end = duration
+		}
+
+		tile := i % perSheet
+		x, y := tile%s.Columns*s.Width, tile/s.Columns*s.Height
+
+		fmt.Fprintf(&vtt, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n", timestamp(start), timestamp(end), sheet(i/perSheet+1), x, y, s.Width, s.Height)
+
+	}
+
+	return vtt.String()
+}
+
+// Filter graph for ffmpeg taking thumbnails and tiling them into sheets.
+func (s Sprites) Filter() string {
+	return WithToneMap(fmt.Sprintf("fps=1/%g,scale=%d:%d,tile=%dx%d", s.Interval.Seconds(), s.Width, s.Height, s.Columns, s.Rows), s.ToneMap)
+}
+
+// How well an 8-bit grayscale frame of width by height pixels would do as a poster; higher is better.
+// Sharpness is the mean gradient between neighbouring pixels, which blur and motion smear lower; it is weighed down the further mean brightness strays from mid-grey, so frames that are black, blown out or flat lose.
+func PosterScore(gray []byte, width int, height int) float64 {
+
+	if width < 2 || height < 2 || len(gray) < width*height {
+		return 0
+	}
+
+	sum, gradient := 0, 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+
+			p := int(gray[y*width+x])
+			sum += p
+
+			if x+1 < width {
+				gradient += abs(p - int(gray[y*width+x+1]))
+			}
+
+			if y+1 < height {
+				gradient += abs(p - int(gray[(y+1)*width+x]))
+			}
+
+		}
+	}
+
+	pixels := float64(width * height)
+	mean := float64(sum) / pixels / 255
+	sharpness := float64(gradient) / pixels
+
+	exposure := 1 - 2*math.Abs(mean-0.45)
+	if exposure < 0 {
+		exposure = 0
+	}
+
+	return sharpness * exposure
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,29 @@
+// Package rename names fragments, by layout, template or the camera's own names, and renames them.
+package rename
+
+import (
+	"strings"
+
+	"github.com/thatpix3l/stopcon/src/format"
+	"github.com/thatpix3l/stopcon/src/scan"
+)
+
+// Letter after "G" in stock names, by probed codec.
+var codecLetters = map[string]string{"hevc": "X", "h264": "H"}
+
+// Stock GoPro name of f, e.g. "GX010123.MP4", with the codec letter reconstructed from its codec; not ok for codecs without one.
+func StockName(f scan.Fragment) (string, bool) {
+
+	letter, ok := codecLetters[f.Codec]
+
+	// 360 footage keeps its own extension and letter, whatever the codec
+	if strings.EqualFold(f.Extension, "360") {
+		letter, ok = "S", true
+	}
+
+	if !ok {
+		return "", false
+	}
+
+	return format.Raw.Format(map[string]any{"codec": letter, "index": f.Index, "id": f.Id, "extension": f.Extension}), true
+}
@@ -0,0 +1,164 @@
+package rename
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/cache"
+	"github.com/thatpix3l/stopcon/src/catalog"
+	"github.com/thatpix3l/stopcon/src/format"
+	"github.com/thatpix3l/stopcon/src/journal"
+	"github.com/thatpix3l/stopcon/src/naming"
+	"github.com/thatpix3l/stopcon/src/scan"
+	"github.com/thatpix3l/stopcon/src/utils"
+)
+
+// Error of fragments to get their stock name back whose codec has no letter in stock names, as when not probed by ffprobe.
+var ErrNoCodecLetter = errors.New("codec has no letter in stock names")
+
+// What a [Renamer] goes by.
+type Options struct {
+	Template *naming.Template // Names fragments by a template instead of [format.Renamed]; nil for the default layout.
+	Raw      bool             // Whether fragments get their stock names back, e.g. "GX010123.MP4", instead.
+	Catalog  *catalog.Catalog // Ratings, notes and stars of recordings, available to templates; nil if none.
+	Copy     bool             // Whether files are copied to their new names, leaving originals untouched.
+	SMB      bool             // Whether files are on an SMB share, where renames are flaky and some characters rejected; files are copied and deleted instead.
+	Retries  int              // Attempts per file over SMB.
+	Timeout  time.Duration    // Time limit per attempt over SMB.
+	WSL      bool             // Whether running under WSL, where names on Windows drives have the same characters rejected.
+	Cache    *cache.Cache     // Probe cache, whose entries follow the files renamed; nil if none.
+
+	// Records each change made, kind being [journal.Rename] or [journal.Copy]; nil to record none.
+	Journal func(kind string, from string, to string)
+}
+
+// Names fragments and renames them, going by its [Options] alone.
+type Renamer struct {
+	opts Options
+}
+
+// Renamer going by opts.
+func New(opts Options) *Renamer {
+	return &Renamer{opts: opts}
+}
+
+// Values of naming templates for recording id of metadata m, along with what the catalog holds on it.
+func (r *Renamer) Data(id string, m scan.Metadata) naming.Data {
+
+	d := naming.Data{Id: id, Codec: m.Codec, Camera: m.Camera, Starred: m.Starred, Lapse: m.Lapse, Variant: m.Variant}
+
+	if m.CreationTime != nil {
+		d.Date = *m.CreationTime
+	}
+
+	if r.opts.Catalog == nil {
+		return d
+	}
+
+	if c := r.opts.Catalog.Lookup(catalog.Key(id, m.CreationTime)); c != nil {
+		d.Starred = d.Starred || c.Starred
+		d.Rating = c.Rating
+		d.Note = c.Note
+	}
+
+	return d
+}
+
+// New name of fragment f, which is at f.Path, made safe for its directory.
+func (r *Renamer) Name(f scan.Fragment) (string, error) {
+
+	current := filepath.Base(f.Path)
+
+	name := format.Renamed.Format(map[string]any{"date": f.CreationTimeString(), "id": f.Id, "extension": f.Extension, "codec": f.Codec, "camera": f.Camera, "index": f.Index})
+
+	if r.opts.Template != nil {
+
+		d := r.Data(f.Id, f.Metadata)
+		d.Index = f.Index
+		d.Extension = f.Extension
+
+		var err error
+		if name, err = r.opts.Template.Execute(d); err != nil {
+			return "", err
+		}
+
+	}
+
+	// A merged name without ID has no ID to carry over, so it stays as it is
+	if values := format.ParseMerged(current); values != nil && values["id"] == "" {
+		name = current
+	}
+
+	// Stock names go by chapter, which merged videos have none of, so they stay as they are
+	if r.opts.Raw {
+
+		name = current
+
+		if f.Index > 0 {
+			stock, ok := StockName(f)
+			if !ok {
+				return "", ErrNoCodecLetter
+			}
+			name = stock
+		}
+
+	}
+
+	return r.SafeName(name, filepath.Dir(f.Path)), nil
+}
+
+// Name made safe for directory dir: SMB servers, and Windows drives under WSL, reject some characters outright.
+func (r *Renamer) SafeName(name string, dir string) string {
+
+	if r.opts.SMB || r.opts.WSL && utils.OnWindowsDrive(dir) {
+		return utils.SanitizeSMB(name)
+	}
+
+	return name
+}
+
+// Rename file old into new, or copy it there.
+func (r *Renamer) Rename(ctx context.Context, old string, new string) error {
+
+	// Original stays where it is in copy mode
+	if r.opts.Copy {
+		if err := utils.CopyFile(ctx, old, new); err != nil {
+			return err
+		}
+		r.record(journal.Copy, old, new)
+		return nil
+	}
+
+	// Renames over SMB are flaky; copy and delete instead.
+	if r.opts.SMB {
+		if err := utils.MoveFile(old, new, r.opts.Retries, r.opts.Timeout); err != nil {
+			return err
+		}
+		r.record(journal.Rename, old, new)
+		return nil
+	}
+
+	if err := os.Rename(old, new); err != nil {
+		return err
+	}
+
+	r.record(journal.Rename, old, new)
+
+	// Renaming keeps size and modification time, so the file is still the one probed
+	if r.opts.Cache != nil {
+		r.opts.Cache.Move(old, new)
+	}
+
+	return nil
+}
+
+// Record change in the journal, if kept.
+func (r *Renamer) record(kind string, from string, to string) {
+
+	if r.opts.Journal != nil {
+		r.opts.Journal(kind, from, to)
+	}
+}
@@ -0,0 +1,60 @@
+package rename
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/naming"
+	"github.com/thatpix3l/stopcon/src/scan"
+)
+
+// Fragments are named by layout, template or their stock names, merged names without ID staying as they are.
+func TestName(t *testing.T) {
+
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	template, err := naming.Parse("{{.Id}}-{{.Index}}.{{.Extension}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timed, err := naming.Parse("{{.Date.Format \"15:04\"}} {{.Id}}.{{.Extension}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fragment := func(name string, index int, codec string) scan.Fragment {
+		return scan.Fragment{Id: "0042", Index: index, Extension: "MP4", Path: "/videos/" + name, Metadata: scan.Metadata{Codec: codec, CreationTime: &created}}
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		fragment scan.Fragment
+		want     string
+		err      error
+	}{
+		{name: "layout", fragment: fragment("GX010042.MP4", 1, "hevc"), want: "Recording _-_ Date 2024-05-01 10_00_00 _-_ ID 0042 _-_ Part 01.MP4"},
+		{name: "template", opts: Options{Template: template}, fragment: fragment("GX010042.MP4", 1, "hevc"), want: "0042-1.MP4"},
+		{name: "raw", opts: Options{Raw: true}, fragment: fragment("Recording _-_ Date 2024-05-01 10_00_00 _-_ ID 0042 _-_ Part 01.MP4", 1, "h264"), want: "GH010042.MP4"},
+		{name: "raw merged", opts: Options{Raw: true}, fragment: fragment("Recording _-_ Date 2024-05-01 10_00_00 _-_ ID 0042.MP4", 0, "hevc"), want: "Recording _-_ Date 2024-05-01 10_00_00 _-_ ID 0042.MP4"},
+		{name: "raw unknown codec", opts: Options{Raw: true}, fragment: fragment("GX010042.MP4", 1, ""), err: ErrNoCodecLetter},
+		{name: "not on smb", opts: Options{Template: timed}, fragment: fragment("GX010042.MP4", 1, "hevc"), want: "10:00 0042.MP4"},
+		{name: "smb", opts: Options{SMB: true, Template: timed}, fragment: fragment("GX010042.MP4", 1, "hevc"), want: "10_00 0042.MP4"},
+	}
+
+	for _, test := range tests {
+
+		got, err := New(test.opts).Name(test.fragment)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: named %q, want %q", test.name, got, test.want)
+		}
+	}
+
+}
@@ -0,0 +1,120 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/failure"
+)
+
+// Receives what a run finds and does, so front ends can show it their own way; methods may be called from several goroutines at once.
+type Reporter interface {
+	Discovered(r Recording)                             // Recording found in the input directories.
+	Planned(stage string, steps []Step)                 // Recordings a stage is about to act on, before any work starts.
+	Progress(id string, stage string, fraction float64) // Share of stage done for recording; first called with 0 as the stage starts on it.
+	Completed(id string, stage string, err error)       // Stage finished for recording; err is nil on success. Stage "run" without ID ends the run.
+}
+
+// Recording as discovered.
+type Recording struct {
+	Id        string    `json:"id"`
+	Fragments int       `json:"fragments"`
+	Duration  float64   `json:"duration,omitempty"` // In seconds; 0 when not probed.
+	Created   time.Time `json:"created"`
+}
+
+// Work planned for a recording.
+type Step struct {
+	Id     string `json:"id"`
+	Output string `json:"output,omitempty"` // Path written to; empty if none.
+}
+
+// Reporter ignoring every event.
+type Nop struct{}
+
+func (Nop) Discovered(Recording)             {}
+func (Nop) Planned(string, []Step)           {}
+func (Nop) Progress(string, string, float64) {}
+func (Nop) Completed(string, string, error)  {}
+
+// Reporter passing every event on to each of its reporters, in order.
+type Multi []Reporter
+
+func (m Multi) Discovered(r Recording) {
+	for _, rep := range m {
+		rep.Discovered(r)
+	}
+}
+
+func (m Multi) Planned(stage string, steps []Step) {
+	for _, rep := range m {
+		rep.Planned(stage, steps)
+	}
+}
+
+func (m Multi) Progress(id string, stage string, fraction float64) {
+	for _, rep := range m {
+		rep.Progress(id, stage, fraction)
+	}
+}
+
+func (m Multi) Completed(id string, stage string, err error) {
+	for _, rep := range m {
+		rep.Completed(id, stage, err)
+	}
+}
+
+// Event as written by [JSON].
+type Event struct {
+	Event     string     `json:"event"` // One of discovered, planned, progress or completed.
+	At        time.Time  `json:"at"`
+	Id        string     `json:"id,omitempty"`
+	Stage     string     `json:"stage,omitempty"`
+	Recording *Recording `json:"recording,omitempty"`
+	Steps     []Step     `json:"steps,omitempty"`
+	Fraction  *float64   `json:"fraction,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Class     string     `json:"class,omitempty"` // Class of error, see package [failure].
+}
+
+// Reporter writing each event as one JSON object per line, for scripts and other programs to follow.
+type JSON struct {
+	W     io.Writer
+	mutex sync.Mutex
+}
+
+func (j *JSON) write(e Event) {
+
+	e.At = time.Now().UTC()
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	// Events are best effort; a reader gone away must not fail the run
+	_ = json.NewEncoder(j.W).Encode(e)
+}
+
+func (j *JSON) Discovered(r Recording) {
+	j.write(Event{Event: "discovered", Id: r.Id, Recording: &r})
+}
+
+func (j *JSON) Planned(stage string, steps []Step) {
+	j.write(Event{Event: "planned", Stage: stage, Steps: steps})
+}
+
+func (j *JSON) Progress(id string, stage string, fraction float64) {
+	j.write(Event{Event: "progress", Id: id, Stage: stage, Fraction: &fraction})
+}
+
+func (j *JSON) Completed(id string, stage string, err error) {
+
+	e := Event{Event: "completed", Id: id, Stage: stage}
+	if err != nil {
+		e.Error = err.Error()
+		e.Class = failure.ClassOf(err).String()
+	}
+
+	j.write(e)
+}
@@ -0,0 +1,285 @@
+// Package scan parses the names of GoPro fragments, reads recording metadata out of their probes and groups them into recordings; a [Scanner] holds all it goes by.
+package scan
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/ff"
+	"github.com/thatpix3l/stopcon/src/format"
+	"github.com/thatpix3l/stopcon/src/mp4"
+)
+
+// Sources of creation times.
+const (
+	SourceContainer = "container" // Container's creation_time tag.
+	SourceStream    = "stream"    // Video stream's creation_time tag.
+	SourceGPS       = "gps"       // First GPS time in the telemetry, taken once the camera had a lock.
+	SourceMtime     = "mtime"     // File's modification time.
+	SourceFilename  = "filename"  // Date of an already renamed or merged name.
+	SourceAssumed   = "assumed"   // Date assumed when no source has one, see [Options.AssumedDate].
+)
+
+// Error of names that are not GoPro's, nor renamed or merged by stopcon.
+var ErrNotGoPro = errors.New("name not parseable")
+
+// Metadata of a fragment, or of a recording made of fragments.
+type Metadata struct {
+	Codec        string // ffprobe codec name, e.g. "hevc".
+	CreationTime *time.Time
+	Duration     time.Duration
+	Starred      bool   // Whether HiLight tags were marked on the camera or in the GoPro app.
+	Lapse        bool   // Whether recorded as TimeWarp or Night Lapse, rather than in real time.
+	Variant      string // Picture variant: "hdr", "10bit", or empty for 8-bit SDR.
+	Camera       string // Camera model, e.g. "HERO11", going by firmware; empty if unknown.
+	TimeSource   string // Source CreationTime was taken from, e.g. "container"; empty if parsed from name alone.
+	Width        int    // Picture size; 0 if not probed.
+	Height       int
+	FrameRate    string // Frame rate as a fraction, e.g. "60000/1001"; empty if not probed.
+}
+
+// Creation time as names hold it, e.g. "2024-05-01 10_00_00"; empty if unknown.
+func (m Metadata) CreationTimeString() string {
+	if m.CreationTime == nil {
+		return ""
+	}
+
+	return m.CreationTime.Format("2006-01-02 15_04_05")
+}
+
+// Part of a recording, as told by its name, and by its file once read by a [Scanner].
+type Fragment struct {
+	Id        string // Recording ID, e.g. "0042".
+	Index     int    // Chapter, counting from 1; 0 for merged videos.
+	Extension string // File name extension, e.g. "MP4".
+	Path      string // File read; empty for names parsed alone.
+	Metadata         // Not in names, so empty for names parsed alone.
+}
+
+// Fragments recorded in one go, see [Join].
+type Recording struct {
+	Id        string
+	Metadata             // Of its first fragment, but created when its earliest fragment was, and starred or lapsed if any fragment is.
+	Fragments []Fragment // Created when the recording was, rather than when each chapter started.
+	Expected  int        // Fragments expected going by the highest chapter found.
+}
+
+// Chapters of [Recording] missing below the highest one expected.
+func (r Recording) Missing() []int {
+
+	found := map[int]bool{}
+	for _, f := range r.Fragments {
+		found[f.Index] = true
+	}
+
+	missing := []int{}
+	for i := 1; i <= r.Expected; i++ {
+		if !found[i] {
+			missing = append(missing, i)
+		}
+	}
+
+	return missing
+}
+
+// Arguments of ffprobe showing container and first video stream of input, as fragments are read.
+func ProbeArgs(input string) []string {
+	return []string{
+		"ffprobe", input,
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		"-select_streams", "v:0",
+		"-hide_banner",
+		"-loglevel", "fatal",
+	}
+}
+
+// Whether file at path is read without ffprobe by reader "auto"; only MP4 files are.
+func ReadsNatively(reader string, path string) bool {
+	return reader == "auto" && strings.EqualFold(filepath.Ext(path), ".mp4")
+}
+
+// Whether a fragment created at next starts too long after one ending at prevEnd to belong to the same recording.
+// Without either time, or without gap, only the ID tells recordings apart.
+func RolledOver(prevEnd time.Time, next time.Time, gap time.Duration) bool {
+
+	if prevEnd.IsZero() || next.IsZero() || gap <= 0 {
+		return false
+	}
+
+	return next.Sub(prevEnd) > gap
+}
+
+// Fragment named name, with its ID, chapter and extension, going by GoPro's names or those stopcon renames and merges into.
+// Merged names without ID stand in for one by their date.
+func ParseName(name string) (Fragment, error) {
+
+	if values := format.ParseRenamed(name); values != nil {
+
+		index, err := strconv.Atoi(values["index"])
+		if err != nil {
+			return Fragment{}, err
+		}
+
+		return Fragment{Id: values["id"], Index: index, Extension: values["extension"]}, nil
+	}
+
+	if matches := format.Raw.Regex.FindStringSubmatch(name); len(matches) >= len(format.Raw.Tokens.Slice) {
+
+		index, err := strconv.Atoi(matches[2])
+		if err != nil {
+			return Fragment{}, errors.New("cannot parse index as an integer")
+		}
+
+		return Fragment{Id: matches[3], Index: index, Extension: matches[4]}, nil
+	}
+
+	if values := format.ParseMerged(name); values != nil {
+
+		f := Fragment{Id: values["id"], Extension: values["extension"]}
+
+		// Recordings alone on their day may be named without ID; their date tells them apart just as well
+		if f.Id == "" {
+			f.Id = strings.NewReplacer("-", "", "_", "", " ", "").Replace(values["date"])
+		}
+
+		return f, nil
+	}
+
+	return Fragment{}, ErrNotGoPro
+}
+
+// Creation time carried by renamed or merged name, as wall-clock time in loc, or UTC if nil; none for raw names.
+func NameDate(name string, loc *time.Location) (time.Time, bool) {
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	for _, values := range []map[string]string{format.ParseRenamed(name), format.ParseMerged(name)} {
+
+		if values == nil {
+			continue
+		}
+
+		date, err := time.ParseInLocation("2006-01-02 15_04_05", values["date"], loc)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		return date, true
+	}
+
+	return time.Time{}, false
+}
+
+// Parse creation_time tag as written by cameras and ffmpeg, e.g. "2024-05-01T10:00:00.000000Z".
+func CreationTime(tag any) (time.Time, bool) {
+
+	s, ok := tag.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse("2006-01-02T15:04:05.9Z", s)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// Whether file at path holds sound, going by its MP4 tracks, as probes only show its first video stream.
+// Files whose tracks cannot be read are taken to, so only explicit handler names make lapses of them.
+func HasAudio(path string) bool {
+
+	audio, err := mp4.HasAudio(path)
+
+	return err != nil || audio
+}
+
+// Whether probed video is a TimeWarp or Night Lapse, going by its handler names and whether the file holds sound, see [HasAudio]; GoPro only records sound in real time.
+func Lapse(data ff.ProbeData, audio bool) bool {
+
+	gopro := false
+
+	for _, s := range data.Streams {
+
+		handler, _ := s.Tags["handler_name"].(string)
+		handler = strings.ToLower(handler)
+
+		if strings.Contains(handler, "lapse") || strings.Contains(handler, "warp") {
+			return true
+		}
+
+		gopro = gopro || strings.Contains(handler, "gopro")
+
+	}
+
+	return gopro && !audio
+}
+
+// Picture variant of probed video: "hdr" for HLG or PQ transfer, "10bit" for other 10-bit video such as 10-bit SDR or GP-Log, or "" for 8-bit SDR.
+func Variant(data ff.ProbeData) string {
+
+	for _, s := range data.Streams {
+
+		if s.CodecType != "video" || s.StreamVideo == nil {
+			continue
+		}
+
+		switch s.ColorTransfer {
+		case "arib-std-b67", "smpte2084":
+			return "hdr"
+		}
+
+		if strings.Contains(s.PixFmt, "10") || strings.Contains(s.Profile, "10") {
+			return "10bit"
+		}
+
+		return ""
+	}
+
+	return ""
+}
+
+// Camera models by firmware prefix, as GoPro writes it into the "firmware" tag, e.g. "H22.01.01.10.00".
+var firmwareCameras = map[string]string{
+	"HD5": "HERO5",
+	"HD6": "HERO6",
+	"HD7": "HERO7",
+	"HD8": "HERO8",
+	"HD9": "HERO9",
+	"H21": "HERO10",
+	"H22": "HERO11",
+	"H23": "HERO12",
+	"H24": "HERO13",
+}
+
+// Camera model of probed video, or its firmware prefix if the model is unknown; empty without firmware tag.
+func Camera(data ff.ProbeData) string {
+
+	firmware, _ := data.Format.Tags["firmware"].(string)
+
+	prefix := strings.SplitN(firmware, ".", 2)[0]
+	if model, ok := firmwareCameras[prefix]; ok {
+		return model
+	}
+
+	return prefix
+}
+
+// Parse ffprobe's decimal seconds, e.g. "12.345000"; zero if unparseable.
+func Seconds(s string) time.Duration {
+
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
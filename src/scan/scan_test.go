@@ -0,0 +1,77 @@
+package scan
+
+import (
+	"testing"
+	"time"
+)
+
+// Names are parsed as GoPro writes them, and as stopcon renames and merges them.
+func TestParseName(t *testing.T) {
+
+	tests := []struct {
+		name string
+		want Fragment
+		err  bool
+	}{
+		{name: "GX010042.MP4", want: Fragment{Id: "0042", Index: 1, Extension: "MP4"}},
+		{name: "GH020043.MP4", want: Fragment{Id: "0043", Index: 2, Extension: "MP4"}},
+		{name: "GS011234.360", want: Fragment{Id: "1234", Index: 1, Extension: "360"}},
+		{name: "Recording _-_ Date 2024-05-01 10_00_00 _-_ ID 0042 _-_ Part 02.MP4", want: Fragment{Id: "0042", Index: 2, Extension: "MP4"}},
+		{name: "Recording _-_ Date 2024-05-01 10_00_00 _-_ ID 0042.mp4", want: Fragment{Id: "0042", Extension: "mp4"}},
+		{name: "GX0100042.MP4", err: true},
+		{name: "GP010042.MP4", err: true},
+		{name: "IMG_0042.JPG", err: true},
+		{name: "", err: true},
+	}
+
+	for _, test := range tests {
+
+		got, err := ParseName(test.name)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q parsed as %+v", test.name, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", test.name, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%q parsed as %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+}
+
+// Fragments roll over into a new recording only once the gap after the previous one is exceeded.
+func TestRolledOver(t *testing.T) {
+
+	end := time.Date(2024, 5, 1, 10, 8, 51, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		next time.Time
+		end  time.Time
+		gap  time.Duration
+		want bool
+	}{
+		{name: "chapter", end: end, next: end.Add(time.Second), gap: time.Minute},
+		{name: "at gap", end: end, next: end.Add(time.Minute), gap: time.Minute},
+		{name: "past gap", end: end, next: end.Add(time.Minute + time.Second), gap: time.Minute, want: true},
+		{name: "next day", end: end, next: end.AddDate(0, 0, 1), gap: time.Minute, want: true},
+		{name: "earlier", end: end, next: end.Add(-time.Hour), gap: time.Minute},
+		{name: "no gap", end: end, next: end.AddDate(0, 0, 1)},
+		{name: "no end", next: end, gap: time.Minute},
+		{name: "no start", end: end, gap: time.Minute},
+	}
+
+	for _, test := range tests {
+		if got := RolledOver(test.end, test.next, test.gap); got != test.want {
+			t.Errorf("%s: rolled over %t, want %t", test.name, got, test.want)
+		}
+	}
+
+}
@@ -0,0 +1,507 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/cache"
+	"github.com/thatpix3l/stopcon/src/ff"
+	"github.com/thatpix3l/stopcon/src/gpmf"
+	"github.com/thatpix3l/stopcon/src/mp4"
+	"github.com/thatpix3l/stopcon/src/utils"
+)
+
+// Error of fragments none of the sources of creation times has one for, and no date is assumed for.
+var ErrNoTimestamp = errors.New("no creation time found")
+
+// What a [Scanner] goes by.
+type Options struct {
+	Sources     []string       // Sources of creation times, the first one holding one winning, e.g. container, gps and mtime; default container, stream, mtime and filename.
+	TimeOffset  time.Duration  // Correction of a camera clock that was off, added to times of container and stream tags and of modification.
+	Location    *time.Location // Zone creation times are shown in; nil to take tags at face value, local wall-clock time marked as UTC as GoPro writes them.
+	AssumedDate time.Time      // Creation time of fragments no source has one for; zero to fail them with [ErrNoTimestamp].
+	RolloverGap time.Duration  // Fragments sharing an ID but recorded further apart than this are separate recordings; 0 to go by ID and chapter alone.
+	Reader      string         // "auto" to read MP4 files natively, falling back to ffprobe, or "ffprobe" to run it on every file; default "auto".
+	NativeOnly  bool           // Whether ffprobe is missing, so only files read natively can be probed.
+	Cache       *cache.Cache   // Probe output of files probed before; nil to probe every file.
+	Jobs        int            // Files probed at once by [Scanner.Fragments]; default number of CPUs.
+
+	// Builds ffprobe and ffmpeg processes, given their name and arguments; defaults to running them from PATH, killed once the context of the scan is done.
+	Command func(args []string, stdin string) *exec.Cmd
+}
+
+// Reads fragments and groups them into recordings, going by its [Options] alone.
+type Scanner struct {
+	opts Options
+}
+
+// Scanner going by opts, unset ones defaulted.
+func New(opts Options) *Scanner {
+
+	if len(opts.Sources) == 0 {
+		opts.Sources = []string{SourceContainer, SourceStream, SourceMtime, SourceFilename}
+	}
+
+	if opts.Reader == "" {
+		opts.Reader = "auto"
+	}
+
+	if opts.Jobs <= 0 {
+		opts.Jobs = runtime.NumCPU()
+	}
+
+	return &Scanner{opts: opts}
+}
+
+// Process running args, the tool first.
+func (s *Scanner) command(ctx context.Context, args []string) *exec.Cmd {
+
+	if s.opts.Command != nil {
+		return s.opts.Command(args, "")
+	}
+
+	return exec.CommandContext(ctx, args[0], args[1:]...)
+}
+
+// Fragments of files at paths, read a few at once, in the order of paths; files not named like GoPro's are left out, the first that is but cannot be read is an error.
+func (s *Scanner) Fragments(ctx context.Context, paths []string) ([]Fragment, error) {
+
+	fragments := make([]Fragment, len(paths))
+	errs := make([]error, len(paths))
+
+	wg := sync.WaitGroup{}
+	queue := make(chan int)
+
+	for i := 0; i < s.opts.Jobs; i++ {
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				fragments[i], errs[i] = s.Fragment(ctx, paths[i])
+			}
+		}()
+
+	}
+
+	for i := range paths {
+		queue <- i
+	}
+
+	close(queue)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	found := []Fragment{}
+	for i, err := range errs {
+
+		if errors.Is(err, ErrNotGoPro) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(paths[i]), err)
+		}
+
+		found = append(found, fragments[i])
+	}
+
+	return found, nil
+}
+
+// Fragment of file at path, parsed by its name and read from its probe.
+func (s *Scanner) Fragment(ctx context.Context, path string) (Fragment, error) {
+
+	f, err := ParseName(filepath.Base(path))
+	if err != nil {
+		return f, err
+	}
+
+	f.Path = path
+
+	if f.Metadata, _, err = s.Metadata(ctx, path); err != nil {
+		return f, err
+	}
+
+	return f, nil
+}
+
+// Metadata of file at path, read from its probe, along with how its creation time was found.
+func (s *Scanner) Metadata(ctx context.Context, path string) (Metadata, Timestamp, error) {
+
+	m := Metadata{}
+
+	data, err := s.Probe(ctx, path)
+	if err != nil {
+		return m, Timestamp{}, err
+	}
+
+	// Cached and snapshot probes of files without video hold no stream to go by
+	if len(data.Streams) == 0 {
+		return m, Timestamp{}, fmt.Errorf("no video stream in %s", filepath.Base(path))
+	}
+
+	ts, err := s.Timestamp(ctx, path, data)
+	if err != nil {
+		return m, ts, err
+	}
+
+	m.Codec = data.Streams[0].CodecName
+	m.CreationTime = &ts.Time
+	m.TimeSource = ts.Source
+	m.Duration = Seconds(data.Format.Duration)
+	m.Lapse = Lapse(data, HasAudio(path))
+	m.Variant = Variant(data)
+	m.Camera = Camera(data)
+
+	if v := data.Streams[0].StreamVideo; v != nil {
+		m.Width = v.Width
+		m.Height = v.Height
+		m.FrameRate = v.RFrameRate
+	}
+
+	// HiLight tags only exist in MP4 containers; absence is not an error.
+	if hilights, err := mp4.HiLights(path); err == nil && len(hilights) > 0 {
+		m.Starred = true
+	}
+
+	return m, ts, nil
+}
+
+// Container and first video stream of file at path, taken from the probe cache if the file has not changed since, else read natively where the reader does, else by ffprobe.
+func (s *Scanner) Probe(ctx context.Context, path string) (ff.ProbeData, error) {
+
+	data := ff.ProbeData{}
+
+	buf, err := s.probe(ctx, path)
+	if err != nil {
+		return data, err
+	}
+
+	if err := json.Unmarshal(buf, &data); err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+// Output of ffprobe for file at path, or as ffprobe would show it.
+func (s *Scanner) probe(ctx context.Context, path string) ([]byte, error) {
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, statErr := os.Stat(path)
+
+	if s.opts.Cache != nil && statErr == nil {
+		if buf, ok := s.opts.Cache.Lookup(path, info); ok {
+			return buf, nil
+		}
+	}
+
+	// Files the native reader cannot make sense of go to ffprobe after all
+	if ReadsNatively(s.opts.Reader, path) {
+		data, err := mp4.Probe(path)
+		if err == nil {
+			return json.Marshal(data)
+		}
+		if s.opts.NativeOnly {
+			return nil, err
+		}
+	}
+
+	buf, err := utils.Output(s.command(ctx, ProbeArgs(path)), filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+
+	if s.opts.Cache != nil && statErr == nil {
+		s.opts.Cache.Store(path, info, buf)
+	}
+
+	return buf, nil
+}
+
+// Creation time of a fragment, as told by one source.
+type Reading struct {
+	Source string
+	Time   time.Time
+}
+
+// Creation time of a fragment, with what each source said about it.
+type Timestamp struct {
+	Time     time.Time
+	Source   string    // Source Time was taken from, e.g. "container", or [SourceAssumed].
+	Readings []Reading // Sources holding a time, in order of preference; the first one was taken unless assumed.
+}
+
+// Readings of sources other than the one taken that are off by over a minute.
+// Modification times trail creation by the recording's length at least, and copies reset them, so they are never off.
+func (ts Timestamp) Disagreeing() []Reading {
+
+	off := []Reading{}
+
+	for _, r := range ts.Readings {
+		if r.Source == ts.Source || r.Source == SourceMtime {
+			continue
+		}
+		if d := r.Time.Sub(ts.Time); d > time.Minute || d < -time.Minute {
+			off = append(off, r)
+		}
+	}
+
+	return off
+}
+
+// Creation time of file at path with probe data, from the first source holding one.
+// Each source is asked, so those disagreeing with the one taken can be pointed out.
+func (s *Scanner) Timestamp(ctx context.Context, path string, data ff.ProbeData) (Timestamp, error) {
+
+	ts := Timestamp{}
+
+	for _, source := range s.opts.Sources {
+		if t, ok := s.TimeFrom(ctx, source, path, data); ok {
+			ts.Readings = append(ts.Readings, Reading{Source: source, Time: t})
+		}
+	}
+
+	if len(ts.Readings) == 0 {
+
+		if s.opts.AssumedDate.IsZero() {
+			return ts, ErrNoTimestamp
+		}
+
+		ts.Time, ts.Source = s.opts.AssumedDate, SourceAssumed
+
+		return ts, nil
+	}
+
+	ts.Time, ts.Source = ts.Readings[0].Time, ts.Readings[0].Source
+
+	return ts, nil
+}
+
+// Creation time of file at path with probe data according to source, if it has one.
+// Sources set by the camera's clock are corrected by the time offset; GPS time does not drift, and names were corrected when given.
+func (s *Scanner) TimeFrom(ctx context.Context, source string, path string, data ff.ProbeData) (time.Time, bool) {
+
+	t, ok := s.rawTimeFrom(ctx, source, path, data)
+	if ok && (source == SourceContainer || source == SourceStream || source == SourceMtime) {
+		t = t.Add(s.opts.TimeOffset)
+	}
+
+	return t, ok
+}
+
+// Creation time of file at path with probe data according to source as it is, if it has one.
+func (s *Scanner) rawTimeFrom(ctx context.Context, source string, path string, data ff.ProbeData) (time.Time, bool) {
+
+	switch source {
+
+	case SourceContainer:
+		t, ok := CreationTime(data.Format.Tags["creation_time"])
+		return s.InZone(t), ok
+
+	case SourceStream:
+		if len(data.Streams) == 0 {
+			return time.Time{}, false
+		}
+		t, ok := CreationTime(data.Streams[0].Tags["creation_time"])
+		return s.InZone(t), ok
+
+	case SourceGPS:
+		fix, err := s.GPSFix(ctx, path)
+		if err != nil || fix.Time.IsZero() {
+			return time.Time{}, false
+		}
+		return s.InZone(fix.Time), true
+
+	// Cameras and card readers stamp local wall-clock time, which GoPro's tags carry marked as UTC; do the same, unless told the zone
+	case SourceMtime:
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if s.opts.Location != nil {
+			return info.ModTime().In(s.opts.Location), true
+		}
+		t := info.ModTime().Local()
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC), true
+
+	// Names hold wall-clock time, which is in the scanner's zone if it has one
+	case SourceFilename:
+		return NameDate(filepath.Base(path), s.opts.Location)
+
+	}
+
+	return time.Time{}, false
+}
+
+// Time t, read from a tag holding real UTC, in the zone of the scanner; unchanged if it has none.
+func (s *Scanner) InZone(t time.Time) time.Time {
+
+	if s.opts.Location == nil || t.IsZero() {
+		return t
+	}
+
+	return t.In(s.opts.Location)
+}
+
+// First GPS position in the telemetry of video at path.
+func (s *Scanner) GPSFix(ctx context.Context, path string) (gpmf.Fix, error) {
+
+	index, err := s.telemetryStream(ctx, path)
+	if err != nil {
+		return gpmf.Fix{}, err
+	}
+
+	// Dump raw telemetry stream
+	buf, err := utils.Output(s.command(ctx, []string{"ffmpeg", "-loglevel", "fatal", "-i", path, "-map", fmt.Sprintf("0:%d", index), "-codec", "copy", "-f", "data", "-"}), filepath.Base(path))
+	if err != nil {
+		return gpmf.Fix{}, err
+	}
+
+	return gpmf.FirstFix(buf)
+}
+
+// Index of the GPMF telemetry stream of video at path.
+func (s *Scanner) telemetryStream(ctx context.Context, path string) (int, error) {
+
+	jsonBuf, err := utils.Output(s.command(ctx, []string{"ffprobe", path, "-print_format", "json", "-show_streams", "-select_streams", "d", "-loglevel", "fatal"}), filepath.Base(path))
+	if err != nil {
+		return 0, err
+	}
+
+	data := ff.ProbeData{}
+	if err := json.Unmarshal(jsonBuf, &data); err != nil {
+		return 0, err
+	}
+
+	for _, s := range data.Streams {
+		if s.CodecTagString == "gpmd" {
+			return s.Index, nil
+		}
+	}
+
+	return 0, errors.New("no telemetry stream")
+}
+
+// Recordings of fragments, by ID and then by time, see [Split] and [Join].
+func (s *Scanner) Group(fragments []Fragment) []Recording {
+
+	recordings := []Recording{}
+	for _, group := range Split(fragments, func(f Fragment) Fragment { return f }, s.opts.RolloverGap) {
+		recordings = append(recordings, Join(group))
+	}
+
+	return recordings
+}
+
+// Items grouped by the recording their fragments, as told by fragment, belong to: fragments sharing an ID belong together unless further apart in time than gap.
+// Groups go by ID, then by time; items of each by time, then by chapter.
+func Split[T any](items []T, fragment func(T) Fragment, gap time.Duration) [][]T {
+
+	sorted := append([]T{}, items...)
+
+	// By ID, then by time, so each recording's fragments follow one another
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := fragment(sorted[i]), fragment(sorted[j])
+		if a.Id != b.Id {
+			return a.Id < b.Id
+		}
+		if a.CreationTime != nil && b.CreationTime != nil && !a.CreationTime.Equal(*b.CreationTime) {
+			return a.CreationTime.Before(*b.CreationTime)
+		}
+		return a.Index < b.Index
+	})
+
+	groups := [][]T{}
+	for i, item := range sorted {
+
+		if i > 0 {
+			prev, next := fragment(sorted[i-1]), fragment(item)
+			if prev.Id == next.Id && !rolledOver(prev, next, gap) {
+				groups[len(groups)-1] = append(groups[len(groups)-1], item)
+				continue
+			}
+		}
+
+		groups = append(groups, []T{item})
+	}
+
+	return groups
+}
+
+// Whether fragment next, following prev in time, starts too long after prev ends to belong to the same recording.
+func rolledOver(prev Fragment, next Fragment, gap time.Duration) bool {
+
+	// Without times, ID is all there is to go by
+	if prev.CreationTime == nil || next.CreationTime == nil {
+		return false
+	}
+
+	return RolledOver(prev.CreationTime.Add(prev.Duration), *next.CreationTime, gap)
+}
+
+// Recording made of fragments, which share its ID; codec, camera and the like are taken from the first one.
+func Join(fragments []Fragment) Recording {
+
+	r := Recording{Fragments: []Fragment{}}
+	if len(fragments) == 0 {
+		return r
+	}
+
+	r.Id = fragments[0].Id
+	r.Metadata = fragments[0].Metadata
+	r.CreationTime = nil
+	r.Starred = false
+	r.Lapse = false
+	r.Variant = ""
+
+	// Recording started with its earliest fragment
+	for _, f := range fragments {
+		if f.CreationTime != nil && (r.CreationTime == nil || f.CreationTime.Before(*r.CreationTime)) {
+			r.CreationTime = f.CreationTime
+		}
+	}
+
+	for _, f := range fragments {
+
+		// Fragments are named after the recording they belong to
+		if r.CreationTime != nil {
+			f.CreationTime = r.CreationTime
+		}
+
+		// Recording is starred if any of its fragments are
+		r.Starred = r.Starred || f.Starred
+		r.Lapse = r.Lapse || f.Lapse
+
+		// Mixed variants are for callers to warn about; the first one found names the recording
+		if r.Variant == "" {
+			r.Variant = f.Variant
+		}
+
+		r.Fragments = append(r.Fragments, f)
+
+		if f.Index > r.Expected {
+			r.Expected = f.Index
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,135 @@
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thatpix3l/stopcon/src/ff"
+)
+
+// Creation times come from the first source having one, corrected by the time offset where the camera's clock set them.
+func TestTimestamp(t *testing.T) {
+
+	const tag = "2024-05-01T10:00:00.000000Z"
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	// Renamed fragment, its name dated a minute later and its file modified a day later
+	path := filepath.Join(t.TempDir(), "Recording _-_ Date 2024-05-01 10_01_00 _-_ ID 0042 _-_ Part 01.MP4")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2024, 5, 2, 10, 0, 0, 0, time.Local)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	tagged := func(container bool, stream bool) ff.ProbeData {
+		data := ff.ProbeData{Format: ff.Format{Tags: map[string]interface{}{}}, Streams: []ff.Stream{{Tags: map[string]interface{}{}}}}
+		if container {
+			data.Format.Tags["creation_time"] = tag
+		}
+		if stream {
+			data.Streams[0].Tags["creation_time"] = "2024-05-01T10:00:30.000000Z"
+		}
+		return data
+	}
+
+	tests := []struct {
+		name     string
+		sources  string
+		data     ff.ProbeData
+		offset   time.Duration
+		assumed  time.Time
+		want     time.Time
+		source   string
+		disagree int
+		err      bool
+	}{
+		{name: "container", sources: "container,stream,mtime,filename", data: tagged(true, true), want: at, source: SourceContainer},
+		{name: "stream", sources: "container,stream,mtime,filename", data: tagged(false, true), want: at.Add(30 * time.Second), source: SourceStream},
+		{name: "mtime", sources: "container,stream,mtime,filename", data: tagged(false, false), want: at.AddDate(0, 0, 1), source: SourceMtime, disagree: 1},
+		{name: "filename", sources: "container,filename", data: tagged(false, false), want: at.Add(time.Minute), source: SourceFilename},
+		{name: "order", sources: "filename,container", data: tagged(true, true), want: at.Add(time.Minute), source: SourceFilename},
+		{name: "no streams", sources: "stream,filename", data: ff.ProbeData{}, want: at.Add(time.Minute), source: SourceFilename},
+		{name: "offset", sources: "container,filename", data: tagged(true, false), offset: time.Hour, want: at.Add(time.Hour), source: SourceContainer, disagree: 1},
+		{name: "names not offset", sources: "filename", data: tagged(true, false), offset: time.Hour, want: at.Add(time.Minute), source: SourceFilename},
+		{name: "mtime not disagreeing", sources: "container,mtime", data: tagged(true, false), want: at, source: SourceContainer},
+		{name: "assumed", sources: "container,stream", data: tagged(false, false), assumed: at.AddDate(0, 1, 0), want: at.AddDate(0, 1, 0), source: SourceAssumed},
+		{name: "none", sources: "container,stream", data: tagged(false, false), err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			s := New(Options{Sources: strings.Split(test.sources, ","), TimeOffset: test.offset, AssumedDate: test.assumed})
+
+			ts, err := s.Timestamp(context.Background(), path, test.data)
+			if test.err {
+				if err != ErrNoTimestamp {
+					t.Fatalf("found %s from %s, error %v", ts.Time, ts.Source, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !ts.Time.Equal(test.want) || ts.Source != test.source {
+				t.Errorf("%s from %s, want %s from %s", ts.Time, ts.Source, test.want, test.source)
+			}
+
+			if got := len(ts.Disagreeing()); got != test.disagree {
+				t.Errorf("%d sources disagree, want %d: %v", got, test.disagree, ts.Readings)
+			}
+
+		})
+	}
+
+}
+
+// Fragments sharing an ID are joined into one recording unless recorded too far apart.
+func TestGroup(t *testing.T) {
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	chapter := 8*time.Minute + 51*time.Second
+
+	fragment := func(id string, index int, created time.Time, starred bool) Fragment {
+		return Fragment{Id: id, Index: index, Metadata: Metadata{CreationTime: &created, Duration: chapter, Starred: starred}}
+	}
+
+	s := New(Options{RolloverGap: time.Hour})
+	recordings := s.Group([]Fragment{
+		fragment("0042", 3, start.Add(2*chapter), true),
+		fragment("0042", 1, start, false),
+		fragment("0042", 1, start.AddDate(1, 0, 0), false),
+	})
+
+	if len(recordings) != 2 {
+		t.Fatalf("%d recordings, want 2", len(recordings))
+	}
+
+	r := recordings[0]
+	if !r.CreationTime.Equal(start) || !r.Starred || r.Expected != 3 || len(r.Fragments) != 2 {
+		t.Errorf("recording created %s, starred %t, expecting %d, of %d fragments", r.CreationTime, r.Starred, r.Expected, len(r.Fragments))
+	}
+
+	if missing := r.Missing(); len(missing) != 1 || missing[0] != 2 {
+		t.Errorf("missing %v, want [2]", missing)
+	}
+
+	// Fragments are named after the recording they belong to
+	for _, f := range r.Fragments {
+		if !f.CreationTime.Equal(start) {
+			t.Errorf("part %d created %s, want %s", f.Index, f.CreationTime, start)
+		}
+	}
+
+	if r := recordings[1]; !r.CreationTime.Equal(start.AddDate(1, 0, 0)) || r.Starred {
+		t.Errorf("rolled over recording created %s, starred %t", r.CreationTime, r.Starred)
+	}
+
+}
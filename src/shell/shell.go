@@ -0,0 +1,25 @@
+package shell
+
+import "strings"
+
+// Label of the context-menu entry.
+const Label = "Process with stopcon"
+
+// Placeholder in commands replaced by the selected folder.
+const Folder = "{}"
+
+// Command with each argument quoted for a POSIX shell, and the placeholder replaced by a reference to the folder.
+func posixCommand(command []string, folder string) string {
+
+	quoted := make([]string, len(command))
+
+	for i, arg := range command {
+		if arg == Folder {
+			quoted[i] = `"` + folder + `"`
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+
+	return strings.Join(quoted, " ")
+}
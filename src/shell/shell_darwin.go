@@ -0,0 +1,166 @@
+package shell
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+)
+
+// Service menu entry for Finder folders.
+const infoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>NSServices</key>
+	<array>
+		<dict>
+			<key>NSMenuItem</key>
+			<dict>
+				<key>default</key>
+				<string>%s</string>
+			</dict>
+			<key>NSMessage</key>
+			<string>runWorkflowAsService</string>
+			<key>NSRequiredContext</key>
+			<dict>
+				<key>NSApplicationIdentifier</key>
+				<string>com.apple.finder</string>
+			</dict>
+			<key>NSSendFileTypes</key>
+			<array>
+				<string>public.folder</string>
+			</array>
+		</dict>
+	</array>
+</dict>
+</plist>
+`
+
+// Quick Action running a shell script with the selected folders as arguments.
+const documentWflow = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>AMApplicationBuild</key>
+	<string>523</string>
+	<key>AMApplicationVersion</key>
+	<string>2.10</string>
+	<key>AMDocumentVersion</key>
+	<string>2</string>
+	<key>actions</key>
+	<array>
+		<dict>
+			<key>action</key>
+			<dict>
+				<key>AMAccepts</key>
+				<dict>
+					<key>Container</key>
+					<string>List</string>
+					<key>Optional</key>
+					<true/>
+					<key>Types</key>
+					<array>
+						<string>com.apple.cocoa.string</string>
+					</array>
+				</dict>
+				<key>AMActionVersion</key>
+				<string>2.0.3</string>
+				<key>AMProvides</key>
+				<dict>
+					<key>Container</key>
+					<string>List</string>
+					<key>Types</key>
+					<array>
+						<string>com.apple.cocoa.string</string>
+					</array>
+				</dict>
+				<key>ActionBundlePath</key>
+				<string>/System/Library/Automator/Run Shell Script.action</string>
+				<key>ActionName</key>
+				<string>Run Shell Script</string>
+				<key>ActionParameters</key>
+				<dict>
+					<key>COMMAND_STRING</key>
+					<string>%s</string>
+					<key>CheckedForUserDefaultShell</key>
+					<true/>
+					<key>inputMethod</key>
+					<integer>1</integer>
+					<key>shell</key>
+					<string>/bin/sh</string>
+					<key>source</key>
+					<string></string>
+				</dict>
+				<key>BundleIdentifier</key>
+				<string>com.apple.RunShellScript</string>
+				<key>CFBundleVersion</key>
+				<string>2.0.3</string>
+				<key>Class Name</key>
+				<string>RunShellScriptAction</string>
+			</dict>
+		</dict>
+	</array>
+	<key>workflowMetaData</key>
+	<dict>
+		<key>serviceInputTypeIdentifier</key>
+		<string>com.apple.Automator.fileSystemObject.folder</string>
+		<key>serviceApplicationBundleID</key>
+		<string>com.apple.finder</string>
+		<key>workflowTypeIdentifier</key>
+		<string>com.apple.Automator.servicesMenu</string>
+	</dict>
+</dict>
+</plist>
+`
+
+// Location of the Quick Action bundle.
+func workflowPath() (string, error) {
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, "Library", "Services", Label+".workflow"), nil
+}
+
+// Install Finder Quick Action running command on the selected folders; returns location written.
+func Install(command []string) ([]string, error) {
+
+	path, err := workflowPath()
+	if err != nil {
+		return nil, err
+	}
+
+	script := "for folder in \"$@\"; do\n\t" + posixCommand(command, "$folder") + "\ndone\n"
+
+	contents := filepath.Join(path, "Contents")
+	if err := os.MkdirAll(contents, 0o755); err != nil {
+		return nil, err
+	}
+
+	files := map[string]string{
+		"Info.plist":     fmt.Sprintf(infoPlist, html.EscapeString(Label)),
+		"document.wflow": fmt.Sprintf(documentWflow, html.EscapeString(script)),
+	}
+
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(contents, name), []byte(text), 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	return []string{path}, nil
+}
+
+// Remove Quick Action.
+func Uninstall() error {
+
+	path, err := workflowPath()
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(path)
+}
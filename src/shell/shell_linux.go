@@ -0,0 +1,83 @@
+package shell
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Locations of the entry: a Nautilus script and a Dolphin service menu.
+func linuxPaths() (nautilus string, dolphin string, err error) {
+
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", err
+		}
+
+		data = filepath.Join(home, ".local", "share")
+	}
+
+	return filepath.Join(data, "nautilus", "scripts", Label), filepath.Join(data, "kio", "servicemenus", "stopcon.desktop"), nil
+}
+
+// Install context-menu entries running command for file managers of the current user; returns locations written.
+func Install(command []string) ([]string, error) {
+
+	nautilus, dolphin, err := linuxPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	// Nautilus passes selected paths as arguments, or runs in the open folder without any
+	script := "#!/bin/sh\n" +
+		"[ $# -eq 0 ] && set -- \"$PWD\"\n" +
+		"for folder in \"$@\"; do\n" +
+		"\t" + posixCommand(command, "$folder") + "\n" +
+		"done\n"
+
+	// Dolphin runs the same script on the selected folders
+	desktop := "[Desktop Entry]\n" +
+		"Type=Service\n" +
+		"MimeType=inode/directory;\n" +
+		"Actions=stopcon\n" +
+		"X-KDE-ServiceTypes=KonqPopupMenu/Plugin\n" +
+		"\n" +
+		"[Desktop Action stopcon]\n" +
+		"Name=" + Label + "\n" +
+		"Exec=\"" + nautilus + "\" %F\n"
+
+	for path, contents := range map[string]string{nautilus: script, dolphin: desktop} {
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+
+		if err := os.WriteFile(path, []byte(contents), 0o755); err != nil {
+			return nil, err
+		}
+
+	}
+
+	return []string{nautilus, dolphin}, nil
+}
+
+// Remove context-menu entries.
+func Uninstall() error {
+
+	nautilus, dolphin, err := linuxPaths()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range []string{nautilus, dolphin} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !windows && !linux && !darwin
+
+package shell
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Install context-menu entry running command; unsupported on this platform.
+func Install(command []string) ([]string, error) {
+	return nil, fmt.Errorf("shell integration is not supported on %s", runtime.GOOS)
+}
+
+// Remove context-menu entry; unsupported on this platform.
+func Uninstall() error {
+	return fmt.Errorf("shell integration is not supported on %s", runtime.GOOS)
+}
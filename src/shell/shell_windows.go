@@ -0,0 +1,86 @@
+package shell
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// Registry keys of the entry, for right-clicking a folder and the background of an open folder.
+var keys = []string{
+	`Software\Classes\Directory\shell\stopcon`,
+	`Software\Classes\Directory\Background\shell\stopcon`,
+}
+
+// Command line for the registry, with the placeholder replaced by Explorer's folder variable.
+func windowsCommand(command []string) string {
+
+	quoted := make([]string, len(command))
+
+	for i, arg := range command {
+		if arg == Folder {
+			arg = "%V"
+		}
+		quoted[i] = `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// Register context-menu entry running command, for the current user; returns locations written.
+func Install(command []string) ([]string, error) {
+
+	for _, key := range keys {
+
+		k, _, err := registry.CreateKey(registry.CURRENT_USER, key, registry.SET_VALUE)
+		if err != nil {
+			return nil, err
+		}
+
+		err = k.SetStringValue("", Label)
+		if err == nil {
+			err = k.SetStringValue("Icon", command[0])
+		}
+		k.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		c, _, err := registry.CreateKey(registry.CURRENT_USER, key+`\command`, registry.SET_VALUE)
+		if err != nil {
+			return nil, err
+		}
+
+		err = c.SetStringValue("", windowsCommand(command))
+		c.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+	}
+
+	locations := []string{}
+	for _, key := range keys {
+		locations = append(locations, `HKEY_CURRENT_USER\`+key)
+	}
+
+	return locations, nil
+}
+
+// Remove context-menu entry.
+func Uninstall() error {
+
+	for _, key := range keys {
+
+		for _, k := range []string{key + `\command`, key} {
+			if err := registry.DeleteKey(registry.CURRENT_USER, k); err != nil && err != registry.ErrNotExist {
+				return err
+			}
+		}
+
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package sidecar
+
+import (
+	"encoding/json"
+	"io"
+	"runtime/debug"
+	"text/template"
+	"time"
+)
+
+// Fragment merged into a recording, as probed before merging.
+type Fragment struct {
+	Name     string     `json:"name"`
+	SHA256   string     `json:"sha256,omitempty"`
+	Codec    string     `json:"codec,omitempty"`
+	Created  *time.Time `json:"created,omitempty"`
+	Duration string     `json:"duration"` // E.g. "8m51.2s".
+	Variant  string     `json:"variant,omitempty"`
+	Source   string     `json:"created_from,omitempty"` // Where Created was taken from, e.g. "container" or "gps".
+}
+
+// Provenance of a merged recording, written next to it.
+type Sidecar struct {
+	Id        string     `json:"id"`
+	Output    string     `json:"output"`
+	Created   *time.Time `json:"created,omitempty"`
+	Lapse     bool       `json:"lapse,omitempty"`
+	Verified  bool       `json:"verified"`
+	Fragments []Fragment `json:"fragments"`
+	Merged    time.Time  `json:"merged"`
+	Version   string     `json:"version"` // Version of stopcon, with its VCS revision when known.
+	Args      []string   `json:"args"`    // Command line stopcon ran with.
+}
+
+// Version of running binary, e.g. "v1.2.0" or "(devel) 1a2b3c4".
+func Version() string {
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	version := info.Main.Version
+
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			version += " " + s.Value
+		}
+	}
+
+	return version
+}
+
+// Write sidecar as indented JSON.
+func (s Sidecar) WriteJSON(w io.Writer) error {
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+
+	return e.Encode(s)
+}
+
+var markdown = template.Must(template.New("sidecar").Funcs(template.FuncMap{
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return "unknown"
+		}
+		return t.Format("2006-01-02 15:04:05")
+	},
+}).Parse(`# Recording {{.Id}}
+
+- Output: {{.Output}}
+- Recorded: {{date .Created}}{{if .Lapse}}
+- TimeWarp or Night Lapse{{end}}
+- Merged: {{.Merged.Format "2006-01-02 15:04:05"}}, {{if .Verified}}verified{{else}}not verified{{end}}
+
+## Fragments
+
+| Name | Codec | Variant | Recorded | Duration | SHA-256 |
+| --- | --- | --- | --- | --- | --- |
+{{range .Fragments}}| {{.Name}} | {{.Codec}} | {{or .Variant "sdr"}} | {{date .Created}} | {{.Duration}} | {{.SHA256}} |
+{{end}}
+## Processing
+
+- stopcon {{.Version}}
+- Arguments:{{range .Args}} ` + "`{{.}}`" + `{{end}}
+`))
+
+// Write sidecar as a Markdown README.
+func (s Sidecar) WriteMarkdown(w io.Writer) error {
+	return markdown.Execute(w, s)
+}
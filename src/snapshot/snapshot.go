@@ -0,0 +1,84 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Probe results of fragments, taken where probing is fast, e.g. next to the card, and planned with elsewhere.
+type Snapshot struct {
+	Taken     time.Time        `json:"taken"`
+	Fragments map[string]Entry `json:"fragments"` // By file name.
+}
+
+// Probe result of a single fragment.
+type Entry struct {
+	Size     int64           `json:"size"`     // File size when probed, telling whether the file is still the same.
+	Metadata json.RawMessage `json:"metadata"` // Metadata as parsed by stopcon.
+}
+
+// Empty snapshot taken now.
+func New() *Snapshot {
+	return &Snapshot{Taken: time.Now().UTC(), Fragments: map[string]Entry{}}
+}
+
+// Load snapshot stored at path.
+func Load(path string) (*Snapshot, error) {
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := New()
+	if err := json.Unmarshal(buf, s); err != nil {
+		return nil, err
+	}
+
+	// File may contain an explicit null
+	if s.Fragments == nil {
+		s.Fragments = map[string]Entry{}
+	}
+
+	return s, nil
+}
+
+// Record metadata of fragment named name of size bytes.
+func (s *Snapshot) Store(name string, size int64, metadata any) error {
+
+	buf, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	s.Fragments[name] = Entry{Size: size, Metadata: buf}
+
+	return nil
+}
+
+// Decode metadata of fragment named name into metadata, if recorded at size bytes.
+func (s *Snapshot) Lookup(name string, size int64, metadata any) (bool, error) {
+
+	e, ok := s.Fragments[name]
+	if !ok || e.Size != size {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(e.Metadata, metadata); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Write snapshot to path.
+func (s *Snapshot) Save(path string) error {
+
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, buf, 0o644)
+}
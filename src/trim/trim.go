@@ -0,0 +1,162 @@
+package trim
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stretch of a trimmed video, copied as it is or, not starting on a keyframe, re-encoded.
+type Segment struct {
+	Start  time.Duration
+	End    time.Duration
+	Encode bool
+}
+
+// Segments cutting start to end out of a video of duration with keyframes at keyframes, in order.
+// Only the stretches before the first keyframe after start and after the last keyframe before end are re-encoded, so the cut is frame-accurate while the rest is copied.
+// An end of 0 or past duration keeps the rest of the video.
+func Plan(keyframes []time.Duration, start, end, duration time.Duration) []Segment {
+
+	if end <= 0 || end > duration {
+		end = duration
+	}
+
+	first, last := -1, -1
+	for i, k := range keyframes {
+		if k >= start && k < end {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	// Too short to hold a keyframe
+	if first < 0 {
+		return []Segment{{Start: start, End: end, Encode: true}}
+	}
+
+	segments := []Segment{}
+
+	k1, k2 := keyframes[first], keyframes[last]
+	if k1 > start {
+		segments = append(segments, Segment{Start: start, End: k1, Encode: true})
+	}
+
+	// Ending where the video does or on a keyframe, the last group of pictures is whole
+	if end == duration || isKeyframe(keyframes, end) {
+		return append(segments, Segment{Start: k1, End: end})
+	}
+
+	if k2 > k1 {
+		segments = append(segments, Segment{Start: k1, End: k2})
+	}
+
+	return append(segments, Segment{Start: k2, End: end, Encode: true})
+}
+
+func isKeyframe(keyframes []time.Duration, t time.Duration) bool {
+
+	for _, k := range keyframes {
+		if k == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Arguments of ffprobe listing keyframes and duration of input, as read by [ParseProbe].
+func ProbeArgs(input string) []string {
+	return []string{"ffprobe", "-v", "error", "-select_streams", "v:0", "-show_entries", "packet=pts_time,flags:format=duration", "-of", "json", input}
+}
+
+// Keyframe times and duration of a video, from the output of [ProbeArgs].
+func ParseProbe(buf []byte) ([]time.Duration, time.Duration, error) {
+
+	data := struct {
+		Packets []struct {
+			PtsTime string `json:"pts_time"`
+			Flags   string `json:"flags"`
+		} `json:"packets"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}{}
+
+	if err := json.Unmarshal(buf, &data); err != nil {
+		return nil, 0, err
+	}
+
+	duration, err := parseSeconds(data.Format.Duration)
+	if err != nil {
+		return nil, 0, errors.New("video has no duration")
+	}
+
+	keyframes := []time.Duration{}
+	for _, p := range data.Packets {
+
+		if !strings.Contains(p.Flags, "K") {
+			continue
+		}
+
+		// Packets without timestamps cannot be cut at
+		t, err := parseSeconds(p.PtsTime)
+		if err != nil {
+			continue
+		}
+
+		keyframes = append(keyframes, t)
+
+	}
+
+	// Packets are listed in decoding order, which B-frames put out of presentation order
+	sort.Slice(keyframes, func(i, j int) bool { return keyframes[i] < keyframes[j] })
+
+	return keyframes, duration, nil
+}
+
+func parseSeconds(s string) (time.Duration, error) {
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 6, 64)
+}
+
+// Arguments writing segment s of input's video to output as MPEG-TS, which joins cleanly even where copied and re-encoded stretches differ in codec parameters.
+// Re-encoded segments use encoder, e.g. "libx265".
+func SegmentArgs(input string, s Segment, encoder string, output string) []string {
+
+	args := []string{"ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-ss", seconds(s.Start), "-i", input, "-t", seconds(s.End - s.Start), "-map", "0:v:0"}
+
+	if s.Encode {
+		args = append(args, "-codec:v", encoder, "-crf", "18", "-preset", "medium")
+	} else {
+		args = append(args, "-codec", "copy")
+	}
+
+	return append(args, "-f", "mpegts", output)
+}
+
+// Arguments joining the segments in concat list at list with input's audio and metadata from start to end into output; an end of 0 runs to the end of input.
+func JoinArgs(list string, input string, start, end time.Duration, output string) []string {
+
+	args := []string{"ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-f", "concat", "-safe", "0", "-i", list, "-ss", seconds(start)}
+
+	if end > 0 {
+		args = append(args, "-t", seconds(end-start))
+	}
+
+	return append(args, "-i", input, "-map", "0:v", "-map", "1:a?", "-codec", "copy", "-map_metadata", "1", output)
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package utils
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// Whether file has other hard links, which share its contents and times.
+func HardLinked(info fs.FileInfo) bool {
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+
+	return stat.Nlink > 1
+}
@@ -0,0 +1,8 @@
+package utils
+
+import "io/fs"
+
+// Whether file has other hard links, which share its contents and times; not told by a plain stat on this platform.
+func HardLinked(info fs.FileInfo) bool {
+	return false
+}
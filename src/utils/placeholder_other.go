@@ -0,0 +1,10 @@
+//go:build !windows
+
+package utils
+
+import "io/fs"
+
+// Whether file is a cloud placeholder whose contents have not been downloaded; undetectable on this platform.
+func isCloudPlaceholder(info fs.FileInfo) bool {
+	return false
+}
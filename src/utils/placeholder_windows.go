@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// Attributes of cloud files whose contents are not stored locally, e.g. OneDrive "online-only" files.
+const (
+	attributeOffline            = 0x1000
+	attributeRecallOnOpen       = 0x40000
+	attributeRecallOnDataAccess = 0x400000
+)
+
+// Whether file is a cloud placeholder whose contents have not been downloaded.
+func isCloudPlaceholder(info fs.FileInfo) bool {
+
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return false
+	}
+
+	return data.FileAttributes&(attributeOffline|attributeRecallOnOpen|attributeRecallOnDataAccess) != 0
+}
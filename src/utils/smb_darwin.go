@@ -0,0 +1,23 @@
+package utils
+
+import "syscall"
+
+// Whether path lives on an SMB/CIFS mount.
+func IsSMB(path string) (bool, error) {
+
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return false, err
+	}
+
+	// Convert null-terminated filesystem type name
+	name := []byte{}
+	for _, c := range stat.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+
+	return string(name) == "smbfs", nil
+}
@@ -0,0 +1,26 @@
+package utils
+
+import "syscall"
+
+// Filesystem magic numbers of SMB/CIFS mounts.
+const (
+	magicSMB  = 0x517b
+	magicCIFS = 0xff534d42
+	magicSMB2 = 0xfe534d42
+)
+
+// Whether path lives on an SMB/CIFS mount.
+func IsSMB(path string) (bool, error) {
+
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return false, err
+	}
+
+	switch uint32(stat.Type) {
+	case magicSMB, magicCIFS, magicSMB2:
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package utils
+
+// Whether path lives on an SMB/CIFS mount; undetectable on this platform.
+func IsSMB(path string) (bool, error) {
+	return false, nil
+}
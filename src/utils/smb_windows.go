@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// Whether path lives on an SMB share, either as a UNC path or a mapped network drive.
+func IsSMB(path string) (bool, error) {
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+
+	if strings.HasPrefix(abs, `\\`) {
+		return true, nil
+	}
+
+	root, err := windows.UTF16PtrFromString(filepath.VolumeName(abs) + `\`)
+	if err != nil {
+		return false, err
+	}
+
+	return windows.GetDriveType(root) == windows.DRIVE_REMOTE, nil
+}
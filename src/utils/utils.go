@@ -1 +1,423 @@
 package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Characters SMB servers refuse to store in file names.
+const smbReserved = `\/:*?"<>|`
+
+// Replace characters SMB servers reject with an underscore, and strip trailing dots and spaces.
+func SanitizeSMB(name string) string {
+
+	sanitized := strings.Map(func(r rune) rune {
+
+		// Control characters are rejected too
+		if r < 0x20 || strings.ContainsRune(smbReserved, r) {
+			return '_'
+		}
+
+		return r
+
+	}, name)
+
+	return strings.TrimRight(sanitized, ". ")
+}
+
+// Writer that aborts once its context is done.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw ctxWriter) Write(p []byte) (int, error) {
+
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return cw.w.Write(p)
+}
+
+// Copy file from src to dst, aborting when ctx is done. A partially written dst is removed on failure.
+func CopyFile(ctx context.Context, src string, dst string) error {
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	// Copy contents, then make sure they actually hit the destination
+	_, err = io.Copy(ctxWriter{ctx: ctx, w: out}, in)
+	if err == nil {
+		err = out.Sync()
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	// Keep original modification time
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// Move file by copying it to dst and deleting src, retrying up to attempts times with each try bounded by timeout.
+func MoveFile(src string, dst string, attempts int, timeout time.Duration) error {
+
+	var err error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+
+		// Back off a little longer after each failed attempt
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * time.Second)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = CopyFile(ctx, src, dst)
+		cancel()
+
+		if err != nil {
+			continue
+		}
+
+		// Only delete source once the copy is confirmed complete
+		if err = sameSize(src, dst); err != nil {
+			os.Remove(dst)
+			continue
+		}
+
+		return os.Remove(src)
+	}
+
+	return fmt.Errorf("moving after %d attempts: %w", attempts, err)
+}
+
+// Error if both files do not share the same size.
+func sameSize(a string, b string) error {
+
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return err
+	}
+
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return err
+	}
+
+	if aInfo.Size() != bInfo.Size() {
+		return fmt.Errorf("size mismatch: %d != %d bytes", aInfo.Size(), bInfo.Size())
+	}
+
+	return nil
+}
+
+// Whether files can be created inside dir; false for read-only mounts and locked cards.
+func IsWritable(dir string) (bool, error) {
+
+	f, err := os.CreateTemp(dir, ".stopcon-probe-*")
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	f.Close()
+	os.Remove(f.Name())
+
+	return true, nil
+}
+
+// Name suffixes of files still being downloaded or synced.
+var partialSuffixes = []string{".tmp", ".part", ".partial", ".crdownload", ".download"}
+
+// Whether file is an incomplete placeholder: a sync tool's temporary file or a cloud file not yet downloaded.
+func IsPlaceholder(info fs.FileInfo) bool {
+
+	name := strings.ToLower(info.Name())
+
+	// Syncthing writes into ".syncthing.NAME.tmp" or "~syncthing~NAME.tmp" before renaming
+	if strings.HasPrefix(name, ".syncthing.") || strings.HasPrefix(name, "~syncthing~") {
+		return true
+	}
+
+	for _, suffix := range partialSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return isCloudPlaceholder(info)
+}
+
+// Writer passing each write whole to W, one at a time, so lines written from several goroutines never interleave.
+type LockedWriter struct {
+	W     io.Writer
+	mutex sync.Mutex
+}
+
+func (l *LockedWriter) Write(p []byte) (int, error) {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.W.Write(p)
+}
+
+// Names operating systems scatter across removable media.
+var systemNames = map[string]bool{
+	"thumbs.db":                 true,
+	"ehthumbs.db":               true,
+	"desktop.ini":               true,
+	"system volume information": true,
+	"$recycle.bin":              true,
+	"icon\r":                    true,
+}
+
+// Whether name is a hidden file or an OS artifact, e.g. "._GX010153.MP4" AppleDouble files, ".Trashes" or "Thumbs.db".
+func IsSystemFile(name string) bool {
+
+	// Covers AppleDouble files, .DS_Store, .Trashes, .Spotlight-V100 and .fseventsd
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+
+	return systemNames[strings.ToLower(name)]
+}
+
+// Parse size with optional binary suffix, e.g. "512K", "2M" or "1G".
+func ParseSize(s string) (int64, error) {
+
+	multiplier := int64(1)
+
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if strings.HasSuffix(strings.ToUpper(s), suffix) {
+			multiplier = m
+			s = s[:len(s)-1]
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size \"%s\"", s)
+	}
+
+	return n * multiplier, nil
+}
+
+// Lines of standard error kept in errors of failed commands; ffmpeg says why it failed last.
+const stderrLines = 5
+
+// Error of cmd failing with err while working on path, carrying the last lines of what it wrote to standard error.
+// Path may be empty if the caller names it already.
+func CmdError(cmd *exec.Cmd, path string, stderr string, err error) error {
+
+	lines := []string{}
+	for _, line := range strings.Split(stderr, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) > stderrLines {
+		lines = lines[len(lines)-stderrLines:]
+	}
+
+	prefix := filepath.Base(cmd.Path)
+	if path != "" {
+		prefix = path + ": " + prefix
+	}
+
+	if len(lines) == 0 {
+		return fmt.Errorf("%s: %w", prefix, err)
+	}
+
+	return fmt.Errorf("%s: %w: %s", prefix, err, strings.Join(lines, "; "))
+}
+
+// Run cmd, returning what it wrote to standard output unless already sent elsewhere.
+// Failures carry its standard error, as described for [CmdError].
+func Output(cmd *exec.Cmd, path string) ([]byte, error) {
+
+	stderr := bytes.Buffer{}
+	if cmd.Stderr == nil {
+		cmd.Stderr = &stderr
+	}
+
+	stdout := bytes.Buffer{}
+	if cmd.Stdout == nil {
+		cmd.Stdout = &stdout
+	}
+
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), CmdError(cmd, path, stderr.String(), err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// Random version 4 UUID, e.g. "2f1c7b7e-4a0d-4c8e-9a57-3b3f0d6c1e42".
+func NewUUID() (string, error) {
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	// Version 4, variant 10
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// Join args into a command line a POSIX shell would split back into the same args.
+func ShellQuote(args []string) string {
+
+	quoted := make([]string, len(args))
+
+	for i, arg := range args {
+
+		// Leave plain words alone for readability
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.,/:=+@%") == "" {
+			quoted[i] = arg
+			continue
+		}
+
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// Split command line s into args as a POSIX shell would, undoing [ShellQuote]: single quotes keep everything, double quotes and backslashes escape.
+// Variables, globs and the like are taken literally.
+func ShellSplit(s string) ([]string, error) {
+
+	args := []string{}
+	arg := strings.Builder{}
+	inArg := false
+
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+
+		switch {
+
+		case escaped:
+			// Within double quotes, a backslash only escapes what is special there
+			if quote == '"' && !strings.ContainsRune("\\\"$`", r) {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(r)
+			escaped = false
+
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+
+		case r == '\\':
+			escaped, inArg = true, true
+
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+
+		default:
+			arg.WriteRune(r)
+			inArg = true
+
+		}
+
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
+
+// Copy every regular file directly inside src into dst.
+func CopyDir(src string, dst string) error {
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+
+		// Skip directories and other non-regular files
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		if err := CopyFile(context.Background(), filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+}
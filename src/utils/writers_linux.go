@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Subset of paths currently opened for writing by any visible process.
+func OpenForWriting(paths []string) (map[string]bool, error) {
+
+	wanted := map[string]string{}
+	for _, p := range paths {
+		if abs, err := filepath.Abs(p); err == nil {
+			wanted[abs] = p
+		}
+	}
+
+	open := map[string]bool{}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	// For each process...
+	for _, proc := range procs {
+
+		if _, err := strconv.Atoi(proc.Name()); err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+
+		// Processes of other users are not readable; skip them.
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+
+		// For each file descriptor of process...
+		for _, fd := range fds {
+
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil {
+				continue
+			}
+
+			p, ok := wanted[target]
+			if !ok {
+				continue
+			}
+
+			if fdWritable(filepath.Join("/proc", proc.Name(), "fdinfo", fd.Name())) {
+				open[p] = true
+			}
+
+		}
+
+	}
+
+	return open, nil
+}
+
+// Whether file descriptor described by fdinfo file was opened with write access.
+func fdWritable(fdinfo string) bool {
+
+	buf, err := os.ReadFile(fdinfo)
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(buf), "\n") {
+
+		if !strings.HasPrefix(line, "flags:") {
+			continue
+		}
+
+		flags, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "flags:")), 8, 64)
+		if err != nil {
+			return false
+		}
+
+		return flags&uint64(os.O_WRONLY|os.O_RDWR) != 0
+	}
+
+	return false
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// Subset of paths currently opened for writing by another process.
+func OpenForWriting(paths []string) (map[string]bool, error) {
+
+	open := map[string]bool{}
+
+	for _, p := range paths {
+
+		name, err := windows.UTF16PtrFromString(p)
+		if err != nil {
+			return nil, err
+		}
+
+		// Refusing to share write access fails if a writer already holds the file
+		h, err := windows.CreateFile(name, windows.GENERIC_READ, windows.FILE_SHARE_READ, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+		if errors.Is(err, windows.ERROR_SHARING_VIOLATION) {
+			open[p] = true
+			continue
+		}
+
+		if err == nil {
+			windows.CloseHandle(h)
+		}
+
+	}
+
+	return open, nil
+}
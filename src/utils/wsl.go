@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Whether running under the Windows Subsystem for Linux, going by the kernel it boots.
+func IsWSL() bool {
+
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return false
+	}
+
+	lower := strings.ToLower(string(release))
+
+	return strings.Contains(lower, "microsoft") || strings.Contains(lower, "wsl")
+}
+
+var windowsPath = regexp.MustCompile(`^([A-Za-z]):([\\/].*)?$`)
+
+// WSL path of Windows path p, e.g. "/mnt/c/Videos" for "C:\Videos"; other paths are returned as they are.
+func FromWindowsPath(p string) string {
+
+	matches := windowsPath.FindStringSubmatch(p)
+	if matches == nil {
+		return p
+	}
+
+	return "/mnt/" + strings.ToLower(matches[1]) + strings.ReplaceAll(matches[2], `\`, "/")
+}
+
+var windowsMount = regexp.MustCompile(`^/mnt/[a-z](/|$)`)
+
+// Whether p lives on a Windows drive mounted into WSL, such as /mnt/c.
+func OnWindowsDrive(p string) bool {
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+
+	return windowsMount.MatchString(abs)
+}
@@ -0,0 +1,282 @@
+package youtube
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	deviceCodeURL = "https://oauth2.googleapis.com/device/code"
+	tokenURL      = "https://oauth2.googleapis.com/token"
+	uploadURL     = "https://www.googleapis.com/upload/youtube/v3/videos?uploadType=resumable&part=snippet,status,recordingDetails"
+	scope         = "https://www.googleapis.com/auth/youtube"
+)
+
+// OAuth token, persisted between runs so authorization happens only once.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// Response of the token endpoint, successful or not.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+}
+
+// Response of the device code endpoint.
+type deviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// Authorized YouTube Data API client.
+type Client struct {
+	ClientID     string
+	ClientSecret string
+	TokenPath    string // Where [Token] is cached.
+	token        Token
+	http         *http.Client
+}
+
+// Details of an uploaded video.
+type Video struct {
+	Title         string
+	Description   string
+	Privacy       string // One of "private", "unlisted" or "public".
+	RecordingDate time.Time
+}
+
+// Post form to endpoint and decode JSON response into dest.
+func postForm(endpoint string, form url.Values, dest any) error {
+
+	resp, err := http.PostForm(endpoint, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+// Create client, reusing a cached token or walking the user through the OAuth device flow.
+func Authorize(clientID string, clientSecret string, tokenPath string, prompt func(verificationURL string, userCode string)) (*Client, error) {
+
+	c := Client{ClientID: clientID, ClientSecret: clientSecret, TokenPath: tokenPath, http: &http.Client{}}
+
+	// Reuse cached token if there is one
+	if buf, err := os.ReadFile(tokenPath); err == nil {
+		if err := json.Unmarshal(buf, &c.token); err != nil {
+			return nil, err
+		}
+		return &c, nil
+	}
+
+	// Request a code for the user to enter
+	device := deviceCodeResponse{}
+	if err := postForm(deviceCodeURL, url.Values{"client_id": {clientID}, "scope": {scope}}, &device); err != nil {
+		return nil, err
+	}
+
+	if device.DeviceCode == "" {
+		return nil, errors.New("no device code returned, check client ID")
+	}
+
+	prompt(device.VerificationURL, device.UserCode)
+
+	interval := time.Duration(device.Interval) * time.Second
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+
+	// Poll until user has granted access
+	for time.Now().Before(deadline) {
+
+		time.Sleep(interval)
+
+		resp := tokenResponse{}
+		form := url.Values{
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+			"device_code":   {device.DeviceCode},
+			"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+		}
+
+		if err := postForm(tokenURL, form, &resp); err != nil {
+			return nil, err
+		}
+
+		switch resp.Error {
+		case "":
+			c.setToken(resp)
+			return &c, c.saveToken()
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+		default:
+			return nil, fmt.Errorf("authorization failed: %s", resp.Error)
+		}
+
+	}
+
+	return nil, errors.New("authorization expired before access was granted")
+}
+
+// Store token from response, keeping the old refresh token if none was returned.
+func (c *Client) setToken(resp tokenResponse) {
+
+	c.token.AccessToken = resp.AccessToken
+	c.token.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+
+	if resp.RefreshToken != "" {
+		c.token.RefreshToken = resp.RefreshToken
+	}
+
+}
+
+// Persist token to [Client.TokenPath].
+func (c *Client) saveToken() error {
+
+	buf, err := json.Marshal(c.token)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.TokenPath), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.TokenPath, buf, 0o600)
+}
+
+// Access token, refreshed first if about to expire.
+func (c *Client) accessToken() (string, error) {
+
+	if time.Until(c.token.Expiry) > time.Minute {
+		return c.token.AccessToken, nil
+	}
+
+	resp := tokenResponse{}
+	form := url.Values{
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"refresh_token": {c.token.RefreshToken},
+		"grant_type":    {"refresh_token"},
+	}
+
+	if err := postForm(tokenURL, form, &resp); err != nil {
+		return "", err
+	}
+
+	if resp.Error != "" {
+		return "", fmt.Errorf("refreshing token: %s", resp.Error)
+	}
+
+	c.setToken(resp)
+
+	return c.token.AccessToken, c.saveToken()
+}
+
+// Upload video file at path, returning its YouTube video ID.
+func (c *Client) Upload(path string, v Video) (string, error) {
+
+	token, err := c.accessToken()
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	meta := map[string]any{
+		"snippet": map[string]any{"title": v.Title, "description": v.Description},
+		"status":  map[string]any{"privacyStatus": v.Privacy},
+	}
+
+	if !v.RecordingDate.IsZero() {
+		meta["recordingDetails"] = map[string]any{"recordingDate": v.RecordingDate.Format(time.RFC3339)}
+	}
+
+	metaBuf, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+
+	// Start resumable upload session
+	req, err := http.NewRequest(http.MethodPost, uploadURL, bytes.NewReader(metaBuf))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(info.Size(), 10))
+	req.Header.Set("X-Upload-Content-Type", "video/*")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("starting upload: %s", resp.Status)
+	}
+
+	session := resp.Header.Get("Location")
+
+	// Send video contents to session
+	req, err = http.NewRequest(http.MethodPut, session, f)
+	if err != nil {
+		return "", err
+	}
+
+	req.ContentLength = info.Size()
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "video/*")
+
+	resp, err = c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("uploading: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	uploaded := struct {
+		Id string `json:"id"`
+	}{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&uploaded); err != nil {
+		return "", err
+	}
+
+	return uploaded.Id, nil
+}